@@ -1,52 +1,244 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-)
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-const (
-	DefaultPort = 8080
-	Version     = "0.1.0"
+	"github.com/requestbite/proxy-go/slingshot"
 )
 
+// DefaultPort is the port the proxy listens on unless -port is given
+const DefaultPort = 8080
+
 func main() {
+	// Run a collection or workflow, or tail a running proxy, instead of serving
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(slingshot.RunCommand(os.Args[2:]))
+		case "workflow":
+			os.Exit(slingshot.WorkflowCommand(os.Args[2:]))
+		case "tail":
+			os.Exit(slingshot.TailCommand(os.Args[2:]))
+		}
+	}
+
 	// Command line flags
 	var (
 		port        = flag.Int("port", DefaultPort, "Port to listen on")
+		socketPath  = flag.String("socket", "", "Unix socket to also serve the API on, for local tools such as tail")
+		grpcPort    = flag.Int("grpc-port", 0, "Port to also serve the API on over gRPC, as defined by GET /slingshot.proto (0: disabled)")
 		showVersion = flag.Bool("version", false, "Show version information")
 		showHelp    = flag.Bool("help", false, "Show help information")
+		serveStale  = flag.Bool("serve-stale", false, "Serve cached responses when the upstream is unreachable")
+		netProfile  = flag.String("network-profile", "", "Simulate a network on every request (e.g. 3g, flaky-wifi)")
+		maxInFlight = flag.Int("max-concurrent", 0, "Most requests sent at once; others wait their turn by priority (0: unlimited)")
+		queueWait   = flag.Duration("queue-timeout", slingshot.DefaultQueueTimeout, "How long requests wait for a slot when -max-concurrent is reached")
+		uploadDirs  = flag.String("upload-dirs", "", "Comma-separated directories files may be uploaded from")
+		artifactDir = flag.String("artifacts-dir", slingshot.DefaultArtifactsDir(), "Directory to store response body artifacts in")
+		artifactMin = flag.Int64("artifact-threshold", 0, "Store response bodies larger than this many bytes as artifacts (0: only on request)")
+		artifactTTL = flag.Duration("artifact-retention", slingshot.DefaultArtifactRetention, "How long to keep artifacts after they were last stored")
+		artifactS3  = flag.String("artifact-s3", "", "S3-compatible bucket to upload large artifacts to (e.g. s3://bucket/prefix?region=eu-west-1)")
+		artifactBig = flag.Int64("artifact-s3-threshold", 0, "Upload artifacts larger than this many bytes to -artifact-s3 (0: all)")
+		artifactExp = flag.Duration("artifact-url-expiry", slingshot.DefaultArtifactURLExpiry, "How long presigned artifact URLs are valid (at most 168h)")
+		storageURL  = flag.String("storage", "", "Where to keep the history, artifact metadata and session holders: sqlite:///path/history.db, postgres://..., redis://host:6379/0 or memory (default: "+slingshot.DefaultStorage()+", or the -cluster Redis)")
+		clusterURL  = flag.String("cluster", "", "Redis URL shared by proxies behind a load balancer (e.g. redis://:password@redis:6379/0)")
+		advertise   = flag.String("cluster-advertise", "", "URL the other proxies of the cluster reach this one at (e.g. http://10.0.0.5:8080)")
+		callbackKey = flag.String("callback-secret", "", "Secret signing the callbacks of background jobs that bring none")
+		publishURLs = flag.String("publish", "", "Comma-separated kafka://, nats:// and amqp:// URLs to publish a record of each completed request to")
+		geoIPFiles  = flag.String("geoip", "", "Comma-separated MaxMind DB files (e.g. GeoLite2-Country.mmdb,GeoLite2-ASN.mmdb) to locate target addresses with")
+		scrub       = flag.String("scrub", "", "Comma-separated built-in rules scrubbing stored traffic (email, jwt, bearer, secret-params, card)")
+		scrubRules  = flag.String("scrub-rules", "", "JSON file of rules scrubbing stored traffic")
+		scriptDirs  = flag.String("script-dirs", "", "Comma-separated directories scripts may be loaded from")
+		protoDirs   = flag.String("proto-dirs", "", "Comma-separated directories of .proto files for protobuf bodies")
+		passthrough = flag.String("passthrough-headers", "", "Comma-separated caller headers to forward to the target (e.g. Authorization,X-*)")
+		requestID   = flag.String("request-id-header", "", "Header used to forward each request's correlation ID to the target (e.g. X-Request-Id)")
+		requireKey  = flag.Bool("require-api-key", false, "Require an API key issued through the admin API on proxy endpoints")
+		apiKeysFile = flag.String("api-keys-file", "", "File to keep API keys in across restarts")
+		adminToken  = flag.String("admin-token", "", "Bearer token enabling the admin API")
+		drainWait   = flag.Duration("drain-timeout", slingshot.DefaultDrainTimeout, "How long shutting down waits for requests in flight")
+		transforms  = flag.String("transforms-file", "", "JSON file of header, URL and body transforms applied to matching hosts")
+		profiles    = flag.String("header-profiles", "", "JSON file of headers attached to requests to matching hosts")
+		pluginsFile = flag.String("plugins-file", "", "JSON file of plugins called before and after each request")
+		canaryURL   = flag.String("ready-canary", "", "URL readiness checks fetch to confirm outbound connectivity")
+		tunnelURL   = flag.String("tunnel", "", "Public relay URL to expose the webhook buckets through")
+		tunnelRelay = flag.Bool("tunnel-relay", false, "Act as a public relay for tunnel clients")
+		tunnelToken = flag.String("tunnel-token", "", "Shared secret between tunnel client and relay")
+		schedules   = flag.String("schedules-file", "", "File to keep scheduled requests in across restarts")
+		monitors    = flag.String("monitors-file", "", "File to keep monitors in across restarts")
+		notifyHook  = flag.String("notify-webhook", "", "URL to POST monitor and schedule notifications to")
+		notifySlack = flag.String("notify-slack", "", "Slack incoming webhook URL for notifications")
+		notifyEmail = flag.String("notify-email", "", "Comma-separated addresses to email notifications to")
+		notifyAfter = flag.Int("notify-after", slingshot.DefaultNotifyAfter, "Consecutive failed runs of a scheduled request before notifying")
+		smtpAddr    = flag.String("smtp-addr", "", "SMTP server (host:port) for email notifications")
+		smtpUser    = flag.String("smtp-username", "", "SMTP username")
+		smtpPass    = flag.String("smtp-password", "", "SMTP password")
+		smtpFrom    = flag.String("smtp-from", "", "Sender address for email notifications")
 	)
 	flag.Parse()
 
 	// Show version
 	if *showVersion {
-		fmt.Printf("RequestBite Slingshot Proxy (Go) v%s\n", Version)
+		fmt.Printf("RequestBite Slingshot Proxy (Go) %s\n", slingshot.CurrentBuild())
 		os.Exit(0)
 	}
 
 	// Show help
 	if *showHelp {
-		fmt.Printf("RequestBite Slingshot Proxy (Go) v%s\n\n", Version)
+		fmt.Printf("RequestBite Slingshot Proxy (Go) v%s\n\n", slingshot.Version)
 		fmt.Println("Usage:")
-		fmt.Printf("  %s [options]\n\n", os.Args[0])
+		fmt.Printf("  %s [options]\n", os.Args[0])
+		fmt.Printf("  %s run [options] <collection.json>\n", os.Args[0])
+		fmt.Printf("  %s workflow [options] <workflow.yaml>\n", os.Args[0])
+		fmt.Printf("  %s tail [options]\n\n", os.Args[0])
 		fmt.Println("Options:")
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
 
 	// Start the proxy server
-	server, err := NewProxyServer(*port)
+	config := &slingshot.Config{
+		Port:       *port,
+		Socket:     *socketPath,
+		GRPCPort:   *grpcPort,
+		ServeStale: *serveStale,
+		UploadDirs: slingshot.SplitList(*uploadDirs),
+		ScriptDirs: slingshot.SplitList(*scriptDirs),
+		ProtoDirs:  slingshot.SplitList(*protoDirs),
+
+		NetworkProfile: strings.ToLower(strings.TrimSpace(*netProfile)),
+
+		MaxConcurrent: *maxInFlight,
+		QueueTimeout:  *queueWait,
+
+		ArtifactsDir:      *artifactDir,
+		ArtifactThreshold: *artifactMin,
+		ArtifactRetention: *artifactTTL,
+
+		ArtifactS3:          *artifactS3,
+		ArtifactS3Threshold: *artifactBig,
+		ArtifactURLExpiry:   *artifactExp,
+
+		Storage: *storageURL,
+
+		ClusterURL:       *clusterURL,
+		ClusterAdvertise: *advertise,
+
+		CallbackSecret: *callbackKey,
+
+		Publish: slingshot.SplitList(*publishURLs),
+
+		GeoIP: slingshot.SplitList(*geoIPFiles),
+
+		Scrub:          slingshot.SplitList(*scrub),
+		ScrubRulesFile: *scrubRules,
+
+		PassthroughHeaders: slingshot.HeaderAllowlist(slingshot.SplitList(*passthrough)),
+		RequestIDHeader:    strings.TrimSpace(*requestID),
+
+		RequireAPIKey: *requireKey,
+		APIKeysFile:   *apiKeysFile,
+		AdminToken:    *adminToken,
+
+		TransformsFile:     *transforms,
+		HeaderProfilesFile: *profiles,
+		PluginsFile:        *pluginsFile,
+
+		CanaryURL:    *canaryURL,
+		DrainTimeout: *drainWait,
+
+		TunnelURL:   *tunnelURL,
+		TunnelRelay: *tunnelRelay,
+		TunnelToken: *tunnelToken,
+
+		SchedulesFile: *schedules,
+		MonitorsFile:  *monitors,
+
+		NotifyWebhook: *notifyHook,
+		NotifySlack:   *notifySlack,
+		NotifyEmail:   slingshot.SplitList(*notifyEmail),
+		SMTPAddr:      *smtpAddr,
+		SMTPUsername:  *smtpUser,
+		SMTPPassword:  *smtpPass,
+		SMTPFrom:      *smtpFrom,
+		NotifyAfter:   *notifyAfter,
+	}
+
+	if (config.TunnelURL != "" || config.TunnelRelay) && config.TunnelToken == "" {
+		log.Fatalf("-tunnel and -tunnel-relay require -tunnel-token")
+	}
+	if config.ClusterURL != "" && config.ClusterAdvertise == "" {
+		log.Fatalf("-cluster requires -cluster-advertise")
+	}
+	if config.RequireAPIKey && config.AdminToken == "" && config.APIKeysFile == "" {
+		log.Fatalf("-require-api-key needs -admin-token to issue keys or -api-keys-file holding them")
+	}
+	if len(config.NotifyEmail) > 0 && (config.SMTPAddr == "" || config.SMTPFrom == "") {
+		log.Fatalf("-notify-email requires -smtp-addr and -smtp-from")
+	}
+	if config.MaxConcurrent < 0 {
+		log.Fatalf("-max-concurrent cannot be negative")
+	}
+	if config.ArtifactThreshold < 0 {
+		log.Fatalf("-artifact-threshold cannot be negative")
+	}
+	if config.ArtifactS3Threshold < 0 {
+		log.Fatalf("-artifact-s3-threshold cannot be negative")
+	}
+	if _, err := slingshot.LookupNetworkProfile(config.NetworkProfile); err != nil {
+		log.Fatalf("-network-profile: %v", err)
+	}
+	if config.NotifyAfter < 1 {
+		log.Fatalf("-notify-after must be at least 1")
+	}
+
+	server, err := slingshot.NewProxyServer(config)
 	if err != nil {
 		log.Fatalf("Failed to create proxy server: %v", err)
 	}
 
 	fmt.Printf("RequestBite Slingshot Proxy listening on port %d\n", *port)
+	if config.Socket != "" {
+		fmt.Printf("Serving local tools on %s\n", config.Socket)
+	}
+	if config.GRPCPort != 0 {
+		fmt.Printf("Serving the gRPC API on port %d\n", config.GRPCPort)
+	}
 	fmt.Println("Press Ctrl+C to stop")
 
-	if err := server.Start(); err != nil {
+	stopped := make(chan struct{})
+	go drainOnSignal(server, config.DrainTimeout, stopped)
+
+	if err := server.Start(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed: %v", err)
 	}
-}
\ No newline at end of file
+	<-stopped
+}
+
+// drainOnSignal drains and stops the server on SIGTERM or SIGINT, closing
+// stopped once done. A second signal exits immediately.
+func drainOnSignal(server *slingshot.ProxyServer, timeout time.Duration, stopped chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	sig := <-signals
+	signal.Stop(signals)
+
+	log.Printf("Received %s, draining for up to %s (signal again to exit now)", sig, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Drain(ctx); err != nil {
+		log.Printf("Stopping with %v", err)
+	}
+	if err := server.Stop(ctx); err != nil {
+		log.Printf("Failed to stop server: %v", err)
+	}
+	close(stopped)
+}
@@ -0,0 +1,406 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// errCancelledByAdmin is the cause of requests cancelled through the admin API
+var errCancelledByAdmin = errors.New("cancelled by an administrator")
+
+// ActiveRequest is a request the proxy is currently handling
+type ActiveRequest struct {
+	ID        string    `json:"id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Target    string    `json:"target,omitempty"` // Method and URL being proxied, once known
+	APIKey    string    `json:"api_key,omitempty"`
+	Remote    string    `json:"remote"`
+	StartedAt time.Time `json:"started_at"`
+	Duration  string    `json:"duration"`
+
+	cancel context.CancelCauseFunc
+}
+
+// ActiveRequests tracks the requests in flight so they can be listed and
+// cancelled
+type ActiveRequests struct {
+	mu       sync.Mutex
+	requests map[string]*ActiveRequest
+}
+
+// NewActiveRequests creates an empty tracker
+func NewActiveRequests() *ActiveRequests {
+	return &ActiveRequests{requests: make(map[string]*ActiveRequest)}
+}
+
+// add starts tracking a request
+func (a *ActiveRequests) add(request *ActiveRequest) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests[request.ID] = request
+}
+
+// remove stops tracking a request
+func (a *ActiveRequests) remove(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.requests, id)
+}
+
+// describe records what a request is proxying
+func (a *ActiveRequests) describe(id, method, url string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if request, ok := a.requests[id]; ok {
+		request.Target = method + " " + url
+	}
+}
+
+// Cancel cancels a request, returning a snapshot of it or nil if it is no
+// longer active
+func (a *ActiveRequests) Cancel(id string) *ActiveRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	request, ok := a.requests[id]
+	if !ok {
+		return nil
+	}
+	request.cancel(errCancelledByAdmin)
+	snapshot := *request
+	snapshot.Duration = formatMillis(time.Since(request.StartedAt))
+	return &snapshot
+}
+
+// List returns snapshots of the active requests, oldest first
+func (a *ActiveRequests) List() []*ActiveRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	requests := make([]*ActiveRequest, 0, len(a.requests))
+	for _, request := range a.requests {
+		snapshot := *request
+		snapshot.Duration = formatMillis(time.Since(request.StartedAt))
+		requests = append(requests, &snapshot)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].StartedAt.Before(requests[j].StartedAt)
+	})
+	return requests
+}
+
+// activeRequestMiddleware tracks each request and lets the admin API cancel
+// it through its context. Admin requests, health probes and live tails, which
+// stay open until the proxy stops, are not tracked.
+func (s *ProxyServer) activeRequestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "OPTIONS" || strings.HasPrefix(r.URL.Path, "/admin/") || strings.HasPrefix(r.URL.Path, "/health") || r.URL.Path == "/proxy/history/tail" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancelCause(r.Context())
+		defer cancel(nil)
+
+		request := &ActiveRequest{
+			ID:        requestID(w),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Remote:    r.RemoteAddr,
+			StartedAt: time.Now().UTC(),
+			cancel:    cancel,
+		}
+		if key := apiKeyFromContext(r.Context()); key != nil {
+			request.APIKey = key.Name
+		}
+		s.active.add(request)
+		defer s.active.remove(request.ID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// markAdminCancelled flags a failed response whose request was cancelled
+// through the admin API
+func markAdminCancelled(ctx context.Context, response *ProxyResponse) {
+	if response.Success || context.Cause(ctx) != errCancelledByAdmin {
+		return
+	}
+	response.Cancelled = true
+	response.ErrorMessage = "The request was cancelled by an administrator."
+}
+
+// ConnectionStats counts the connections the proxy's HTTP transport opened
+type ConnectionStats struct {
+	Open         int64 `json:"open"`
+	Opened       int64 `json:"opened"`
+	DialFailures int64 `json:"dial_failures"`
+}
+
+// connCounter keeps ConnectionStats for a dialer
+type connCounter struct {
+	open, opened, failed atomic.Int64
+}
+
+// dial wraps a dial function to count the connections it opens and closes
+func (c *connCounter) dial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			c.failed.Add(1)
+			return nil, err
+		}
+		c.open.Add(1)
+		c.opened.Add(1)
+		return &countedConn{Conn: conn, counter: c}, nil
+	}
+}
+
+// stats returns the current counts
+func (c *connCounter) stats() ConnectionStats {
+	return ConnectionStats{Open: c.open.Load(), Opened: c.opened.Load(), DialFailures: c.failed.Load()}
+}
+
+// countedConn decrements its counter's open connections once closed
+type countedConn struct {
+	net.Conn
+	counter   *connCounter
+	closeOnce sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(func() { c.counter.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// PoolStats describes the shared HTTP connection pool
+type PoolStats struct {
+	ConnectionStats
+	MaxIdleConns        int    `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int    `json:"max_idle_conns_per_host"`
+	IdleConnTimeout     string `json:"idle_conn_timeout"`
+}
+
+// RateLimitStatus is the state of one API key's rate limit
+type RateLimitStatus struct {
+	KeyID     string `json:"key_id"`
+	Name      string `json:"name"`
+	Limit     int    `json:"limit"` // Requests per minute
+	Remaining int    `json:"remaining"`
+	Limited   int64  `json:"rate_limited"`
+}
+
+// HistoryStats describes the history store
+type HistoryStats struct {
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"max_entries"`
+	BodyBytes  int64  `json:"body_bytes"`
+	BodySize   string `json:"body_size"`
+}
+
+// RuntimeStats describes the proxy process
+type RuntimeStats struct {
+	Version    string `json:"version"`
+	GoVersion  string `json:"go_version"`
+	Uptime     string `json:"uptime"`
+	StartedAt  string `json:"started_at"`
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  string `json:"heap_alloc"`
+	HeapSys    string `json:"heap_sys"`
+	NumGC      uint32 `json:"num_gc"`
+}
+
+// AdminStatsResponse is returned by GET /admin/stats
+type AdminStatsResponse struct {
+	Success        bool              `json:"success"`
+	Runtime        RuntimeStats      `json:"runtime"`
+	Pool           PoolStats         `json:"pool"`
+	ActiveRequests int               `json:"active_requests"`
+	Queue          QueueStats        `json:"queue"`
+	RateLimits     []RateLimitStatus `json:"rate_limits"`
+	History        HistoryStats      `json:"history"`
+	Publishers     []PublisherStats  `json:"publishers"`
+	Sessions       map[string]int    `json:"sessions"`
+}
+
+// AdminConfigResponse is returned by GET /admin/config
+type AdminConfigResponse struct {
+	Success bool    `json:"success"`
+	Config  *Config `json:"config"`
+}
+
+// AdminRequestsResponse is returned by the /admin/requests endpoints
+type AdminRequestsResponse struct {
+	Success  bool             `json:"success"`
+	Request  *ActiveRequest   `json:"request,omitempty"`
+	Requests []*ActiveRequest `json:"requests,omitempty"`
+}
+
+// redactedConfig copies the configuration with its secrets, including
+// webhook URLs, blanked out
+func redactedConfig(config *Config) *Config {
+	redacted := *config
+	for _, secret := range []*string{&redacted.AdminToken, &redacted.TunnelToken, &redacted.SMTPPassword, &redacted.NotifySlack, &redacted.NotifyWebhook, &redacted.CallbackSecret} {
+		if *secret != "" {
+			*secret = DefaultScrubReplacement
+		}
+	}
+	redacted.Storage = redactedURL(redacted.Storage)
+	redacted.ClusterURL = redactedURL(redacted.ClusterURL)
+	redacted.ArtifactS3 = redactedURL(redacted.ArtifactS3)
+	redacted.Publish = make([]string, len(config.Publish))
+	for i, publishURL := range config.Publish {
+		redacted.Publish[i] = redactedURL(publishURL)
+	}
+	return &redacted
+}
+
+// redactedURL hides the credentials of a storage URL
+func redactedURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.User == nil {
+		return value
+	}
+	// redis://secret@host has its password in the user name
+	parsed.User = url.User("xxxxx")
+	return parsed.String()
+}
+
+// handleAdminConfig returns the running configuration without its secrets
+func (s *ProxyServer) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&AdminConfigResponse{Success: true, Config: redactedConfig(s.config)}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleAdminStats returns runtime statistics
+func (s *ProxyServer) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	transport := s.httpClient.transport
+	entries, bodyBytes, err := s.history.Stats()
+	if err != nil {
+		s.logger.Printf("Failed to read history stats: %v", err)
+	}
+	response := &AdminStatsResponse{
+		Success: true,
+		Runtime: RuntimeStats{
+			Version:    Version,
+			GoVersion:  runtime.Version(),
+			Uptime:     time.Since(s.started).Round(time.Second).String(),
+			StartedAt:  s.started.UTC().Format(time.RFC3339),
+			Goroutines: runtime.NumGoroutine(),
+			HeapAlloc:  formatSize(int64(mem.HeapAlloc)),
+			HeapSys:    formatSize(int64(mem.HeapSys)),
+			NumGC:      mem.NumGC,
+		},
+		Pool: PoolStats{
+			ConnectionStats:     s.httpClient.conns.stats(),
+			MaxIdleConns:        transport.MaxIdleConns,
+			MaxIdleConnsPerHost: transport.MaxIdleConnsPerHost,
+			IdleConnTimeout:     transport.IdleConnTimeout.String(),
+		},
+		ActiveRequests: len(s.active.List()),
+		Queue:          s.httpClient.queue.Stats(),
+		RateLimits:     s.apiKeys.RateLimits(),
+		History: HistoryStats{
+			Entries:    entries,
+			MaxEntries: MaxHistoryEntries,
+			BodyBytes:  bodyBytes,
+			BodySize:   formatSize(bodyBytes),
+		},
+		Publishers: s.history.publishers.Stats(),
+		Sessions: map[string]int{
+			"websocket": len(s.sockets.List()),
+			"sse":       len(s.eventSources.List()),
+			"downloads": len(s.downloads.List()),
+			"schedules": len(s.scheduler.List()),
+			"monitors":  len(s.monitors.List()),
+		},
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleAdminRequests lists the requests in flight
+func (s *ProxyServer) handleAdminRequests(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&AdminRequestsResponse{Success: true, Requests: s.active.List()}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleAdminRequest cancels (DELETE) a request in flight
+func (s *ProxyServer) handleAdminRequest(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	request := s.active.Cancel(id)
+	if request == nil {
+		s.writeErrorResponse(w, "not_found", "Request Not Found", fmt.Sprintf("No active request with id %s", id))
+		return
+	}
+	s.logger.Printf("[%s] Cancelled by an administrator", id)
+
+	if err := json.NewEncoder(w).Encode(&AdminRequestsResponse{Success: true, Request: request}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
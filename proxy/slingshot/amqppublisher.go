@@ -0,0 +1,120 @@
+package slingshot
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpPublisher publishes records to an AMQP 0-9-1 exchange, such as one on
+// RabbitMQ. Records are sent as persistent messages, each waiting for the
+// broker to confirm it.
+type amqpPublisher struct {
+	url        string
+	exchange   string
+	routingKey string
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	closed  chan *amqp.Error // Why the broker closed the channel
+}
+
+// newAMQPPublisher sets up publishing to
+// amqp[s]://user:pass@host[:port]/vhost?exchange=name&routing_key=key
+func newAMQPPublisher(parsed *url.URL) (*amqpPublisher, error) {
+	a := &amqpPublisher{
+		url:        parsed.String(),
+		exchange:   parsed.Query().Get("exchange"),
+		routingKey: parsed.Query().Get("routing_key"),
+	}
+	if a.exchange == "" && a.routingKey == "" {
+		return nil, fmt.Errorf("AMQP URL %s needs an exchange or a routing_key naming a queue", redactedURL(parsed.String()))
+	}
+	if len(a.exchange) > 255 || len(a.routingKey) > 255 {
+		return nil, fmt.Errorf("AMQP exchange and routing key names are at most 255 bytes")
+	}
+	if _, err := amqp.ParseURI(a.url); err != nil {
+		return nil, fmt.Errorf("Invalid AMQP URL %s: %v", redactedURL(parsed.String()), err)
+	}
+	return a, nil
+}
+
+// connect dials the broker, logs in and opens a channel in confirm mode. The
+// client reads TLS and authentication options from the URL.
+func (a *amqpPublisher) connect() error {
+	conn, err := amqp.DialConfig(a.url, amqp.Config{
+		Dial:       amqp.DefaultDial(publishTimeout),
+		Properties: amqp.Table{"product": "slingshot", "version": Version},
+	})
+	if err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err == nil {
+		err = channel.Confirm(false)
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	a.conn, a.channel = conn, channel
+	a.closed = channel.NotifyClose(make(chan *amqp.Error, 1))
+	return nil
+}
+
+func (a *amqpPublisher) Publish(key string, record []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.conn == nil || a.conn.IsClosed() {
+		if err := a.connect(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	confirmation, err := a.channel.PublishWithDeferredConfirmWithContext(ctx, a.exchange, a.routingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    key,
+		Body:         record,
+	})
+	if err == nil {
+		var acked bool
+		acked, err = confirmation.WaitContext(ctx)
+		if err == nil && !acked {
+			// A missing exchange closes the channel instead of confirming
+			err = fmt.Errorf("AMQP: the broker rejected the message")
+			select {
+			case reason := <-a.closed:
+				if reason != nil {
+					err = reason
+				}
+			default:
+			}
+		}
+	}
+	if err != nil {
+		a.conn.Close()
+		a.conn = nil
+	}
+	return err
+}
+
+func (a *amqpPublisher) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.conn == nil {
+		return nil
+	}
+	err := a.conn.Close()
+	a.conn = nil
+	return err
+}
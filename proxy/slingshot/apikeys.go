@@ -0,0 +1,642 @@
+package slingshot
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// APIKeyHeader carries the caller's API key. It is never forwarded to
+	// targets, even when it matches the passthrough allowlist.
+	APIKeyHeader = "X-Slingshot-Key"
+
+	// apiKeyQueryParam carries the API key for clients that cannot set
+	// headers, such as browser EventSource feeds
+	apiKeyQueryParam = "slingshot_key"
+
+	// apiKeyPrefix starts every issued key so leaked keys are easy to spot
+	apiKeyPrefix = "ssk_"
+)
+
+// APIKey lets one caller use the proxy, limited to a request rate and a set
+// of target hosts. Only the SHA-256 of the key is kept; the key itself is
+// returned once, when it is created.
+type APIKey struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	Key          string      `json:"key,omitempty"`
+	Hash         string      `json:"hash,omitempty"`
+	Hint         string      `json:"hint"`                    // Start of the key, to tell keys apart
+	RateLimit    int         `json:"rate_limit,omitempty"`    // Requests per minute; 0 is unlimited
+	AllowedHosts []string    `json:"allowed_hosts,omitempty"` // Empty allows every host
+	CreatedAt    time.Time   `json:"created_at"`
+	Usage        APIKeyUsage `json:"usage"`
+
+	// Token bucket for the rate limit
+	tokens   float64
+	refilled time.Time
+}
+
+// APIKeyUsage counts the requests made with a key through this proxy since
+// it started
+type APIKeyUsage struct {
+	Requests    int64      `json:"requests"`
+	RateLimited int64      `json:"rate_limited"`
+	LastUsed    *time.Time `json:"last_used,omitempty"`
+}
+
+// CreateAPIKeyRequest is the body of POST /admin/keys
+type CreateAPIKeyRequest struct {
+	Name         string   `json:"name"`
+	RateLimit    int      `json:"rateLimit,omitempty"`
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+}
+
+// APIKeyResponse is returned by the /admin/keys endpoints
+type APIKeyResponse struct {
+	Success bool      `json:"success"`
+	Key     *APIKey   `json:"key,omitempty"`
+	Keys    []*APIKey `json:"keys,omitempty"`
+}
+
+// allowsHost reports whether the key may send requests to host
+func (k *APIKey) allowsHost(host string) bool {
+	if k == nil || len(k.AllowedHosts) == 0 {
+		return true
+	}
+	return HostPatterns(k.AllowedHosts).Matches(host)
+}
+
+// APIKeyStore holds the issued API keys
+type APIKeyStore struct {
+	mu     sync.Mutex
+	keys   map[string]*APIKey // By ID
+	hashes map[string]*APIKey // By key hash
+	file   string
+	logger *log.Logger
+
+	// cluster, when set, keeps the keys and their revocations in Redis for
+	// every proxy sharing it, which count rate limits together
+	cluster *Cluster
+}
+
+// NewAPIKeyStore creates a store that, when file is set, keeps the keys in
+// that file across restarts
+func NewAPIKeyStore(file string, logger *log.Logger) *APIKeyStore {
+	return &APIKeyStore{
+		keys:   make(map[string]*APIKey),
+		hashes: make(map[string]*APIKey),
+		file:   file,
+		logger: logger,
+	}
+}
+
+// Start loads stored keys. In a cluster, they join the shared keys unless
+// revoked meanwhile, and the store takes every shared key.
+func (s *APIKeyStore) Start() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.cluster == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	loaded := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		loaded = append(loaded, key)
+	}
+	s.mu.Unlock()
+	for _, key := range loaded {
+		if err := s.cluster.importAPIKey(key); err != nil {
+			return fmt.Errorf("Failed to share API key %s with the cluster: %v", key.ID, err)
+		}
+	}
+	if err := s.sync(); err != nil {
+		return fmt.Errorf("Failed to read API keys from the cluster: %v", err)
+	}
+	s.save()
+	return nil
+}
+
+// load reads the keys stored in the store's file, if it is set and exists
+func (s *APIKeyStore) load() error {
+	if s.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read API keys: %v", err)
+	}
+
+	var keys []*APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("Failed to parse %s: %v", s.file, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		key.Usage = APIKeyUsage{}
+		s.keys[key.ID] = key
+		s.hashes[key.Hash] = key
+	}
+	return nil
+}
+
+// Create issues a new key. The returned copy is the only one holding the
+// key itself.
+func (s *APIKeyStore) Create(req *CreateAPIKeyRequest) (*APIKey, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if req.RateLimit < 0 {
+		return nil, fmt.Errorf("rateLimit cannot be negative")
+	}
+	for _, host := range req.AllowedHosts {
+		if host == "" || strings.ContainsAny(host, "/:") {
+			return nil, fmt.Errorf("invalid allowed host %q; use a host name such as api.example.com or *.example.com", host)
+		}
+	}
+
+	var secret [24]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return nil, fmt.Errorf("Failed to generate key: %v", err)
+	}
+	plain := apiKeyPrefix + hex.EncodeToString(secret[:])
+
+	key := &APIKey{
+		ID:           newRequestID(),
+		Name:         strings.TrimSpace(req.Name),
+		Hash:         hashAPIKey(plain),
+		Hint:         plain[:len(apiKeyPrefix)+6],
+		RateLimit:    req.RateLimit,
+		AllowedHosts: req.AllowedHosts,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if s.cluster != nil {
+		if err := s.cluster.putAPIKey(key); err != nil {
+			return nil, fmt.Errorf("Failed to share key with the cluster: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.keys[key.ID] = key
+	s.hashes[key.Hash] = key
+	s.mu.Unlock()
+	s.save()
+
+	created := snapshotAPIKey(key)
+	created.Key = plain
+	return created, nil
+}
+
+// Revoke deletes a key, reporting whether it existed. In a cluster, every
+// proxy stops accepting it at once.
+func (s *APIKeyStore) Revoke(id string) (bool, error) {
+	shared := false
+	if s.cluster != nil {
+		var err error
+		if shared, err = s.cluster.revokeAPIKey(id); err != nil {
+			return false, fmt.Errorf("Failed to revoke key in the cluster: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	key, ok := s.keys[id]
+	if ok {
+		delete(s.keys, id)
+		delete(s.hashes, key.Hash)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		s.save()
+	}
+	return ok || shared, nil
+}
+
+// Get returns a snapshot of a key, or nil if there is none
+func (s *APIKeyStore) Get(id string) *APIKey {
+	s.refresh()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil
+	}
+	return snapshotAPIKey(key)
+}
+
+// List returns snapshots of all keys, oldest first
+func (s *APIKeyStore) List() []*APIKey {
+	s.refresh()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, snapshotAPIKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Use authenticates a key and counts a request against its rate limit. It
+// returns the key, or nil when the key is unknown, and how long to wait
+// before retrying when the rate limit is exhausted.
+func (s *APIKeyStore) Use(plain string) (*APIKey, time.Duration) {
+	hash := hashAPIKey(plain)
+	var shared *APIKey
+	var err error
+	if s.cluster != nil {
+		// Keys created or revoked through other proxies count at once
+		if shared, err = s.cluster.lookupAPIKey(hash); err != nil {
+			s.logger.Printf("Failed to look up API key in the cluster: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.hashes[hash]
+	if s.cluster != nil && err == nil {
+		if shared == nil {
+			if ok {
+				delete(s.keys, key.ID)
+				delete(s.hashes, hash)
+			}
+			return nil, 0
+		}
+		key, ok = s.add(shared), true
+	}
+	if !ok {
+		return nil, 0
+	}
+
+	now := time.Now()
+	if key.RateLimit > 0 && s.cluster != nil {
+		// Other proxies count against the same limit
+		s.mu.Unlock()
+		wait, err := s.cluster.take(key.ID, key.RateLimit)
+		s.mu.Lock()
+		if err != nil {
+			s.logger.Printf("Failed to count rate limit of key %s in the cluster: %v", key.ID, err)
+		}
+		if wait > 0 {
+			key.Usage.RateLimited++
+			return snapshotAPIKey(key), wait
+		}
+	} else if key.RateLimit > 0 {
+		// Refill at RateLimit tokens per minute, up to a minute's worth
+		limit := float64(key.RateLimit)
+		if key.refilled.IsZero() {
+			key.tokens = limit
+		} else {
+			key.tokens = math.Min(limit, key.tokens+now.Sub(key.refilled).Minutes()*limit)
+		}
+		key.refilled = now
+
+		if key.tokens < 1 {
+			key.Usage.RateLimited++
+			return snapshotAPIKey(key), time.Duration((1 - key.tokens) / limit * float64(time.Minute))
+		}
+		key.tokens--
+	}
+
+	key.Usage.Requests++
+	used := now.UTC()
+	key.Usage.LastUsed = &used
+	return snapshotAPIKey(key), 0
+}
+
+// RateLimits returns the state of the rate limit of every limited key
+func (s *APIKeyStore) RateLimits() []RateLimitStatus {
+	s.refresh()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	limits := []RateLimitStatus{}
+	for _, key := range s.keys {
+		if key.RateLimit == 0 {
+			continue
+		}
+		limit := float64(key.RateLimit)
+		tokens := limit
+		if s.cluster != nil {
+			remaining, err := s.cluster.remaining(key.ID, key.RateLimit)
+			if err != nil {
+				s.logger.Printf("Failed to read rate limit of key %s in the cluster: %v", key.ID, err)
+			} else {
+				tokens = float64(remaining)
+			}
+		} else if !key.refilled.IsZero() {
+			tokens = math.Min(limit, key.tokens+now.Sub(key.refilled).Minutes()*limit)
+		}
+		limits = append(limits, RateLimitStatus{
+			KeyID:     key.ID,
+			Name:      key.Name,
+			Limit:     key.RateLimit,
+			Remaining: int(tokens),
+			Limited:   key.Usage.RateLimited,
+		})
+	}
+	sort.Slice(limits, func(i, j int) bool { return limits[i].Name < limits[j].Name })
+	return limits
+}
+
+// sync makes the store's keys the cluster's, keeping the usage this proxy
+// counted
+func (s *APIKeyStore) sync() error {
+	if s.cluster == nil {
+		return nil
+	}
+	shared, err := s.cluster.apiKeys()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := make(map[string]bool, len(shared))
+	for _, key := range shared {
+		s.add(key)
+		kept[key.ID] = true
+	}
+	for id, key := range s.keys {
+		if !kept[id] {
+			delete(s.keys, id)
+			delete(s.hashes, key.Hash)
+		}
+	}
+	return nil
+}
+
+// refresh syncs the store with the cluster, keeping the keys it has when
+// the cluster cannot be reached
+func (s *APIKeyStore) refresh() {
+	if err := s.sync(); err != nil {
+		s.logger.Printf("Failed to read API keys from the cluster: %v", err)
+	}
+}
+
+// add keeps a shared key unless the store has it already, and returns the
+// store's copy. Callers hold s.mu.
+func (s *APIKeyStore) add(shared *APIKey) *APIKey {
+	if key, ok := s.keys[shared.ID]; ok {
+		return key
+	}
+	s.keys[shared.ID] = shared
+	s.hashes[shared.Hash] = shared
+	return shared
+}
+
+// snapshotAPIKey copies a key without its hash
+func snapshotAPIKey(key *APIKey) *APIKey {
+	snapshot := *key
+	snapshot.Hash = ""
+	snapshot.AllowedHosts = append([]string(nil), key.AllowedHosts...)
+	return &snapshot
+}
+
+// save writes the keys, with their hashes, to the store's file
+func (s *APIKeyStore) save() {
+	if s.file == "" {
+		return
+	}
+
+	s.mu.Lock()
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		stored := *key
+		stored.Usage = APIKeyUsage{}
+		keys = append(keys, &stored)
+	}
+	s.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		s.logger.Printf("Failed to encode API keys: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.file, data, 0600); err != nil {
+		s.logger.Printf("Failed to save API keys: %v", err)
+	}
+}
+
+// hashAPIKey returns the hex SHA-256 a key is stored as
+func hashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyContextKey stores the caller's API key in a request context
+type apiKeyContextKey struct{}
+
+// apiKeyFromContext returns the API key a request was made with, or nil
+func apiKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// checkTargetURL returns an error if the caller's API key may not send
+// requests to the host of rawURL
+func checkTargetURL(ctx context.Context, rawURL string) error {
+	key := apiKeyFromContext(ctx)
+	if key == nil {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil // Reported by URL validation
+	}
+	return checkTargetHost(ctx, parsed.Hostname())
+}
+
+// checkTargetHost returns an error if the caller's API key may not connect
+// to host, which may include a port
+func checkTargetHost(ctx context.Context, host string) error {
+	key := apiKeyFromContext(ctx)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if !key.allowsHost(host) {
+		return fmt.Errorf("API key %q may not send requests to %s", key.Name, host)
+	}
+	return nil
+}
+
+// apiKeyExempt reports whether a path is reachable without an API key:
+// health checks, the API descriptions and Swagger UI, the dashboard's files,
+// which send the key on their own calls, public webhook capture, tunnel
+// connections and the admin API, which has its own token
+func apiKeyExempt(path string) bool {
+	return path == "/health" || strings.HasPrefix(path, "/health/") || path == "/version" ||
+		path == "/openapi.json" || path == "/docs" || strings.HasPrefix(path, "/docs/") ||
+		path == "/slingshot.proto" ||
+		path == "/ui" || strings.HasPrefix(path, "/ui/") ||
+		strings.HasPrefix(path, "/hooks/") ||
+		strings.HasPrefix(path, "/tunnel/") ||
+		strings.HasPrefix(path, "/admin/")
+}
+
+// apiKeyMiddleware requires a valid API key on every other endpoint when
+// -require-api-key is set, enforcing the key's rate limit
+func (s *ProxyServer) apiKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.config.RequireAPIKey || r.Method == "OPTIONS" || apiKeyExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, failure, retryAfter := s.checkAPIKey(r)
+		if failure != nil {
+			if retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			s.writeErrorResponse(w, failure.Type, failure.Title, failure.Message)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	})
+}
+
+// checkAPIKey finds the API key a request sends and counts the request
+// against its rate limit. Otherwise it returns the error to reject the request
+// with, and the seconds to retry in when the key is rate limited.
+func (s *ProxyServer) checkAPIKey(r *http.Request) (*APIKey, *ProxyError, int) {
+	plain := r.Header.Get(APIKeyHeader)
+	if plain == "" {
+		plain = r.URL.Query().Get(apiKeyQueryParam)
+	}
+	if plain == "" {
+		return nil, &ProxyError{UnauthorizedError.Type, UnauthorizedError.Title, fmt.Sprintf("An API key is required in the %s header", APIKeyHeader)}, 0
+	}
+
+	key, retryAfter := s.apiKeys.Use(plain)
+	if key == nil {
+		return nil, &ProxyError{UnauthorizedError.Type, UnauthorizedError.Title, "Unknown or revoked API key"}, 0
+	}
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		return key, &ProxyError{RateLimitedError.Type, RateLimitedError.Title,
+			fmt.Sprintf("API key %q is limited to %d requests per minute; retry in %d seconds", key.Name, key.RateLimit, seconds)}, seconds
+	}
+	return key, nil, 0
+}
+
+// authorizeAdmin checks the admin token sent as a bearer token, writing an
+// error response and returning false when it is missing or wrong
+func (s *ProxyServer) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.config.AdminToken == "" {
+		s.writeErrorResponse(w, UnauthorizedError.Type, UnauthorizedError.Title, "The admin API is disabled; start the proxy with -admin-token to enable it")
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+		s.writeErrorResponse(w, UnauthorizedError.Type, UnauthorizedError.Title, "A valid admin token is required as a bearer token")
+		return false
+	}
+	return true
+}
+
+// handleAdminKeys lists (GET) or creates (POST) API keys
+func (s *ProxyServer) handleAdminKeys(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	response := &APIKeyResponse{Success: true}
+	if r.Method == "POST" {
+		var req CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+			return
+		}
+		key, err := s.apiKeys.Create(&req)
+		if err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid API Key", err.Error())
+			return
+		}
+		s.logger.Printf("Created API key %s (%s)", key.ID, key.Name)
+		response.Key = key
+	} else {
+		response.Keys = s.apiKeys.List()
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleAdminKey returns (GET) or revokes (DELETE) one API key
+func (s *ProxyServer) handleAdminKey(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	key := s.apiKeys.Get(id)
+	if key == nil {
+		s.writeErrorResponse(w, "not_found", "API Key Not Found", fmt.Sprintf("No API key with id %s", id))
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if _, err := s.apiKeys.Revoke(id); err != nil {
+			s.writeErrorResponse(w, "unknown_error", "Revocation Failed", err.Error())
+			return
+		}
+		s.logger.Printf("Revoked API key %s (%s)", key.ID, key.Name)
+	}
+
+	if err := json.NewEncoder(w).Encode(&APIKeyResponse{Success: true, Key: key}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,494 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultArtifactRetention is how long an artifact is kept after it was last stored
+const DefaultArtifactRetention = 24 * time.Hour
+
+// DefaultArtifactsDir is where artifacts are stored unless configured otherwise
+func DefaultArtifactsDir() string {
+	return filepath.Join(os.TempDir(), "slingshot-artifacts")
+}
+
+// ArtifactStorageS3 marks artifacts kept in object storage rather than on disk
+const ArtifactStorageS3 = "s3"
+
+// artifactIDPattern matches artifact IDs, the SHA-256 of their content
+var artifactIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Artifact describes a stored response body
+type Artifact struct {
+	ID          string    `json:"id"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	Storage     string    `json:"storage,omitempty"` // s3 when kept in object storage
+	StoredAt    time.Time `json:"stored_at"`
+}
+
+// ArtifactResponse is returned by the artifact endpoints
+type ArtifactResponse struct {
+	Success  bool      `json:"success"`
+	Artifact *Artifact `json:"artifact"`
+}
+
+// ArtifactStore keeps large response bodies as content-addressed files. Each
+// body is stored once under the SHA-256 of its content, with its metadata in
+// the proxy's storage, and removed once it has not been stored again for the
+// retention period. With object storage, bodies above its threshold are
+// uploaded there instead.
+type ArtifactStore struct {
+	dir       string
+	retention time.Duration
+	meta      ArtifactStorage
+	logger    *log.Logger
+
+	objects         *objectStorage
+	objectThreshold int64         // Bodies larger than this go to object storage
+	urlExpiry       time.Duration // Validity of presigned object URLs
+}
+
+// NewArtifactStore creates a store keeping artifacts in dir for retention,
+// and their metadata in meta
+func NewArtifactStore(dir string, retention time.Duration, meta ArtifactStorage, logger *log.Logger) *ArtifactStore {
+	if dir == "" {
+		dir = DefaultArtifactsDir()
+	}
+	if retention <= 0 {
+		retention = DefaultArtifactRetention
+	}
+
+	return &ArtifactStore{
+		dir:       dir,
+		retention: retention,
+		meta:      meta,
+		logger:    logger,
+	}
+}
+
+// Start creates the artifact directory and begins removing expired artifacts
+func (a *ArtifactStore) Start() error {
+	if err := os.MkdirAll(a.dir, 0700); err != nil {
+		return fmt.Errorf("Failed to create artifact directory: %v", err)
+	}
+	a.importMeta()
+	go a.loop()
+	return nil
+}
+
+// importMeta moves the metadata files earlier versions kept next to each
+// artifact into storage
+func (a *ArtifactStore) importMeta() {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		a.logger.Printf("Failed to list artifacts: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		id, found := strings.CutSuffix(entry.Name(), ".json")
+		if !found || !artifactIDPattern.MatchString(id) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(a.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var artifact Artifact
+		if json.Unmarshal(data, &artifact) == nil && a.Get(id) == nil {
+			if err := a.meta.Put(&artifact); err != nil {
+				a.logger.Printf("%v", err)
+				continue
+			}
+		}
+		os.Remove(filepath.Join(a.dir, entry.Name()))
+	}
+}
+
+// Put stores data, or refreshes the expiry of an identical stored body
+func (a *ArtifactStore) Put(data []byte, contentType string) (*Artifact, error) {
+	sum := sha256.Sum256(data)
+	artifact := &Artifact{
+		ID:          hex.EncodeToString(sum[:]),
+		Size:        int64(len(data)),
+		ContentType: contentType,
+		StoredAt:    time.Now().UTC(),
+	}
+
+	if a.offloads(artifact.Size) {
+		return artifact, a.upload(artifact, bytes.NewReader(data))
+	}
+
+	path := a.path(artifact.ID)
+	if _, err := os.Stat(path); err == nil {
+		os.Chtimes(path, artifact.StoredAt, artifact.StoredAt)
+	} else if err := writeFileAtomic(path, data); err != nil {
+		return nil, fmt.Errorf("Failed to store artifact: %v", err)
+	}
+	return artifact, a.writeMeta(artifact)
+}
+
+// PutFile moves a file written in the artifact directory, such as a finished
+// download, into the store
+func (a *ArtifactStore) PutFile(name, contentType string) (*Artifact, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to store artifact: %v", err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to store artifact: %v", err)
+	}
+
+	artifact := &Artifact{
+		ID:          hex.EncodeToString(hash.Sum(nil)),
+		Size:        size,
+		ContentType: contentType,
+		StoredAt:    time.Now().UTC(),
+	}
+
+	if a.offloads(size) {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to store artifact: %v", err)
+		}
+		err = a.upload(artifact, file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		os.Remove(name)
+		return artifact, nil
+	}
+
+	path := a.path(artifact.ID)
+	if _, err := os.Stat(path); err == nil {
+		os.Remove(name)
+		os.Chtimes(path, artifact.StoredAt, artifact.StoredAt)
+	} else if err := os.Rename(name, path); err != nil {
+		return nil, fmt.Errorf("Failed to store artifact: %v", err)
+	}
+	return artifact, a.writeMeta(artifact)
+}
+
+// offloads reports whether bodies of size bytes go to object storage
+func (a *ArtifactStore) offloads(size int64) bool {
+	return a.objects != nil && size > a.objectThreshold
+}
+
+// upload stores an artifact's content in object storage, unless an identical
+// body is there already, and records its metadata on disk
+func (a *ArtifactStore) upload(artifact *Artifact, body io.Reader) error {
+	artifact.Storage = ArtifactStorageS3
+	if existing := a.Get(artifact.ID); existing == nil || existing.Storage != ArtifactStorageS3 {
+		if err := a.objects.Put(context.Background(), artifact.ID, body, artifact.Size, artifact.ID, artifact.ContentType); err != nil {
+			return fmt.Errorf("Failed to store artifact: %v", err)
+		}
+		// A copy stored on disk before is no longer needed
+		os.Remove(a.path(artifact.ID))
+	}
+	return a.writeMeta(artifact)
+}
+
+// URL returns where an artifact can be downloaded: a presigned URL for
+// artifacts in object storage, otherwise its /proxy/artifacts URL
+func (a *ArtifactStore) URL(artifact *Artifact) string {
+	if artifact.Storage == ArtifactStorageS3 && a.objects != nil {
+		return a.objects.PresignGet(artifact.ID, a.urlExpiry)
+	}
+	return "/proxy/artifacts/" + artifact.ID
+}
+
+// writeMeta stores the metadata of an artifact
+func (a *ArtifactStore) writeMeta(artifact *Artifact) error {
+	return a.meta.Put(artifact)
+}
+
+// partialPath returns the file an unfinished download is written to
+func (a *ArtifactStore) partialPath(downloadID string) string {
+	return filepath.Join(a.dir, ".partial-"+downloadID)
+}
+
+// Get returns the metadata of a stored artifact, or nil if there is none
+func (a *ArtifactStore) Get(id string) *Artifact {
+	if !artifactIDPattern.MatchString(id) {
+		return nil
+	}
+
+	artifact, err := a.meta.Get(id)
+	if err != nil {
+		a.logger.Printf("%v", err)
+		return nil
+	}
+	return artifact
+}
+
+// Open opens the content of a stored artifact, downloading it to a temporary
+// file when it is kept in object storage
+func (a *ArtifactStore) Open(id string) (io.ReadSeekCloser, error) {
+	if !artifactIDPattern.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+	if artifact := a.Get(id); artifact != nil && artifact.Storage == ArtifactStorageS3 {
+		return a.download(artifact)
+	}
+	return os.Open(a.path(id))
+}
+
+// download copies an artifact from object storage into a temporary file,
+// removed once closed
+func (a *ArtifactStore) download(artifact *Artifact) (io.ReadSeekCloser, error) {
+	if a.objects == nil {
+		return nil, fmt.Errorf("Artifact %s is kept in object storage, which is not configured", artifact.ID)
+	}
+	body, err := a.objects.Get(context.Background(), artifact.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	file, err := os.CreateTemp(a.dir, ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return tempFile{file}, nil
+}
+
+// tempFile is a file removed once closed
+type tempFile struct {
+	*os.File
+}
+
+func (f tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// Remove deletes an artifact, reporting whether it existed
+func (a *ArtifactStore) Remove(id string) bool {
+	if !artifactIDPattern.MatchString(id) {
+		return false
+	}
+
+	if artifact := a.Get(id); artifact != nil && artifact.Storage == ArtifactStorageS3 && a.objects != nil {
+		if err := a.objects.Delete(context.Background(), id); err != nil {
+			a.logger.Printf("Failed to remove artifact %s: %v", id, err)
+		}
+	}
+	removed, err := a.meta.Remove(id)
+	if err != nil {
+		a.logger.Printf("%v", err)
+	}
+	return os.Remove(a.path(id)) == nil || removed
+}
+
+// path returns the file an artifact's content is stored in
+func (a *ArtifactStore) path(id string) string {
+	return filepath.Join(a.dir, id)
+}
+
+// loop removes expired artifacts periodically
+func (a *ArtifactStore) loop() {
+	interval := a.retention / 10
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+
+	for {
+		a.prune(time.Now())
+		time.Sleep(interval)
+	}
+}
+
+// prune removes artifacts last stored before the retention period, then
+// files left in the directory as long: unfinished downloads and content
+// whose metadata is gone
+func (a *ArtifactStore) prune(now time.Time) {
+	expired, err := a.meta.Expired(now.Add(-a.retention))
+	if err != nil {
+		a.logger.Printf("%v", err)
+	}
+	for _, artifact := range expired {
+		a.Remove(artifact.ID)
+	}
+
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		a.logger.Printf("Failed to list artifacts: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, ".partial-") && !strings.HasPrefix(name, ".tmp-") && !artifactIDPattern.MatchString(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < a.retention {
+			continue
+		}
+		if artifactIDPattern.MatchString(name) && a.Get(name) != nil {
+			continue
+		}
+		os.Remove(filepath.Join(a.dir, name))
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place,
+// so readers never see a partly written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// offloadBody moves a response body into the artifact store when the caller
+// asked for it or the body is larger than the configured threshold, leaving
+// the artifact's ID and download URL in its place
+func (s *ProxyServer) offloadBody(response *ProxyResponse, requested bool) {
+	if !response.Success || response.ResponseData == "" {
+		return
+	}
+
+	data := []byte(response.ResponseData)
+	if response.IsBinary {
+		decoded, err := base64.StdEncoding.DecodeString(response.ResponseData)
+		if err != nil {
+			return
+		}
+		data = decoded
+	}
+
+	threshold := s.config.ArtifactThreshold
+	if !requested && (threshold <= 0 || int64(len(data)) <= threshold) {
+		return
+	}
+
+	// Bodies converted from a binary format are stored as the JSON returned
+	contentType := response.ContentType
+	if response.BodyFormat != "" {
+		contentType = "application/json"
+	}
+
+	// Stored copies never hold what the scrub rules match
+	artifact, err := s.artifacts.Put(s.scrubber.Body(data, response.IsBinary), contentType)
+	if err != nil {
+		s.logger.Printf("%v", err)
+		return
+	}
+
+	response.ArtifactID = artifact.ID
+	response.ArtifactURL = s.artifacts.URL(artifact)
+	response.ResponseData = ""
+}
+
+// handleArtifact downloads (GET), describes (GET ?info=true) or deletes
+// (DELETE) a stored response body
+func (s *ProxyServer) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	artifact := s.artifacts.Get(id)
+	if artifact == nil {
+		w.Header().Set("Content-Type", "application/json")
+		s.writeErrorResponse(w, "not_found", "Artifact Not Found", fmt.Sprintf("No artifact with id %s", id))
+		return
+	}
+
+	if r.Method == "DELETE" || r.URL.Query().Get("info") == "true" {
+		if r.Method == "DELETE" {
+			s.artifacts.Remove(id)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&ArtifactResponse{Success: true, Artifact: artifact}); err != nil {
+			s.logger.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+
+	// Bodies in object storage are downloaded straight from there
+	if artifact.Storage == ArtifactStorageS3 && s.artifacts.objects != nil {
+		http.Redirect(w, r, s.artifacts.URL(artifact), http.StatusFound)
+		return
+	}
+
+	file, err := s.artifacts.Open(id)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		s.writeErrorResponse(w, "not_found", "Artifact Not Found", fmt.Sprintf("No artifact with id %s", id))
+		return
+	}
+	defer file.Close()
+
+	contentType := artifact.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", artifactFilename(artifact)))
+	}
+	http.ServeContent(w, r, "", artifact.StoredAt, file)
+}
+
+// artifactFilename suggests a download name from the artifact's content type
+func artifactFilename(artifact *Artifact) string {
+	name := artifact.ID[:12]
+	mediaType := strings.TrimSpace(strings.Split(artifact.ContentType, ";")[0])
+	if slash := strings.LastIndex(mediaType, "/"); slash >= 0 {
+		ext := mediaType[slash+1:]
+		if plus := strings.LastIndex(ext, "+"); plus >= 0 {
+			ext = ext[plus+1:]
+		}
+		if ext != "" && !strings.ContainsAny(ext, ".-") {
+			name += "." + ext
+		}
+	}
+	return name
+}
@@ -0,0 +1,254 @@
+package slingshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Assertion sources
+const (
+	AssertStatus       = "status"        // Response status code
+	AssertResponseTime = "response_time" // Response time in milliseconds
+	AssertHeader       = "header"        // Response header named by property
+	AssertBody         = "body"          // Raw response body
+	AssertJSON         = "json"          // Value at the JSON path in property, e.g. data.items.0.id
+)
+
+// Assertion comparisons
+const (
+	CompareEquals      = "equals"
+	CompareNotEquals   = "not_equals"
+	CompareContains    = "contains"
+	CompareNotContains = "not_contains"
+	CompareLessThan    = "less_than"
+	CompareGreaterThan = "greater_than"
+	CompareExists      = "exists"
+	CompareNotExists   = "not_exists"
+)
+
+// Assertion is an expected condition on a response
+type Assertion struct {
+	Source     string `json:"source"`
+	Property   string `json:"property,omitempty"`
+	Comparison string `json:"comparison"`
+	Target     string `json:"target,omitempty"`
+}
+
+// UnmarshalJSON accepts numeric and boolean targets as well as strings
+func (a *Assertion) UnmarshalJSON(data []byte) error {
+	type plain Assertion
+	var raw struct {
+		plain
+		Target json.RawMessage `json:"target,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*a = Assertion(raw.plain)
+	a.Target = scalarString(raw.Target)
+	return nil
+}
+
+// scalarString returns a JSON string unquoted and any other value as written
+func scalarString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// AssertionResult reports whether an assertion held
+type AssertionResult struct {
+	Assertion
+	Passed  bool   `json:"passed"`
+	Actual  string `json:"actual,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// validateAssertions checks that every assertion is well formed
+func validateAssertions(assertions []Assertion) error {
+	for i, a := range assertions {
+		if err := validateSource(a.Source, a.Property); err != nil {
+			return fmt.Errorf("Assertion %d: %v", i+1, err)
+		}
+		if err := validateComparison(a.Comparison, a.Target); err != nil {
+			return fmt.Errorf("Assertion %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateSource checks a response value source and its property
+func validateSource(source, property string) error {
+	switch source {
+	case AssertStatus, AssertResponseTime, AssertBody:
+	case AssertHeader, AssertJSON:
+		if property == "" {
+			return fmt.Errorf("%s needs a property", source)
+		}
+	default:
+		return fmt.Errorf("unknown source %q", source)
+	}
+	return nil
+}
+
+// validateComparison checks a comparison and its target
+func validateComparison(comparison, target string) error {
+	switch comparison {
+	case CompareEquals, CompareNotEquals, CompareContains, CompareNotContains, CompareExists, CompareNotExists:
+	case CompareLessThan, CompareGreaterThan:
+		if _, err := strconv.ParseFloat(target, 64); err != nil {
+			return fmt.Errorf("%s needs a numeric target", comparison)
+		}
+	default:
+		return fmt.Errorf("unknown comparison %q", comparison)
+	}
+	return nil
+}
+
+// evaluateAssertions checks the assertions against a response
+func evaluateAssertions(assertions []Assertion, response *ProxyResponse, durationMillis float64) []AssertionResult {
+	results := make([]AssertionResult, 0, len(assertions))
+	for _, a := range assertions {
+		actual, found := assertionValue(a, response, durationMillis)
+		result := AssertionResult{Assertion: a, Actual: truncateActual(actual)}
+		result.Passed, result.Message = compare(a, actual, found)
+		results = append(results, result)
+	}
+	return results
+}
+
+// maxActualLength is the longest actual value echoed back in a result
+const maxActualLength = 200
+
+// truncateActual shortens long values such as bodies for the result
+func truncateActual(actual string) string {
+	if len(actual) <= maxActualLength {
+		return actual
+	}
+	return strings.ToValidUTF8(actual[:maxActualLength], "") + "..."
+}
+
+// String describes the assertion, e.g. "header content-type equals text/plain"
+func (a Assertion) String() string {
+	parts := []string{a.Source}
+	if a.Property != "" {
+		parts = append(parts, a.Property)
+	}
+	parts = append(parts, a.Comparison)
+	if a.Target != "" {
+		parts = append(parts, a.Target)
+	}
+	return strings.Join(parts, " ")
+}
+
+// assertionValue extracts the value an assertion is about
+func assertionValue(a Assertion, response *ProxyResponse, durationMillis float64) (string, bool) {
+	switch a.Source {
+	case AssertStatus:
+		return strconv.Itoa(response.ResponseStatus), true
+	case AssertResponseTime:
+		return strconv.FormatFloat(durationMillis, 'f', 2, 64), true
+	case AssertHeader:
+		value, ok := response.ResponseHeaders[strings.ToLower(a.Property)]
+		return value, ok
+	case AssertBody:
+		return response.ResponseData, true
+	case AssertJSON:
+		return lookupJSONPath(response.ResponseData, a.Property)
+	}
+	return "", false
+}
+
+// compare applies the assertion's comparison to the actual value
+func compare(a Assertion, actual string, found bool) (bool, string) {
+	switch a.Comparison {
+	case CompareExists:
+		if !found {
+			return false, "value does not exist"
+		}
+		return true, ""
+	case CompareNotExists:
+		if found {
+			return false, "value exists"
+		}
+		return true, ""
+	}
+
+	if !found {
+		return false, "value does not exist"
+	}
+
+	switch a.Comparison {
+	case CompareEquals:
+		if actual != a.Target {
+			return false, fmt.Sprintf("expected %q, got %q", a.Target, actual)
+		}
+	case CompareNotEquals:
+		if actual == a.Target {
+			return false, fmt.Sprintf("expected anything but %q", a.Target)
+		}
+	case CompareContains:
+		if !strings.Contains(actual, a.Target) {
+			return false, fmt.Sprintf("expected to contain %q", a.Target)
+		}
+	case CompareNotContains:
+		if strings.Contains(actual, a.Target) {
+			return false, fmt.Sprintf("expected not to contain %q", a.Target)
+		}
+	case CompareLessThan, CompareGreaterThan:
+		value, err := strconv.ParseFloat(actual, 64)
+		if err != nil {
+			return false, fmt.Sprintf("%q is not a number", actual)
+		}
+		target, _ := strconv.ParseFloat(a.Target, 64)
+		if a.Comparison == CompareLessThan && !(value < target) {
+			return false, fmt.Sprintf("expected less than %s", a.Target)
+		}
+		if a.Comparison == CompareGreaterThan && !(value > target) {
+			return false, fmt.Sprintf("expected greater than %s", a.Target)
+		}
+	}
+	return true, ""
+}
+
+// lookupJSONPath returns the value at a dot-separated path in a JSON document.
+// Array elements are addressed by index. Strings are returned unquoted; other
+// values as JSON.
+func lookupJSONPath(document, path string) (string, bool) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		return "", false
+	}
+
+	for _, key := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			value = child
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", false
+			}
+			value = node[index]
+		default:
+			return "", false
+		}
+	}
+
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded), true
+}
@@ -0,0 +1,104 @@
+package slingshot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// buildRequestBody returns the outgoing request body, its length and, for
+// bodies that dictate their own format, the Content-Type to send.
+// Only one of body, bodyPath and multipart may be set.
+func (c *HTTPClient) buildRequestBody(req *ProxyRequest) (io.Reader, int64, string, error) {
+	sources := 0
+	for _, set := range []bool{req.Body != "", req.BodyPath != "", len(req.Multipart) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, 0, "", fmt.Errorf("Only one of body, bodyPath and multipart can be set.")
+	}
+
+	switch {
+	case len(req.Multipart) > 0:
+		body, length, contentType, err := c.newMultipartBody(req.Multipart)
+		return body, length, contentType, err
+	case req.BodyPath != "":
+		body, length, contentType, err := c.openBodyFile(req.BodyPath)
+		return body, length, contentType, err
+	default:
+		return strings.NewReader(req.Body), int64(len(req.Body)), "", nil
+	}
+}
+
+// openBodyFile opens a server-side file to be streamed as the request body
+func (c *HTTPClient) openBodyFile(bodyPath string) (io.ReadCloser, int64, string, error) {
+	path, err := resolveUploadPath(bodyPath, c.uploadDirs)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("Failed to open %s: %v", bodyPath, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, "", fmt.Errorf("Failed to read %s: %v", bodyPath, err)
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, 0, "", fmt.Errorf("%s is a directory", bodyPath)
+	}
+
+	return file, info.Size(), "", nil
+}
+
+// closeBody closes a request body that was never handed to the transport
+func closeBody(body io.Reader) {
+	if closer, ok := body.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// useChunkedEncoding switches a request to chunked transfer encoding without a
+// Content-Length. When chunkSize is set, the body is sent in chunks of at
+// most that many bytes.
+func useChunkedEncoding(httpReq *http.Request, chunkSize int) {
+	httpReq.ContentLength = -1
+	httpReq.TransferEncoding = []string{"chunked"}
+	httpReq.Header.Del("Content-Length")
+
+	if chunkSize > 0 {
+		httpReq.Body = &chunkReader{ReadCloser: httpReq.Body, size: chunkSize}
+
+		getBody := httpReq.GetBody
+		if getBody != nil {
+			httpReq.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return &chunkReader{ReadCloser: body, size: chunkSize}, nil
+			}
+		}
+	}
+}
+
+// chunkReader limits each read so the transport writes chunks of a fixed size
+type chunkReader struct {
+	io.ReadCloser
+	size int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(p) > r.size {
+		p = p[:r.size]
+	}
+	return r.ReadCloser.Read(p)
+}
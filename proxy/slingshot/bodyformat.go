@@ -0,0 +1,197 @@
+package slingshot
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// bodyFormat converts request and response bodies between JSON and a binary
+// encoding
+type bodyFormat struct {
+	// ContentType is sent when the request has no Content-Type header
+	ContentType string
+
+	// ContentTypes are the response content types decoded to JSON
+	ContentTypes []string
+
+	Encode func(value interface{}) ([]byte, error)
+	Decode func(data []byte) (interface{}, error)
+}
+
+// bodyFormats are the formats that bodyFormat may name
+var bodyFormats = map[string]*bodyFormat{
+	"msgpack": {
+		ContentType:  "application/msgpack",
+		ContentTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+		Encode:       encodeMsgpack,
+		Decode:       decodeMsgpack,
+	},
+	"cbor": {
+		ContentType:  "application/cbor",
+		ContentTypes: []string{"application/cbor"},
+		Encode:       cbor.Marshal,
+		Decode: func(data []byte) (interface{}, error) {
+			var value interface{}
+			err := cbor.Unmarshal(data, &value)
+			return value, err
+		},
+	},
+}
+
+// encodeMsgpack encodes a value as MessagePack, using the smallest integer types
+func encodeMsgpack(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.UseCompactInts(true)
+	encoder.UseCompactFloats(true)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeMsgpack decodes MessagePack, allowing map keys that are not strings
+func decodeMsgpack(data []byte) (interface{}, error) {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetMapDecoder(func(d *msgpack.Decoder) (interface{}, error) {
+		return d.DecodeUntypedMap()
+	})
+	return decoder.DecodeInterface()
+}
+
+// responseBodyFormat finds the format of a response content type
+func responseBodyFormat(contentType string) (string, *bodyFormat) {
+	contentType = strings.ToLower(contentType)
+	for name, format := range bodyFormats {
+		for _, formatType := range format.ContentTypes {
+			if strings.HasPrefix(contentType, formatType) {
+				return name, format
+			}
+		}
+	}
+	return "", nil
+}
+
+// parseJSONValue decodes JSON, keeping integers as int64 or uint64 so they
+// are not encoded as floats
+func parseJSONValue(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return convertJSONNumbers(value), nil
+}
+
+// convertJSONNumbers replaces the json.Numbers in a decoded value
+func convertJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertJSONNumbers(item)
+		}
+	}
+	return value
+}
+
+// jsonCompatible converts a decoded value so it can be marshaled as JSON.
+// Map keys that are not strings are formatted as strings.
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = jsonCompatible(item)
+		}
+		return converted
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonCompatible(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+	}
+	return value
+}
+
+// encodeBody replaces the JSON body of a request with its bodyFormat
+// encoding, defaulting the Content-Type to the format's
+func (c *HTTPClient) encodeBody(req *ProxyRequest) error {
+	format, ok := bodyFormats[strings.ToLower(req.BodyFormat)]
+	if !ok {
+		return fmt.Errorf("Unknown body format %q", req.BodyFormat)
+	}
+	value, err := parseJSONValue([]byte(req.Body))
+	if err != nil {
+		return fmt.Errorf("Body is not valid JSON: %v", err)
+	}
+	encoded, err := format.Encode(value)
+	if err != nil {
+		return fmt.Errorf("Failed to encode body as %s: %v", req.BodyFormat, err)
+	}
+	req.Body = string(encoded)
+
+	for _, field := range parseHeaderFields(req.Headers) {
+		if strings.EqualFold(field.Name, "Content-Type") {
+			return nil
+		}
+	}
+	req.Headers = append(req.Headers, "Content-Type: "+format.ContentType)
+	return nil
+}
+
+// decodeResponseBody replaces a response body in a known binary format with
+// its JSON form
+func (c *HTTPClient) decodeResponseBody(response *ProxyResponse) error {
+	name, format := responseBodyFormat(response.ContentType)
+	if format == nil || response.BodyOmitted || response.ResponseData == "" {
+		return nil
+	}
+
+	data := []byte(response.ResponseData)
+	if response.IsBinary {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(response.ResponseData); err != nil {
+			return err
+		}
+	}
+	value, err := format.Decode(data)
+	if err != nil {
+		return fmt.Errorf("Response is not valid %s: %v", name, err)
+	}
+	decoded, err := json.Marshal(jsonCompatible(value))
+	if err != nil {
+		return fmt.Errorf("Failed to convert %s response to JSON: %v", name, err)
+	}
+	response.ResponseData = string(decoded)
+	response.IsBinary = false
+	response.BodyFormat = name
+	return nil
+}
@@ -0,0 +1,212 @@
+package slingshot
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DefaultPageBytes and MaxPageBytes bound a page of a body read by bytes
+	DefaultPageBytes = 64 << 10
+	MaxPageBytes     = 1 << 20
+
+	// DefaultPageLines and MaxPageLines bound a page of a body read by lines
+	DefaultPageLines = 1000
+	MaxPageLines     = 10000
+)
+
+// BodyPageResponse is returned by GET /proxy/history/{id}/body
+type BodyPageResponse struct {
+	Success    bool     `json:"success"`
+	ID         string   `json:"id"`
+	Unit       string   `json:"unit"` // "bytes" or "lines"
+	Offset     int64    `json:"offset"`
+	NextOffset int64    `json:"next_offset"`
+	More       bool     `json:"more"`
+	TotalSize  int64    `json:"total_size"`
+	TotalLines int64    `json:"total_lines,omitempty"`
+	Data       string   `json:"data,omitempty"`
+	IsBinary   bool     `json:"is_binary,omitempty"`
+	Lines      []string `json:"lines,omitempty"`
+}
+
+// readBytePage reads up to limit bytes of a body from offset. Text bodies
+// end the page on a character boundary so no character is split.
+func readBytePage(body io.ReadSeeker, size, offset, limit int64, isBinary bool) (*BodyPageResponse, error) {
+	page := &BodyPageResponse{Unit: "bytes", Offset: offset, TotalSize: size, IsBinary: isBinary}
+	if offset >= size {
+		page.NextOffset = size
+		return page, nil
+	}
+
+	if _, err := body.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, min(limit, size-offset))
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, err
+	}
+
+	if !isBinary && offset+int64(len(data)) < size {
+		// Drop a character cut off at the end of the page
+		for cut := len(data) - 1; cut >= 0 && cut >= len(data)-utf8.UTFMax; cut-- {
+			if utf8.RuneStart(data[cut]) {
+				if cut > 0 && !utf8.FullRune(data[cut:]) {
+					data = data[:cut]
+				}
+				break
+			}
+		}
+	}
+
+	page.NextOffset = offset + int64(len(data))
+	page.More = page.NextOffset < size
+	if isBinary {
+		page.Data = base64.StdEncoding.EncodeToString(data)
+	} else {
+		page.Data = string(data)
+	}
+	return page, nil
+}
+
+// readLinePage reads up to limit lines of a body, starting at the 0-based
+// line offset, and counts the lines of the whole body
+func readLinePage(body io.Reader, size, offset, limit int64) (*BodyPageResponse, error) {
+	page := &BodyPageResponse{Unit: "lines", Offset: offset, TotalSize: size, Lines: []string{}}
+
+	reader := bufio.NewReader(body)
+	var lineNumber int64
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if lineNumber >= offset && lineNumber < offset+limit {
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		// A body ending in a newline has no further line
+		atEnd := err == io.EOF
+		if atEnd && len(chunk) == 0 && (lineNumber > 0 || size == 0) {
+			break
+		}
+		if lineNumber >= offset && lineNumber < offset+limit {
+			page.Lines = append(page.Lines, string(trimLineEnding(line)))
+			line = line[:0]
+		}
+		lineNumber++
+		if atEnd {
+			break
+		}
+	}
+
+	page.TotalLines = lineNumber
+	page.NextOffset = min(offset+int64(len(page.Lines)), lineNumber)
+	page.More = page.NextOffset < lineNumber
+	return page, nil
+}
+
+// trimLineEnding removes a trailing \n or \r\n
+func trimLineEnding(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+		if n := len(line); n > 0 && line[n-1] == '\r' {
+			line = line[:n-1]
+		}
+	}
+	return line
+}
+
+// handleHistoryBody returns a page of the response body of a history entry
+// (?offset=&limit=&unit=bytes|lines)
+func (s *ProxyServer) handleHistoryBody(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	entry, err := s.history.Get(id)
+	if err != nil {
+		s.writeErrorResponse(w, "unknown_error", "History Unavailable", err.Error())
+		return
+	}
+	if entry == nil {
+		s.writeErrorResponse(w, "not_found", "Request Not Found", fmt.Sprintf("No request with id %s in the history", id))
+		return
+	}
+
+	query := r.URL.Query()
+	unit := query.Get("unit")
+	if unit == "" {
+		unit = "bytes"
+	}
+	defaultLimit, maxLimit := int64(DefaultPageBytes), int64(MaxPageBytes)
+	switch unit {
+	case "bytes":
+	case "lines":
+		if entry.isBinary {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Page", "Binary bodies can only be read by bytes")
+			return
+		}
+		defaultLimit, maxLimit = DefaultPageLines, MaxPageLines
+	default:
+		s.writeErrorResponse(w, "request_format_error", "Invalid Page", fmt.Sprintf("Unknown unit %q; use bytes or lines", unit))
+		return
+	}
+
+	var offset int64
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		n, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || n < 0 {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Page", "offset must be a non-negative number")
+			return
+		}
+		offset = n
+	}
+	limit := defaultLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if n, err := strconv.ParseInt(limitStr, 10, 64); err == nil && n > 0 {
+			limit = min(n, maxLimit)
+		}
+	}
+
+	body, size, err := s.openHistoryBody(entry)
+	if err != nil {
+		s.writeErrorResponse(w, "not_found", "Body Not Available", err.Error())
+		return
+	}
+	defer body.Close()
+
+	var page *BodyPageResponse
+	if unit == "lines" {
+		page, err = readLinePage(body, size, offset, limit)
+	} else {
+		page, err = readBytePage(body, size, offset, limit, entry.isBinary)
+	}
+	if err != nil {
+		s.writeErrorResponse(w, "unknown_error", "Failed to Read Body", err.Error())
+		return
+	}
+
+	page.Success = true
+	page.ID = id
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package slingshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DefaultSearchMatches is how many matches a body search returns by default
+	DefaultSearchMatches = 100
+
+	// MaxSearchMatches is the most matches a body search may return
+	MaxSearchMatches = 1000
+
+	// searchContext is how many bytes around a match are shown with it
+	searchContext = 40
+)
+
+// BodyMatch is one match of a body search
+type BodyMatch struct {
+	Line    int    `json:"line"`   // 1-based line number
+	Column  int    `json:"column"` // 1-based byte offset within the line
+	Offset  int    `json:"offset"` // Byte offset within the body
+	Match   string `json:"match"`
+	Context string `json:"context"` // The match with surrounding text on its line
+}
+
+// BodySearchResponse is returned by GET /proxy/history/{id}/search
+type BodySearchResponse struct {
+	Success   bool         `json:"success"`
+	ID        string       `json:"id"`
+	Query     string       `json:"query"`
+	BodySize  int          `json:"body_size"`
+	Matches   []*BodyMatch `json:"matches"`
+	Truncated bool         `json:"truncated,omitempty"` // More matches than limit
+}
+
+// compileBodySearch builds the pattern for a query, matched literally unless
+// isRegex is set
+func compileBodySearch(query string, isRegex, ignoreCase bool) (*regexp.Regexp, error) {
+	if query == "" {
+		return nil, fmt.Errorf("Search query q is required")
+	}
+
+	pattern := query
+	if !isRegex {
+		pattern = regexp.QuoteMeta(query)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid regular expression: %v", err)
+	}
+	return re, nil
+}
+
+// searchBody finds up to limit matches of re in body, line by line. It
+// reports whether there were more.
+func searchBody(body []byte, re *regexp.Regexp, limit int) ([]*BodyMatch, bool) {
+	matches := []*BodyMatch{}
+	offset := 0
+	for lineNumber := 1; offset <= len(body); lineNumber++ {
+		end := bytes.IndexByte(body[offset:], '\n')
+		if end < 0 {
+			end = len(body) - offset
+		}
+		line := body[offset : offset+end]
+
+		for _, loc := range re.FindAllIndex(line, -1) {
+			if loc[0] == loc[1] {
+				continue // Empty matches are not useful
+			}
+			if len(matches) == limit {
+				return matches, true
+			}
+			matches = append(matches, &BodyMatch{
+				Line:    lineNumber,
+				Column:  loc[0] + 1,
+				Offset:  offset + loc[0],
+				Match:   printable(line[loc[0]:loc[1]]),
+				Context: printable(line[max(loc[0]-searchContext, 0):min(loc[1]+searchContext, len(line))]),
+			})
+		}
+		offset += end + 1
+	}
+	return matches, false
+}
+
+// printable returns text for JSON output, replacing bytes that are not
+// valid UTF-8 so binary bodies can be searched too
+func printable(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return string(bytes.ToValidUTF8(data, []byte("�")))
+}
+
+// handleHistorySearch searches the response body of a history entry
+// (?q=, &regex=true, &ignoreCase=true, &limit=)
+func (s *ProxyServer) handleHistorySearch(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	entry, err := s.history.Get(id)
+	if err != nil {
+		s.writeErrorResponse(w, "unknown_error", "History Unavailable", err.Error())
+		return
+	}
+	if entry == nil {
+		s.writeErrorResponse(w, "not_found", "Request Not Found", fmt.Sprintf("No request with id %s in the history", id))
+		return
+	}
+
+	query := r.URL.Query()
+	isRegex, _ := strconv.ParseBool(query.Get("regex"))
+	ignoreCase, _ := strconv.ParseBool(query.Get("ignoreCase"))
+	re, err := compileBodySearch(query.Get("q"), isRegex, ignoreCase)
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Search", err.Error())
+		return
+	}
+
+	limit := DefaultSearchMatches
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if n, err := strconv.Atoi(limitStr); err == nil && n > 0 {
+			limit = min(n, MaxSearchMatches)
+		}
+	}
+
+	body, err := s.historyBody(entry)
+	if err != nil {
+		s.writeErrorResponse(w, "not_found", "Body Not Available", err.Error())
+		return
+	}
+
+	matches, truncated := searchBody(body, re, limit)
+	response := &BodySearchResponse{
+		Success:   true,
+		ID:        id,
+		Query:     query.Get("q"),
+		BodySize:  len(body),
+		Matches:   matches,
+		Truncated: truncated,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
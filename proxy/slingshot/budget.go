@@ -0,0 +1,123 @@
+package slingshot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons a body read stopped early
+const (
+	PartialMaxDownloadBytes   = "max_download_bytes"
+	PartialMaxDownloadSeconds = "max_download_seconds"
+)
+
+// validateDownloadBudget checks the maxDownloadBytes/maxDownloadSeconds options
+func validateDownloadBudget(req *ProxyRequest) error {
+	if req.MaxDownloadBytes < 0 {
+		return fmt.Errorf("maxDownloadBytes cannot be negative")
+	}
+	if req.MaxDownloadSeconds < 0 {
+		return fmt.Errorf("maxDownloadSeconds cannot be negative")
+	}
+	return nil
+}
+
+// budgetReader reads a response body until it ends or a download budget is
+// used up. Running out of budget ends the body like EOF and records why, so
+// the caller still gets the status, headers and the partial body.
+type budgetReader struct {
+	body      io.ReadCloser
+	remaining int64 // -1 when there is no byte budget
+	timer     *time.Timer
+	timedOut  atomic.Bool
+	reason    string
+}
+
+// newBudgetReader wraps body with the request's download budgets. The time
+// budget starts when the body starts downloading.
+func newBudgetReader(body io.ReadCloser, req *ProxyRequest) *budgetReader {
+	r := &budgetReader{body: body, remaining: -1}
+	if req.MaxDownloadBytes > 0 {
+		r.remaining = req.MaxDownloadBytes
+	}
+	if req.MaxDownloadSeconds > 0 {
+		r.timer = time.AfterFunc(time.Duration(req.MaxDownloadSeconds)*time.Second, func() {
+			r.timedOut.Store(true)
+			body.Close()
+		})
+	}
+	return r
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	if r.reason != "" {
+		return 0, io.EOF
+	}
+
+	// Out of bytes: only a genuine EOF means the body was complete
+	if r.remaining == 0 {
+		var probe [1]byte
+		for {
+			n, err := r.body.Read(probe[:])
+			if n > 0 {
+				r.stop(PartialMaxDownloadBytes)
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, r.checkTimeout(err)
+			}
+		}
+	}
+
+	if r.remaining > 0 && int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.body.Read(p)
+	if r.remaining > 0 {
+		r.remaining -= int64(n)
+	}
+	if err != nil {
+		err = r.checkTimeout(err)
+	}
+	return n, err
+}
+
+// checkTimeout turns the error from a body closed by the timer into EOF
+func (r *budgetReader) checkTimeout(err error) error {
+	if err != io.EOF && r.timedOut.Load() {
+		r.reason = PartialMaxDownloadSeconds
+		return io.EOF
+	}
+	return err
+}
+
+// stop records why reading stopped and drops the rest of the body
+func (r *budgetReader) stop(reason string) {
+	r.reason = reason
+	r.Close()
+}
+
+func (r *budgetReader) Close() error {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	return r.body.Close()
+}
+
+// markPartial flags a response whose body was cut short by a download budget
+func markPartial(resp *http.Response, response *ProxyResponse) {
+	if isPartial(resp) {
+		response.Partial = true
+		response.PartialReason = resp.Body.(*budgetReader).reason
+	}
+}
+
+// isPartial reports whether the response body was cut short by a download budget
+func isPartial(resp *http.Response) bool {
+	budget, ok := resp.Body.(*budgetReader)
+	return ok && budget.reason != ""
+}
@@ -0,0 +1,99 @@
+package slingshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Version is the proxy's release version
+const Version = "0.1.0"
+
+// Commit and BuildDate identify the build. Release builds set them with
+//
+//	go build -ldflags "-X main.Commit=$(git rev-parse HEAD) -X main.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Otherwise the commit is read from the version control information Go
+// embeds, which has the commit's date but not the build's.
+var (
+	Commit    string
+	BuildDate string
+)
+
+// BuildInfo identifies the exact build of the running proxy
+type BuildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitDate string `json:"commit_date,omitempty"`
+	BuildDate  string `json:"build_date,omitempty"`
+	Modified   bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	GoVersion  string `json:"go_version"`
+	Platform   string `json:"platform"`
+}
+
+// CurrentBuild returns the build metadata, preferring values set with
+// -ldflags over those embedded by the Go toolchain
+func CurrentBuild() BuildInfo {
+	build := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok || build.Commit != "" {
+		return build
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Commit = setting.Value
+		case "vcs.time":
+			build.CommitDate = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
+
+// String describes the build in one line for --version
+func (b BuildInfo) String() string {
+	details := []string{}
+	if b.Commit != "" {
+		commit := b.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if b.Modified {
+			commit += "-dirty"
+		}
+		details = append(details, "commit "+commit)
+	}
+	if b.BuildDate != "" {
+		details = append(details, "built "+b.BuildDate)
+	} else if b.CommitDate != "" {
+		details = append(details, "committed "+b.CommitDate)
+	}
+	details = append(details, b.GoVersion, b.Platform)
+	return fmt.Sprintf("v%s (%s)", b.Version, strings.Join(details, ", "))
+}
+
+// handleVersion returns the build metadata
+func (s *ProxyServer) handleVersion(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CurrentBuild()); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
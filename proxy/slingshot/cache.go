@@ -0,0 +1,246 @@
+package slingshot
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheEntries is the maximum number of responses kept in the cache
+const DefaultCacheEntries = 500
+
+// CacheEntry holds a stored response along with its validators
+type CacheEntry struct {
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	ETag         string
+	LastModified string
+	StoredAt     time.Time
+
+	// Vary names the request headers the response depends on, and Varied
+	// holds their values in the request it answered
+	Vary   []string
+	Varied []string
+
+	key string
+}
+
+// HasValidators reports whether the entry can be revalidated with a conditional request
+func (e *CacheEntry) HasValidators() bool {
+	return e.ETag != "" || e.LastModified != ""
+}
+
+// ResponseCache is a small in-memory cache of upstream responses. The proxy
+// is shared by its callers, so it caches as a shared cache does: responses
+// are kept per combination of the request headers they Vary on, and
+// responses that are private or not to be stored are not kept at all.
+type ResponseCache struct {
+	mu         sync.Mutex
+	entries    map[string][]*CacheEntry // Variants by method and URL
+	order      []*CacheEntry
+	maxEntries int
+}
+
+// NewResponseCache creates a cache holding at most maxEntries responses
+func NewResponseCache(maxEntries int) *ResponseCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheEntries
+	}
+
+	return &ResponseCache{
+		entries:    make(map[string][]*CacheEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// cacheKey builds the lookup key for a request
+func cacheKey(method, targetURL string) string {
+	return method + " " + targetURL
+}
+
+// Get returns the cached entry for a request sent with header, if any
+func (c *ResponseCache) Get(method, targetURL string, header http.Header) *CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, entry := range c.entries[cacheKey(method, targetURL)] {
+		if entry.matches(header) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Put stores the response to a request sent with header, replacing the
+// variant of the same varied header values and evicting the oldest entry
+// when the cache is full. Responses a shared cache must not store are
+// ignored.
+func (c *ResponseCache) Put(method, targetURL string, header http.Header, resp *http.Response, body []byte) {
+	if !isStorable(header, resp.Header) {
+		return
+	}
+
+	entry := &CacheEntry{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		StoredAt:     time.Now(),
+		Vary:         varyHeaders(resp.Header),
+		key:          cacheKey(method, targetURL),
+	}
+	for _, name := range entry.Vary {
+		entry.Varied = append(entry.Varied, varyValue(header, name))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A response replaces the variant it would have been served from
+	for _, variant := range c.entries[entry.key] {
+		if variant.matches(header) {
+			c.remove(variant)
+			break
+		}
+	}
+	c.entries[entry.key] = append(c.entries[entry.key], entry)
+	c.order = append(c.order, entry)
+
+	// Evict oldest entries
+	for len(c.order) > c.maxEntries {
+		c.remove(c.order[0])
+	}
+}
+
+// remove drops an entry. Callers hold c.mu.
+func (c *ResponseCache) remove(entry *CacheEntry) {
+	variants := c.entries[entry.key]
+	for i, variant := range variants {
+		if variant == entry {
+			variants = append(variants[:i:i], variants[i+1:]...)
+			break
+		}
+	}
+	if len(variants) == 0 {
+		delete(c.entries, entry.key)
+	} else {
+		c.entries[entry.key] = variants
+	}
+
+	for i, stored := range c.order {
+		if stored == entry {
+			c.order = append(c.order[:i:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// matches reports whether the entry answers a request sent with header: the
+// headers the response varies on must have the same values
+func (e *CacheEntry) matches(header http.Header) bool {
+	for i, name := range e.Vary {
+		if varyValue(header, name) != e.Varied[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// varyHeaders returns the request header names a response's Vary lists
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// varyValue normalizes a request header's values for comparison, leaving the
+// header itself as it will be sent
+func varyValue(header http.Header, name string) string {
+	values := make([]string, len(header.Values(name)))
+	for i, value := range header.Values(name) {
+		values[i] = strings.Join(strings.Fields(value), " ")
+	}
+	return strings.Join(values, ", ")
+}
+
+// cacheDirectives returns the directives of a Cache-Control header, in lower
+// case and without their arguments
+func cacheDirectives(header http.Header) map[string]bool {
+	directives := make(map[string]bool)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(directive, "=")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				directives[name] = true
+			}
+		}
+	}
+	return directives
+}
+
+// isStorable reports whether a shared cache may keep the response to a
+// request: not when either says no-store, the response is private or varies
+// on everything, and, for requests with credentials, only when the response
+// allows it explicitly
+func isStorable(reqHeader, respHeader http.Header) bool {
+	request := cacheDirectives(reqHeader)
+	response := cacheDirectives(respHeader)
+	if request["no-store"] || response["no-store"] || response["private"] {
+		return false
+	}
+	for _, name := range varyHeaders(respHeader) {
+		if name == "*" {
+			return false
+		}
+	}
+	if reqHeader.Get("Authorization") != "" {
+		return response["public"] || response["s-maxage"] || response["must-revalidate"]
+	}
+	return true
+}
+
+// isCacheableMethod reports whether responses to the method may be cached
+func isCacheableMethod(method string) bool {
+	return method == http.MethodGet
+}
+
+// addConditionalHeaders sets If-None-Match/If-Modified-Since from a cached entry
+// unless the caller already provided them. Returns true if any header was added.
+func addConditionalHeaders(req *http.Request, entry *CacheEntry) bool {
+	added := false
+
+	if entry.ETag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+		added = true
+	}
+
+	if entry.LastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+		added = true
+	}
+
+	return added
+}
+
+// toResponse builds a response from the cached entry, refreshed with any
+// headers the server sent along with its 304
+func (e *CacheEntry) toResponse(notModified *http.Response) *http.Response {
+	header := e.Header.Clone()
+	for key, values := range notModified.Header {
+		header[key] = values
+	}
+
+	return &http.Response{
+		StatusCode: e.StatusCode,
+		Header:     header,
+	}
+}
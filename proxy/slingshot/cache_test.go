@@ -0,0 +1,173 @@
+package slingshot
+
+import (
+	"net/http"
+	"testing"
+)
+
+// cacheResponse builds a 200 response with the given headers
+func cacheResponse(headers ...string) *http.Response {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header)}
+	for i := 0; i+1 < len(headers); i += 2 {
+		resp.Header.Add(headers[i], headers[i+1])
+	}
+	return resp
+}
+
+// requestHeader builds request headers from name and value pairs
+func requestHeader(headers ...string) http.Header {
+	header := make(http.Header)
+	for i := 0; i+1 < len(headers); i += 2 {
+		header.Add(headers[i], headers[i+1])
+	}
+	return header
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	const target = "https://api.example.com/items"
+	tests := []struct {
+		name   string
+		stored http.Header // Request the cached response answered
+		vary   []string    // Vary values of the response
+		lookup http.Header
+		hit    bool
+	}{
+		{
+			name:   "no vary",
+			stored: requestHeader("Accept", "application/json"),
+			lookup: requestHeader("Accept", "text/html"),
+			hit:    true,
+		},
+		{
+			name:   "same value",
+			stored: requestHeader("Accept", "application/json"),
+			vary:   []string{"Accept"},
+			lookup: requestHeader("Accept", "application/json"),
+			hit:    true,
+		},
+		{
+			name:   "different value",
+			stored: requestHeader("Accept", "application/json"),
+			vary:   []string{"Accept"},
+			lookup: requestHeader("Accept", "text/html"),
+		},
+		{
+			name:   "header missing",
+			stored: requestHeader("Accept-Language", "en"),
+			vary:   []string{"accept-language"},
+			lookup: requestHeader(),
+		},
+		{
+			name:   "whitespace normalized",
+			stored: requestHeader("Accept", "text/html,  application/json"),
+			vary:   []string{"Accept"},
+			lookup: requestHeader("Accept", "text/html, application/json"),
+			hit:    true,
+		},
+		{
+			name:   "several headers in one value",
+			stored: requestHeader("Accept", "text/html", "Accept-Encoding", "gzip"),
+			vary:   []string{"Accept, Accept-Encoding"},
+			lookup: requestHeader("Accept", "text/html", "Accept-Encoding", "br"),
+		},
+		{
+			name:   "several Vary headers",
+			stored: requestHeader("Accept", "text/html", "Accept-Encoding", "gzip"),
+			vary:   []string{"Accept", "Accept-Encoding"},
+			lookup: requestHeader("Accept", "text/html", "Accept-Encoding", "gzip"),
+			hit:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewResponseCache(10)
+			resp := cacheResponse()
+			for _, vary := range test.vary {
+				resp.Header.Add("Vary", vary)
+			}
+			cache.Put("GET", target, test.stored, resp, []byte("cached"))
+
+			if entry := cache.Get("GET", target, test.stored); entry == nil {
+				t.Fatal("The response is not served to the request it answered")
+			}
+			if entry := cache.Get("GET", target, test.lookup); (entry != nil) != test.hit {
+				t.Errorf("Get() hit = %v, want %v", entry != nil, test.hit)
+			}
+		})
+	}
+}
+
+func TestResponseCacheVariants(t *testing.T) {
+	const target = "https://api.example.com/items"
+	cache := NewResponseCache(10)
+	json := requestHeader("Accept", "application/json")
+	html := requestHeader("Accept", "text/html")
+
+	cache.Put("GET", target, json, cacheResponse("Vary", "Accept"), []byte("json"))
+	cache.Put("GET", target, html, cacheResponse("Vary", "Accept"), []byte("html"))
+	cache.Put("GET", target, json, cacheResponse("Vary", "Accept"), []byte("json again"))
+
+	tests := []struct {
+		header http.Header
+		want   string
+	}{
+		{header: json, want: "json again"},
+		{header: html, want: "html"},
+	}
+	for _, test := range tests {
+		entry := cache.Get("GET", target, test.header)
+		if entry == nil || string(entry.Body) != test.want {
+			t.Errorf("Get(Accept: %s) = %v, want %q", test.header.Get("Accept"), entry, test.want)
+		}
+	}
+	if len(cache.order) != 2 {
+		t.Errorf("%d entries stored, want the 2 variants", len(cache.order))
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache := NewResponseCache(2)
+	for _, target := range []string{"https://a.test/", "https://b.test/", "https://c.test/"} {
+		cache.Put("GET", target, requestHeader(), cacheResponse(), []byte(target))
+	}
+
+	tests := []struct {
+		target string
+		kept   bool
+	}{
+		{target: "https://a.test/", kept: false},
+		{target: "https://b.test/", kept: true},
+		{target: "https://c.test/", kept: true},
+	}
+	for _, test := range tests {
+		if entry := cache.Get("GET", test.target, requestHeader()); (entry != nil) != test.kept {
+			t.Errorf("%s kept = %v, want %v", test.target, entry != nil, test.kept)
+		}
+	}
+}
+
+func TestIsStorable(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  http.Header
+		response http.Header
+		want     bool
+	}{
+		{name: "plain", request: requestHeader(), response: requestHeader(), want: true},
+		{name: "request no-store", request: requestHeader("Cache-Control", "no-store"), response: requestHeader()},
+		{name: "response no-store", request: requestHeader(), response: requestHeader("Cache-Control", "max-age=60, No-Store")},
+		{name: "private", request: requestHeader(), response: requestHeader("Cache-Control", "private")},
+		{name: "vary on everything", request: requestHeader(), response: requestHeader("Vary", "Accept, *")},
+		{name: "credentials", request: requestHeader("Authorization", "Bearer token"), response: requestHeader("Cache-Control", "max-age=60")},
+		{name: "credentials public", request: requestHeader("Authorization", "Bearer token"), response: requestHeader("Cache-Control", "public"), want: true},
+		{name: "credentials s-maxage", request: requestHeader("Authorization", "Bearer token"), response: requestHeader("Cache-Control", "s-maxage=60"), want: true},
+		{name: "credentials must-revalidate", request: requestHeader("Authorization", "Bearer token"), response: requestHeader("Cache-Control", "must-revalidate"), want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isStorable(test.request, test.response); got != test.want {
+				t.Errorf("isStorable() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
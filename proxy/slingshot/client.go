@@ -0,0 +1,907 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HTTPClient handles HTTP requests with proper timeout and redirect control
+type HTTPClient struct {
+	client     *http.Client
+	transport  *http.Transport
+	conns      *connCounter
+	cache      *ResponseCache
+	serveStale bool
+	uploadDirs []string
+	scriptDirs []string
+
+	graphQLSchemas *GraphQLSchemaCache
+	protos         *ProtoRegistry
+
+	// Network simulated on requests that do not choose their own profile
+	networkProfile *NetworkProfile
+
+	// Configured request and response transforms
+	transforms *Transforms
+
+	// Headers attached to requests to configured hosts
+	headerProfiles *HeaderProfiles
+
+	// External plugins called before and after each request
+	plugins *Plugins
+
+	// Limits the requests in flight, sending waiting ones by priority
+	queue *RequestQueue
+
+	// Locates the addresses requests connect to
+	geoIP *GeoIP
+}
+
+// NewHTTPClient creates a new HTTP client with sensible defaults
+func NewHTTPClient(config *Config) *HTTPClient {
+	transport := &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     30 * time.Second,
+		// Wait briefly for 100 Continue when a request sends Expect
+		ExpectContinueTimeout: DefaultExpectContinueTimeout,
+		// Never upgrade to HTTP/2; requests may ask for HTTP/1.0 instead
+		Protocols: http1Protocols(),
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: false,
+		},
+	}
+
+	// Count connections for the admin API
+	conns := &connCounter{}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = conns.dial(dialer.DialContext)
+
+	// The profile name was validated when the flags were parsed
+	networkProfile, _ := LookupNetworkProfile(config.NetworkProfile)
+
+	return &HTTPClient{
+		client: &http.Client{
+			Transport: transport,
+			// Don't follow redirects by default - we'll handle this manually
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		transport:  transport,
+		conns:      conns,
+		cache:      NewResponseCache(DefaultCacheEntries),
+		serveStale: config.ServeStale,
+		uploadDirs: config.UploadDirs,
+		scriptDirs: config.ScriptDirs,
+
+		graphQLSchemas: NewGraphQLSchemaCache(),
+		protos:         NewProtoRegistry(config.ProtoDirs),
+		networkProfile: networkProfile,
+		transforms:     NewTransforms(config.TransformsFile),
+		headerProfiles: NewHeaderProfiles(config.HeaderProfilesFile),
+		plugins:        NewPlugins(config.PluginsFile),
+		queue:          NewRequestQueue(config.MaxConcurrent, config.QueueTimeout),
+	}
+}
+
+// ExecuteRequest executes an HTTP request with proper timeout and redirect handling
+func (c *HTTPClient) ExecuteRequest(ctx context.Context, req *ProxyRequest) (*ProxyResponse, error) {
+	return c.execute(ctx, req, nil)
+}
+
+// StreamRequest executes an HTTP request like ExecuteRequest, but hands the
+// response headers and body chunks to stream as they arrive. The returned
+// response carries the final metrics but no body.
+func (c *HTTPClient) StreamRequest(ctx context.Context, req *ProxyRequest, stream ResponseStream) (*ProxyResponse, error) {
+	return c.execute(ctx, req, stream)
+}
+
+// execute runs a request, streaming the response body when stream is set
+func (c *HTTPClient) execute(ctx context.Context, req *ProxyRequest, stream ResponseStream) (*ProxyResponse, error) {
+	// Wait for a slot when the most requests allowed are in flight
+	if err := validatePriority(req.Priority); err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), &RequestMetrics{StartTime: time.Now()}), nil
+	}
+	ctx, release, queued, err := c.queue.acquire(ctx, requestPriority(ctx, req))
+	if err != nil {
+		return c.createErrorResponse(QueueTimeoutError, err.Error(), &RequestMetrics{StartTime: time.Now()}), nil
+	}
+	defer release()
+
+	metrics := &RequestMetrics{
+		StartTime: time.Now(),
+	}
+
+	// Load the scripts up front so a missing file fails before sending
+	if err := validateScriptLanguage(req.ScriptLanguage); err != nil {
+		return c.createErrorResponse(ScriptError, err.Error(), metrics), nil
+	}
+	preScript, err := loadScript(req.PreRequestScript, req.PreRequestScriptFile, c.scriptDirs)
+	if err != nil {
+		return c.createErrorResponse(ScriptError, err.Error(), metrics), nil
+	}
+	postScript, err := loadScript(req.PostResponseScript, req.PostResponseScriptFile, c.scriptDirs)
+	if err != nil {
+		return c.createErrorResponse(ScriptError, err.Error(), metrics), nil
+	}
+
+	// Run the pre-request script, which may change the request
+	var scriptLogs []string
+	if preScript != "" {
+		scriptLogs, err = runPreRequestScript(ctx, req, preScript)
+		if err != nil {
+			response := c.createErrorResponse(ScriptError, err.Error(), metrics)
+			response.ScriptLogs = scriptLogs
+			return response, nil
+		}
+	}
+
+	// Fill in {{name}} placeholders from the environment and template functions
+	substituteVariables(req, req.Environment)
+
+	// Check GraphQL queries against the endpoint's schema before sending
+	if req.ValidateGraphQL {
+		if response := c.checkGraphQLRequest(ctx, req, metrics); response != nil {
+			response.ScriptLogs = scriptLogs
+			return response, nil
+		}
+	}
+
+	// Encode JSON bodies as protobuf or another binary format
+	if req.BodyFormat != "" {
+		if err := c.encodeBody(req); err != nil {
+			response := c.createErrorResponse(BodyEncodingError, err.Error(), metrics)
+			response.ScriptLogs = scriptLogs
+			return response, nil
+		}
+	}
+	if req.ProtoMessage != "" {
+		if err := c.encodeProtoBody(req); err != nil {
+			response := c.createErrorResponse(ProtoError, err.Error(), metrics)
+			response.ScriptLogs = scriptLogs
+			return response, nil
+		}
+	}
+
+	// Apply the configured header and URL transforms
+	transforms, rewrite := c.transforms.applyRequest(req)
+
+	// Convert internationalized hostnames to punycode before validation and dialing
+	asciiURL, unicodeHost, asciiHost, err := toASCIIURL(req.URL)
+	if err != nil {
+		return c.createErrorResponse(URLValidationError, err.Error(), metrics), nil
+	}
+	req.URL = asciiURL
+
+	// Attach the headers configured for the target host
+	profile := c.headerProfiles.apply(req)
+	ctx = withHeaderProfile(ctx, profile)
+
+	// Attach an Idempotency-Key so retried writes are only applied once
+	var idempotencyKey string
+	if req.IdempotencyKey && isIdempotencyKeyMethod(req.Method) {
+		idempotencyKey = ensureIdempotencyKey(req)
+	}
+
+	// Let plugins sign, check or change the request as it will be sent
+	rejected, pluginErrors := c.plugins.beforeRequest(ctx, req)
+	if rejected != nil {
+		response := c.createErrorResponse(rejected, rejected.Message, metrics)
+		response.ScriptLogs = scriptLogs
+		response.PluginErrors = pluginErrors
+		return response, nil
+	}
+
+	// Record the request as it goes out when asked to echo it
+	var sent *sentTrace
+	if req.EchoRequest {
+		ctx, sent = withSentTrace(ctx)
+	}
+
+	// Note the connection used, which failed requests report too
+	ctx, connection := withConnTrace(ctx)
+
+	response, err := c.executeRequest(ctx, req, metrics, stream)
+	if response != nil && response.Success && stream == nil {
+		var decodeErr error
+		if req.ProtoResponseMessage != "" {
+			decodeErr = c.decodeProtoResponse(req, response)
+		} else {
+			decodeErr = c.decodeResponseBody(response)
+		}
+		if decodeErr != nil {
+			response.BodyFormatError = decodeErr.Error()
+		}
+	}
+	if response != nil && asciiHost != "" {
+		response.HostUnicode = unicodeHost
+		response.HostASCII = asciiHost
+	}
+	if response != nil && response.Success && stream == nil && len(req.Assertions) > 0 {
+		response.Assertions = evaluateAssertions(req.Assertions, response, metrics.GetDuration())
+	}
+	if response != nil {
+		if queued > 0 {
+			response.QueueTime = formatMillis(queued)
+		}
+		response.ScriptLogs = scriptLogs
+		if response.Success && stream == nil && postScript != "" {
+			runPostResponseScript(ctx, req, response, metrics.GetDuration(), postScript)
+		}
+		response.IdempotencyKey = idempotencyKey
+		if req.Retries > 0 {
+			response.Attempts = metrics.Attempts
+		}
+
+		// A streamed body was already sent, but plugins still hear of failures
+		response.PluginErrors = pluginErrors
+		if stream == nil || !response.Success {
+			c.plugins.afterResponse(ctx, req, response)
+		}
+
+		// Body transforms apply to what the caller gets, not what scripts saw
+		if stream == nil {
+			transforms = append(transforms, c.transforms.applyResponse(req, response)...)
+		}
+		response.Transforms = transforms
+		response.URLRewrite = rewrite
+		if profile != nil {
+			response.HeaderProfile = profile.Name
+		}
+		if sent != nil {
+			sent.annotate(req, response)
+		}
+		connection.annotate(response, c.conns)
+		c.geoIP.annotate(response)
+
+		// Assertions and scripts saw every header; the caller gets the filtered set
+		newResponseHeaderFilter(req).apply(response)
+	}
+
+	return response, err
+}
+
+// executeRequest performs the request once the URL has been normalized
+func (c *HTTPClient) executeRequest(ctx context.Context, req *ProxyRequest, metrics *RequestMetrics, stream ResponseStream) (*ProxyResponse, error) {
+	// Validate URL
+	if err := c.validateURL(req.URL); err != nil {
+		return c.createErrorResponse(URLValidationError, err.Error(), metrics), nil
+	}
+
+	// Only send to hosts the caller's API key allows
+	if err := checkTargetURL(ctx, req.URL); err != nil {
+		return c.createErrorResponse(HostNotAllowedError, err.Error(), metrics), nil
+	}
+
+	// Validate method
+	if err := c.validateMethod(req.Method); err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Validate download budgets
+	if err := validateDownloadBudget(req); err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Validate retries
+	if err := validateRetries(req); err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Validate HTTP version
+	if err := validateHTTPVersion(req); err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Validate TLS options
+	tlsConfig, err := requestTLSConfig(req)
+	if err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Validate assertions
+	if err := validateAssertions(req.Assertions); err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Validate bandwidth limits
+	uploadRate, downloadRate, err := throttleRates(req)
+	if err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Resolve the simulated network; its bandwidth applies unless the
+	// request sets its own limits
+	profile := c.networkProfile
+	if req.NetworkProfile != "" {
+		if profile, err = LookupNetworkProfile(req.NetworkProfile); err != nil {
+			return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+		}
+	}
+	if profile != nil {
+		if uploadRate == 0 {
+			uploadRate = int64(profile.UploadKbps) * 1000 / 8
+		}
+		if downloadRate == 0 {
+			downloadRate = int64(profile.DownloadKbps) * 1000 / 8
+		}
+	}
+
+	// Validate range
+	var requestedRange *byteRange
+	if req.Range != "" {
+		var err error
+		if requestedRange, err = parseRangeHeader(req.Range); err != nil {
+			return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+		}
+	}
+
+	// Parse headers, dropping hop-by-hop headers unless explicitly overridden
+	headers := c.parseHeaders(req.Headers)
+	overrides := headerOverrideSet(req.HeaderOverrides)
+	removeHopByHopHeaders(headers, overrides)
+	removeReservedHeaders(headers, overrides)
+
+	// Build request body
+	requestBody, contentLength, bodyContentType, err := c.buildRequestBody(req)
+	if err != nil {
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, requestBody)
+	if err != nil {
+		closeBody(requestBody)
+		return c.createErrorResponse(URLValidationError, fmt.Sprintf("Failed to create request: %v", err), metrics), nil
+	}
+	httpReq.ContentLength = contentLength
+	if contentLength == 0 {
+		closeBody(requestBody)
+		httpReq.Body = http.NoBody
+		httpReq.GetBody = nil
+	}
+
+	// Set headers
+	for key, values := range headers {
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+
+	// Ask for part of the resource
+	if requestedRange != nil {
+		httpReq.Header.Set("Range", req.Range)
+	}
+
+	// Multipart bodies need the generated boundary in their Content-Type
+	if bodyContentType != "" {
+		httpReq.Header.Set("Content-Type", bodyContentType)
+	}
+
+	// Set default User-Agent if not provided
+	if httpReq.Header.Get("User-Agent") == "" {
+    httpReq.Header.Set("User-Agent", fmt.Sprintf("rb-slingshot/%s (https://requestbite.com/slingshot)", Version))
+	}
+
+	// Send the body with chunked encoding instead of a Content-Length
+	if req.Chunked && contentLength > 0 {
+		useChunkedEncoding(httpReq, req.ChunkSize)
+	} else if contentLength > 0 {
+		// Set Content-Length for any request with a body
+		httpReq.Header.Set("Content-Length", fmt.Sprintf("%d", contentLength))
+	}
+
+	// Apply Host, Content-Length and Transfer-Encoding overrides
+	if err := applyHeaderOverrides(httpReq, headers, overrides, req.ChunkSize); err != nil {
+		closeBody(httpReq.Body)
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+
+	// Send the body no faster than the upload limit
+	if uploadRate > 0 && contentLength != 0 {
+		throttleRequestBody(httpReq, uploadRate)
+	}
+
+	// Report upload progress to streams that want it
+	if progress, ok := stream.(ProgressStream); ok && contentLength > 0 {
+		trackUploadProgress(httpReq, contentLength, progress)
+	}
+
+	// Revalidate a cached response if we hold validators for it
+	var cached *CacheEntry
+	conditional := false
+	useCache := (req.Cache || c.serveStale) && isCacheableMethod(req.Method) && stream == nil
+	if useCache {
+		cached = c.cache.Get(req.Method, req.URL, httpReq.Header)
+		if cached != nil && cached.HasValidators() {
+			conditional = addConditionalHeaders(httpReq, cached)
+		}
+	}
+
+	// Handle redirects based on followRedirects and redirectMethod settings
+	policy, err := newRedirectPolicy(req)
+	if err != nil {
+		closeBody(httpReq.Body)
+		return c.createErrorResponse(RequestFormatError, err.Error(), metrics), nil
+	}
+	followRedirects := policy.follow
+
+	// Receive the exact bytes the server sends when decoding is disabled
+	if req.DecodeBody != nil && !*req.DecodeBody {
+		requestRawEncoding(httpReq)
+	}
+
+	// Ask the server to confirm before the body is sent
+	if req.ExpectContinue && contentLength != 0 {
+		httpReq.Header.Set("Expect", "100-continue")
+	}
+	var expectTrace *continueTrace
+	if strings.EqualFold(httpReq.Header.Get("Expect"), "100-continue") {
+		expectTrace = &continueTrace{}
+		httpReq = expectTrace.trace(httpReq)
+	}
+
+	// Send headers verbatim and in order when requested, and HTTP/1.0
+	// requests, which Go's transport cannot write
+	var transport http.RoundTripper
+	if req.PreserveHeaders {
+		transport = &orderedHeaderTransport{fields: parseHeaderFields(req.Headers), overrides: overrides, proto: httpVersions[req.HTTPVersion], tlsConfig: tlsConfig, fingerprint: req.TLSFingerprint}
+	} else if req.HTTPVersion == "1.0" {
+		transport = &orderedHeaderTransport{overrides: overrides, proto: httpVersions[req.HTTPVersion], tlsConfig: tlsConfig, fingerprint: req.TLSFingerprint}
+	} else if req.TLSFingerprint != "" {
+		// Handshakes that imitate a browser are not shared either
+		custom := newFingerprintTransport(c.transport, tlsConfig, req.TLSFingerprint)
+		defer custom.CloseIdleConnections()
+		transport = custom
+	} else if tlsConfig != nil {
+		// Connections with the request's own TLS settings are not shared
+		custom := c.transport.Clone()
+		custom.TLSClientConfig = tlsConfig
+		defer custom.CloseIdleConnections()
+		transport = custom
+	}
+
+	// Wait out the simulated network latency before sending
+	var latency time.Duration
+	if profile != nil {
+		if latency, err = profile.simulateLatency(ctx); err != nil {
+			closeBody(httpReq.Body)
+			if err == context.DeadlineExceeded {
+				return c.createErrorResponse(TimeoutError, "The server took too long to respond.", metrics), nil
+			}
+			return c.createNetworkErrorResponse(fmt.Sprintf("Failed to connect to server: %v", err), err, metrics), nil
+		}
+	}
+
+	// Execute request with potential redirect handling and retries
+	resp, redirectChain, err := c.executeWithRetries(ctx, httpReq, req.Retries, policy, transport, metrics)
+	if err != nil {
+		// Fall back to a stale cached copy if the upstream is unreachable
+		if c.serveStale && cached != nil && !isRedirectError(err) {
+			return c.staleResponse(cached, metrics), nil
+		}
+
+		if ctx.Err() == context.DeadlineExceeded {
+			return c.createErrorResponse(TimeoutError, "The server took too long to respond.", metrics), nil
+		}
+		
+		// A redirect that needs the streamed body sent again can't be followed
+		var bodyErr *redirectBodyError
+		if errors.As(err, &bodyErr) {
+			return c.createErrorResponse(RedirectNotFollowedError, bodyErr.Error(), metrics), nil
+		}
+
+		// Check if this is a redirect error when redirects are disabled
+		if isRedirectError(err) && !followRedirects {
+			return c.createErrorResponse(RedirectNotFollowedError, "Server attempted to redirect but followRedirects is disabled.", metrics), nil
+		}
+		
+		return c.createNetworkErrorResponse(fmt.Sprintf("Failed to connect to server: %v", err), err, metrics), nil
+	}
+
+	defer resp.Body.Close()
+	metrics.EndTime = time.Now()
+
+	// Check for redirects when follow_redirects is false
+	if !followRedirects && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return c.createErrorResponse(RedirectNotFollowedError, 
+			fmt.Sprintf("Server returned %d redirect but following redirects is disabled. Please check your settings.", resp.StatusCode), 
+			metrics), nil
+	}
+
+	// Read response body, unless the response cannot have one (HEAD, 204, 304)
+	var body []byte
+	bodyless := !responseHasBody(httpReq.Method, resp.StatusCode)
+	reset := false
+	if !bodyless && profile != nil {
+		reset = profile.simulateReset(resp)
+	}
+	if !bodyless && downloadRate > 0 {
+		resp.Body = newThrottledReader(resp.Body, downloadRate)
+	}
+	if !bodyless && (req.MaxDownloadBytes > 0 || req.MaxDownloadSeconds > 0) {
+		resp.Body = newBudgetReader(resp.Body, req)
+		defer resp.Body.Close()
+	}
+	if stream != nil {
+		response := c.streamResponse(resp, bodyless, redirectChain, metrics, stream, newResponseHeaderFilter(req))
+		profile.annotate(response, latency, reset)
+		return response, nil
+	}
+	if !bodyless {
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			response := c.createNetworkErrorResponse(fmt.Sprintf("Failed to read response: %v", err), err, metrics)
+			profile.annotate(response, latency, reset)
+			return response, nil
+		}
+	}
+
+	// Serve the cached body when the server confirms it is still valid
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		metrics.ResponseSize = int64(len(cached.Body))
+		response := c.processResponse(cached.toResponse(resp), cached.Body, metrics)
+		response.Cached = true
+		response.Revalidated = true
+		if expectTrace != nil {
+			expectTrace.annotate(response)
+		}
+		return response, nil
+	}
+
+	if useCache && resp.StatusCode == http.StatusOK && !isPartial(resp) {
+		c.cache.Put(req.Method, req.URL, httpReq.Header, resp, body)
+	}
+
+	metrics.ResponseSize = int64(len(body))
+
+	// Process response
+	response := c.processResponse(resp, body, metrics)
+	response.RedirectChain = redirectChain
+	reportContentEncoding(resp, body, response)
+	markPartial(resp, response)
+	if requestedRange != nil {
+		bodyLength := int64(len(body))
+		if response.Partial {
+			bodyLength = -1
+		}
+		reportRange(resp, requestedRange, bodyLength, response)
+	}
+	if bodyless {
+		describeBodylessResponse(resp, response)
+	}
+	if expectTrace != nil {
+		expectTrace.annotate(response)
+	}
+	profile.annotate(response, latency, reset)
+	return response, nil
+}
+
+// executeWithRedirects handles the request execution with manual redirect control
+// on a per-request copy of the client. A nil transport uses the shared one.
+func (c *HTTPClient) executeWithRedirects(ctx context.Context, req *http.Request, policy *redirectPolicy, transport http.RoundTripper, metrics *RequestMetrics) (*http.Response, []RedirectHop, error) {
+	client := *c.client
+	if transport != nil {
+		client.Transport = transport
+	}
+
+	return c.followRedirects(&client, req, policy)
+}
+
+// isRedirectError reports whether a client error was caused by redirect handling
+func isRedirectError(err error) bool {
+	return strings.Contains(err.Error(), "redirect")
+}
+
+// staleResponse serves a cached entry when the upstream could not be reached
+func (c *HTTPClient) staleResponse(entry *CacheEntry, metrics *RequestMetrics) *ProxyResponse {
+	metrics.EndTime = time.Now()
+	metrics.ResponseSize = int64(len(entry.Body))
+
+	response := c.processResponse(entry.toResponse(&http.Response{}), entry.Body, metrics)
+	response.Cached = true
+	response.Stale = true
+	return response
+}
+
+// validateURL validates the URL format and scheme
+func (c *HTTPClient) validateURL(urlStr string) error {
+	if urlStr == "" {
+		return fmt.Errorf("URL is required")
+	}
+
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return fmt.Errorf("Invalid URL format")
+	}
+
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("Invalid URL format")
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("Only HTTP and HTTPS schemes are supported")
+	}
+
+	return nil
+}
+
+// validateMethod checks that the method is a valid RFC 7230 token. Any token
+// is accepted, so extension methods such as PROPFIND, PURGE or REPORT work.
+func (c *HTTPClient) validateMethod(method string) error {
+	if method == "" {
+		return fmt.Errorf("HTTP method is required")
+	}
+
+	for i := 0; i < len(method); i++ {
+		if !isTokenChar(method[i]) {
+			return fmt.Errorf("Invalid HTTP method %q: methods may only contain letters, digits and !#$%%&'*+-.^_`|~", method)
+		}
+	}
+
+	return nil
+}
+
+// isTokenChar reports whether ch is an RFC 7230 tchar
+func isTokenChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+		strings.IndexByte("!#$%&'*+-.^_`|~", ch) >= 0
+}
+
+// parseHeaders converts header array to http.Header, keeping repeated headers
+func (c *HTTPClient) parseHeaders(headerArray []string) http.Header {
+	headers := make(http.Header)
+	for _, field := range parseHeaderFields(headerArray) {
+		headers.Add(field.Name, field.Value)
+	}
+	return headers
+}
+
+// processResponse converts HTTP response to ProxyResponse format
+func (c *HTTPClient) processResponse(resp *http.Response, body []byte, metrics *RequestMetrics) *ProxyResponse {
+	// Convert headers to map, leaving out hop-by-hop headers
+	header := resp.Header.Clone()
+	removeHopByHopHeaders(header, nil)
+	responseHeaders := make(map[string]string)
+	for key, values := range header {
+		if len(values) > 0 {
+			responseHeaders[strings.ToLower(key)] = values[0]
+		}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	isBinary := c.isBinaryContent(contentType, body)
+	
+	responseData := string(body)
+	if isBinary {
+		responseData = base64.StdEncoding.EncodeToString(body)
+	}
+
+	response := &ProxyResponse{
+		Success:           true,
+		ResponseStatus:    resp.StatusCode,
+		ResponseHeaders:   responseHeaders,
+		ResponseData:      responseData,
+		ResponseSize:      metrics.FormatSize(),
+		ResponseTime:      metrics.FormatDuration(),
+		ResponseSizeBytes: metrics.ResponseSize,
+		ResponseTimeMs:    metrics.GetDuration(),
+		ContentType:       contentType,
+		IsBinary:          isBinary,
+		HTTPVersion:       resp.Proto,
+		Cancelled:         false,
+	}
+	reportTLS(resp.TLS, response)
+	return response
+}
+
+// responseHasBody reports whether a response to the method may carry a body
+func responseHasBody(method string, statusCode int) bool {
+	if method == http.MethodHead {
+		return false
+	}
+	if statusCode >= 100 && statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		return false
+	}
+	return true
+}
+
+// describeBodylessResponse reports the size the server declared for a
+// response without a body, such as the resource size in a HEAD response
+func describeBodylessResponse(resp *http.Response, response *ProxyResponse) {
+	response.BodyOmitted = true
+
+	declared := resp.ContentLength
+	if declared < 0 {
+		return
+	}
+
+	response.DeclaredSize = formatSize(declared)
+	response.DeclaredLength = declared
+	if _, ok := response.ResponseHeaders["content-length"]; !ok {
+		response.ResponseHeaders["content-length"] = fmt.Sprintf("%d", declared)
+	}
+}
+
+// isBinaryContent determines if a response body is binary by sniffing it, so
+// missing or mislabeled content types don't matter. Only bodies that are valid
+// UTF-8 are returned as text, as anything else would not survive the JSON
+// response. Without a body, as when streaming, the Content-Type decides.
+func (c *HTTPClient) isBinaryContent(contentType string, body []byte) bool {
+	if body == nil {
+		return isBinaryContentType(contentType)
+	}
+	return isBinaryBody(body)
+}
+
+// isBinaryBody sniffs whether a body is binary, as isBinaryContent does
+func isBinaryBody(body []byte) bool {
+	if len(body) == 0 {
+		return false
+	}
+
+	sniffed := http.DetectContentType(body)
+	if strings.HasPrefix(sniffed, "text/") {
+		return !utf8.Valid(body)
+	}
+	if sniffed != "application/octet-stream" {
+		// A recognized binary format such as an image, archive or PDF
+		return true
+	}
+	// Control characters made the sniffer give up; text may still contain
+	// some, such as terminal escape codes
+	return !utf8.Valid(body) || bytes.IndexByte(body, 0) >= 0
+}
+
+// isBinaryContentType determines if content is binary based on Content-Type
+func isBinaryContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+
+	binaryTypes := []string{
+		"image/",
+		"video/",
+		"audio/",
+		"application/pdf",
+		"application/zip",
+		"application/octet-stream",
+		"application/protobuf",
+		"application/msgpack",
+		"application/cbor",
+		"application/msword",
+		"application/vnd.",
+		"application/x-",
+		"font/",
+	}
+
+	contentTypeLower := strings.ToLower(contentType)
+	for _, binaryType := range binaryTypes {
+		if strings.Contains(contentTypeLower, binaryType) {
+			return true
+		}
+	}
+	
+	return false
+}
+
+// createErrorResponse creates a standardized error response
+func (c *HTTPClient) createErrorResponse(errType *ProxyError, message string, metrics *RequestMetrics) *ProxyResponse {
+	metrics.EndTime = time.Now()
+	
+	return &ProxyResponse{
+		Success:        false,
+		ErrorType:      errType.Type,
+		ErrorTitle:     errType.Title,
+		ErrorMessage:   message,
+		ResponseTime:   metrics.FormatDuration(),
+		ResponseTimeMs: metrics.GetDuration(),
+		Cancelled:      false,
+	}
+}
+
+// createNetworkErrorResponse creates the error response for a request that
+// failed on the network, typed by what went wrong and listing its causes
+func (c *HTTPClient) createNetworkErrorResponse(message string, err error, metrics *RequestMetrics) *ProxyResponse {
+	response := c.createErrorResponse(networkErrorType(err), message, metrics)
+	response.ErrorCauses = errorCauses(err)
+	return response
+}
+
+// substitutePathParams replaces :param patterns in URL with actual values,
+// encoded per parameter as set in encodings (path-segment escaping by default)
+func (c *HTTPClient) substitutePathParams(targetURL string, pathParams map[string]string, encodings map[string]string) (string, error) {
+	if pathParams == nil {
+		return targetURL, nil
+	}
+
+	// Normalize encoding keys so both "id" and ":id" work
+	paramEncodings := make(map[string]string)
+	for paramName, encoding := range encodings {
+		paramEncodings[strings.TrimPrefix(paramName, ":")] = encoding
+	}
+
+	resultURL := targetURL
+	for paramName, paramValue := range pathParams {
+		// Remove leading colon from param name if present, then add it back
+		cleanParamName := strings.TrimPrefix(paramName, ":")
+		pattern := ":" + cleanParamName
+		
+		// URL encode the parameter value
+		encodedValue, err := encodePathParam(paramValue, paramEncodings[cleanParamName])
+		if err != nil {
+			return "", err
+		}
+		
+		// Replace all occurrences
+		resultURL = strings.ReplaceAll(resultURL, pattern, encodedValue)
+	}
+	
+	return resultURL, nil
+}
+
+// ExecuteFormRequest executes a form-based request
+func (c *HTTPClient) ExecuteFormRequest(ctx context.Context, queryParams *FormProxyRequest, formData map[string]string) (*ProxyResponse, error) {
+
+	// Build the actual ProxyRequest from form parameters
+	req := &ProxyRequest{
+		Method:          queryParams.Method,
+		URL:             queryParams.URL,
+		Timeout:         queryParams.Timeout,
+		FollowRedirects: queryParams.FollowRedirects,
+	}
+
+	// Parse headers if provided
+	if queryParams.Headers != "" {
+		headers := strings.Split(queryParams.Headers, ",")
+		for _, header := range headers {
+			trimmed := strings.TrimSpace(header)
+			if trimmed != "" {
+				req.Headers = append(req.Headers, trimmed)
+			}
+		}
+	}
+
+	// Substitute path parameters, given as a JSON object as in /proxy/request
+	if queryParams.PathParams != "" {
+		var pathParams map[string]string
+		if err := json.Unmarshal([]byte(queryParams.PathParams), &pathParams); err != nil {
+			return c.createErrorResponse(RequestFormatError, fmt.Sprintf("path_params must be a JSON object of strings: %v", err), &RequestMetrics{StartTime: time.Now()}), nil
+		}
+		substituted, err := c.substitutePathParams(req.URL, pathParams, nil)
+		if err != nil {
+			return c.createErrorResponse(RequestFormatError, err.Error(), &RequestMetrics{StartTime: time.Now()}), nil
+		}
+		req.URL = substituted
+	}
+
+	// Set content type and build body based on form data
+	if len(queryParams.RawBody) > 0 {
+		// Use raw body for multipart/form-data (preserves boundaries and files)
+		req.Body = string(queryParams.RawBody)
+		req.Headers = append(req.Headers, "Content-Type: "+queryParams.ContentType)
+	} else if queryParams.ContentType == "application/x-www-form-urlencoded" {
+		// Build URL-encoded body from form data
+		values := url.Values{}
+		for key, value := range formData {
+			values.Set(key, value)
+		}
+		req.Body = values.Encode()
+		req.Headers = append(req.Headers, "Content-Type: application/x-www-form-urlencoded")
+	}
+
+	return c.ExecuteRequest(ctx, req)
+}
@@ -0,0 +1,695 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cluster timings: instances announce themselves every clusterHeartbeat and
+// are forgotten when they missed a few
+const (
+	clusterHeartbeat   = 10 * time.Second
+	clusterInstanceTTL = 30 * time.Second
+	clusterPeerTimeout = 5 * time.Second
+)
+
+// Redis keys of the cluster state: the live proxies, rate limit windows,
+// the API keys by ID with their IDs by key hash and the IDs of revoked keys,
+// and the requests captured in each webhook bucket, announced on a channel
+const (
+	clusterInstancesKey      = "slingshot:cluster:instances"
+	clusterInstanceKeyPrefix = "slingshot:cluster:instance:"
+	clusterRateKeyPrefix     = "slingshot:cluster:rate:"
+	clusterKeysKey           = "slingshot:cluster:keys"
+	clusterKeyHashesKey      = "slingshot:cluster:key-hashes"
+	clusterRevokedKeysKey    = "slingshot:cluster:keys-revoked"
+	clusterHookKeyPrefix     = "slingshot:cluster:hooks:"
+	clusterHooksChannel      = "slingshot:cluster:hooks"
+)
+
+// ClusterHopHeader marks requests one proxy forwards to another, which
+// answers them itself instead of forwarding them again
+const ClusterHopHeader = "X-Slingshot-Cluster-Hop"
+
+// Kinds of what one proxy holds, which keep their IDs apart in the cluster
+const (
+	clusterSessionWebSocket   = "ws"
+	clusterSessionEventSource = "sse"
+	clusterSchedule           = "schedule"
+	clusterMonitor            = "monitor"
+	clusterDeadLetter         = "deadletter"
+)
+
+// clusterPath finds what a path is about: one of clusterPathKinds, and its ID
+var clusterPath = regexp.MustCompile(`^/(ws/sessions|sse/sessions|proxy/schedules|monitors|proxy/deadletters)/([^/]+)(?:/|$)`)
+
+// clusterPathKinds gives the kind of the IDs under each path clusterPath finds
+var clusterPathKinds = map[string]string{
+	"ws/sessions":       clusterSessionWebSocket,
+	"sse/sessions":      clusterSessionEventSource,
+	"proxy/schedules":   clusterSchedule,
+	"monitors":          clusterMonitor,
+	"proxy/deadletters": clusterDeadLetter,
+}
+
+// clusterLookupAPIKey returns the record of the key whose hash is ARGV[1]
+var clusterLookupAPIKey = redis.NewScript(`
+local id = redis.call('HGET', KEYS[2], ARGV[1])
+if not id then
+	return false
+end
+return redis.call('HGET', KEYS[1], id)
+`)
+
+// clusterImportAPIKey adds the key ARGV[1], with hash ARGV[2] and record
+// ARGV[3], unless it is known or was revoked
+var clusterImportAPIKey = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[3], ARGV[1]) == 1 then
+	return 0
+end
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[3]) == 1 then
+	redis.call('HSET', KEYS[2], ARGV[2], ARGV[1])
+end
+return 1
+`)
+
+// clusterRevokeAPIKey deletes the key ARGV[1] and records it as revoked,
+// returning 1 if it was known
+var clusterRevokeAPIKey = redis.NewScript(`
+redis.call('SADD', KEYS[3], ARGV[1])
+local record = redis.call('HGET', KEYS[1], ARGV[1])
+if not record then
+	return 0
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], cjson.decode(record)['hash'])
+return 1
+`)
+
+// ClusterInstance is one proxy of the cluster
+type ClusterInstance struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	StartedAt time.Time `json:"started_at"`
+	Self      bool      `json:"self,omitempty"`
+}
+
+// AdminClusterResponse is returned by GET /admin/cluster
+type AdminClusterResponse struct {
+	Success   bool               `json:"success"`
+	Instance  string             `json:"instance"`
+	Instances []*ClusterInstance `json:"instances"`
+}
+
+// Cluster lets several proxies behind a load balancer share their state
+// through Redis: API keys are kept and rate limits counted there, webhook
+// captures reach every proxy, sessions are reached through the proxy holding
+// their connection, each schedule and monitor runs on one proxy and lists
+// span every proxy. Methods on a nil Cluster do nothing, for proxies running
+// alone.
+type Cluster struct {
+	self     ClusterInstance
+	redis    *redis.Client
+	sessions SessionStorage // Which proxy holds each session, schedule, monitor and dead letter
+	client   *http.Client
+	logger   *log.Logger
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewCluster joins the cluster sharing the Redis server at clusterURL,
+// announcing that this proxy is reachable at advertise
+func NewCluster(clusterURL, advertise string, logger *log.Logger) (*Cluster, error) {
+	parsed, err := url.Parse(clusterURL)
+	if err != nil || (parsed.Scheme != "redis" && parsed.Scheme != "rediss") {
+		return nil, fmt.Errorf("Invalid cluster %q; use a redis:// or rediss:// URL", clusterURL)
+	}
+	if _, err := url.ParseRequestURI(advertise); err != nil || !strings.HasPrefix(advertise, "http") {
+		return nil, fmt.Errorf("Invalid cluster address %q; use the URL other proxies reach this one at, e.g. http://10.0.0.5:8080", advertise)
+	}
+	client, err := openRedis(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cluster{
+		self: ClusterInstance{
+			ID:        newRequestID()[:12],
+			URL:       strings.TrimSuffix(advertise, "/"),
+			StartedAt: time.Now().UTC(),
+		},
+		redis:    client,
+		sessions: &redisSessions{client: client},
+		client:   &http.Client{Timeout: clusterPeerTimeout},
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Start announces the proxy to the others and keeps announcing it
+func (c *Cluster) Start() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.announce(); err != nil {
+		return err
+	}
+	c.logger.Printf("Joined cluster as %s at %s", c.self.ID, c.self.URL)
+
+	go func() {
+		ticker := time.NewTicker(clusterHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				if err := c.announce(); err != nil {
+					c.logger.Printf("Failed to announce to the cluster: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop leaves the cluster
+func (c *Cluster) Stop() {
+	if c == nil {
+		return
+	}
+	c.once.Do(func() {
+		close(c.stop)
+		ctx, cancel := redisContext()
+		defer cancel()
+		c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, clusterInstanceKeyPrefix+c.self.ID)
+			pipe.SRem(ctx, clusterInstancesKey, c.self.ID)
+			return nil
+		})
+	})
+}
+
+// announce records the proxy as alive for another clusterInstanceTTL
+func (c *Cluster) announce() error {
+	record, err := json.Marshal(c.self)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := redisContext()
+	defer cancel()
+	_, err = c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, clusterInstanceKeyPrefix+c.self.ID, record, clusterInstanceTTL)
+		pipe.SAdd(ctx, clusterInstancesKey, c.self.ID)
+		return nil
+	})
+	return err
+}
+
+// Instances lists the live proxies, oldest first, forgetting those that
+// stopped announcing themselves
+func (c *Cluster) Instances() ([]*ClusterInstance, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	ids, err := c.redis.SMembers(ctx, clusterInstancesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = clusterInstanceKeyPrefix + id
+	}
+	records, err := c.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []*ClusterInstance{}
+	for i, record := range records {
+		record, ok := record.(string)
+		if !ok {
+			c.redis.SRem(ctx, clusterInstancesKey, ids[i])
+			continue
+		}
+		var instance ClusterInstance
+		if err := json.Unmarshal([]byte(record), &instance); err != nil {
+			continue
+		}
+		instance.Self = instance.ID == c.self.ID
+		instances = append(instances, &instance)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].StartedAt.Before(instances[j].StartedAt)
+	})
+	return instances, nil
+}
+
+// instance returns a live proxy, or nil if it is gone
+func (c *Cluster) instance(id string) (*ClusterInstance, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	record, err := c.redis.Get(ctx, clusterInstanceKeyPrefix+id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var instance ClusterInstance
+	if err := json.Unmarshal([]byte(record), &instance); err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// ClaimSession records that this proxy holds a session, failing when a live
+// proxy already holds one with that ID
+func (c *Cluster) ClaimSession(kind, id string) error {
+	if c == nil {
+		return nil
+	}
+	owner, err := c.claim(kind, id)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		return fmt.Errorf("A session named %s already exists on %s", id, owner.URL)
+	}
+	return nil
+}
+
+// ReleaseSession forgets that this proxy holds a session
+func (c *Cluster) ReleaseSession(kind, id string) {
+	c.release(kind, id)
+}
+
+// claim records that this proxy holds an ID unless a live proxy already
+// does, taking it over from a proxy that is gone. It returns the live proxy
+// holding the ID, or nil once this one does.
+func (c *Cluster) claim(kind, id string) (*ClusterInstance, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		holder, err := c.sessions.Claim(kind, id, c.self.ID)
+		if err != nil {
+			return nil, err
+		}
+		if holder == c.self.ID {
+			return nil, nil
+		}
+
+		owner, err := c.sessionOwner(kind, id)
+		if err != nil || owner != nil {
+			return owner, err
+		}
+	}
+	return nil, fmt.Errorf("%s %s is being claimed by another proxy", kind, id)
+}
+
+// holds reports whether this proxy holds an ID, claiming it unless a live
+// proxy does. A proxy that cannot reach the cluster assumes it holds it, so
+// schedules and monitors keep running through a Redis outage.
+func (c *Cluster) holds(kind, id string) bool {
+	if c == nil {
+		return true
+	}
+	owner, err := c.claim(kind, id)
+	if err != nil {
+		c.logger.Printf("Failed to claim %s %s in the cluster: %v", kind, id, err)
+		return true
+	}
+	return owner == nil
+}
+
+// release forgets that this proxy holds an ID
+func (c *Cluster) release(kind, id string) {
+	if c == nil {
+		return
+	}
+	if err := c.sessions.Release(kind, id, c.self.ID); err != nil {
+		c.logger.Printf("Failed to release %s %s in the cluster: %v", kind, id, err)
+	}
+}
+
+// sessionOwner returns the live proxy holding an ID, or nil when no live
+// proxy does, forgetting the IDs held by proxies that are gone
+func (c *Cluster) sessionOwner(kind, id string) (*ClusterInstance, error) {
+	holder, err := c.sessions.Holder(kind, id)
+	if err != nil || holder == "" {
+		return nil, err
+	}
+	instance, err := c.instance(holder)
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil {
+		c.sessions.Release(kind, id, holder)
+	}
+	return instance, nil
+}
+
+// take counts a request against a rate limit shared by every proxy, in
+// windows of a minute, returning how long to wait when it is exhausted
+func (c *Cluster) take(keyID string, limit int) (time.Duration, error) {
+	now := time.Now()
+	window := now.Truncate(time.Minute)
+	key := clusterRateKeyPrefix + keyID + ":" + strconv.FormatInt(window.Unix(), 10)
+
+	ctx, cancel := redisContext()
+	defer cancel()
+	var incr *redis.IntCmd
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, 2*time.Minute)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if incr.Val() > int64(limit) {
+		return window.Add(time.Minute).Sub(now), nil
+	}
+	return 0, nil
+}
+
+// remaining returns the requests left in the current window of a shared
+// rate limit
+func (c *Cluster) remaining(keyID string, limit int) (int, error) {
+	key := clusterRateKeyPrefix + keyID + ":" + strconv.FormatInt(time.Now().Truncate(time.Minute).Unix(), 10)
+	ctx, cancel := redisContext()
+	defer cancel()
+	used, err := c.redis.Get(ctx, key).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	if used > limit {
+		return 0, nil
+	}
+	return limit - used, nil
+}
+
+// putAPIKey shares a key with every proxy
+func (c *Cluster) putAPIKey(key *APIKey) error {
+	stored := *key
+	stored.Usage = APIKeyUsage{}
+	record, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := redisContext()
+	defer cancel()
+	_, err = c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, clusterKeysKey, key.ID, record)
+		pipe.HSet(ctx, clusterKeyHashesKey, key.Hash, key.ID)
+		return nil
+	})
+	return err
+}
+
+// importAPIKey shares a key loaded from a file unless it is shared already
+// or was revoked meanwhile
+func (c *Cluster) importAPIKey(key *APIKey) error {
+	stored := *key
+	stored.Usage = APIKeyUsage{}
+	record, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := redisContext()
+	defer cancel()
+	return clusterImportAPIKey.Run(ctx, c.redis, []string{clusterKeysKey, clusterKeyHashesKey, clusterRevokedKeysKey},
+		key.ID, key.Hash, record).Err()
+}
+
+// revokeAPIKey deletes a key on every proxy, reporting whether it was shared
+func (c *Cluster) revokeAPIKey(id string) (bool, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	revoked, err := clusterRevokeAPIKey.Run(ctx, c.redis, []string{clusterKeysKey, clusterKeyHashesKey, clusterRevokedKeysKey}, id).Int()
+	return revoked == 1, err
+}
+
+// lookupAPIKey returns the shared key with a hash, or nil if there is none
+func (c *Cluster) lookupAPIKey(hash string) (*APIKey, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	record, err := clusterLookupAPIKey.Run(ctx, c.redis, []string{clusterKeysKey, clusterKeyHashesKey}, hash).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var key APIKey
+	if err := json.Unmarshal([]byte(record), &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// apiKeys returns every shared key
+func (c *Cluster) apiKeys() ([]*APIKey, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	records, err := c.redis.HGetAll(ctx, clusterKeysKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*APIKey, 0, len(records))
+	for id, record := range records {
+		var key APIKey
+		if err := json.Unmarshal([]byte(record), &key); err != nil {
+			c.logger.Printf("Skipping API key %s: %v", id, err)
+			continue
+		}
+		keys = append(keys, &key)
+	}
+	return keys, nil
+}
+
+// addHook keeps a captured request in its bucket, dropping the oldest
+// beyond MaxHookRequests, and announces it to every proxy. Buckets expire
+// after HookBucketIdleTime without captures or reads.
+func (c *Cluster) addHook(captured *CapturedRequest) error {
+	record, err := json.Marshal(captured)
+	if err != nil {
+		return err
+	}
+	key := clusterHookKeyPrefix + captured.Bucket
+	ctx, cancel := redisContext()
+	defer cancel()
+	_, err = c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, record)
+		pipe.LTrim(ctx, key, -MaxHookRequests, -1)
+		pipe.Expire(ctx, key, HookBucketIdleTime)
+		pipe.Publish(ctx, clusterHooksChannel, record)
+		return nil
+	})
+	return err
+}
+
+// hooks returns the requests captured in a bucket, oldest first
+func (c *Cluster) hooks(bucket string) ([]*CapturedRequest, error) {
+	key := clusterHookKeyPrefix + bucket
+	ctx, cancel := redisContext()
+	defer cancel()
+	var records *redis.StringSliceCmd
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		records = pipe.LRange(ctx, key, 0, -1)
+		pipe.Expire(ctx, key, HookBucketIdleTime)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]*CapturedRequest, 0, len(records.Val()))
+	for _, record := range records.Val() {
+		var captured CapturedRequest
+		if err := json.Unmarshal([]byte(record), &captured); err != nil {
+			continue
+		}
+		requests = append(requests, &captured)
+	}
+	return requests, nil
+}
+
+// clearHooks removes the requests captured in a bucket
+func (c *Cluster) clearHooks(bucket string) error {
+	ctx, cancel := redisContext()
+	defer cancel()
+	return c.redis.Del(ctx, clusterHookKeyPrefix+bucket).Err()
+}
+
+// relayHooks passes the requests any proxy captures to notify until the
+// proxy leaves the cluster
+func (c *Cluster) relayHooks(notify func(*CapturedRequest)) {
+	pubsub := c.redis.Subscribe(context.Background(), clusterHooksChannel)
+	go func() {
+		<-c.stop
+		pubsub.Close()
+	}()
+
+	for message := range pubsub.Channel() {
+		var captured CapturedRequest
+		if err := json.Unmarshal([]byte(message.Payload), &captured); err != nil {
+			c.logger.Printf("Invalid captured request from the cluster: %v", err)
+			continue
+		}
+		notify(&captured)
+	}
+}
+
+// gather asks every other proxy for its answer to a request and passes each
+// answer's body to decode, for lists spanning the cluster
+func (c *Cluster) gather(r *http.Request, decode func(body io.Reader) error) {
+	if c == nil || r.Header.Get(ClusterHopHeader) != "" {
+		return
+	}
+	instances, err := c.Instances()
+	if err != nil {
+		c.logger.Printf("Failed to list cluster instances: %v", err)
+		return
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		if instance.Self {
+			continue
+		}
+		wg.Add(1)
+		go func(instance *ClusterInstance) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), clusterPeerTimeout)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, r.Method, instance.URL+r.URL.RequestURI(), nil)
+			if err != nil {
+				return
+			}
+			req.Header.Set(ClusterHopHeader, c.self.ID)
+			if key := r.Header.Get(APIKeyHeader); key != "" {
+				req.Header.Set(APIKeyHeader, key)
+			}
+			resp, err := c.client.Do(req)
+			if err != nil {
+				c.logger.Printf("Failed to reach cluster instance %s: %v", instance.ID, err)
+				return
+			}
+			defer resp.Body.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err := decode(resp.Body); err != nil {
+				c.logger.Printf("Invalid answer from cluster instance %s: %v", instance.ID, err)
+			}
+		}(instance)
+	}
+	wg.Wait()
+}
+
+// clusterMiddleware forwards requests about a session, schedule, monitor or
+// dead letter held by another proxy to that proxy. It runs before API keys
+// are checked, so requests are authenticated and counted once, by the proxy
+// answering them.
+func (s *ProxyServer) clusterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		match := clusterPath.FindStringSubmatch(r.URL.Path)
+		if s.cluster == nil || match == nil || r.Method == "OPTIONS" || r.Header.Get(ClusterHopHeader) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		kind, id := clusterPathKinds[match[1]], match[2]
+		if (kind == clusterSessionWebSocket && s.sockets.Get(id) != nil) ||
+			(kind == clusterSessionEventSource && s.eventSources.Get(id) != nil) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		owner, err := s.cluster.sessionOwner(kind, id)
+		if err != nil {
+			s.logger.Printf("[%s] Failed to look up %s %s in the cluster: %v", requestID(w), kind, id, err)
+		}
+		if owner == nil || owner.Self {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		target, err := url.Parse(owner.URL)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.Out.Header.Set(ClusterHopHeader, s.cluster.self.ID)
+			},
+			// Feeds stream events as they come
+			FlushInterval: -1,
+			ModifyResponse: func(resp *http.Response) error {
+				// This proxy's middleware already set these
+				for name := range resp.Header {
+					if strings.HasPrefix(name, "Access-Control-") {
+						resp.Header.Del(name)
+					}
+				}
+				resp.Header.Del(RequestIDHeader)
+				resp.Header.Del(RealStatusHeader)
+				return nil
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Header().Set("Content-Type", "application/json")
+				s.writeErrorResponse(w, networkErrorType(err).Type, "Cluster Instance Unreachable",
+					fmt.Sprintf("%s is held by %s, which could not be reached: %v", r.URL.Path, owner.URL, err))
+			},
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminCluster lists the proxies of the cluster
+func (s *ProxyServer) handleAdminCluster(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if s.cluster == nil {
+		s.writeErrorResponse(w, "not_found", "Not Clustered", "This proxy runs alone; start it with -cluster to join a cluster")
+		return
+	}
+
+	instances, err := s.cluster.Instances()
+	if err != nil {
+		s.writeErrorResponse(w, "unknown_error", "Cluster Unavailable", err.Error())
+		return
+	}
+	response := &AdminClusterResponse{Success: true, Instance: s.cluster.self.ID, Instances: instances}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
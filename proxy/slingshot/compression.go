@@ -0,0 +1,171 @@
+package slingshot
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// minCompressSize is the size below which JSON responses are sent as is,
+// since compressing them saves next to nothing
+const minCompressSize = 1024
+
+// responseEncoders creates the compressors offered for /proxy/* responses,
+// by Content-Encoding, in order of preference
+var responseEncoders = []struct {
+	name string
+	new  func(w io.Writer) io.WriteCloser
+}{
+	{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+	{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+}
+
+// negotiateEncoding returns the index of the encoder the Accept-Encoding
+// header prefers, or -1 when it accepts none of them
+func negotiateEncoding(acceptEncoding string) int {
+	best, bestQ := -1, 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+
+		for i, encoder := range responseEncoders {
+			if (name == encoder.name || name == "*") && (q > bestQ || q == bestQ && i < best) {
+				best, bestQ = i, q
+			}
+		}
+	}
+	return best
+}
+
+// compressionMiddleware compresses the JSON responses of /proxy/* endpoints
+// for callers that accept it, since they often carry large base64 bodies.
+// Event streams, WebSocket upgrades and artifact downloads are sent as is.
+func (s *ProxyServer) compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/proxy/") || r.Method == "HEAD" || r.Method == "OPTIONS" || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoder := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoder < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		compressed := &compressWriter{ResponseWriter: w, encoder: encoder, status: http.StatusOK}
+		defer compressed.Close()
+		next.ServeHTTP(compressed, r)
+	})
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// it is JSON and large enough to be worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	encoder     int // Index in responseEncoders
+	status      int
+	wroteHeader bool
+	passthrough bool // Sent as is
+	buffer      []byte
+	compressor  io.WriteCloser
+}
+
+// WriteHeader records the status, sending the response as is right away
+// unless it may be compressed
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = statusCode
+
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mediaType != "application/json" || w.Header().Get("Content-Encoding") != "" ||
+		statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.Write(p)
+	case w.compressor != nil:
+		return w.compressor.Write(p)
+	}
+
+	w.buffer = append(w.buffer, p...)
+	if len(w.buffer) >= minCompressSize {
+		if err := w.startCompressing(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// startCompressing sends the headers of a compressed response and the body
+// held back so far
+func (w *compressWriter) startCompressing() error {
+	encoder := responseEncoders[w.encoder]
+	w.Header().Set("Content-Encoding", encoder.name)
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.compressor = encoder.new(w.ResponseWriter)
+	_, err := w.compressor.Write(w.buffer)
+	w.buffer = nil
+	return err
+}
+
+// Flush lets streaming handlers flush through the wrapper, compressing what
+// was held back
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.passthrough && w.compressor == nil {
+		w.startCompressing()
+	}
+	if flusher, ok := w.compressor.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the response, sending it as is when it stayed too small to
+// compress
+func (w *compressWriter) Close() error {
+	switch {
+	case w.compressor != nil:
+		return w.compressor.Close()
+	case w.wroteHeader && !w.passthrough:
+		w.ResponseWriter.WriteHeader(w.status)
+		_, err := w.ResponseWriter.Write(w.buffer)
+		return err
+	}
+	return nil
+}
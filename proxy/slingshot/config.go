@@ -0,0 +1,174 @@
+package slingshot
+
+import (
+	"strings"
+	"time"
+)
+
+// Config holds server-wide settings, which the proxy binary sets from the
+// command line
+type Config struct {
+	Port int
+
+	// Socket, when set, is a Unix socket the API is also served on, so local
+	// tools such as the tail command reach the proxy without knowing its port
+	Socket string
+
+	// GRPCPort, when set, is a port the API is also served on over gRPC,
+	// without TLS, as defined by slingshot.proto
+	GRPCPort int
+
+	// ServeStale caches successful GET responses and serves them, flagged
+	// as stale, whenever the upstream cannot be reached
+	ServeStale bool
+
+	// NetworkProfile, when set, simulates the named network conditions on
+	// every request that does not choose its own profile
+	NetworkProfile string
+
+	// MaxConcurrent, when set, limits the requests sent at once. Others wait
+	// up to QueueTimeout for a slot, highest priority first.
+	MaxConcurrent int
+	QueueTimeout  time.Duration
+
+	// UploadDirs lists the directories request bodies may read server-side
+	// files from. File paths are rejected when empty.
+	UploadDirs []string
+
+	// ArtifactsDir is where large response bodies are stored as artifacts
+	ArtifactsDir string
+
+	// ArtifactThreshold is the body size in bytes above which responses are
+	// stored as artifacts instead of inlined. Zero stores only on request.
+	ArtifactThreshold int64
+
+	// ArtifactRetention is how long artifacts are kept after last being stored
+	ArtifactRetention time.Duration
+
+	// ArtifactS3 is an s3:// URL of a bucket to upload artifacts larger than
+	// ArtifactS3Threshold bytes to, keeping them off the proxy's disk. Their
+	// responses link to presigned URLs valid for ArtifactURLExpiry.
+	ArtifactS3          string
+	ArtifactS3Threshold int64
+	ArtifactURLExpiry   time.Duration
+
+	// Storage names where the history, artifact metadata and session holders
+	// are kept: a sqlite:// (the default, DefaultStorage), postgres:// or
+	// redis:// URL, the last two shared between proxies, or memory to lose
+	// them on restart
+	Storage string
+
+	// ClusterURL, a redis:// URL, joins the proxies sharing it into a cluster
+	// behind a load balancer, and ClusterAdvertise is the URL the others reach
+	// this proxy at. The storage is the same Redis unless Storage
+	// names another one.
+	ClusterURL       string
+	ClusterAdvertise string
+
+	// CallbackSecret signs the callbacks of jobs that bring no secret of
+	// their own
+	CallbackSecret string
+
+	// Publish lists kafka://, nats:// and amqp:// URLs of message queues to
+	// emit a record of each completed request to
+	Publish []string
+
+	// GeoIP lists MaxMind DB files, such as GeoLite2 Country and ASN, to look
+	// up the country and network of the addresses requests connect to
+	GeoIP []string
+
+	// Scrub names built-in scrub rules, and ScrubRulesFile is a JSON file of
+	// more, applied to history entries and artifacts before they are stored
+	Scrub          []string
+	ScrubRulesFile string
+
+	// ScriptDirs lists the directories pre-request and post-response
+	// scripts may be loaded from. Script files are rejected when empty.
+	ScriptDirs []string
+
+	// ProtoDirs lists directories of .proto files whose messages requests
+	// can be encoded to and responses decoded from
+	ProtoDirs []string
+
+	// PassthroughHeaders lists headers of the caller's own request that are
+	// forwarded to the target automatically
+	PassthroughHeaders HeaderAllowlist
+
+	// RequestIDHeader, when set, forwards each request's correlation ID to
+	// the target in this header
+	RequestIDHeader string
+
+	// RequireAPIKey makes every proxy endpoint require one of the API keys
+	// issued through the admin API, kept in APIKeysFile across restarts
+	RequireAPIKey bool
+	APIKeysFile   string
+
+	// AdminToken, when set, enables the admin API for callers presenting it
+	// as a bearer token
+	AdminToken string
+
+	// TransformsFile, when set, configures the chain of header, URL and body
+	// transforms applied to requests to matching hosts
+	TransformsFile string
+
+	// HeaderProfilesFile, when set, configures the headers attached to
+	// requests to matching hosts
+	HeaderProfilesFile string
+
+	// PluginsFile, when set, configures the executables and HTTP endpoints
+	// called before and after each request
+	PluginsFile string
+
+	// DrainTimeout bounds how long a shutdown on SIGTERM or SIGINT waits
+	// for requests in flight after the proxy stopped accepting new ones
+	DrainTimeout time.Duration
+
+	// CanaryURL, when set, is fetched by readiness checks to confirm the
+	// proxy can reach the outside world
+	CanaryURL string
+
+	// TunnelURL, when set, exposes the webhook buckets publicly through the
+	// tunnel relay at this URL
+	TunnelURL string
+
+	// TunnelRelay turns this proxy into a public relay for tunnel clients
+	TunnelRelay bool
+
+	// TunnelToken authenticates tunnel clients with the relay
+	TunnelToken string
+
+	// SchedulesFile, when set, keeps scheduled requests across restarts
+	SchedulesFile string
+
+	// MonitorsFile, when set, keeps monitors across restarts
+	MonitorsFile string
+
+	// NotifyWebhook, when set, receives notifications as JSON POSTs
+	NotifyWebhook string
+
+	// NotifySlack, when set, is a Slack incoming webhook for notifications
+	NotifySlack string
+
+	// NotifyEmail lists the addresses notifications are emailed to through
+	// the SMTP server at SMTPAddr
+	NotifyEmail  []string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// NotifyAfter is the number of consecutive failed runs of a scheduled
+	// request before a notification is sent
+	NotifyAfter int
+}
+
+// SplitList splits a comma-separated list, as given in flags, dropping empty entries
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
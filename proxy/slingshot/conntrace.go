@@ -0,0 +1,100 @@
+package slingshot
+
+import (
+	"context"
+	"net"
+	"net/http/httptrace"
+	"sync"
+)
+
+// ConnectionInfo describes the connection a response arrived on, to help
+// diagnose errors caused by stale pooled connections
+type ConnectionInfo struct {
+	Reused    bool   `json:"reused"`              // Taken from the pool rather than newly dialed
+	IdleTime  string `json:"idle_time,omitempty"` // How long a reused connection sat idle
+	LocalAddr string `json:"local_addr,omitempty"`
+	LocalPort int    `json:"local_port,omitempty"`
+
+	// The address connected to, and the addresses its host name resolved to
+	// when the connection was dialed, to tell which of several DNS records
+	// served the request
+	RemoteAddr  string   `json:"remote_addr,omitempty"`
+	ResolvedIPs []string `json:"resolved_ips,omitempty"`
+
+	// Location and network of the remote address (when -geoip is set)
+	Geo *GeoInfo `json:"geo,omitempty"`
+
+	// Connections open in the shared pool once the response arrived
+	PoolOpen int64 `json:"pool_open"`
+}
+
+// connTrace records the connection used by the last request sent
+type connTrace struct {
+	mu       sync.Mutex
+	info     *ConnectionInfo
+	resolved []string // Addresses of the last lookup, until a connection is made
+	dialed   string   // Address of the last connection attempt
+}
+
+// withConnTrace returns a context whose requests record their connection in
+// the returned trace
+func withConnTrace(ctx context.Context) (context.Context, *connTrace) {
+	t := &connTrace{}
+	trace := &httptrace.ClientTrace{
+		DNSDone: func(done httptrace.DNSDoneInfo) {
+			resolved := make([]string, 0, len(done.Addrs))
+			for _, addr := range done.Addrs {
+				resolved = append(resolved, addr.IP.String())
+			}
+			t.mu.Lock()
+			t.resolved = resolved
+			t.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			t.dialed = addr
+			t.mu.Unlock()
+		},
+		GotConn: func(got httptrace.GotConnInfo) {
+			info := &ConnectionInfo{Reused: got.Reused}
+			if got.WasIdle {
+				info.IdleTime = formatMillis(got.IdleTime)
+			}
+			if got.Conn != nil {
+				info.LocalAddr = got.Conn.LocalAddr().String()
+				if addr, ok := got.Conn.LocalAddr().(*net.TCPAddr); ok {
+					info.LocalPort = addr.Port
+				}
+				info.RemoteAddr = got.Conn.RemoteAddr().String()
+			}
+
+			// A retry or redirect replaces the connection of the one before.
+			// Pooled connections were dialed without a lookup of their own.
+			t.mu.Lock()
+			if !got.Reused && len(t.resolved) > 0 {
+				info.ResolvedIPs = t.resolved
+			}
+			t.info = info
+			t.resolved, t.dialed = nil, ""
+			t.mu.Unlock()
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// annotate reports the connection of the last request sent. When it failed
+// to connect, the address it tried last and the lookup are reported instead.
+// Requests that were never sent, such as invalid or cached ones, have none.
+func (t *connTrace) annotate(response *ProxyResponse, conns *connCounter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.info == nil && t.dialed != "" {
+		t.info = &ConnectionInfo{RemoteAddr: t.dialed, ResolvedIPs: t.resolved}
+	}
+	if t.info == nil {
+		return
+	}
+	t.info.PoolOpen = conns.stats().Open
+	response.Connection = t.info
+}
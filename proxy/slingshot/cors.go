@@ -0,0 +1,321 @@
+package slingshot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// CORSCheckRequest describes a cross-origin call to analyze
+type CORSCheckRequest struct {
+	URL         string   `json:"url"`
+	Origin      string   `json:"origin"`
+	Method      string   `json:"method"`
+	Headers     []string `json:"headers"`
+	Credentials bool     `json:"credentials,omitempty"`
+	Timeout     int      `json:"timeout,omitempty"`
+}
+
+// CORSExchange summarizes one request made during a CORS check
+type CORSExchange struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Allowed bool              `json:"allowed"`
+}
+
+// CORS problem types
+const (
+	CORSProblemHeader = "header" // A CORS header is missing or doesn't allow the call
+	CORSProblemStatus = "status" // The preflight response doesn't have a 2xx status
+)
+
+// CORSProblem explains why a browser would reject the call
+type CORSProblem struct {
+	Stage   string `json:"stage"` // "preflight" or "actual"
+	Type    string `json:"type"`
+	Header  string `json:"header,omitempty"`
+	Message string `json:"message"`
+}
+
+// CORSCheckResponse is the analysis returned by /proxy/corscheck
+type CORSCheckResponse struct {
+	Success           bool          `json:"success"`
+	Allowed           bool          `json:"allowed"`
+	PreflightRequired bool          `json:"preflight_required"`
+	Preflight         *CORSExchange `json:"preflight,omitempty"`
+	Actual            *CORSExchange `json:"actual,omitempty"`
+	Problems          []CORSProblem `json:"problems,omitempty"`
+	MissingHeader     string        `json:"missing_header,omitempty"`
+	ExposedHeaders    []string      `json:"exposed_headers,omitempty"`
+
+	// Error fields (when success = false)
+	ErrorType    string `json:"error_type,omitempty"`
+	ErrorTitle   string `json:"error_title,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// Request and response headers browsers allow without CORS approval
+var (
+	corsSafelistedMethods = []string{"GET", "HEAD", "POST"}
+
+	corsSafelistedRequestHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type", "Range"}
+
+	corsSafelistedContentTypes = []string{"application/x-www-form-urlencoded", "multipart/form-data", "text/plain"}
+
+	corsSafelistedResponseHeaders = []string{"Cache-Control", "Content-Language", "Content-Length", "Content-Type", "Expires", "Last-Modified", "Pragma"}
+)
+
+// CheckCORS performs the preflight (when a browser would send one) and the
+// actual request, and reports whether a browser would allow the call
+func (c *HTTPClient) CheckCORS(ctx context.Context, req *CORSCheckRequest) *CORSCheckResponse {
+	result := &CORSCheckResponse{Success: true}
+
+	// Headers the browser would have to ask permission for
+	headers := c.parseHeaders(req.Headers)
+	var unsafeHeaders []string
+	for name, values := range headers {
+		if !isCORSSafelistedHeader(name, values[0]) {
+			unsafeHeaders = append(unsafeHeaders, strings.ToLower(name))
+		}
+	}
+	sort.Strings(unsafeHeaders)
+
+	result.PreflightRequired = !containsFold(corsSafelistedMethods, req.Method) || len(unsafeHeaders) > 0
+
+	if result.PreflightRequired {
+		preflight, err := c.corsRequest(ctx, http.MethodOptions, req.URL, func(h http.Header) {
+			h.Set("Origin", req.Origin)
+			h.Set("Access-Control-Request-Method", req.Method)
+			if len(unsafeHeaders) > 0 {
+				h.Set("Access-Control-Request-Headers", strings.Join(unsafeHeaders, ","))
+			}
+		})
+		if err != nil {
+			return corsErrorResponse(ctx, "Preflight request failed", err)
+		}
+
+		result.Preflight = preflight
+		problems := checkPreflight(preflight, req, unsafeHeaders)
+		preflight.Allowed = len(problems) == 0
+		result.Problems = append(result.Problems, problems...)
+
+		// A browser stops here, so don't send the actual request
+		if !preflight.Allowed {
+			result.MissingHeader = missingHeader(problems)
+			return result
+		}
+	}
+
+	actual, err := c.corsRequest(ctx, req.Method, req.URL, func(h http.Header) {
+		for name, values := range headers {
+			for _, value := range values {
+				h.Add(name, value)
+			}
+		}
+		h.Set("Origin", req.Origin)
+	})
+	if err != nil {
+		return corsErrorResponse(ctx, "Request failed", err)
+	}
+
+	result.Actual = actual
+	problems := checkAllowOrigin("actual", actual.Headers, req.Origin, req.Credentials)
+	actual.Allowed = len(problems) == 0
+	result.Problems = append(result.Problems, problems...)
+
+	result.Allowed = actual.Allowed
+	result.MissingHeader = missingHeader(result.Problems)
+	if actual.Allowed {
+		result.ExposedHeaders = exposedHeaders(actual.Headers)
+	}
+
+	return result
+}
+
+// corsRequest sends a single request without following redirects
+func (c *HTTPClient) corsRequest(ctx context.Context, method, targetURL string, setHeaders func(http.Header)) (*CORSExchange, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	setHeaders(httpReq.Header)
+	if httpReq.Header.Get("User-Agent") == "" {
+		httpReq.Header.Set("User-Agent", fmt.Sprintf("rb-slingshot/%s (https://requestbite.com/slingshot)", Version))
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	exchange := &CORSExchange{
+		Status:  resp.StatusCode,
+		Headers: make(map[string]string),
+	}
+	for key, values := range resp.Header {
+		exchange.Headers[strings.ToLower(key)] = strings.Join(values, ", ")
+	}
+
+	return exchange, nil
+}
+
+// checkPreflight validates a preflight response against the Fetch standard
+func checkPreflight(preflight *CORSExchange, req *CORSCheckRequest, unsafeHeaders []string) []CORSProblem {
+	if preflight.Status < 200 || preflight.Status > 299 {
+		return []CORSProblem{{
+			Stage:   "preflight",
+			Type:    CORSProblemStatus,
+			Message: fmt.Sprintf("Preflight response has status %d; browsers require a 2xx status", preflight.Status),
+		}}
+	}
+
+	problems := checkAllowOrigin("preflight", preflight.Headers, req.Origin, req.Credentials)
+
+	allowMethods := SplitList(preflight.Headers["access-control-allow-methods"])
+	methodAllowed := containsFold(corsSafelistedMethods, req.Method) ||
+		containsString(allowMethods, req.Method) ||
+		(!req.Credentials && containsString(allowMethods, "*"))
+	if !methodAllowed {
+		problems = append(problems, CORSProblem{
+			Stage:   "preflight",
+			Type:    CORSProblemHeader,
+			Header:  "Access-Control-Allow-Methods",
+			Message: fmt.Sprintf("Method %s is not listed in Access-Control-Allow-Methods", req.Method),
+		})
+	}
+
+	allowHeaders := SplitList(preflight.Headers["access-control-allow-headers"])
+	wildcard := !req.Credentials && containsString(allowHeaders, "*")
+	for _, name := range unsafeHeaders {
+		// The wildcard never covers Authorization
+		if (wildcard && name != "authorization") || containsFold(allowHeaders, name) {
+			continue
+		}
+		problems = append(problems, CORSProblem{
+			Stage:   "preflight",
+			Type:    CORSProblemHeader,
+			Header:  "Access-Control-Allow-Headers",
+			Message: fmt.Sprintf("Request header %s is not listed in Access-Control-Allow-Headers", name),
+		})
+	}
+
+	return problems
+}
+
+// checkAllowOrigin validates Access-Control-Allow-Origin and, for credentialed
+// requests, Access-Control-Allow-Credentials
+func checkAllowOrigin(stage string, headers map[string]string, origin string, credentials bool) []CORSProblem {
+	allowOrigin := headers["access-control-allow-origin"]
+
+	switch {
+	case allowOrigin == "":
+		return []CORSProblem{{
+			Stage:   stage,
+			Type:    CORSProblemHeader,
+			Header:  "Access-Control-Allow-Origin",
+			Message: "Response is missing Access-Control-Allow-Origin",
+		}}
+	case allowOrigin == "*" && credentials:
+		return []CORSProblem{{
+			Stage:   stage,
+			Type:    CORSProblemHeader,
+			Header:  "Access-Control-Allow-Origin",
+			Message: "Access-Control-Allow-Origin cannot be * for credentialed requests",
+		}}
+	case allowOrigin != "*" && allowOrigin != origin:
+		return []CORSProblem{{
+			Stage:   stage,
+			Type:    CORSProblemHeader,
+			Header:  "Access-Control-Allow-Origin",
+			Message: fmt.Sprintf("Access-Control-Allow-Origin is %q but the origin is %q", allowOrigin, origin),
+		}}
+	}
+
+	if credentials && headers["access-control-allow-credentials"] != "true" {
+		return []CORSProblem{{
+			Stage:   stage,
+			Type:    CORSProblemHeader,
+			Header:  "Access-Control-Allow-Credentials",
+			Message: "Credentialed requests require Access-Control-Allow-Credentials: true",
+		}}
+	}
+
+	return nil
+}
+
+// missingHeader returns the header named by the first header problem, if any
+func missingHeader(problems []CORSProblem) string {
+	for _, problem := range problems {
+		if problem.Type == CORSProblemHeader {
+			return problem.Header
+		}
+	}
+	return ""
+}
+
+// exposedHeaders lists the response headers readable from JavaScript
+func exposedHeaders(headers map[string]string) []string {
+	expose := SplitList(headers["access-control-expose-headers"])
+
+	var exposed []string
+	for name := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+		if containsString(corsSafelistedResponseHeaders, canonical) || containsFold(expose, name) || containsString(expose, "*") {
+			exposed = append(exposed, name)
+		}
+	}
+	sort.Strings(exposed)
+
+	return exposed
+}
+
+// isCORSSafelistedHeader reports whether a request header can be sent
+// cross-origin without a preflight
+func isCORSSafelistedHeader(name, value string) bool {
+	if !containsString(corsSafelistedRequestHeaders, name) {
+		return false
+	}
+	if name == "Content-Type" {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(value, ";")[0]))
+		return containsString(corsSafelistedContentTypes, mediaType)
+	}
+	return true
+}
+
+// corsErrorResponse reports a failed CORS check request
+func corsErrorResponse(ctx context.Context, title string, err error) *CORSCheckResponse {
+	errType := networkErrorType(err)
+	if ctx.Err() == context.DeadlineExceeded {
+		errType = TimeoutError
+	}
+
+	return &CORSCheckResponse{
+		Success:      false,
+		ErrorType:    errType.Type,
+		ErrorTitle:   title,
+		ErrorMessage: err.Error(),
+	}
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package slingshot
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardFiles is the web dashboard served at /ui/, a single page calling
+// the proxy's own API. Environments are kept in the browser.
+//
+//go:embed ui
+var dashboardFiles embed.FS
+
+// dashboardHandler serves the dashboard's files, without listing directories
+func dashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ui/" && r.URL.Path[len(r.URL.Path)-1] == '/' {
+			http.NotFound(w, r)
+			return
+		}
+		// Embedded files carry no modification time to revalidate against
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// handleDashboard redirects /ui to the dashboard
+func (s *ProxyServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/ui/", http.StatusMovedPermanently)
+}
@@ -0,0 +1,231 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxDatasetSize is the largest upload accepted by /proxy/data
+	MaxDatasetSize = 10 << 20
+
+	// MaxDatasetRows is the most rows a data-driven run may have
+	MaxDatasetRows = 10000
+)
+
+// DataRowResult is the outcome of running a request or workflow for one row
+type DataRowResult struct {
+	Row      int               `json:"row"`
+	Values   map[string]string `json:"values"`
+	Passed   bool              `json:"passed"`
+	Result   *RunResult        `json:"result,omitempty"`
+	Response *ProxyResponse    `json:"response,omitempty"`
+	Workflow *WorkflowResult   `json:"workflow,omitempty"`
+}
+
+// DataRunResult is returned by /proxy/data and `proxy workflow -data`
+type DataRunResult struct {
+	Success  bool             `json:"success"`
+	Rows     int              `json:"rows"`
+	Passed   int              `json:"passed"`
+	Failed   int              `json:"failed"`
+	Duration float64          `json:"duration_ms"`
+	Results  []*DataRowResult `json:"results"`
+}
+
+// parseDataset parses the rows of a CSV file with a header line, or of a JSON
+// array of objects. The format follows the file name and falls back to the
+// content when the name has no known extension.
+func parseDataset(data []byte, name string) ([]map[string]string, error) {
+	format := strings.ToLower(filepath.Ext(name))
+	if format != ".csv" && format != ".json" {
+		format = ".csv"
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			format = ".json"
+		}
+	}
+
+	var rows []map[string]string
+	if format == ".json" {
+		var objects []map[string]interface{}
+		if err := json.Unmarshal(data, &objects); err != nil {
+			return nil, fmt.Errorf("Failed to parse dataset: expected a JSON array of objects: %v", err)
+		}
+		for _, object := range objects {
+			row := make(map[string]string, len(object))
+			for key, value := range object {
+				row[key] = variableString(value)
+			}
+			rows = append(rows, row)
+		}
+	} else {
+		reader := csv.NewReader(bytes.NewReader(data))
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse dataset: %v", err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("Dataset is empty")
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := make(map[string]string, len(header))
+			for i, key := range header {
+				row[strings.TrimSpace(key)] = record[i]
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("Dataset has no rows")
+	}
+	if len(rows) > MaxDatasetRows {
+		return nil, fmt.Errorf("Dataset has %d rows, the maximum is %d", len(rows), MaxDatasetRows)
+	}
+	return rows, nil
+}
+
+// loadDataset reads a CSV or JSON dataset file
+func loadDataset(path string) ([]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read dataset: %v", err)
+	}
+	return parseDataset(data, path)
+}
+
+// runDataset calls run once per row, with the row's values layered over
+// vars, and collects the results
+func runDataset(rows []map[string]string, vars map[string]string, run func(row int, values map[string]string) *DataRowResult) *DataRunResult {
+	start := time.Now()
+	result := &DataRunResult{
+		Success: true,
+		Rows:    len(rows),
+		Results: []*DataRowResult{},
+	}
+
+	for i, row := range rows {
+		values := make(map[string]string, len(vars)+len(row))
+		for key, value := range vars {
+			values[key] = value
+		}
+		for key, value := range row {
+			values[key] = value
+		}
+
+		rowResult := run(i+1, values)
+		rowResult.Row = i + 1
+		rowResult.Values = row
+		result.Results = append(result.Results, rowResult)
+		if rowResult.Passed {
+			result.Passed++
+		} else {
+			result.Failed++
+		}
+	}
+
+	result.Duration = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+// handleDataRun handles /proxy/data. The multipart upload has a "data" file
+// and either a "request" (the JSON of /proxy/request) or a "workflow" (the
+// YAML of /workflows/run), which is run once per row.
+func (s *ProxyServer) handleDataRun(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxDatasetSize)
+	if err := r.ParseMultipartForm(MaxDatasetSize); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Upload", fmt.Sprintf("Expected a multipart upload: %v", err))
+		return
+	}
+
+	file, header, err := r.FormFile("data")
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Missing Dataset", "A \"data\" file is required")
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Dataset", fmt.Sprintf("Failed to read dataset: %v", err))
+		return
+	}
+	rows, err := parseDataset(data, header.Filename)
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Dataset", err.Error())
+		return
+	}
+
+	// Rows wait behind interactive requests unless they set their own priority
+	ctx := withDefaultPriority(r.Context(), PriorityBatch)
+
+	var result *DataRunResult
+	switch {
+	case r.FormValue("request") != "":
+		var req ProxyRequest
+		if err := json.Unmarshal([]byte(r.FormValue("request")), &req); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse request: %v", err))
+			return
+		}
+		if req.Method == "" || req.URL == "" {
+			s.writeErrorResponse(w, "request_format_error", "Missing Fields", "Method and URL are required")
+			return
+		}
+
+		s.logger.Printf("[%s] %s %s (%d rows)", requestID(w), req.Method, req.URL, len(rows))
+
+		step := &runnerStep{Name: req.Method + " " + req.URL, Request: &req}
+		result = runDataset(rows, req.Environment, func(row int, values map[string]string) *DataRowResult {
+			run, response := runStep(ctx, s.httpClient, step, values)
+			return &DataRowResult{Passed: run.Passed, Result: run, Response: response}
+		})
+
+	case r.FormValue("workflow") != "":
+		workflow, err := parseWorkflow([]byte(r.FormValue("workflow")))
+		if err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Workflow", err.Error())
+			return
+		}
+
+		s.logger.Printf("[%s] Running workflow %s (%d rows)", requestID(w), workflow.Name, len(rows))
+
+		result = runDataset(rows, nil, func(row int, values map[string]string) *DataRowResult {
+			run := runWorkflow(ctx, s.httpClient, workflow, values, io.Discard)
+			return &DataRowResult{Passed: run.Passed, Workflow: run}
+		})
+
+	default:
+		s.writeErrorResponse(w, "request_format_error", "Missing Fields", "Either a \"request\" or a \"workflow\" is required")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// runWorkflowDataset runs a workflow once per row for `proxy workflow -data`
+func runWorkflowDataset(ctx context.Context, client *HTTPClient, workflow *Workflow, rows []map[string]string, overrides map[string]string, out io.Writer) *DataRunResult {
+	return runDataset(rows, overrides, func(row int, values map[string]string) *DataRowResult {
+		fmt.Fprintf(out, "Row %d\n", row)
+		run := runWorkflow(ctx, client, workflow, values, out)
+		return &DataRowResult{Passed: run.Passed, Workflow: run}
+	})
+}
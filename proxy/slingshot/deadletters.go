@@ -0,0 +1,333 @@
+package slingshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxDeadLetters is the number of dead letters kept; the oldest are dropped
+const MaxDeadLetters = 500
+
+// Dead letter sources
+const (
+	DeadLetterSchedule = "schedule"
+	DeadLetterJob      = "job"
+)
+
+// DeadLetterAttempt is one failed run of a dead letter's request
+type DeadLetterAttempt struct {
+	Reason string        `json:"reason"`
+	Retry  bool          `json:"retry,omitempty"` // Run through POST /proxy/deadletters/{id}/retry
+	Run    *HistoryEntry `json:"run"`
+}
+
+// DeadLetter is a scheduled request or job that failed, kept so it can be
+// looked into and retried. Runs of a schedule failing in a row share one
+// dead letter.
+type DeadLetter struct {
+	ID         string               `json:"id"`
+	Source     string               `json:"source"`
+	ScheduleID string               `json:"schedule_id,omitempty"`
+	JobID      string               `json:"job_id,omitempty"`
+	Name       string               `json:"name,omitempty"`
+	Request    ProxyRequest         `json:"request"`
+	Reason     string               `json:"reason"` // Why the last attempt failed
+	Attempts   []*DeadLetterAttempt `json:"attempts"`
+	CreatedAt  time.Time            `json:"created_at"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+}
+
+// DeadLetterResponse is returned by the /proxy/deadletters endpoints. A
+// successful retry resolves the dead letter and returns the run.
+type DeadLetterResponse struct {
+	Success     bool          `json:"success"`
+	DeadLetter  *DeadLetter   `json:"dead_letter,omitempty"`
+	DeadLetters []*DeadLetter `json:"dead_letters,omitempty"`
+	Resolved    bool          `json:"resolved,omitempty"`
+	Run         *HistoryEntry `json:"run,omitempty"`
+}
+
+// failureReason describes why a run failed
+func failureReason(entry *HistoryEntry) string {
+	if !entry.Success {
+		return fmt.Sprintf("%s: %s", entry.ErrorType, entry.ErrorMessage)
+	}
+	return fmt.Sprintf("HTTP %d", entry.Status)
+}
+
+// DeadLetterStore keeps failed background requests in memory
+type DeadLetterStore struct {
+	mu      sync.Mutex
+	letters map[string]*DeadLetter
+	open    map[string]string // Dead letter still collecting failures, by source and job
+
+	// cluster, when set, sends requests about a dead letter to the proxy
+	// that recorded it, which can retry its job
+	cluster *Cluster
+}
+
+// NewDeadLetterStore creates an empty dead-letter store
+func NewDeadLetterStore() *DeadLetterStore {
+	return &DeadLetterStore{
+		letters: make(map[string]*DeadLetter),
+		open:    make(map[string]string),
+	}
+}
+
+// Record adds a failed run to the open dead letter of its job, creating one
+// when the job has none
+func (s *DeadLetterStore) Record(letter *DeadLetter, attempt *DeadLetterAttempt) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	now := time.Now().UTC()
+	key := letter.key()
+	var dropped []string
+	created := false
+	if existing, ok := s.letters[s.open[key]]; ok {
+		letter = existing
+	} else {
+		letter.ID = newRequestID()
+		letter.CreatedAt = now
+		s.letters[letter.ID] = letter
+		s.open[key] = letter.ID
+		dropped = s.trim()
+		created = true
+	}
+	letter.Reason = attempt.Reason
+	letter.Attempts = append(letter.Attempts, attempt)
+	letter.UpdatedAt = now
+	s.mu.Unlock()
+
+	if created {
+		s.cluster.holds(clusterDeadLetter, letter.ID)
+	}
+	for _, id := range dropped {
+		s.cluster.release(clusterDeadLetter, id)
+	}
+}
+
+// Close ends a job's run of failures, so its next failure starts a new dead
+// letter
+func (s *DeadLetterStore) Close(source, jobID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.open, source+":"+jobID)
+}
+
+// key names the job a dead letter collects the failures of
+func (d *DeadLetter) key() string {
+	return d.Source + ":" + d.ScheduleID + d.JobID
+}
+
+// trim drops the oldest dead letters beyond MaxDeadLetters, returning their
+// IDs. Callers hold s.mu.
+func (s *DeadLetterStore) trim() []string {
+	var dropped []string
+	for len(s.letters) > MaxDeadLetters {
+		var oldest *DeadLetter
+		for _, letter := range s.letters {
+			if oldest == nil || letter.UpdatedAt.Before(oldest.UpdatedAt) {
+				oldest = letter
+			}
+		}
+		s.remove(oldest.ID)
+		dropped = append(dropped, oldest.ID)
+	}
+	return dropped
+}
+
+// remove deletes a dead letter. Callers hold s.mu.
+func (s *DeadLetterStore) remove(id string) {
+	letter, ok := s.letters[id]
+	if !ok {
+		return
+	}
+	delete(s.letters, id)
+	if key := letter.key(); s.open[key] == id {
+		delete(s.open, key)
+	}
+}
+
+// Retried records a retry of a dead letter: a successful run resolves it and
+// a failed one is added to its attempts. It returns the dead letter, or nil
+// if it was discarded meanwhile.
+func (s *DeadLetterStore) Retried(id string, run *HistoryEntry) *DeadLetter {
+	if !isFailedRun(run) {
+		s.mu.Lock()
+		letter, ok := s.letters[id]
+		s.remove(id)
+		s.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		s.cluster.release(clusterDeadLetter, id)
+		return letter.snapshot()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, ok := s.letters[id]
+	if !ok {
+		return nil
+	}
+	letter.Reason = failureReason(run)
+	letter.Attempts = append(letter.Attempts, &DeadLetterAttempt{Reason: letter.Reason, Retry: true, Run: run})
+	letter.UpdatedAt = time.Now().UTC()
+	return letter.snapshot()
+}
+
+// Remove deletes a dead letter, reporting whether it existed
+func (s *DeadLetterStore) Remove(id string) bool {
+	s.mu.Lock()
+
+	_, ok := s.letters[id]
+	s.remove(id)
+	s.mu.Unlock()
+
+	if ok {
+		s.cluster.release(clusterDeadLetter, id)
+	}
+	return ok
+}
+
+// Get returns a snapshot of a dead letter
+func (s *DeadLetterStore) Get(id string) *DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, ok := s.letters[id]
+	if !ok {
+		return nil
+	}
+	return letter.snapshot()
+}
+
+// List returns snapshots of the dead letters, most recently failed first
+func (s *DeadLetterStore) List() []*DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters := make([]*DeadLetter, 0, len(s.letters))
+	for _, letter := range s.letters {
+		letters = append(letters, letter.snapshot())
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].UpdatedAt.After(letters[j].UpdatedAt)
+	})
+	return letters
+}
+
+// snapshot copies a dead letter for reading outside the store lock
+func (d *DeadLetter) snapshot() *DeadLetter {
+	snapshot := *d
+	snapshot.Attempts = append([]*DeadLetterAttempt(nil), d.Attempts...)
+	return &snapshot
+}
+
+// handleDeadLetters lists the dead letters
+func (s *ProxyServer) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	letters := s.deadLetters.List()
+	s.cluster.gather(r, func(body io.Reader) error {
+		var peer DeadLetterResponse
+		if err := json.NewDecoder(body).Decode(&peer); err != nil {
+			return err
+		}
+		letters = append(letters, peer.DeadLetters...)
+		return nil
+	})
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].UpdatedAt.After(letters[j].UpdatedAt)
+	})
+
+	response := &DeadLetterResponse{Success: true, DeadLetters: letters}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleDeadLetter returns (GET) or discards (DELETE) one dead letter
+func (s *ProxyServer) handleDeadLetter(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	letter := s.deadLetters.Get(id)
+	if letter == nil {
+		s.writeErrorResponse(w, "not_found", "Dead Letter Not Found", fmt.Sprintf("No dead letter with id %s", id))
+		return
+	}
+	if r.Method == "DELETE" {
+		s.deadLetters.Remove(id)
+	}
+
+	if err := json.NewEncoder(w).Encode(&DeadLetterResponse{Success: true, DeadLetter: letter}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleDeadLetterRetry runs a dead letter's request again. A successful run
+// resolves the dead letter; a failed one is added to its attempts.
+func (s *ProxyServer) handleDeadLetterRetry(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	letter := s.deadLetters.Get(id)
+	if letter == nil {
+		s.writeErrorResponse(w, "not_found", "Dead Letter Not Found", fmt.Sprintf("No dead letter with id %s", id))
+		return
+	}
+	if err := checkTargetURL(r.Context(), letter.Request.URL); err != nil {
+		s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+
+	s.logger.Printf("[%s] Retrying dead letter %s", requestID(w), id)
+	var run *HistoryEntry
+	if letter.Source == DeadLetterJob {
+		run = s.retryJob(letter)
+	} else {
+		run = s.runSchedule(&Schedule{ID: letter.ScheduleID, Name: letter.Name, Request: letter.Request})
+	}
+
+	response := &DeadLetterResponse{
+		Success:    true,
+		DeadLetter: s.deadLetters.Retried(id, run),
+		Resolved:   !isFailedRun(run),
+		Run:        run,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
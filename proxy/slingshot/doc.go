@@ -0,0 +1,24 @@
+// Package slingshot is the engine behind the RequestBite Slingshot proxy,
+// for Go programs that embed it instead of running the proxy binary.
+//
+// HTTPClient executes requests described by a ProxyRequest the same way the
+// /proxy/request endpoint does:
+//
+//	client := slingshot.NewHTTPClient(&slingshot.Config{})
+//	response, err := client.ExecuteRequest(ctx, &slingshot.ProxyRequest{
+//		Method: "GET",
+//		URL:    "https://api.example.com/health",
+//	})
+//
+// ProxyServer serves the proxy's endpoints, either on its own port with
+// Start or Serve, or mounted in another server through Handler:
+//
+//	server, err := slingshot.NewProxyServer(&slingshot.Config{Port: 8080})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	log.Fatal(server.Start())
+//
+// Config fields left at their zero value disable the feature they control or
+// use the same defaults as the proxy binary's flags.
+package slingshot
@@ -0,0 +1,531 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DefaultDownloadTimeout bounds one attempt of a download in seconds
+	DefaultDownloadTimeout = 600
+
+	// MaxDownloadResumes is the most automatic resumes a download may ask for
+	MaxDownloadResumes = 10
+)
+
+// Download states
+const (
+	DownloadRunning     = "downloading"
+	DownloadInterrupted = "interrupted"
+	DownloadComplete    = "complete"
+	DownloadFailed      = "failed"
+)
+
+// DownloadRequest is the JSON body of POST /proxy/downloads
+type DownloadRequest struct {
+	URL     string   `json:"url"`
+	Headers []string `json:"headers,omitempty"`
+	Timeout int      `json:"timeout,omitempty"` // Seconds per attempt
+	Resumes int      `json:"resumes,omitempty"` // Automatic resumes after an interruption
+
+	// Connections splits the download into this many byte ranges fetched in
+	// parallel, when the server supports range requests
+	Connections int `json:"connections,omitempty"`
+}
+
+// DownloadAttempt is one request made for a download
+type DownloadAttempt struct {
+	Range        string `json:"range,omitempty"`
+	Connections  int    `json:"connections,omitempty"`
+	Status       int    `json:"status,omitempty"`
+	Bytes        int64  `json:"bytes"`
+	ResponseTime string `json:"response_time"`
+	Restarted    bool   `json:"restarted,omitempty"` // The server sent the whole body instead of the rest
+	Error        string `json:"error,omitempty"`
+}
+
+// Download is a GET request whose body is written to disk and kept as an
+// artifact once complete. An interrupted download resumes where it stopped
+// when the server supports range requests.
+type Download struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Headers   []string  `json:"headers,omitempty"`
+	Timeout   int       `json:"timeout"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Received     int64  `json:"received"`
+	Total        int64  `json:"total"` // -1 until the server says
+	AcceptRanges string `json:"accept_ranges,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// Parallel downloads: the byte ranges fetched over separate connections,
+	// or why the download fell back to a single connection
+	Connections      int              `json:"connections,omitempty"`
+	Chunks           []*DownloadChunk `json:"chunks,omitempty"`
+	ParallelFallback string           `json:"parallel_fallback,omitempty"`
+
+	Attempts    []*DownloadAttempt `json:"attempts"`
+	ArtifactID  string             `json:"artifact_id,omitempty"`
+	ArtifactURL string             `json:"artifact_url,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// DownloadResponse is returned by the download endpoints
+type DownloadResponse struct {
+	Success   bool        `json:"success"`
+	Download  *Download   `json:"download,omitempty"`
+	Downloads []*Download `json:"downloads,omitempty"`
+}
+
+// DownloadStore keeps the downloads started through the proxy in memory
+type DownloadStore struct {
+	mu        sync.Mutex
+	downloads map[string]*Download
+}
+
+// NewDownloadStore creates an empty download store
+func NewDownloadStore() *DownloadStore {
+	return &DownloadStore{downloads: make(map[string]*Download)}
+}
+
+// Add registers a download
+func (s *DownloadStore) Add(download *Download) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downloads[download.ID] = download
+}
+
+// Get returns a snapshot of a download
+func (s *DownloadStore) Get(id string) *Download {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	download, ok := s.downloads[id]
+	if !ok {
+		return nil
+	}
+	return download.snapshot()
+}
+
+// List returns snapshots of all downloads, oldest first
+func (s *DownloadStore) List() []*Download {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	downloads := make([]*Download, 0, len(s.downloads))
+	for _, download := range s.downloads {
+		downloads = append(downloads, download.snapshot())
+	}
+	sort.Slice(downloads, func(i, j int) bool {
+		return downloads[i].CreatedAt.Before(downloads[j].CreatedAt)
+	})
+	return downloads
+}
+
+// Remove deletes a download, reporting whether it existed
+func (s *DownloadStore) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.downloads[id]
+	delete(s.downloads, id)
+	return ok
+}
+
+// claim marks a stopped download as running, reporting whether it was stopped
+func (s *DownloadStore) claim(id string) (*Download, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	download, ok := s.downloads[id]
+	if !ok || download.State == DownloadRunning || download.State == DownloadComplete {
+		return download, false
+	}
+	download.State = DownloadRunning
+	download.Error = ""
+	return download, true
+}
+
+// update changes a download while holding the store lock
+func (s *DownloadStore) update(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// snapshot copies a download for reading outside the store lock
+func (d *Download) snapshot() *Download {
+	snapshot := *d
+	snapshot.Attempts = make([]*DownloadAttempt, len(d.Attempts))
+	for i, attempt := range d.Attempts {
+		copied := *attempt
+		snapshot.Attempts[i] = &copied
+	}
+	if d.Chunks != nil {
+		snapshot.Chunks = make([]*DownloadChunk, len(d.Chunks))
+		for i, chunk := range d.Chunks {
+			copied := *chunk
+			snapshot.Chunks[i] = &copied
+		}
+	}
+	return &snapshot
+}
+
+// progressWriter counts the bytes written to a download as they arrive
+type progressWriter struct {
+	w   io.Writer
+	add func(n int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.add(int64(n))
+	return n, err
+}
+
+// runDownload makes attempts until the download completes, fails, or is
+// interrupted more than resumes times
+func (s *ProxyServer) runDownload(ctx context.Context, download *Download, resumes int) {
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if download.Connections > 1 {
+			retry = s.parallelDownloadAttempt(ctx, download)
+		} else {
+			retry = s.downloadAttempt(ctx, download)
+		}
+
+		var state string
+		s.downloads.update(func() { state = download.State })
+		if state != DownloadInterrupted || !retry || attempt >= resumes || ctx.Err() != nil {
+			return
+		}
+		s.logger.Printf("Resuming download %s at %d bytes", download.ID, download.Received)
+	}
+}
+
+// downloadAttempt requests the rest of a download and appends it to the
+// partial file, finishing the download when the body is complete. It reports
+// whether a failed attempt is worth resuming.
+func (s *ProxyServer) downloadAttempt(ctx context.Context, download *Download) bool {
+	start := time.Now()
+	attempt := &DownloadAttempt{}
+
+	fail := func(state, message string) {
+		s.downloads.update(func() {
+			download.State = state
+			download.Error = message
+			attempt.Error = message
+			attempt.ResponseTime = formatMillis(time.Since(start))
+		})
+	}
+
+	// Start over if the partial file is gone or shorter than recorded
+	partialPath := s.artifacts.partialPath(download.ID)
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fail(DownloadFailed, fmt.Sprintf("Failed to open download file: %v", err))
+		return false
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil || info.Size() < download.Received {
+		s.downloads.update(func() { download.Received = 0 })
+	}
+	file.Truncate(download.Received)
+	file.Seek(download.Received, io.SeekStart)
+
+	resumeFrom := download.Received
+	if resumeFrom > 0 {
+		attempt.Range = fmt.Sprintf("bytes=%d-", resumeFrom)
+	}
+	s.downloads.update(func() {
+		download.State = DownloadRunning
+		download.Error = ""
+		download.Attempts = append(download.Attempts, attempt)
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(download.Timeout)*time.Second)
+	defer cancel()
+
+	httpReq, err := s.newDownloadRequest(ctx, download, attempt.Range)
+	if err != nil {
+		fail(DownloadFailed, fmt.Sprintf("Failed to create request: %v", err))
+		return false
+	}
+	resp, err := s.sendDownloadRequest(httpReq)
+	if err != nil {
+		fail(DownloadInterrupted, fmt.Sprintf("Failed to connect to server: %v", err))
+		return true
+	}
+	defer resp.Body.Close()
+	s.downloads.update(func() { attempt.Status = resp.StatusCode })
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// The server sent the whole body: it ignored the range or the
+		// resource changed
+		file.Truncate(0)
+		file.Seek(0, io.SeekStart)
+		s.downloads.update(func() {
+			attempt.Restarted = resumeFrom > 0
+			download.Received = 0
+			download.Total = resp.ContentLength
+			download.AcceptRanges = resp.Header.Get("Accept-Ranges")
+			download.ContentType = resp.Header.Get("Content-Type")
+			download.ETag = resp.Header.Get("ETag")
+			download.LastModified = resp.Header.Get("Last-Modified")
+		})
+	case resp.StatusCode == http.StatusPartialContent && resumeFrom > 0:
+		cr, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err == nil {
+			err = validatePartialResponse(&byteRange{start: resumeFrom, end: -1}, cr, -1)
+		}
+		if err != nil {
+			fail(DownloadFailed, err.Error())
+			return false
+		}
+		s.downloads.update(func() {
+			download.Total = cr.Total
+			download.AcceptRanges = "bytes"
+		})
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && resumeFrom > 0 && resumeFrom == download.Total:
+		// Everything had arrived before the connection dropped
+	default:
+		fail(DownloadFailed, fmt.Sprintf("Server returned %s", resp.Status))
+		return false
+	}
+
+	writer := &progressWriter{w: file, add: func(n int64) {
+		s.downloads.update(func() {
+			download.Received += n
+			attempt.Bytes += n
+		})
+	}}
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		if _, err := io.Copy(writer, resp.Body); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("attempt timed out after %d seconds", download.Timeout)
+			}
+			fail(DownloadInterrupted, fmt.Sprintf("Download interrupted: %v", err))
+			return true
+		}
+	}
+	if download.Total >= 0 && download.Received != download.Total {
+		fail(DownloadInterrupted, fmt.Sprintf("Download interrupted after %d of %d bytes", download.Received, download.Total))
+		return true
+	}
+	if err := file.Close(); err != nil {
+		fail(DownloadFailed, fmt.Sprintf("Failed to write download file: %v", err))
+		return false
+	}
+
+	if err := s.finishDownload(download); err != nil {
+		fail(DownloadFailed, err.Error())
+		return false
+	}
+	s.downloads.update(func() { attempt.ResponseTime = formatMillis(time.Since(start)) })
+	return false
+}
+
+// newDownloadRequest builds a GET request for a download. A byte range is
+// only honored if the resource has not changed since the download started.
+func (s *ProxyServer) newDownloadRequest(ctx context.Context, download *Download, byteRange string) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, download.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	headers := s.httpClient.parseHeaders(download.Headers)
+	removeHopByHopHeaders(headers, nil)
+	httpReq.Header = headers
+	if httpReq.Header.Get("User-Agent") == "" {
+		httpReq.Header.Set("User-Agent", fmt.Sprintf("rb-slingshot/%s (https://requestbite.com/slingshot)", Version))
+	}
+
+	if byteRange != "" {
+		httpReq.Header.Set("Range", byteRange)
+		if download.ETag != "" && !strings.HasPrefix(download.ETag, "W/") {
+			httpReq.Header.Set("If-Range", download.ETag)
+		} else if download.LastModified != "" {
+			httpReq.Header.Set("If-Range", download.LastModified)
+		}
+	}
+	return httpReq, nil
+}
+
+// sendDownloadRequest sends a download request, following redirects
+func (s *ProxyServer) sendDownloadRequest(httpReq *http.Request) (*http.Response, error) {
+	policy, _ := newRedirectPolicy(&ProxyRequest{})
+	client := *s.httpClient.client
+	resp, _, err := s.httpClient.followRedirects(&client, httpReq, policy)
+	return resp, err
+}
+
+// finishDownload moves a complete download into the artifact store
+func (s *ProxyServer) finishDownload(download *Download) error {
+	// Stored copies never hold what the scrub rules match
+	path := s.artifacts.partialPath(download.ID)
+	if err := s.scrubber.File(path); err != nil {
+		return fmt.Errorf("Failed to scrub download: %v", err)
+	}
+	artifact, err := s.artifacts.PutFile(path, download.ContentType)
+	if err != nil {
+		return err
+	}
+	s.downloads.update(func() {
+		download.State = DownloadComplete
+		download.Total = download.Received
+		download.ArtifactID = artifact.ID
+		download.ArtifactURL = s.artifacts.URL(artifact)
+	})
+	return nil
+}
+
+// handleDownloads lists (GET) or starts (POST) downloads. A POST returns once
+// the download has completed, failed or been interrupted.
+func (s *ProxyServer) handleDownloads(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := &DownloadResponse{Success: true}
+	if r.Method == "POST" {
+		var req DownloadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+			return
+		}
+
+		asciiURL, _, _, err := toASCIIURL(req.URL)
+		if err == nil {
+			err = s.httpClient.validateURL(asciiURL)
+		}
+		if err != nil {
+			s.writeErrorResponse(w, "url_validation_error", "Invalid URL", err.Error())
+			return
+		}
+		if err := checkTargetURL(r.Context(), asciiURL); err != nil {
+			s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+			return
+		}
+		if req.Resumes < 0 || req.Resumes > MaxDownloadResumes {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Download", fmt.Sprintf("resumes must be between 0 and %d", MaxDownloadResumes))
+			return
+		}
+		if req.Connections < 0 || req.Connections > MaxDownloadConnections {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Download", fmt.Sprintf("connections must be between 1 and %d", MaxDownloadConnections))
+			return
+		}
+		if req.Timeout <= 0 {
+			req.Timeout = DefaultDownloadTimeout
+		}
+
+		download := &Download{
+			ID:          newRequestID(),
+			URL:         asciiURL,
+			Headers:     req.Headers,
+			Timeout:     req.Timeout,
+			Connections: max(req.Connections, 1),
+			State:       DownloadRunning,
+			CreatedAt:   time.Now().UTC(),
+			Total:       -1,
+		}
+		s.downloads.Add(download)
+
+		s.logger.Printf("[%s] Downloading %s (download %s)", requestID(w), download.URL, download.ID)
+		s.runDownload(r.Context(), download, req.Resumes)
+		response.Download = s.downloads.Get(download.ID)
+	} else {
+		response.Downloads = s.downloads.List()
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleDownload returns (GET) or deletes (DELETE) one download. Deleting
+// removes its partial file but keeps the artifact of a completed download.
+func (s *ProxyServer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	download := s.downloads.Get(id)
+	if download == nil {
+		s.writeErrorResponse(w, "not_found", "Download Not Found", fmt.Sprintf("No download with id %s", id))
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if download.State == DownloadRunning {
+			s.writeErrorResponse(w, "request_format_error", "Download Running", "A running download cannot be deleted")
+			return
+		}
+		s.downloads.Remove(id)
+		os.Remove(s.artifacts.partialPath(id))
+	}
+
+	if err := json.NewEncoder(w).Encode(&DownloadResponse{Success: true, Download: download}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleDownloadResume resumes an interrupted or failed download
+// (?resumes= sets the automatic resumes for this call)
+func (s *ProxyServer) handleDownloadResume(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	download, ok := s.downloads.claim(id)
+	if download == nil {
+		s.writeErrorResponse(w, "not_found", "Download Not Found", fmt.Sprintf("No download with id %s", id))
+		return
+	}
+	if !ok {
+		s.writeErrorResponse(w, "request_format_error", "Download Not Resumable", "Only interrupted or failed downloads can be resumed")
+		return
+	}
+
+	resumes := 0
+	if resumesStr := r.URL.Query().Get("resumes"); resumesStr != "" {
+		if n, err := strconv.Atoi(resumesStr); err == nil && n > 0 {
+			resumes = min(n, MaxDownloadResumes)
+		}
+	}
+
+	s.logger.Printf("[%s] Resuming download %s at %d bytes", requestID(w), id, download.Received)
+	s.runDownload(r.Context(), download, resumes)
+
+	if err := json.NewEncoder(w).Encode(&DownloadResponse{Success: true, Download: s.downloads.Get(id)}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
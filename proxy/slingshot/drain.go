@@ -0,0 +1,142 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDrainTimeout bounds how long a shutdown waits for requests in flight
+const DefaultDrainTimeout = 30 * time.Second
+
+// drainRetryAfter is the Retry-After sent with requests rejected while
+// draining, by when another instance should have taken over
+const drainRetryAfter = 5
+
+// drainPollInterval is how often Drain checks whether requests finished
+const drainPollInterval = 100 * time.Millisecond
+
+// AdminDrainResponse is returned by the /admin/drain endpoint
+type AdminDrainResponse struct {
+	Success        bool   `json:"success"`
+	Draining       bool   `json:"draining"`
+	Since          string `json:"since,omitempty"`
+	ActiveRequests int    `json:"active_requests"`
+}
+
+// drainingSince returns when the server started draining, or nil while it
+// serves normally
+func (s *ProxyServer) drainingSince() *time.Time {
+	return s.draining.Load()
+}
+
+// StartDrain puts the server in lame-duck mode: readiness fails, new
+// requests are rejected and requests in flight run to completion. It reports
+// whether the server was serving normally before.
+func (s *ProxyServer) StartDrain() bool {
+	now := time.Now().UTC()
+	if !s.draining.CompareAndSwap(nil, &now) {
+		return false
+	}
+	s.server.SetKeepAlivesEnabled(false)
+	s.logger.Printf("Draining: rejecting new requests, %d in flight", len(s.active.List()))
+	return true
+}
+
+// StopDrain takes the server out of lame-duck mode
+func (s *ProxyServer) StopDrain() bool {
+	if s.draining.Swap(nil) == nil {
+		return false
+	}
+	s.server.SetKeepAlivesEnabled(true)
+	s.logger.Printf("Stopped draining, accepting requests again")
+	return true
+}
+
+// Drain starts draining and waits until the requests in flight finished or
+// ctx is done
+func (s *ProxyServer) Drain(ctx context.Context) error {
+	s.StartDrain()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		active := len(s.active.List())
+		if active == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests still in flight: %v", active, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainExempt reports whether a path keeps answering while draining, so
+// probes and administrators can follow the drain
+func drainExempt(path string) bool {
+	return path == "/health" || strings.HasPrefix(path, "/health/") ||
+		path == "/version" ||
+		strings.HasPrefix(path, "/admin/")
+}
+
+// drainMiddleware rejects new requests with 503 Service Unavailable while
+// draining, so load balancers retry them on another instance
+func (s *ProxyServer) drainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.drainingSince() == nil || drainExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		response := &ProxyResponse{
+			Success:      false,
+			RequestID:    requestID(w),
+			ErrorType:    DrainingError.Type,
+			ErrorTitle:   DrainingError.Title,
+			ErrorMessage: "The proxy is shutting down and no longer accepts requests; retry on another instance",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Retry-After", strconv.Itoa(drainRetryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			s.logger.Printf("Failed to encode error response: %v", err)
+		}
+	})
+}
+
+// handleAdminDrain reports (GET), starts (POST) or stops (DELETE) draining
+func (s *ProxyServer) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		s.StartDrain()
+	case "DELETE":
+		s.StopDrain()
+	}
+
+	response := &AdminDrainResponse{Success: true, ActiveRequests: len(s.active.List())}
+	if since := s.drainingSince(); since != nil {
+		response.Draining = true
+		response.Since = since.Format(time.RFC3339)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
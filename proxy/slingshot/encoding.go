@@ -0,0 +1,41 @@
+package slingshot
+
+import (
+	"encoding/base64"
+	"net/http"
+)
+
+// rawAcceptEncoding is offered when the caller wants the compressed bytes
+// exactly as the server sends them
+const rawAcceptEncoding = "gzip, deflate, br"
+
+// requestRawEncoding makes sure the server may compress the response and that
+// the transport won't transparently decompress it. Go only decodes responses
+// when it added Accept-Encoding itself, so setting it explicitly is enough.
+func requestRawEncoding(httpReq *http.Request) {
+	if httpReq.Header.Get("Accept-Encoding") == "" {
+		httpReq.Header.Set("Accept-Encoding", rawAcceptEncoding)
+	}
+}
+
+// reportContentEncoding records the response Content-Encoding. Bodies that
+// were not decoded are returned as base64 since they are compressed bytes.
+func reportContentEncoding(resp *http.Response, body []byte, response *ProxyResponse) {
+	if resp.Uncompressed {
+		// The transport decoded a gzip response and removed the header
+		response.ContentEncoding = "gzip"
+		response.Decoded = true
+		return
+	}
+
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding == "" || encoding == "identity" {
+		return
+	}
+
+	response.ContentEncoding = encoding
+	if len(body) > 0 {
+		response.ResponseData = base64.StdEncoding.EncodeToString(body)
+		response.IsBinary = true
+	}
+}
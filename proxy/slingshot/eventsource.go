@@ -0,0 +1,663 @@
+package slingshot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// MaxEventSources is the number of SSE sessions that may exist at once
+	MaxEventSources = 50
+
+	// MaxEventSourceEvents is the number of events kept per session
+	MaxEventSourceEvents = 1000
+
+	// DefaultEventSourceRetry is the reconnection delay used until the
+	// target sends a retry field, as in browsers
+	DefaultEventSourceRetry = 3 * time.Second
+)
+
+// EventSourceOpenRequest is the JSON body of POST /sse/sessions
+type EventSourceOpenRequest struct {
+	Name          string   `json:"name,omitempty"`
+	URL           string   `json:"url"`
+	Headers       []string `json:"headers,omitempty"`
+	LastEventID   string   `json:"lastEventId,omitempty"`   // Resume a stream from this event
+	Retry         int      `json:"retry,omitempty"`         // Milliseconds between reconnections until the target sends retry
+	MaxReconnects int      `json:"maxReconnects,omitempty"` // Reconnections in a row before giving up; 0 means no limit
+}
+
+// ServerSentEvent is an event received from a target
+type ServerSentEvent struct {
+	Seq   int64     `json:"seq"`
+	ID    string    `json:"id,omitempty"`
+	Event string    `json:"event"`
+	Data  string    `json:"data"`
+	Time  time.Time `json:"time"`
+}
+
+// EventSourceInfo describes an SSE session
+type EventSourceInfo struct {
+	ID          string     `json:"id"`
+	URL         string     `json:"url"`
+	State       string     `json:"state"` // "connecting", "open", "reconnecting" or "closed"
+	LastEventID string     `json:"last_event_id,omitempty"`
+	Events      int        `json:"events"`
+	Connects    int        `json:"connects"`
+	Retry       int64      `json:"retry_ms"`
+	LastError   string     `json:"last_error,omitempty"`
+	OpenedAt    time.Time  `json:"opened_at"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+}
+
+// EventSourceResponse is returned for a single SSE session
+type EventSourceResponse struct {
+	Success bool             `json:"success"`
+	Session *EventSourceInfo `json:"session"`
+}
+
+// EventSourcesResponse is returned when listing SSE sessions
+type EventSourcesResponse struct {
+	Success  bool               `json:"success"`
+	Sessions []*EventSourceInfo `json:"sessions"`
+}
+
+// EventSourceEventsResponse is returned when polling an SSE session's events
+type EventSourceEventsResponse struct {
+	Success bool               `json:"success"`
+	State   string             `json:"state"`
+	Events  []*ServerSentEvent `json:"events"`
+}
+
+// errEventSourceFailed ends a session without reconnecting, like an
+// EventSource that fails on a response it cannot use
+type errEventSourceFailed struct{ message string }
+
+func (e *errEventSourceFailed) Error() string { return e.message }
+
+// EventSource keeps an SSE connection to a target, reconnecting with
+// Last-Event-ID when it drops, and buffers the events it receives
+type EventSource struct {
+	mu          sync.Mutex
+	client      *http.Client
+	req         EventSourceOpenRequest
+	info        EventSourceInfo
+	retry       time.Duration
+	seq         int64
+	events      []*ServerSentEvent
+	subscribers map[chan *ServerSentEvent]struct{}
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// record numbers an event, keeps it and notifies subscribers
+func (es *EventSource) record(event *ServerSentEvent) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.seq++
+	event.Seq = es.seq
+	event.Time = time.Now().UTC()
+	es.info.Events++
+	es.events = append(es.events, event)
+	if len(es.events) > MaxEventSourceEvents {
+		es.events = es.events[len(es.events)-MaxEventSourceEvents:]
+	}
+
+	// Slow subscribers miss events rather than stall the connection
+	for ch := range es.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// setState updates the session state, recording err as the last error
+func (es *EventSource) setState(state string, err error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.info.State = state
+	if err != nil {
+		es.info.LastError = err.Error()
+	}
+	if state == "closed" {
+		closedAt := time.Now().UTC()
+		es.info.ClosedAt = &closedAt
+	}
+}
+
+// run connects until the session is closed, the target refuses the stream
+// or maxReconnects attempts in a row fail
+func (es *EventSource) run(ctx context.Context) {
+	defer close(es.done)
+
+	failures := 0
+	for {
+		received, err := es.connect(ctx)
+		if ctx.Err() != nil {
+			es.setState("closed", nil)
+			return
+		}
+		if _, ok := err.(*errEventSourceFailed); ok {
+			es.setState("closed", err)
+			return
+		}
+		if received {
+			failures = 0
+		}
+		failures++
+		if es.req.MaxReconnects > 0 && failures > es.req.MaxReconnects {
+			es.setState("closed", fmt.Errorf("Gave up after %d reconnections: %v", es.req.MaxReconnects, err))
+			return
+		}
+
+		es.setState("reconnecting", err)
+		es.mu.Lock()
+		retry := es.retry
+		es.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			es.setState("closed", nil)
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// connect reads one connection's events until it ends, reporting whether
+// any event arrived
+func (es *EventSource) connect(ctx context.Context) (bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", es.req.URL, nil)
+	if err != nil {
+		return false, &errEventSourceFailed{err.Error()}
+	}
+	for _, field := range parseHeaderFields(es.req.Headers) {
+		httpReq.Header.Add(field.Name, field.Value)
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("Cache-Control", "no-cache")
+
+	es.mu.Lock()
+	es.info.Connects++
+	if es.info.LastEventID != "" {
+		httpReq.Header.Set("Last-Event-ID", es.info.LastEventID)
+	}
+	es.mu.Unlock()
+
+	resp, err := es.client.Do(httpReq)
+	if err != nil {
+		return false, fmt.Errorf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// As in browsers, only a 200 event stream is read, and 204 ends the session
+	if resp.StatusCode == http.StatusNoContent {
+		return false, &errEventSourceFailed{"The target ended the stream with HTTP 204"}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, &errEventSourceFailed{fmt.Sprintf("The target returned HTTP %d", resp.StatusCode)}
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		return false, &errEventSourceFailed{fmt.Sprintf("The target returned %q instead of text/event-stream", resp.Header.Get("Content-Type"))}
+	}
+	es.setState("open", nil)
+
+	es.mu.Lock()
+	lastEventID := es.info.LastEventID
+	es.mu.Unlock()
+
+	received := false
+	err = readServerSentEvents(resp.Body, lastEventID, func(event *ServerSentEvent, lastEventID string, retry int64) {
+		es.mu.Lock()
+		es.info.LastEventID = lastEventID
+		if retry >= 0 {
+			es.retry = time.Duration(retry) * time.Millisecond
+			es.info.Retry = retry
+		}
+		es.mu.Unlock()
+		if event != nil {
+			received = true
+			es.record(event)
+		}
+	})
+	if err == nil {
+		err = fmt.Errorf("The target closed the stream")
+	}
+	return received, err
+}
+
+// readServerSentEvents parses an event stream that continues from
+// lastEventID. dispatch is called at the end of each event, with nil when
+// the event has no data, and for each retry field, with retry -1 otherwise.
+func readServerSentEvents(body io.Reader, lastEventID string, dispatch func(event *ServerSentEvent, lastEventID string, retry int64)) error {
+	reader := bufio.NewReader(body)
+	var data []string
+	var eventType string
+	hasData := false
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			// A blank line dispatches the buffered event
+			var event *ServerSentEvent
+			if hasData {
+				event = &ServerSentEvent{ID: lastEventID, Event: eventType, Data: strings.Join(data, "\n")}
+				if event.Event == "" {
+					event.Event = "message"
+				}
+			}
+			dispatch(event, lastEventID, -1)
+			data, eventType, hasData = nil, "", false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "event":
+			eventType = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				lastEventID = value
+			}
+		case "retry":
+			if retry, err := strconv.ParseInt(value, 10, 64); err == nil && retry >= 0 {
+				dispatch(nil, lastEventID, retry)
+			}
+		}
+	}
+}
+
+// Info returns a copy of the session's description
+func (es *EventSource) Info() *EventSourceInfo {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	info := es.info
+	return &info
+}
+
+// Events returns the kept events numbered after seq
+func (es *EventSource) Events(after int64) []*ServerSentEvent {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	events := []*ServerSentEvent{}
+	for _, event := range es.events {
+		if event.Seq > after {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Subscribe returns the kept events numbered after seq, a channel receiving
+// new events, and a function to stop the subscription
+func (es *EventSource) Subscribe(after int64) ([]*ServerSentEvent, <-chan *ServerSentEvent, func()) {
+	ch := make(chan *ServerSentEvent, 64)
+
+	es.mu.Lock()
+	events := []*ServerSentEvent{}
+	for _, event := range es.events {
+		if event.Seq > after {
+			events = append(events, event)
+		}
+	}
+	es.subscribers[ch] = struct{}{}
+	es.mu.Unlock()
+
+	return events, ch, func() {
+		es.mu.Lock()
+		delete(es.subscribers, ch)
+		es.mu.Unlock()
+	}
+}
+
+// EventSourceStore keeps the SSE sessions
+type EventSourceStore struct {
+	mu       sync.Mutex
+	client   *http.Client
+	sessions map[string]*EventSource
+}
+
+// NewEventSourceStore creates an empty SSE session store. Connections use
+// transport without a timeout, as they stay open.
+func NewEventSourceStore(transport http.RoundTripper) *EventSourceStore {
+	return &EventSourceStore{
+		client:   &http.Client{Transport: transport},
+		sessions: make(map[string]*EventSource),
+	}
+}
+
+// Open starts a session connecting to a target in the background
+func (s *EventSourceStore) Open(req *EventSourceOpenRequest) (*EventSource, error) {
+	id := req.Name
+	if id == "" {
+		id = newRequestID()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[id]; exists {
+		return nil, fmt.Errorf("A session named %s already exists", id)
+	}
+	if len(s.sessions) >= MaxEventSources {
+		return nil, fmt.Errorf("Too many sessions; close one first (maximum %d)", MaxEventSources)
+	}
+
+	retry := DefaultEventSourceRetry
+	if req.Retry > 0 {
+		retry = time.Duration(req.Retry) * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &EventSource{
+		client: s.client,
+		req:    *req,
+		info: EventSourceInfo{
+			ID:          id,
+			URL:         req.URL,
+			State:       "connecting",
+			LastEventID: req.LastEventID,
+			Retry:       retry.Milliseconds(),
+			OpenedAt:    time.Now().UTC(),
+		},
+		retry:       retry,
+		subscribers: make(map[chan *ServerSentEvent]struct{}),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	s.sessions[id] = session
+	go session.run(ctx)
+	return session, nil
+}
+
+// Get returns a session, or nil if there is none with that id
+func (s *EventSourceStore) Get(id string) *EventSource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sessions[id]
+}
+
+// List describes all sessions, oldest first
+func (s *EventSourceStore) List() []*EventSourceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []*EventSourceInfo{}
+	for _, session := range s.sessions {
+		sessions = append(sessions, session.Info())
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].OpenedAt.Before(sessions[j].OpenedAt)
+	})
+	return sessions
+}
+
+// Remove stops a session and forgets it
+func (s *EventSourceStore) Remove(id string) {
+	s.mu.Lock()
+	session := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	if session != nil {
+		session.cancel()
+		<-session.done
+	}
+}
+
+// eventSource returns the session named in the route, writing an error
+// response when there is none
+func (s *ProxyServer) eventSource(w http.ResponseWriter, r *http.Request) *EventSource {
+	id := mux.Vars(r)["id"]
+	session := s.eventSources.Get(id)
+	if session == nil {
+		w.Header().Set("Content-Type", "application/json")
+		s.writeErrorResponse(w, "not_found", "Session Not Found", fmt.Sprintf("No SSE session with id %s", id))
+	}
+	return session
+}
+
+// handleEventSources lists (GET) or opens (POST) SSE sessions
+func (s *ProxyServer) handleEventSources(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "GET" {
+		sessions := s.eventSources.List()
+		s.cluster.gather(r, func(body io.Reader) error {
+			var peer EventSourcesResponse
+			if err := json.NewDecoder(body).Decode(&peer); err != nil {
+				return err
+			}
+			sessions = append(sessions, peer.Sessions...)
+			return nil
+		})
+		sort.Slice(sessions, func(i, j int) bool { return sessions[i].OpenedAt.Before(sessions[j].OpenedAt) })
+
+		response := &EventSourcesResponse{Success: true, Sessions: sessions}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			s.logger.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+
+	var req EventSourceOpenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if err := s.httpClient.validateURL(req.URL); err != nil {
+		s.writeErrorResponse(w, URLValidationError.Type, URLValidationError.Title, err.Error())
+		return
+	}
+	if err := checkTargetURL(r.Context(), req.URL); err != nil {
+		s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+	if req.Name != "" && !hookBucketPattern.MatchString(req.Name) {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Name", "Session names may only contain letters, digits, '-' and '_'")
+		return
+	}
+
+	if req.Name != "" {
+		if err := s.cluster.ClaimSession(clusterSessionEventSource, req.Name); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Session", err.Error())
+			return
+		}
+	}
+	session, err := s.eventSources.Open(&req)
+	if err != nil {
+		// Keep the claim of the local session holding the name
+		if req.Name != "" && s.eventSources.Get(req.Name) == nil {
+			s.cluster.ReleaseSession(clusterSessionEventSource, req.Name)
+		}
+		s.writeErrorResponse(w, "request_format_error", "Invalid Session", err.Error())
+		return
+	}
+	if req.Name == "" {
+		if err := s.cluster.ClaimSession(clusterSessionEventSource, session.Info().ID); err != nil {
+			s.logger.Printf("[%s] Failed to record SSE session in the cluster: %v", requestID(w), err)
+		}
+	}
+	s.logger.Printf("[%s] Opened SSE session %s to %s", requestID(w), session.Info().ID, req.URL)
+
+	response := &EventSourceResponse{Success: true, Session: session.Info()}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleEventSource describes (GET) or closes (DELETE) an SSE session
+func (s *ProxyServer) handleEventSource(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	session := s.eventSource(w, r)
+	if session == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "DELETE" {
+		s.eventSources.Remove(mux.Vars(r)["id"])
+		s.cluster.ReleaseSession(clusterSessionEventSource, mux.Vars(r)["id"])
+		s.logger.Printf("[%s] Closed SSE session %s", requestID(w), mux.Vars(r)["id"])
+	}
+
+	response := &EventSourceResponse{Success: true, Session: session.Info()}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleEventSourceEvents returns the kept events of an SSE session,
+// optionally only those numbered after the "after" query parameter
+func (s *ProxyServer) handleEventSourceEvents(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	session := s.eventSource(w, r)
+	if session == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	response := &EventSourceEventsResponse{
+		Success: true,
+		State:   session.Info().State,
+		Events:  session.Events(after),
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleEventSourceFeed streams an SSE session's events. Events numbered
+// after the "after" query parameter or the Last-Event-ID header are
+// replayed first.
+func (s *ProxyServer) handleEventSourceFeed(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	session := s.eventSource(w, r)
+	if session == nil {
+		return
+	}
+
+	after := int64(-1)
+	if value := r.URL.Query().Get("after"); value != "" {
+		after, _ = strconv.ParseInt(value, 10, 64)
+	} else if value := r.Header.Get("Last-Event-ID"); value != "" {
+		after, _ = strconv.ParseInt(value, 10, 64)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher, _ := w.(http.Flusher)
+
+	// Without a starting point, only new events are streamed
+	replay, events, unsubscribe := session.Subscribe(after)
+	defer unsubscribe()
+	if after < 0 {
+		replay = nil
+	}
+
+	// Events are relayed under their own type, numbered by seq so the
+	// caller's EventSource resumes from the buffer when it reconnects
+	write := func(event *ServerSentEvent) bool {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", event.Event, event.Seq, data); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	// Open the stream right away so EventSource reports it as connected
+	fmt.Fprint(w, ": connected\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for _, event := range replay {
+		if !write(event) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-session.done:
+			// Deliver what arrived before the session ended, then report it
+		drain:
+			for {
+				select {
+				case event := <-events:
+					write(event)
+				default:
+					break drain
+				}
+			}
+			data, _ := json.Marshal(session.Info())
+			fmt.Fprintf(w, "event: session_closed\ndata: %s\n\n", data)
+			return
+		case event := <-events:
+			if !write(event) {
+				return
+			}
+		}
+	}
+}
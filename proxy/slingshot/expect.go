@@ -0,0 +1,50 @@
+package slingshot
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// DefaultExpectContinueTimeout is how long to wait for a 100 Continue before
+// sending the body anyway
+const DefaultExpectContinueTimeout = 1 * time.Second
+
+// continueTrace records whether and when a 100 Continue interim response arrived
+type continueTrace struct {
+	mu           sync.Mutex
+	headersSent  time.Time
+	continueTime time.Time
+}
+
+// trace attaches the client trace to the request
+func (t *continueTrace) trace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		WroteHeaders: func() {
+			t.mu.Lock()
+			t.headersSent = time.Now()
+			t.mu.Unlock()
+		},
+		Got100Continue: func() {
+			t.mu.Lock()
+			t.continueTime = time.Now()
+			t.mu.Unlock()
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// annotate reports whether the interim response was received and how long
+// after the request headers it arrived
+func (t *continueTrace) annotate(response *ProxyResponse) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	received := !t.continueTime.IsZero()
+	response.ContinueReceived = &received
+	if received {
+		response.ContinueTime = formatMillis(t.continueTime.Sub(t.headersSent))
+	}
+}
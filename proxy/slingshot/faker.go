@@ -0,0 +1,166 @@
+package slingshot
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+var (
+	fakeFirstNames = []string{
+		"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda",
+		"William", "Elizabeth", "David", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+		"Thomas", "Sarah", "Charles", "Karen", "Daniel", "Nancy", "Matthew", "Lisa",
+		"Anthony", "Betty", "Mark", "Margaret", "Steven", "Sandra", "Paul", "Ashley",
+		"Andrew", "Emily", "Joshua", "Donna", "Kenneth", "Michelle", "Kevin", "Carol",
+	}
+	fakeLastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+		"Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas",
+		"Taylor", "Moore", "Jackson", "Martin", "Lee", "Perez", "Thompson", "White",
+		"Harris", "Sanchez", "Clark", "Ramirez", "Lewis", "Robinson", "Walker", "Young",
+	}
+	fakeStreetNames = []string{
+		"Main", "Oak", "Pine", "Maple", "Cedar", "Elm", "Washington", "Lake",
+		"Hill", "Park", "Sunset", "Highland", "River", "Church", "Mill", "Spring",
+	}
+	fakeStreetSuffixes = []string{"Street", "Avenue", "Road", "Lane", "Drive", "Court", "Way", "Boulevard"}
+	fakeCities         = []string{
+		"Springfield", "Riverside", "Franklin", "Greenville", "Bristol", "Clinton", "Fairview", "Salem",
+		"Madison", "Georgetown", "Arlington", "Ashland", "Dover", "Oxford", "Jackson", "Burlington",
+	}
+	fakeStates = []string{
+		"AL", "AZ", "CA", "CO", "FL", "GA", "IL", "MA", "MI", "MN", "NC", "NJ", "NY", "OH", "OR", "PA", "TX", "VA", "WA", "WI",
+	}
+	fakeCountries = []string{
+		"United States", "Canada", "United Kingdom", "Germany", "France", "Sweden", "Norway", "Denmark",
+		"Netherlands", "Spain", "Italy", "Australia", "Japan", "Brazil", "Mexico", "India",
+	}
+	fakeCompanySuffixes = []string{"Inc", "LLC", "Group", "Ltd", "and Sons", "Holdings"}
+	fakeEmailDomains    = []string{"example.com", "example.net", "example.org"}
+	fakeWords           = []string{
+		"alpha", "bravo", "cloud", "delta", "echo", "forest", "garden", "harbor",
+		"island", "jungle", "kettle", "lemon", "meadow", "north", "ocean", "pepper",
+		"quartz", "river", "silver", "timber", "umbrella", "valley", "willow", "yellow",
+	}
+
+	// fakeCardPrefixes are the leading digits and lengths of test card numbers
+	fakeCardPrefixes = []struct {
+		prefix string
+		length int
+	}{
+		{"4", 16},    // Visa
+		{"51", 16},   // Mastercard
+		{"55", 16},   // Mastercard
+		{"34", 15},   // American Express
+		{"37", 15},   // American Express
+		{"6011", 16}, // Discover
+	}
+)
+
+// fakeFuncs generate fake data for {{fake.*}} placeholders
+var fakeFuncs = map[string]templateFunc{
+	"firstName": func(args []interface{}) (interface{}, error) {
+		return pick(fakeFirstNames), nil
+	},
+	"lastName": func(args []interface{}) (interface{}, error) {
+		return pick(fakeLastNames), nil
+	},
+	"name": func(args []interface{}) (interface{}, error) {
+		return pick(fakeFirstNames) + " " + pick(fakeLastNames), nil
+	},
+	"username": func(args []interface{}) (interface{}, error) {
+		return fakeUsername(), nil
+	},
+	"email": func(args []interface{}) (interface{}, error) {
+		return fakeUsername() + "@" + pick(fakeEmailDomains), nil
+	},
+	"phone": func(args []interface{}) (interface{}, error) {
+		return fmt.Sprintf("+1-%d-555-%04d", 200+rand.IntN(800), rand.IntN(10000)), nil
+	},
+	"company": func(args []interface{}) (interface{}, error) {
+		return pick(fakeLastNames) + " " + pick(fakeCompanySuffixes), nil
+	},
+	"street": func(args []interface{}) (interface{}, error) {
+		return fakeStreet(), nil
+	},
+	"city": func(args []interface{}) (interface{}, error) {
+		return pick(fakeCities), nil
+	},
+	"state": func(args []interface{}) (interface{}, error) {
+		return pick(fakeStates), nil
+	},
+	"zip": func(args []interface{}) (interface{}, error) {
+		return fmt.Sprintf("%05d", rand.IntN(100000)), nil
+	},
+	"country": func(args []interface{}) (interface{}, error) {
+		return pick(fakeCountries), nil
+	},
+	"address": func(args []interface{}) (interface{}, error) {
+		return fmt.Sprintf("%s, %s, %s %05d", fakeStreet(), pick(fakeCities), pick(fakeStates), rand.IntN(100000)), nil
+	},
+	"creditCard": func(args []interface{}) (interface{}, error) {
+		return fakeCardNumber(), nil
+	},
+	"cvv": func(args []interface{}) (interface{}, error) {
+		return fmt.Sprintf("%03d", rand.IntN(1000)), nil
+	},
+	"word": func(args []interface{}) (interface{}, error) {
+		return pick(fakeWords), nil
+	},
+	"sentence": func(args []interface{}) (interface{}, error) {
+		words := make([]string, 4+rand.IntN(6))
+		for i := range words {
+			words[i] = pick(fakeWords)
+		}
+		sentence := strings.Join(words, " ")
+		return strings.ToUpper(sentence[:1]) + sentence[1:] + ".", nil
+	},
+}
+
+// pick returns a random element of values
+func pick(values []string) string {
+	return values[rand.IntN(len(values))]
+}
+
+// fakeUsername returns a lowercase name with a number, such as mary.smith42
+func fakeUsername() string {
+	return strings.ToLower(pick(fakeFirstNames)+"."+pick(fakeLastNames)) + fmt.Sprint(rand.IntN(100))
+}
+
+// fakeStreet returns a street address, such as 123 Oak Avenue
+func fakeStreet() string {
+	return fmt.Sprintf("%d %s %s", 1+rand.IntN(9999), pick(fakeStreetNames), pick(fakeStreetSuffixes))
+}
+
+// fakeCardNumber returns a card number that passes the Luhn check
+func fakeCardNumber() string {
+	card := fakeCardPrefixes[rand.IntN(len(fakeCardPrefixes))]
+	digits := make([]int, card.length)
+	for i, c := range card.prefix {
+		digits[i] = int(c - '0')
+	}
+	for i := len(card.prefix); i < card.length-1; i++ {
+		digits[i] = rand.IntN(10)
+	}
+
+	// Choose the check digit so the Luhn sum is a multiple of 10
+	sum := 0
+	for i := card.length - 2; i >= 0; i-- {
+		d := digits[i]
+		if (card.length-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	digits[card.length-1] = (10 - sum%10) % 10
+
+	var b strings.Builder
+	for _, d := range digits {
+		b.WriteByte(byte('0' + d))
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package slingshot
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// resolveUploadPath resolves a server-side file path and makes sure it lives
+// inside one of the directories the operator allowed uploads from
+func resolveUploadPath(path string, allowedDirs []string) (string, error) {
+	if len(allowedDirs) == 0 {
+		return "", fmt.Errorf("File uploads from server paths are disabled")
+	}
+
+	resolved, inside, err := resolveInDirs(path, allowedDirs)
+	if err != nil {
+		return "", err
+	}
+	if !inside {
+		return "", fmt.Errorf("File %s is outside the allowed upload directories", path)
+	}
+	return resolved, nil
+}
+
+// resolveInDirs resolves a file path and reports whether it lives inside one
+// of dirs
+func resolveInDirs(path string, dirs []string) (string, bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false, fmt.Errorf("Invalid file path: %v", err)
+	}
+
+	// Resolve symlinks so they can't point outside the allowed directories
+	resolved, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return "", false, fmt.Errorf("File not found: %s", path)
+	}
+
+	for _, dir := range dirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if resolvedDir, err := filepath.EvalSymlinks(absDir); err == nil {
+			absDir = resolvedDir
+		}
+
+		if resolved == absDir || strings.HasPrefix(resolved, absDir+string(filepath.Separator)) {
+			return resolved, true, nil
+		}
+	}
+
+	return resolved, false, nil
+}
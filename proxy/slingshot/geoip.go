@@ -0,0 +1,96 @@
+package slingshot
+
+import (
+	"net"
+)
+
+// GeoInfo is where an address is, and the network it belongs to, as the
+// configured GeoIP databases know it
+type GeoInfo struct {
+	Country     string `json:"country,omitempty"` // ISO 3166-1 code
+	CountryName string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint64 `json:"asn,omitempty"`
+	ASOrg       string `json:"as_org,omitempty"`
+}
+
+// GeoIP looks up addresses in local MaxMind DB files, such as GeoLite2
+// Country or City for the location and GeoLite2 ASN for the network. A nil
+// GeoIP looks up nothing.
+type GeoIP struct {
+	databases []*mmdbReader
+}
+
+// OpenGeoIP reads the MaxMind DB files at paths
+func OpenGeoIP(paths []string) (*GeoIP, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	g := &GeoIP{}
+	for _, path := range paths {
+		database, err := openMMDB(path)
+		if err != nil {
+			return nil, err
+		}
+		g.databases = append(g.databases, database)
+	}
+	return g, nil
+}
+
+// Lookup returns what the databases know about ip, or nil when none knows
+// anything. The first database with a value for a field wins.
+func (g *GeoIP) Lookup(ip net.IP) *GeoInfo {
+	if g == nil || ip == nil {
+		return nil
+	}
+
+	info := &GeoInfo{}
+	for _, database := range g.databases {
+		record, err := database.lookup(ip)
+		if err != nil || record == nil {
+			continue
+		}
+		// Anycast and satellite networks may only have a registered country
+		for _, country := range []string{"country", "registered_country"} {
+			if info.Country == "" {
+				info.Country, _ = mmdbField(record, country, "iso_code").(string)
+				info.CountryName, _ = mmdbField(record, country, "names", "en").(string)
+			}
+		}
+		if info.City == "" {
+			info.City, _ = mmdbField(record, "city", "names", "en").(string)
+		}
+		if info.ASN == 0 {
+			info.ASN, _ = mmdbField(record, "autonomous_system_number").(uint64)
+			info.ASOrg, _ = mmdbField(record, "autonomous_system_organization").(string)
+		}
+	}
+	if *info == (GeoInfo{}) {
+		return nil
+	}
+	return info
+}
+
+// annotate adds the location of the address a response's connection went to
+func (g *GeoIP) annotate(response *ProxyResponse) {
+	if g == nil || response.Connection == nil {
+		return
+	}
+	host, _, err := net.SplitHostPort(response.Connection.RemoteAddr)
+	if err != nil {
+		return
+	}
+	response.Connection.Geo = g.Lookup(net.ParseIP(host))
+}
+
+// mmdbField follows a path of keys through nested maps of a decoded record
+func mmdbField(record interface{}, path ...string) interface{} {
+	for _, key := range path {
+		values, ok := record.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		record = values[key]
+	}
+	return record
+}
@@ -0,0 +1,533 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// GraphQLSchemaTTL is how long an introspected schema is reused before it is
+// fetched again
+const GraphQLSchemaTTL = 10 * time.Minute
+
+// graphQLIntrospectionTimeout bounds the introspection query
+const graphQLIntrospectionTimeout = 30 * time.Second
+
+// graphQLIntrospectionQuery fetches everything needed to validate queries
+const graphQLIntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives { name locations args { ...InputValue } }
+  }
+}
+fragment FullType on __Type {
+  kind
+  name
+  fields(includeDeprecated: true) { name args { ...InputValue } type { ...TypeRef } }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) { name }
+  possibleTypes { ...TypeRef }
+}
+fragment InputValue on __InputValue {
+  name
+  type { ...TypeRef }
+  defaultValue
+}
+fragment TypeRef on __Type {
+  kind name ofType { kind name ofType { kind name ofType { kind name ofType {
+    kind name ofType { kind name ofType { kind name ofType { kind name } } } } } } }
+}`
+
+// graphQLPreludeDirectives are defined by the validator and must not be
+// declared again
+var graphQLPreludeDirectives = map[string]bool{
+	"defer": true, "include": true, "skip": true, "deprecated": true, "specifiedBy": true, "oneOf": true,
+}
+
+// graphQLBuiltinScalars are defined by the validator and must not be
+// declared again
+var graphQLBuiltinScalars = map[string]bool{
+	"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true,
+}
+
+// GraphQLSchemaRequest is the JSON body of /graphql/schema
+type GraphQLSchemaRequest struct {
+	URL     string   `json:"url"`
+	Headers []string `json:"headers,omitempty"`
+	Refresh bool     `json:"refresh,omitempty"`
+}
+
+// GraphQLValidateRequest is the JSON body of /graphql/validate
+type GraphQLValidateRequest struct {
+	URL           string                 `json:"url"`
+	Headers       []string               `json:"headers,omitempty"`
+	Refresh       bool                   `json:"refresh,omitempty"`
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// GraphQLError is a validation error with its position in the query
+type GraphQLError struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+}
+
+// GraphQLSchemaResponse is returned by /graphql/schema
+type GraphQLSchemaResponse struct {
+	Success          bool      `json:"success"`
+	URL              string    `json:"url"`
+	Cached           bool      `json:"cached"`
+	FetchedAt        time.Time `json:"fetched_at"`
+	QueryType        string    `json:"query_type,omitempty"`
+	MutationType     string    `json:"mutation_type,omitempty"`
+	SubscriptionType string    `json:"subscription_type,omitempty"`
+	Types            int       `json:"types"`
+	SDL              string    `json:"sdl"`
+}
+
+// GraphQLValidateResponse is returned by /graphql/validate
+type GraphQLValidateResponse struct {
+	Success bool           `json:"success"`
+	Valid   bool           `json:"valid"`
+	Cached  bool           `json:"cached"`
+	Errors  []GraphQLError `json:"errors,omitempty"`
+}
+
+// graphQLSchema is an introspected schema
+type graphQLSchema struct {
+	schema    *ast.Schema
+	sdl       string
+	types     int
+	fetchedAt time.Time
+}
+
+// GraphQLSchemaCache keeps introspected schemas by endpoint URL
+type GraphQLSchemaCache struct {
+	mu      sync.Mutex
+	schemas map[string]*graphQLSchema
+}
+
+// NewGraphQLSchemaCache creates an empty schema cache
+func NewGraphQLSchemaCache() *GraphQLSchemaCache {
+	return &GraphQLSchemaCache{schemas: make(map[string]*graphQLSchema)}
+}
+
+// Get returns the schema of an endpoint unless it is missing or expired
+func (c *GraphQLSchemaCache) Get(endpoint string) *graphQLSchema {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	schema := c.schemas[endpoint]
+	if schema == nil || time.Since(schema.fetchedAt) > GraphQLSchemaTTL {
+		return nil
+	}
+	return schema
+}
+
+// Put stores the schema of an endpoint
+func (c *GraphQLSchemaCache) Put(endpoint string, schema *graphQLSchema) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.schemas[endpoint] = schema
+}
+
+// introspection result types
+type (
+	introspectionTypeRef struct {
+		Kind   string                `json:"kind"`
+		Name   string                `json:"name"`
+		OfType *introspectionTypeRef `json:"ofType"`
+	}
+	introspectionInputValue struct {
+		Name         string               `json:"name"`
+		Type         introspectionTypeRef `json:"type"`
+		DefaultValue *string              `json:"defaultValue"`
+	}
+	introspectionField struct {
+		Name string                    `json:"name"`
+		Args []introspectionInputValue `json:"args"`
+		Type introspectionTypeRef      `json:"type"`
+	}
+	introspectionType struct {
+		Kind          string                    `json:"kind"`
+		Name          string                    `json:"name"`
+		Fields        []introspectionField      `json:"fields"`
+		InputFields   []introspectionInputValue `json:"inputFields"`
+		Interfaces    []introspectionTypeRef    `json:"interfaces"`
+		EnumValues    []struct{ Name string }   `json:"enumValues"`
+		PossibleTypes []introspectionTypeRef    `json:"possibleTypes"`
+	}
+	introspectionSchema struct {
+		QueryType        *struct{ Name string } `json:"queryType"`
+		MutationType     *struct{ Name string } `json:"mutationType"`
+		SubscriptionType *struct{ Name string } `json:"subscriptionType"`
+		Types            []introspectionType    `json:"types"`
+		Directives       []struct {
+			Name      string                    `json:"name"`
+			Locations []string                  `json:"locations"`
+			Args      []introspectionInputValue `json:"args"`
+		} `json:"directives"`
+	}
+)
+
+// introspectGraphQL returns the schema of a GraphQL endpoint, running an
+// introspection query unless a cached schema can be used. The second result
+// reports whether the schema came from the cache.
+func (c *HTTPClient) introspectGraphQL(ctx context.Context, endpoint string, headers []string, refresh bool) (*graphQLSchema, bool, error) {
+	if !refresh {
+		if schema := c.graphQLSchemas.Get(endpoint); schema != nil {
+			return schema, true, nil
+		}
+	}
+
+	body, _ := json.Marshal(map[string]string{"query": graphQLIntrospectionQuery})
+	req := &ProxyRequest{
+		Method:  "POST",
+		URL:     endpoint,
+		Headers: append([]string{"Content-Type: application/json", "Accept: application/json"}, headers...),
+		Body:    string(body),
+		Timeout: int(graphQLIntrospectionTimeout / time.Second),
+	}
+	ctx, cancel := context.WithTimeout(ctx, graphQLIntrospectionTimeout)
+	defer cancel()
+
+	response, err := c.ExecuteRequest(ctx, req)
+	if err != nil {
+		return nil, false, err
+	}
+	if !response.Success {
+		return nil, false, fmt.Errorf("Introspection failed: %s", response.ErrorMessage)
+	}
+	if response.ResponseStatus != http.StatusOK {
+		return nil, false, fmt.Errorf("Introspection failed: HTTP %d", response.ResponseStatus)
+	}
+
+	var result struct {
+		Data struct {
+			Schema *introspectionSchema `json:"__schema"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(response.ResponseData), &result); err != nil {
+		return nil, false, fmt.Errorf("Introspection returned invalid JSON: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, false, fmt.Errorf("Introspection failed: %s", result.Errors[0].Message)
+	}
+	if result.Data.Schema == nil {
+		return nil, false, errors.New("Introspection returned no schema")
+	}
+
+	sdl := introspectionSDL(result.Data.Schema)
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: endpoint, Input: sdl})
+	if err != nil {
+		return nil, false, fmt.Errorf("Introspected schema is invalid: %v", err)
+	}
+
+	introspected := &graphQLSchema{
+		schema:    schema,
+		sdl:       sdl,
+		types:     len(result.Data.Schema.Types),
+		fetchedAt: time.Now().UTC(),
+	}
+	c.graphQLSchemas.Put(endpoint, introspected)
+	return introspected, false, nil
+}
+
+// introspectionSDL writes an introspection result as schema definition
+// language, leaving out the built-in types and directives
+func introspectionSDL(schema *introspectionSchema) string {
+	var b strings.Builder
+
+	b.WriteString("schema {\n")
+	if schema.QueryType != nil {
+		fmt.Fprintf(&b, "  query: %s\n", schema.QueryType.Name)
+	}
+	if schema.MutationType != nil {
+		fmt.Fprintf(&b, "  mutation: %s\n", schema.MutationType.Name)
+	}
+	if schema.SubscriptionType != nil {
+		fmt.Fprintf(&b, "  subscription: %s\n", schema.SubscriptionType.Name)
+	}
+	b.WriteString("}\n")
+
+	types := append([]introspectionType(nil), schema.Types...)
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+
+	for _, t := range types {
+		if strings.HasPrefix(t.Name, "__") || graphQLBuiltinScalars[t.Name] {
+			continue
+		}
+		b.WriteString("\n")
+		switch t.Kind {
+		case "SCALAR":
+			fmt.Fprintf(&b, "scalar %s\n", t.Name)
+		case "OBJECT", "INTERFACE":
+			keyword := "type"
+			if t.Kind == "INTERFACE" {
+				keyword = "interface"
+			}
+			fmt.Fprintf(&b, "%s %s", keyword, t.Name)
+			if len(t.Interfaces) > 0 {
+				names := make([]string, len(t.Interfaces))
+				for i, iface := range t.Interfaces {
+					names[i] = iface.Name
+				}
+				fmt.Fprintf(&b, " implements %s", strings.Join(names, " & "))
+			}
+			b.WriteString(" {\n")
+			for _, field := range t.Fields {
+				fmt.Fprintf(&b, "  %s%s: %s\n", field.Name, introspectionArgs(field.Args), field.Type)
+			}
+			b.WriteString("}\n")
+		case "UNION":
+			names := make([]string, len(t.PossibleTypes))
+			for i, possible := range t.PossibleTypes {
+				names[i] = possible.Name
+			}
+			fmt.Fprintf(&b, "union %s = %s\n", t.Name, strings.Join(names, " | "))
+		case "ENUM":
+			fmt.Fprintf(&b, "enum %s {\n", t.Name)
+			for _, value := range t.EnumValues {
+				fmt.Fprintf(&b, "  %s\n", value.Name)
+			}
+			b.WriteString("}\n")
+		case "INPUT_OBJECT":
+			fmt.Fprintf(&b, "input %s {\n", t.Name)
+			for _, field := range t.InputFields {
+				fmt.Fprintf(&b, "  %s\n", field)
+			}
+			b.WriteString("}\n")
+		}
+	}
+
+	for _, directive := range schema.Directives {
+		if graphQLPreludeDirectives[directive.Name] {
+			continue
+		}
+		fmt.Fprintf(&b, "\ndirective @%s%s on %s\n", directive.Name, introspectionArgs(directive.Args), strings.Join(directive.Locations, " | "))
+	}
+	return b.String()
+}
+
+// introspectionArgs formats an argument list, such as (id: ID!, first: Int = 10)
+func introspectionArgs(args []introspectionInputValue) string {
+	if len(args) == 0 {
+		return ""
+	}
+	formatted := make([]string, len(args))
+	for i, arg := range args {
+		formatted[i] = arg.String()
+	}
+	return "(" + strings.Join(formatted, ", ") + ")"
+}
+
+// String formats an input value as name: Type = default
+func (v introspectionInputValue) String() string {
+	s := v.Name + ": " + v.Type.String()
+	if v.DefaultValue != nil {
+		s += " = " + *v.DefaultValue
+	}
+	return s
+}
+
+// String formats a type reference, such as [String!]!
+func (t introspectionTypeRef) String() string {
+	switch {
+	case t.Kind == "NON_NULL" && t.OfType != nil:
+		return t.OfType.String() + "!"
+	case t.Kind == "LIST" && t.OfType != nil:
+		return "[" + t.OfType.String() + "]"
+	}
+	return t.Name
+}
+
+// validateGraphQL checks a query and its variables against a schema. It
+// returns nil when the query is valid.
+func validateGraphQL(schema *ast.Schema, query string, variables map[string]interface{}, operationName string) []GraphQLError {
+	document, errs := gqlparser.LoadQueryWithRules(schema, query, nil)
+	if len(errs) > 0 {
+		return graphQLErrors(errs)
+	}
+
+	operation := document.Operations.ForName(operationName)
+	if operation == nil {
+		if operationName == "" {
+			return []GraphQLError{{Message: "The query has several operations, operationName is required"}}
+		}
+		return []GraphQLError{{Message: fmt.Sprintf("The query has no operation named %q", operationName)}}
+	}
+
+	if variables == nil {
+		variables = map[string]interface{}{}
+	}
+	if _, err := validator.VariableValues(schema, operation, variables); err != nil {
+		var gqlErr *gqlerror.Error
+		if errors.As(err, &gqlErr) {
+			return graphQLErrors(gqlerror.List{gqlErr})
+		}
+		return []GraphQLError{{Message: err.Error()}}
+	}
+	return nil
+}
+
+// graphQLErrors converts parser and validator errors
+func graphQLErrors(errs gqlerror.List) []GraphQLError {
+	converted := make([]GraphQLError, len(errs))
+	for i, err := range errs {
+		converted[i] = GraphQLError{Message: err.Message}
+		if len(err.Locations) > 0 {
+			converted[i].Line = err.Locations[0].Line
+			converted[i].Column = err.Locations[0].Column
+		}
+		if len(err.Path) > 0 {
+			converted[i].Path = err.Path.String()
+		}
+	}
+	return converted
+}
+
+// checkGraphQLRequest validates the GraphQL query in the body of a request
+// with validateGraphQL set. It returns an error response when the request
+// must not be sent.
+func (c *HTTPClient) checkGraphQLRequest(ctx context.Context, req *ProxyRequest, metrics *RequestMetrics) *ProxyResponse {
+	var body struct {
+		Query         string                 `json:"query"`
+		Variables     map[string]interface{} `json:"variables"`
+		OperationName string                 `json:"operationName"`
+	}
+	if err := json.Unmarshal([]byte(req.Body), &body); err != nil || body.Query == "" {
+		return c.createErrorResponse(RequestFormatError, "validateGraphQL needs a JSON body with a query", metrics)
+	}
+
+	// Introspect with the request's own credentials
+	var headers []string
+	for _, field := range parseHeaderFields(req.Headers) {
+		if !strings.EqualFold(field.Name, "Content-Type") && !strings.EqualFold(field.Name, "Content-Length") {
+			headers = append(headers, field.Name+": "+field.Value)
+		}
+	}
+	schema, _, err := c.introspectGraphQL(ctx, req.URL, headers, false)
+	if err != nil {
+		return c.createErrorResponse(GraphQLValidationError, err.Error(), metrics)
+	}
+
+	if errs := validateGraphQL(schema.schema, body.Query, body.Variables, body.OperationName); errs != nil {
+		response := c.createErrorResponse(GraphQLValidationError, errs[0].Message, metrics)
+		response.GraphQLErrors = errs
+		return response
+	}
+	return nil
+}
+
+// handleGraphQLSchema handles /graphql/schema, which introspects an endpoint
+func (s *ProxyServer) handleGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req GraphQLSchemaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if req.URL == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing URL", "URL is required")
+		return
+	}
+
+	s.logger.Printf("[%s] Introspecting GraphQL schema of %s", requestID(w), req.URL)
+
+	schema, cached, err := s.httpClient.introspectGraphQL(r.Context(), req.URL, req.Headers, req.Refresh)
+	if err != nil {
+		s.writeErrorResponse(w, GraphQLValidationError.Type, "Introspection Failed", err.Error())
+		return
+	}
+
+	response := GraphQLSchemaResponse{
+		Success:   true,
+		URL:       req.URL,
+		Cached:    cached,
+		FetchedAt: schema.fetchedAt,
+		Types:     schema.types,
+		SDL:       schema.sdl,
+	}
+	if schema.schema.Query != nil {
+		response.QueryType = schema.schema.Query.Name
+	}
+	if schema.schema.Mutation != nil {
+		response.MutationType = schema.schema.Mutation.Name
+	}
+	if schema.schema.Subscription != nil {
+		response.SubscriptionType = schema.schema.Subscription.Name
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleGraphQLValidate handles /graphql/validate, which checks a query
+// against the schema of an endpoint without sending it
+func (s *ProxyServer) handleGraphQLValidate(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req GraphQLValidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if req.URL == "" || req.Query == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing Fields", "URL and query are required")
+		return
+	}
+
+	schema, cached, err := s.httpClient.introspectGraphQL(r.Context(), req.URL, req.Headers, req.Refresh)
+	if err != nil {
+		s.writeErrorResponse(w, GraphQLValidationError.Type, "Introspection Failed", err.Error())
+		return
+	}
+
+	errs := validateGraphQL(schema.schema, req.Query, req.Variables, req.OperationName)
+	s.logger.Printf("[%s] Validated GraphQL query for %s (%d errors)", requestID(w), req.URL, len(errs))
+
+	response := GraphQLValidateResponse{
+		Success: true,
+		Valid:   len(errs) == 0,
+		Cached:  cached,
+		Errors:  errs,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
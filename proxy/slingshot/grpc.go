@@ -0,0 +1,658 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GRPCProto is the published definition of the gRPC API, also served at
+// GET /slingshot.proto for generating typed clients
+//
+//go:embed slingshot.proto
+var GRPCProto string
+
+const (
+	// grpcServiceName is the service of slingshot.proto
+	grpcServiceName = "slingshot.v1.Slingshot"
+
+	// grpcMaxMessageSize is the largest request message accepted, as gRPC
+	// servers accept by default
+	grpcMaxMessageSize = 4 << 20
+
+	// DefaultGRPCBatchConcurrency is how many requests of a batch are sent
+	// at once unless the batch chooses
+	DefaultGRPCBatchConcurrency = 8
+	maxGRPCBatchConcurrency     = 64
+)
+
+// gRPC status codes
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcUnknown           = 2
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// grpcStatusCodes maps the errors the REST API rejects a call with to gRPC
+// status codes. Failures of proxied requests are not among them: Execute
+// returns those in its response.
+var grpcStatusCodes = map[string]int{
+	"request_format_error": grpcInvalidArgument,
+	"unauthorized":         grpcUnauthenticated,
+	"rate_limited":         grpcResourceExhausted,
+	"host_not_allowed":     grpcPermissionDenied,
+	"not_found":            grpcNotFound,
+	"draining":             grpcUnavailable,
+}
+
+// grpcStatus is the status a gRPC call fails with
+type grpcStatus struct {
+	code    int
+	message string
+}
+
+func (e *grpcStatus) Error() string {
+	return e.message
+}
+
+// grpcMethod is a call of the gRPC API. handle reads the request message and
+// sends the response messages of one call.
+type grpcMethod struct {
+	input, output protoreflect.MessageDescriptor
+	handle        func(call *grpcCall, request *dynamicpb.Message) error
+}
+
+// grpcCall is a gRPC call being served
+type grpcCall struct {
+	r      *http.Request
+	ctx    context.Context
+	output protoreflect.MessageDescriptor
+
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+// send writes a response message, framed with its length
+func (c *grpcCall) send(message proto.Message) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.w.Write(frame); err != nil {
+		return err
+	}
+	return http.NewResponseController(c.w).Flush()
+}
+
+// message converts a JSON response of the REST API into a message of the
+// call's output type. Fields the message does not define are dropped, but a
+// json field keeps the whole response.
+func (c *grpcCall) message(data []byte) (*dynamicpb.Message, error) {
+	return jsonMessage(c.output, data)
+}
+
+// jsonMessage converts JSON into a message of the given type, keeping the JSON
+// in the message's json field when it has one
+func jsonMessage(descriptor protoreflect.MessageDescriptor, data []byte) (*dynamicpb.Message, error) {
+	message := dynamicpb.NewMessage(descriptor)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, message); err != nil {
+		return nil, &grpcStatus{grpcInternal, fmt.Sprintf("Failed to convert the response: %v", err)}
+	}
+	if field := descriptor.Fields().ByName("json"); field != nil {
+		message.Set(field, protoreflect.ValueOfString(string(bytes.TrimSpace(data))))
+	}
+	return message, nil
+}
+
+// grpcService serves the proxy's API over gRPC by running the matching REST
+// endpoints in-process, so calls are authenticated, logged, tracked and
+// recorded like any other
+type grpcService struct {
+	server  *ProxyServer
+	methods map[string]*grpcMethod // By path, /slingshot.v1.Slingshot/Execute
+}
+
+// newGRPCService compiles the published definition and binds its methods
+func newGRPCService(s *ProxyServer) (*grpcService, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"slingshot.proto": GRPCProto}),
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), "slingshot.proto")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile slingshot.proto: %w", err)
+	}
+	descriptor, ok := files[0].FindDescriptorByName(grpcServiceName).(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("slingshot.proto does not define %s", grpcServiceName)
+	}
+
+	g := &grpcService{server: s, methods: make(map[string]*grpcMethod)}
+	handlers := map[string]func(*grpcCall, *dynamicpb.Message) error{
+		"Execute":       g.execute,
+		"Batch":         g.batch,
+		"QueryHistory":  g.queryHistory,
+		"TailHistory":   g.tailHistory,
+		"GetStats":      g.getStats,
+		"ListRequests":  g.listRequests,
+		"CancelRequest": g.cancelRequest,
+	}
+	methods := descriptor.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		handle, ok := handlers[string(method.Name())]
+		if !ok {
+			return nil, fmt.Errorf("No handler for %s", method.FullName())
+		}
+		g.methods["/"+grpcServiceName+"/"+string(method.Name())] = &grpcMethod{
+			input:  method.Input(),
+			output: method.Output(),
+			handle: handle,
+		}
+	}
+	return g, nil
+}
+
+// ServeHTTP serves a gRPC call. Messages are not compressed, and the status is
+// sent in the trailers.
+func (g *grpcService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if r.Method != "POST" || (contentType != "application/grpc" && !strings.HasPrefix(contentType, "application/grpc+proto")) {
+		http.Error(w, "Only gRPC calls are served on this port", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Accept-Encoding", "identity")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	err := g.serve(w, r)
+
+	code, message := grpcOK, ""
+	var status *grpcStatus
+	switch {
+	case err == nil:
+	case errors.As(err, &status):
+		code, message = status.code, status.message
+	case errors.Is(err, context.DeadlineExceeded):
+		code, message = grpcDeadlineExceeded, "The call's deadline was exceeded"
+	case errors.Is(err, context.Canceled):
+		code, message = grpcCanceled, "The call was cancelled"
+	default:
+		code, message = grpcUnknown, err.Error()
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", grpcEncodeMessage(message))
+	}
+}
+
+// serve reads the request message of a call and runs its method
+func (g *grpcService) serve(w http.ResponseWriter, r *http.Request) error {
+	method, ok := g.methods[r.URL.Path]
+	if !ok {
+		return &grpcStatus{grpcUnimplemented, fmt.Sprintf("Unknown method %s", r.URL.Path)}
+	}
+
+	ctx := r.Context()
+	if value := r.Header.Get("Grpc-Timeout"); value != "" {
+		timeout, err := parseGRPCTimeout(value)
+		if err != nil {
+			return &grpcStatus{grpcInvalidArgument, err.Error()}
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	data, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return err
+	}
+	request := dynamicpb.NewMessage(method.input)
+	if err := proto.Unmarshal(data, request); err != nil {
+		return &grpcStatus{grpcInvalidArgument, fmt.Sprintf("Invalid %s message: %v", method.input.FullName(), err)}
+	}
+
+	call := &grpcCall{r: r.WithContext(ctx), ctx: ctx, output: method.output, w: w}
+	if err := method.handle(call, request); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// readGRPCMessage reads the single message of a request
+func readGRPCMessage(body io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return nil, &grpcStatus{grpcInvalidArgument, "The call has no request message"}
+	}
+	if header[0] != 0 {
+		return nil, &grpcStatus{grpcUnimplemented, "Compressed messages are not supported"}
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > grpcMaxMessageSize {
+		return nil, &grpcStatus{grpcResourceExhausted, fmt.Sprintf("The request message is larger than %d bytes", grpcMaxMessageSize)}
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, &grpcStatus{grpcInvalidArgument, "The request message is cut short"}
+	}
+	return data, nil
+}
+
+// parseGRPCTimeout parses a grpc-timeout header, such as 500m or 30S
+func parseGRPCTimeout(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("Invalid grpc-timeout %q", value)
+	}
+	unit, ok := units[value[len(value)-1]]
+	amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if !ok || err != nil || amount < 0 {
+		return 0, fmt.Errorf("Invalid grpc-timeout %q", value)
+	}
+	return time.Duration(amount) * unit, nil
+}
+
+// grpcEncodeMessage percent-encodes a status message as the grpc-message
+// trailer requires
+func grpcEncodeMessage(message string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c >= ' ' && c <= '~' && c != '%' {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+// grpcInternalHeaders are the headers of a gRPC call not passed on to the REST
+// API, which would change how it answers
+var grpcInternalHeaders = map[string]bool{
+	"Content-Type": true, "Content-Length": true, "Te": true, "Trailer": true,
+	"Accept": true, "Accept-Encoding": true, "User-Agent": true,
+}
+
+// callAPI runs a REST endpoint in-process for a gRPC call, with the call's
+// metadata as headers, and returns its JSON response. Responses reporting an
+// error the API rejected the call with fail with the matching status, as do
+// all other failures unless proxied is set; the response is returned either
+// way.
+func (g *grpcService) callAPI(call *grpcCall, method, target string, body []byte, proxied bool) ([]byte, error) {
+	r, err := http.NewRequestWithContext(call.ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range call.r.Header {
+		if !grpcInternalHeaders[name] && !strings.HasPrefix(name, "Grpc-") {
+			r.Header[name] = values
+		}
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.RemoteAddr = call.r.RemoteAddr
+
+	recorder := &bufferedResponse{header: make(http.Header)}
+	g.server.router.ServeHTTP(recorder, r)
+
+	var failure ProxyResponse
+	if err := json.Unmarshal(recorder.body.Bytes(), &failure); err != nil {
+		return nil, &grpcStatus{grpcInternal, fmt.Sprintf("%s %s answered with invalid JSON", method, target)}
+	}
+	if !failure.Success {
+		code, ok := grpcStatusCodes[failure.ErrorType]
+		if !ok && !proxied {
+			code, ok = grpcUnknown, true
+		}
+		if ok {
+			return recorder.body.Bytes(), &grpcStatus{code, failure.ErrorMessage}
+		}
+	}
+	return recorder.body.Bytes(), nil
+}
+
+// bufferedResponse keeps a response of the REST API served in-process
+type bufferedResponse struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(int)             {}
+
+// proxyRequestJSON converts a ProxyRequest message into the JSON body of POST
+// /proxy/request, over its options_json
+func proxyRequestJSON(request protoreflect.Message) ([]byte, error) {
+	body := make(map[string]json.RawMessage)
+	optionsField := request.Descriptor().Fields().ByName("options_json")
+	if options := request.Get(optionsField).String(); options != "" {
+		if err := json.Unmarshal([]byte(options), &body); err != nil {
+			return nil, &grpcStatus{grpcInvalidArgument, fmt.Sprintf("options_json is not a JSON object: %v", err)}
+		}
+	}
+
+	typed := proto.Clone(request.Interface()).ProtoReflect()
+	typed.Clear(optionsField)
+	data, err := protojson.Marshal(typed.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		body[name] = value
+	}
+	if string(body["stream"]) == "true" {
+		return nil, &grpcStatus{grpcInvalidArgument, "Streamed responses are not available over gRPC"}
+	}
+	return json.Marshal(body)
+}
+
+// execute implements Execute
+func (g *grpcService) execute(call *grpcCall, request *dynamicpb.Message) error {
+	body, err := proxyRequestJSON(request)
+	if err != nil {
+		return err
+	}
+	data, err := g.callAPI(call, "POST", "/proxy/request", body, true)
+	if err != nil {
+		return err
+	}
+	response, err := call.message(data)
+	if err != nil {
+		return err
+	}
+	return call.send(response)
+}
+
+// batch implements Batch, sending the requests a few at a time and streaming
+// each response as it completes
+func (g *grpcService) batch(call *grpcCall, request *dynamicpb.Message) error {
+	fields := request.Descriptor().Fields()
+	requests := request.Get(fields.ByName("requests")).List()
+	concurrency := int(request.Get(fields.ByName("concurrency")).Int())
+	if concurrency <= 0 {
+		concurrency = DefaultGRPCBatchConcurrency
+	}
+	concurrency = min(concurrency, maxGRPCBatchConcurrency)
+
+	resultFields := call.output.Fields()
+	responseDescriptor := resultFields.ByName("response").Message()
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var sendErr error
+	var sendOnce sync.Once
+	for i := 0; i < requests.Len(); i++ {
+		select {
+		case slots <- struct{}{}:
+		case <-call.ctx.Done():
+		}
+		if call.ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(index int, item protoreflect.Message) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			// Rejected requests are reported like failed ones, so the other
+			// results still arrive
+			data, err := g.batchRequest(call, item)
+			if err != nil {
+				data, _ = json.Marshal(&ProxyResponse{Success: false, ErrorType: "request_format_error", ErrorTitle: "Invalid Request", ErrorMessage: err.Error()})
+			}
+			response, err := jsonMessage(responseDescriptor, data)
+			if err == nil {
+				result := dynamicpb.NewMessage(call.output)
+				result.Set(resultFields.ByName("index"), protoreflect.ValueOfInt32(int32(index)))
+				result.Set(resultFields.ByName("response"), protoreflect.ValueOfMessage(response))
+				err = call.send(result)
+			}
+			if err != nil {
+				sendOnce.Do(func() { sendErr = err })
+			}
+		}(i, requests.Get(i).Message())
+	}
+	wg.Wait()
+	return sendErr
+}
+
+// batchRequest sends one request of a batch, returning the JSON of its
+// ProxyResponse. An error means there is no response to report: the request
+// could not be built, or the proxy did not answer with a ProxyResponse.
+func (g *grpcService) batchRequest(call *grpcCall, item protoreflect.Message) ([]byte, error) {
+	body, err := proxyRequestJSON(item)
+	if err != nil {
+		return nil, err
+	}
+	data, err := g.callAPI(call, "POST", "/proxy/request", body, true)
+	if data == nil {
+		return nil, err
+	}
+	// Failures are described by the response itself
+	return data, nil
+}
+
+// historyQueryValues converts a HistoryQuery message into the query of GET
+// /proxy/history, whose parameters are its fields' JSON names
+func historyQueryValues(message protoreflect.Message) (url.Values, error) {
+	data, err := protojson.Marshal(message.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	for name, value := range fields {
+		if items, ok := value.([]any); ok {
+			list := make([]string, len(items))
+			for i, item := range items {
+				list[i] = fmt.Sprint(item)
+			}
+			query.Set(name, strings.Join(list, ","))
+		} else {
+			query.Set(name, fmt.Sprint(value))
+		}
+	}
+	return query, nil
+}
+
+// queryHistory implements QueryHistory
+func (g *grpcService) queryHistory(call *grpcCall, request *dynamicpb.Message) error {
+	query, err := historyQueryValues(request)
+	if err != nil {
+		return err
+	}
+	data, err := g.callAPI(call, "GET", "/proxy/history?"+query.Encode(), nil, false)
+	if err != nil {
+		return err
+	}
+	page, err := call.message(data)
+	if err != nil {
+		return err
+	}
+	return call.send(page)
+}
+
+// tailHistory implements TailHistory, streaming from the live tail until the
+// caller cancels or the proxy stops
+func (g *grpcService) tailHistory(call *grpcCall, request *dynamicpb.Message) error {
+	fields := request.Descriptor().Fields()
+	query, err := historyQueryValues(request.Get(fields.ByName("filter")).Message())
+	if err != nil {
+		return err
+	}
+	if types := request.Get(fields.ByName("types")).List(); types.Len() > 0 {
+		list := make([]string, types.Len())
+		for i := range list {
+			list[i] = types.Get(i).String()
+		}
+		query.Set("types", strings.Join(list, ","))
+	}
+	if recent := request.Get(fields.ByName("recent")).Int(); recent != 0 {
+		query.Set("recent", strconv.FormatInt(recent, 10))
+	}
+	tq, err := parseTailQuery(query)
+	if err != nil {
+		return &grpcStatus{grpcInvalidArgument, err.Error()}
+	}
+
+	// Refuse new tails while draining and count the call against the API
+	// key's rate limit, as opening a live tail over a WebSocket does
+	if g.server.drainingSince() != nil {
+		return &grpcStatus{grpcUnavailable, "The proxy is shutting down and no longer accepts requests; retry on another instance"}
+	}
+	if g.server.config.RequireAPIKey {
+		if _, failure, _ := g.server.checkAPIKey(call.r); failure != nil {
+			return &grpcStatus{grpcStatusCodes[failure.Type], failure.Message}
+		}
+	}
+
+	events, unsubscribe := g.server.tail.Subscribe()
+	defer unsubscribe()
+
+	send := func(event *TailEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		message, err := call.message(data)
+		if err != nil {
+			return err
+		}
+		return call.send(message)
+	}
+
+	stream := &tailStream{query: tq}
+	recent, err := stream.recentEvents(g.server.history)
+	if err != nil {
+		g.server.logger.Printf("Failed to read recent history: %v", err)
+	}
+	for _, event := range recent {
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-call.ctx.Done():
+			return call.ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return &grpcStatus{grpcUnavailable, "The proxy is stopping"}
+			}
+			if event = stream.next(event); event != nil {
+				if err := send(event); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// getStats implements GetStats
+func (g *grpcService) getStats(call *grpcCall, request *dynamicpb.Message) error {
+	data, err := g.callAPI(call, "GET", "/admin/stats", nil, false)
+	if err != nil {
+		return err
+	}
+	stats, err := call.message(data)
+	if err != nil {
+		return err
+	}
+	return call.send(stats)
+}
+
+// listRequests implements ListRequests
+func (g *grpcService) listRequests(call *grpcCall, request *dynamicpb.Message) error {
+	data, err := g.callAPI(call, "GET", "/admin/requests", nil, false)
+	if err != nil {
+		return err
+	}
+	requests, err := call.message(data)
+	if err != nil {
+		return err
+	}
+	return call.send(requests)
+}
+
+// cancelRequest implements CancelRequest
+func (g *grpcService) cancelRequest(call *grpcCall, request *dynamicpb.Message) error {
+	id := request.Get(request.Descriptor().Fields().ByName("id")).String()
+	if id == "" {
+		return &grpcStatus{grpcInvalidArgument, "The id of the request to cancel is required"}
+	}
+	data, err := g.callAPI(call, "DELETE", "/admin/requests/"+url.PathEscape(id), nil, false)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Request json.RawMessage `json:"request"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return err
+	}
+	cancelled, err := call.message(response.Request)
+	if err != nil {
+		return err
+	}
+	return call.send(cancelled)
+}
+
+// handleGRPCProto serves the definition of the gRPC API
+func (s *ProxyServer) handleGRPCProto(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := io.WriteString(w, GRPCProto); err != nil {
+		s.logger.Printf("Failed to write slingshot.proto: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package slingshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcFrame frames a message as a gRPC request body carries it
+func grpcFrame(compressed byte, size uint32, data []byte) []byte {
+	frame := make([]byte, 5, 5+len(data))
+	frame[0] = compressed
+	binary.BigEndian.PutUint32(frame[1:], size)
+	return append(frame, data...)
+}
+
+func TestReadGRPCMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want string
+		code int // Of the status the read fails with, or 0
+	}{
+		{name: "message", body: grpcFrame(0, 5, []byte("hello")), want: "hello"},
+		{name: "empty message", body: grpcFrame(0, 0, nil), want: ""},
+		{name: "trailing data ignored", body: append(grpcFrame(0, 2, []byte("hi")), 0xff), want: "hi"},
+		{name: "no message", body: nil, code: grpcInvalidArgument},
+		{name: "truncated header", body: []byte{0, 0, 0}, code: grpcInvalidArgument},
+		{name: "compressed flag", body: grpcFrame(1, 5, []byte("hello")), code: grpcUnimplemented},
+		{name: "truncated frame", body: grpcFrame(0, 10, []byte("hello")), code: grpcInvalidArgument},
+		{name: "too large", body: grpcFrame(0, grpcMaxMessageSize+1, nil), code: grpcResourceExhausted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := readGRPCMessage(bytes.NewReader(test.body))
+			if test.code == 0 {
+				if err != nil {
+					t.Fatalf("readGRPCMessage() error = %v", err)
+				}
+				if string(data) != test.want {
+					t.Errorf("readGRPCMessage() = %q, want %q", data, test.want)
+				}
+				return
+			}
+			var status *grpcStatus
+			if !errors.As(err, &status) {
+				t.Fatalf("readGRPCMessage() error = %v, want a gRPC status", err)
+			}
+			if status.code != test.code {
+				t.Errorf("status code = %d, want %d (%s)", status.code, test.code, status.message)
+			}
+		})
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "500m", want: "500ms"},
+		{value: "30S", want: "30s"},
+		{value: "2H", want: "2h0m0s"},
+		{value: "1", wantErr: true},
+		{value: "10x", wantErr: true},
+		{value: "-5S", wantErr: true},
+		{value: "1234567890S", wantErr: true},
+	}
+	for _, test := range tests {
+		timeout, err := parseGRPCTimeout(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseGRPCTimeout(%q) = %s, want an error", test.value, timeout)
+			}
+			continue
+		}
+		if err != nil || timeout.String() != test.want {
+			t.Errorf("parseGRPCTimeout(%q) = %s, %v, want %s", test.value, timeout, err, test.want)
+		}
+	}
+}
+
+// TestGRPCBatchErrors checks that requests of a batch the proxy rejects, or
+// answers without a ProxyResponse, are reported as failed results while the
+// other results still arrive
+func TestGRPCBatchErrors(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/proxy/request", func(w http.ResponseWriter, r *http.Request) {
+		var req ProxyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Invalid request body: %v", err)
+		}
+		if req.URL == "http://garbled.test" {
+			w.Write([]byte("not JSON"))
+			return
+		}
+		json.NewEncoder(w).Encode(&ProxyResponse{Success: true, ResponseStatus: 200})
+	})
+	g, err := newGRPCService(&ProxyServer{router: router})
+	if err != nil {
+		t.Fatal(err)
+	}
+	method := g.methods["/"+grpcServiceName+"/Batch"]
+
+	requests := []struct {
+		url, optionsJSON string
+		wantError        bool
+	}{
+		{url: "http://ok.test"},
+		{url: "http://ok.test", optionsJSON: "[1, 2]", wantError: true},
+		{url: "http://ok.test", optionsJSON: `{"stream": true}`, wantError: true},
+		{url: "http://garbled.test", wantError: true},
+	}
+	batch := dynamicpb.NewMessage(method.input)
+	list := batch.Mutable(method.input.Fields().ByName("requests")).List()
+	for _, request := range requests {
+		item := list.NewElement().Message()
+		fields := item.Descriptor().Fields()
+		item.Set(fields.ByName("url"), protoreflect.ValueOfString(request.url))
+		item.Set(fields.ByName("options_json"), protoreflect.ValueOfString(request.optionsJSON))
+		list.Append(protoreflect.ValueOfMessage(item))
+	}
+	data, err := proto.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/"+grpcServiceName+"/Batch", bytes.NewReader(grpcFrame(0, uint32(len(data)), data)))
+	r.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+
+	if status := w.Result().Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("Grpc-Status = %q, want 0 (%s)", status, w.Result().Trailer.Get("Grpc-Message"))
+	}
+	seen := make(map[int]bool)
+	body := bytes.NewReader(w.Body.Bytes())
+	for body.Len() > 0 {
+		frame, err := readGRPCMessage(body)
+		if err != nil {
+			t.Fatalf("Invalid response frame: %v", err)
+		}
+		result := dynamicpb.NewMessage(method.output)
+		if err := proto.Unmarshal(frame, result); err != nil {
+			t.Fatal(err)
+		}
+		fields := method.output.Fields()
+		index := int(result.Get(fields.ByName("index")).Int())
+		response := result.Get(fields.ByName("response")).Message()
+		responseFields := response.Descriptor().Fields()
+		success := response.Get(responseFields.ByName("success")).Bool()
+		errorType := response.Get(responseFields.ByName("error_type")).String()
+
+		seen[index] = true
+		if want := requests[index]; success == want.wantError {
+			t.Errorf("Request %d: success = %v, want %v", index, success, !want.wantError)
+		} else if want.wantError && errorType != "request_format_error" {
+			t.Errorf("Request %d: error_type = %q, want request_format_error", index, errorType)
+		}
+	}
+	if len(seen) != len(requests) {
+		t.Errorf("Got results for %d requests, want %d", len(seen), len(requests))
+	}
+}
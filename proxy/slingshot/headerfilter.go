@@ -0,0 +1,33 @@
+package slingshot
+
+// responseHeaderFilter trims the response headers returned to the caller to
+// an allowlist, minus a denylist. Both match like HeaderAllowlist, so "X-*"
+// covers every header starting with "X-".
+type responseHeaderFilter struct {
+	include HeaderAllowlist
+	exclude HeaderAllowlist
+}
+
+// newResponseHeaderFilter returns the request's header filter, or nil when it
+// keeps every header
+func newResponseHeaderFilter(req *ProxyRequest) *responseHeaderFilter {
+	if len(req.IncludeResponseHeaders) == 0 && len(req.ExcludeResponseHeaders) == 0 {
+		return nil
+	}
+	return &responseHeaderFilter{
+		include: HeaderAllowlist(req.IncludeResponseHeaders),
+		exclude: HeaderAllowlist(req.ExcludeResponseHeaders),
+	}
+}
+
+// apply removes the filtered headers from a response
+func (f *responseHeaderFilter) apply(response *ProxyResponse) {
+	if f == nil {
+		return
+	}
+	for name := range response.ResponseHeaders {
+		if (len(f.include) > 0 && !f.include.Allows(name)) || f.exclude.Allows(name) {
+			delete(response.ResponseHeaders, name)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+)
+
+// HeaderProfile attaches headers, typically credentials, to every request to
+// its hosts, so callers neither need nor see them. Values may refer to
+// environment variables as ${NAME}, keeping secrets out of the file.
+type HeaderProfile struct {
+	Name    string            `json:"name"`
+	Hosts   HostPatterns      `json:"hosts"`
+	Headers map[string]string `json:"headers"`
+}
+
+// headerNames returns the profile's header names in order
+func (p *HeaderProfile) headerNames() []string {
+	names := make([]string, 0, len(p.Headers))
+	for name := range p.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HeaderProfiles holds the header profiles configured in a file
+type HeaderProfiles struct {
+	file     string
+	profiles []*HeaderProfile
+}
+
+// NewHeaderProfiles creates the profiles configured in file, once loaded
+func NewHeaderProfiles(file string) *HeaderProfiles {
+	return &HeaderProfiles{file: file}
+}
+
+// Load reads the profiles file, if one is configured, and fills in the
+// environment variables its values refer to
+func (h *HeaderProfiles) Load() error {
+	if h.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(h.file)
+	if err != nil {
+		return fmt.Errorf("Failed to read header profiles: %v", err)
+	}
+	var profiles []*HeaderProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return fmt.Errorf("Failed to parse header profiles %s: %v", h.file, err)
+	}
+
+	for i, profile := range profiles {
+		if profile.Name == "" {
+			profile.Name = fmt.Sprintf("profile %d", i+1)
+		}
+		if len(profile.Hosts) == 0 {
+			return fmt.Errorf("Header profile %s: no hosts", profile.Name)
+		}
+		for name, value := range profile.Headers {
+			var missing []string
+			profile.Headers[name] = os.Expand(value, func(variable string) string {
+				expanded, ok := os.LookupEnv(variable)
+				if !ok {
+					missing = append(missing, variable)
+				}
+				return expanded
+			})
+			if len(missing) > 0 {
+				return fmt.Errorf("Header profile %s: environment variable %s is not set", profile.Name, missing[0])
+			}
+		}
+	}
+	h.profiles = profiles
+	return nil
+}
+
+// match returns the first profile for the host of targetURL, or nil
+func (h *HeaderProfiles) match(targetURL string) *HeaderProfile {
+	if h == nil || len(h.profiles) == 0 {
+		return nil
+	}
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil
+	}
+	for _, profile := range h.profiles {
+		if profile.Hosts.Matches(parsed.Hostname()) {
+			return profile
+		}
+	}
+	return nil
+}
+
+// apply attaches the headers of the profile matching the request's host,
+// replacing those the caller sent, and returns that profile
+func (h *HeaderProfiles) apply(req *ProxyRequest) *HeaderProfile {
+	profile := h.match(req.URL)
+	if profile == nil {
+		return nil
+	}
+
+	names := profile.headerNames()
+	req.Headers = removeHeaderFields(req.Headers, HeaderAllowlist(names))
+	for _, name := range names {
+		req.Headers = append(req.Headers, name+": "+profile.Headers[name])
+	}
+	return profile
+}
+
+// headerProfileContextKey carries the profile applied to a request
+type headerProfileContextKey struct{}
+
+// withHeaderProfile records the profile applied to a request so redirects
+// can keep its headers from other hosts
+func withHeaderProfile(ctx context.Context, profile *HeaderProfile) context.Context {
+	if profile == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, headerProfileContextKey{}, profile)
+}
+
+// headerProfileFromContext returns the profile applied to a request, if any
+func headerProfileFromContext(ctx context.Context) *HeaderProfile {
+	profile, _ := ctx.Value(headerProfileContextKey{}).(*HeaderProfile)
+	return profile
+}
@@ -0,0 +1,189 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout bounds each readiness check
+const healthCheckTimeout = 5 * time.Second
+
+// Health statuses
+const (
+	HealthOK     = "ok"
+	HealthFailed = "failed"
+)
+
+// HealthCheck is the result of one readiness check
+type HealthCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// HealthResponse is returned by /health/live and /health/ready
+type HealthResponse struct {
+	Status  string        `json:"status"` // "ok" or "failed"
+	Version string        `json:"version"`
+	Checks  []HealthCheck `json:"checks,omitempty"`
+}
+
+// readinessCheck checks one dependency, describing its state on success
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) (string, error)
+}
+
+// readinessChecks returns the checks that apply to this configuration
+func (s *ProxyServer) readinessChecks() []readinessCheck {
+	checks := []readinessCheck{
+		{"draining", func(ctx context.Context) (string, error) {
+			if since := s.drainingSince(); since != nil {
+				return "", fmt.Errorf("draining since %s, %d requests in flight", since.Format(time.RFC3339), len(s.active.List()))
+			}
+			return "serving", nil
+		}},
+		{"history", func(ctx context.Context) (string, error) {
+			entries, _, err := s.history.Stats()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d entries", entries), nil
+		}},
+		{"scheduler", func(ctx context.Context) (string, error) {
+			return fmt.Sprintf("%d schedules", len(s.scheduler.List())), nil
+		}},
+		{"artifacts", func(ctx context.Context) (string, error) {
+			file, err := os.CreateTemp(s.config.ArtifactsDir, ".tmp-*")
+			if err != nil {
+				return "", fmt.Errorf("artifact directory is not writable: %v", err)
+			}
+			file.Close()
+			os.Remove(file.Name())
+			return s.config.ArtifactsDir, nil
+		}},
+	}
+
+	if s.config.TunnelURL != "" {
+		checks = append(checks, readinessCheck{"tunnel", func(ctx context.Context) (string, error) {
+			connected := s.tunnelConnections.Load()
+			if connected == 0 {
+				return "", fmt.Errorf("no connections to the relay at %s", s.config.TunnelURL)
+			}
+			return fmt.Sprintf("%d connections to the relay", connected), nil
+		}})
+	}
+
+	if s.config.CanaryURL != "" {
+		checks = append(checks, readinessCheck{"canary", func(ctx context.Context) (string, error) {
+			req, err := http.NewRequestWithContext(ctx, "GET", s.config.CanaryURL, nil)
+			if err != nil {
+				return "", err
+			}
+			resp, err := s.httpClient.client.Do(req)
+			if err != nil {
+				return "", fmt.Errorf("%s is unreachable: %v", s.config.CanaryURL, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 500 {
+				return "", fmt.Errorf("%s returned %s", s.config.CanaryURL, resp.Status)
+			}
+			return fmt.Sprintf("%s returned %s", s.config.CanaryURL, resp.Status), nil
+		}})
+	}
+
+	return checks
+}
+
+// runReadinessChecks runs the checks concurrently, each within
+// healthCheckTimeout, so a hung dependency fails instead of blocking the probe
+func (s *ProxyServer) runReadinessChecks(ctx context.Context) []HealthCheck {
+	checks := s.readinessChecks()
+	results := make([]HealthCheck, len(checks))
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			type outcome struct {
+				message string
+				err     error
+			}
+			done := make(chan outcome, 1)
+			go func() {
+				message, err := check.check(ctx)
+				done <- outcome{message, err}
+			}()
+
+			result := HealthCheck{Name: check.name, Status: HealthOK}
+			select {
+			case o := <-done:
+				result.Message = o.message
+				if o.err != nil {
+					result.Status = HealthFailed
+					result.Message = o.err.Error()
+				}
+			case <-ctx.Done():
+				result.Status = HealthFailed
+				result.Message = fmt.Sprintf("no answer within %s", healthCheckTimeout)
+			}
+			result.Duration = formatMillis(time.Since(start))
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// writeHealth writes a health response, with 503 Service Unavailable when it
+// failed so orchestrators can act on the status code alone
+func (s *ProxyServer) writeHealth(w http.ResponseWriter, response *HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if response.Status != HealthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleHealthLive reports that the process is up and serving requests
+func (s *ProxyServer) handleHealthLive(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	s.writeHealth(w, &HealthResponse{Status: HealthOK, Version: Version})
+}
+
+// handleHealthReady reports whether the proxy's dependencies work, so it
+// should receive traffic
+func (s *ProxyServer) handleHealthReady(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	response := &HealthResponse{Status: HealthOK, Version: Version, Checks: s.runReadinessChecks(r.Context())}
+	for _, check := range response.Checks {
+		if check.Status != HealthOK {
+			response.Status = HealthFailed
+		}
+	}
+	s.writeHealth(w, response)
+}
@@ -0,0 +1,250 @@
+package slingshot
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// MaxHistoryEntries is the number of requests kept in the history
+const MaxHistoryEntries = 1000
+
+// MaxHistoryBodySize is the largest response body kept in the history.
+// Larger bodies are only kept when stored as artifacts.
+const MaxHistoryBodySize = 1 << 20
+
+// historyPageSize is the number of entries read from storage at a time when
+// looking for entries that match
+const historyPageSize = 200
+
+// History entry sources
+const (
+	HistorySourceProxy    = "proxy"
+	HistorySourceSchedule = "schedule"
+	HistorySourceMonitor  = "monitor"
+	HistorySourceJob      = "job"
+)
+
+// HistoryEntry summarizes one executed request
+type HistoryEntry struct {
+	ID                string    `json:"id"`
+	Time              time.Time `json:"time"`
+	Source            string    `json:"source"`
+	ScheduleID        string    `json:"schedule_id,omitempty"`
+	MonitorID         string    `json:"monitor_id,omitempty"`
+	JobID             string    `json:"job_id,omitempty"`
+	Method            string    `json:"method"`
+	URL               string    `json:"url"`
+	Success           bool      `json:"success"`
+	Status            int       `json:"status,omitempty"`
+	ResponseTime      string    `json:"response_time,omitempty"`
+	ResponseSize      string    `json:"response_size,omitempty"`
+	ResponseTimeMs    float64   `json:"response_time_ms,omitempty"`
+	ResponseSizeBytes int64     `json:"response_size_bytes,omitempty"`
+	ArtifactID        string    `json:"artifact_id,omitempty"`
+	ErrorType         string    `json:"error_type,omitempty"`
+	ErrorMessage      string    `json:"error_message,omitempty"`
+	RemoteAddr        string    `json:"remote_addr,omitempty"`
+	Geo               *GeoInfo  `json:"geo,omitempty"`
+
+	// body is the response body, decoded from base64 for binary responses,
+	// unless it was larger than MaxHistoryBodySize
+	body        []byte
+	bodyDropped bool
+	isBinary    bool
+}
+
+// HistoryResponse is returned by GET /proxy/history
+type HistoryResponse struct {
+	Success    bool            `json:"success"`
+	Entries    []*HistoryEntry `json:"entries"`
+	Total      int             `json:"total"`                 // Entries matching the filters
+	NextOffset int             `json:"next_offset,omitempty"` // Offset of the next page, if there is one
+}
+
+// History keeps the most recent requests in its storage, scrubbed of the
+// values the scrub rules match, and publishes them to message queues and the
+// live tail
+type History struct {
+	storage    HistoryStorage
+	scrubber   *Scrubber
+	publishers *Publishers
+	tail       *Tail
+}
+
+// NewHistory creates a history kept in storage
+func NewHistory(storage HistoryStorage, scrubber *Scrubber) *History {
+	return &History{storage: storage, scrubber: scrubber}
+}
+
+// newHistoryEntry summarizes a request and its outcome
+func newHistoryEntry(id, source, method, url string, response *ProxyResponse) *HistoryEntry {
+	entry := &HistoryEntry{
+		isBinary:          response.IsBinary,
+		ID:                id,
+		Time:              time.Now().UTC(),
+		Source:            source,
+		Method:            method,
+		URL:               url,
+		Success:           response.Success,
+		Status:            response.ResponseStatus,
+		ResponseTime:      response.ResponseTime,
+		ResponseSize:      response.ResponseSize,
+		ResponseTimeMs:    response.ResponseTimeMs,
+		ResponseSizeBytes: response.ResponseSizeBytes,
+		ArtifactID:        response.ArtifactID,
+		ErrorType:         response.ErrorType,
+		ErrorMessage:      response.ErrorMessage,
+	}
+	if response.Connection != nil {
+		entry.RemoteAddr = response.Connection.RemoteAddr
+		entry.Geo = response.Connection.Geo
+	}
+
+	body := []byte(response.ResponseData)
+	if response.IsBinary {
+		body, _ = base64.StdEncoding.DecodeString(response.ResponseData)
+	}
+	if len(body) > MaxHistoryBodySize {
+		entry.bodyDropped = true
+	} else {
+		entry.body = body
+	}
+	return entry
+}
+
+// Add scrubs and stores an entry, dropping the oldest one when the history
+// is full
+func (h *History) Add(entry *HistoryEntry) error {
+	entry.URL = h.scrubber.String(entry.URL)
+	entry.ErrorMessage = h.scrubber.String(entry.ErrorMessage)
+	entry.body = h.scrubber.Body(entry.body, entry.isBinary)
+	h.publishers.Publish(entry)
+	h.tail.publishEntry(entry)
+	return h.storage.Add(entry)
+}
+
+// Get returns the entry with the given ID, or nil if it is no longer kept
+func (h *History) Get(id string) (*HistoryEntry, error) {
+	return h.storage.Get(id)
+}
+
+// Stats returns the number of entries and the bytes of response bodies held
+func (h *History) Stats() (int, int64, error) {
+	return h.storage.Stats()
+}
+
+// Recent returns up to limit entries, newest first, that match keep
+func (h *History) Recent(limit int, keep func(*HistoryEntry) bool) ([]*HistoryEntry, error) {
+	if keep == nil {
+		return h.storage.List(HistoryRange{Limit: limit})
+	}
+
+	// Read pages until enough entries match
+	entries := []*HistoryEntry{}
+	for offset := 0; len(entries) < limit; offset += historyPageSize {
+		page, err := h.storage.List(HistoryRange{Offset: offset, Limit: historyPageSize})
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range page {
+			if len(entries) == limit {
+				break
+			}
+			if keep(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		if len(page) < historyPageSize {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// recordHistory records a request made through one of the proxy endpoints
+func (s *ProxyServer) recordHistory(w http.ResponseWriter, method, url string, response *ProxyResponse) {
+	if err := s.history.Add(newHistoryEntry(requestID(w), HistorySourceProxy, method, url, response)); err != nil {
+		s.logger.Printf("Failed to record history: %v", err)
+	}
+}
+
+// historyBody returns the response body of a history entry
+func (s *ProxyServer) historyBody(entry *HistoryEntry) ([]byte, error) {
+	body, _, err := s.openHistoryBody(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// openHistoryBody opens the response body of a history entry and returns its
+// size, reading it from the artifact store when it was stored there
+func (s *ProxyServer) openHistoryBody(entry *HistoryEntry) (io.ReadSeekCloser, int64, error) {
+	if entry.ArtifactID != "" {
+		file, err := s.artifacts.Open(entry.ArtifactID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("The artifact holding this response body has expired")
+		}
+		size, err := file.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+		return file, size, nil
+	}
+	if entry.bodyDropped {
+		return nil, 0, fmt.Errorf("Response bodies larger than %s are only kept when stored as artifacts", formatSize(MaxHistoryBodySize))
+	}
+	return nopSeekCloser{bytes.NewReader(entry.body)}, int64(len(entry.body)), nil
+}
+
+// nopSeekCloser adds a no-op Close to an in-memory body
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// handleHistory returns the requests matching the query's filters, newest
+// first unless sorted otherwise
+func (s *ProxyServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid History Query", err.Error())
+		return
+	}
+
+	entries, total, err := s.history.Query(filter)
+	if err != nil {
+		s.writeErrorResponse(w, "unknown_error", "History Unavailable", err.Error())
+		return
+	}
+	response := &HistoryResponse{
+		Success: true,
+		Entries: entries,
+		Total:   total,
+	}
+	if next := filter.offset + len(entries); next < total {
+		response.NextOffset = next
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+package slingshot
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// History sort fields for GET /proxy/history
+const (
+	HistorySortTime         = "time"
+	HistorySortStatus       = "status"
+	HistorySortResponseTime = "response_time"
+	HistorySortResponseSize = "response_size"
+	HistorySortURL          = "url"
+)
+
+// statusRange is an inclusive range of response statuses
+type statusRange struct {
+	min, max int
+}
+
+// historyFilter selects, orders and pages history entries
+type historyFilter struct {
+	hosts      HostPatterns
+	methods    map[string]bool
+	statuses   []statusRange
+	errorTypes map[string]bool
+	sources    map[string]bool
+	success    *bool
+	from, to   time.Time
+	text       string // Lower-cased text the URL must contain
+	sort       string
+	ascending  bool
+	offset     int
+	limit      int
+}
+
+// splitList splits a comma-separated query value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseStatusRange parses a status (404), a class (4xx) or a range (500-599)
+func parseStatusRange(value string) (statusRange, error) {
+	if class, found := strings.CutSuffix(strings.ToLower(value), "xx"); found && len(class) == 1 && class[0] >= '1' && class[0] <= '5' {
+		digit := int(class[0]-'0') * 100
+		return statusRange{digit, digit + 99}, nil
+	}
+	low, high, isRange := strings.Cut(value, "-")
+	min, err := strconv.Atoi(low)
+	if err != nil {
+		return statusRange{}, fmt.Errorf("Invalid status %q; use e.g. 404, 4xx or 500-599", value)
+	}
+	max := min
+	if isRange {
+		if max, err = strconv.Atoi(high); err != nil || max < min {
+			return statusRange{}, fmt.Errorf("Invalid status range %q", value)
+		}
+	}
+	return statusRange{min, max}, nil
+}
+
+// parseHistoryTime parses an RFC 3339 time, or a duration such as 15m meaning
+// that long ago
+func parseHistoryTime(name, value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid %s %q; use an RFC 3339 time or a duration such as 15m", name, value)
+}
+
+// parseHistoryFilter reads the filters of GET /proxy/history. Lists are
+// comma-separated and match any of their items.
+func parseHistoryFilter(query url.Values) (*historyFilter, error) {
+	filter := &historyFilter{sort: HistorySortTime, limit: 100}
+
+	filter.hosts = HostPatterns(splitList(query.Get("host")))
+	if methods := splitList(query.Get("method")); len(methods) > 0 {
+		filter.methods = make(map[string]bool)
+		for _, method := range methods {
+			filter.methods[strings.ToUpper(method)] = true
+		}
+	}
+	for _, value := range splitList(query.Get("status")) {
+		status, err := parseStatusRange(value)
+		if err != nil {
+			return nil, err
+		}
+		filter.statuses = append(filter.statuses, status)
+	}
+	if errorTypes := splitList(query.Get("errorType")); len(errorTypes) > 0 {
+		filter.errorTypes = make(map[string]bool)
+		for _, errorType := range errorTypes {
+			filter.errorTypes[errorType] = true
+		}
+	}
+	if sources := splitList(query.Get("source")); len(sources) > 0 {
+		filter.sources = make(map[string]bool)
+		for _, source := range sources {
+			filter.sources[source] = true
+		}
+	}
+	if value := query.Get("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid success %q; use true or false", value)
+		}
+		filter.success = &success
+	}
+
+	var err error
+	if value := query.Get("from"); value != "" {
+		if filter.from, err = parseHistoryTime("from", value); err != nil {
+			return nil, err
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.to, err = parseHistoryTime("to", value); err != nil {
+			return nil, err
+		}
+	}
+	filter.text = strings.ToLower(query.Get("q"))
+
+	if value := query.Get("sort"); value != "" {
+		switch value {
+		case HistorySortTime, HistorySortStatus, HistorySortResponseTime, HistorySortResponseSize, HistorySortURL:
+			filter.sort = value
+		default:
+			return nil, fmt.Errorf("Unknown sort %q; use %s, %s, %s, %s or %s", value, HistorySortTime, HistorySortStatus, HistorySortResponseTime, HistorySortResponseSize, HistorySortURL)
+		}
+	}
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.ascending = true
+	default:
+		return nil, fmt.Errorf("Unknown order %q; use asc or desc", order)
+	}
+
+	if value := query.Get("limit"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			filter.limit = n
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid offset %q", value)
+		}
+		filter.offset = n
+	}
+	return filter, nil
+}
+
+// matches reports whether an entry passes every filter
+func (f *historyFilter) matches(entry *HistoryEntry) bool {
+	if len(f.hosts) > 0 {
+		parsed, err := url.Parse(entry.URL)
+		if err != nil || !f.hosts.Matches(parsed.Hostname()) {
+			return false
+		}
+	}
+	if f.methods != nil && !f.methods[entry.Method] {
+		return false
+	}
+	if len(f.statuses) > 0 {
+		found := false
+		for _, status := range f.statuses {
+			if entry.Status >= status.min && entry.Status <= status.max {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.errorTypes != nil && !f.errorTypes[entry.ErrorType] {
+		return false
+	}
+	if f.sources != nil && !f.sources[entry.Source] {
+		return false
+	}
+	if f.success != nil && entry.Success != *f.success {
+		return false
+	}
+	if !f.from.IsZero() && entry.Time.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && entry.Time.After(f.to) {
+		return false
+	}
+	return f.text == "" || strings.Contains(strings.ToLower(entry.URL), f.text)
+}
+
+// less orders two entries by the sort field, ascending
+func (f *historyFilter) less(a, b *HistoryEntry) bool {
+	switch f.sort {
+	case HistorySortStatus:
+		return a.Status < b.Status
+	case HistorySortResponseTime:
+		return a.ResponseTimeMs < b.ResponseTimeMs
+	case HistorySortResponseSize:
+		return a.ResponseSizeBytes < b.ResponseSizeBytes
+	case HistorySortURL:
+		return a.URL < b.URL
+	default:
+		return a.Time.Before(b.Time)
+	}
+}
+
+// timeOnly reports whether the filter selects entries only by time and
+// orders them by time, so that storage can page through them itself
+func (f *historyFilter) timeOnly() bool {
+	return f.sort == HistorySortTime && len(f.hosts) == 0 && f.methods == nil && len(f.statuses) == 0 &&
+		f.errorTypes == nil && f.sources == nil && f.success == nil && f.text == ""
+}
+
+// Query returns a page of the entries matching filter in its order, and the
+// number of entries matching
+func (h *History) Query(filter *historyFilter) ([]*HistoryEntry, int, error) {
+	if filter.timeOnly() {
+		return h.queryPage(filter)
+	}
+
+	all, err := h.storage.List(HistoryRange{From: filter.from, To: filter.to})
+	if err != nil {
+		return nil, 0, err
+	}
+	matched := []*HistoryEntry{}
+	for _, entry := range all {
+		if filter.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+
+	// Entries are newest first; a stable sort keeps that order among equals
+	sort.SliceStable(matched, func(i, j int) bool {
+		if filter.ascending {
+			return filter.less(matched[i], matched[j])
+		}
+		return filter.less(matched[j], matched[i])
+	})
+
+	total := len(matched)
+	if filter.offset >= total {
+		return []*HistoryEntry{}, total, nil
+	}
+	matched = matched[filter.offset:]
+	if len(matched) > filter.limit {
+		matched = matched[:filter.limit]
+	}
+	return matched, total, nil
+}
+
+// queryPage reads only the requested page from storage, which holds entries
+// newest first
+func (h *History) queryPage(filter *historyFilter) ([]*HistoryEntry, int, error) {
+	total, err := h.storage.Count(filter.from, filter.to)
+	if err != nil {
+		return nil, 0, err
+	}
+	if filter.offset >= total {
+		return []*HistoryEntry{}, total, nil
+	}
+
+	page := HistoryRange{From: filter.from, To: filter.to, Offset: filter.offset, Limit: filter.limit}
+	if filter.ascending {
+		// The page counted from the oldest entry
+		page.Offset = total - filter.offset - filter.limit
+		if page.Offset < 0 {
+			page.Limit += page.Offset
+			page.Offset = 0
+		}
+	}
+	entries, err := h.storage.List(page)
+	if err != nil {
+		return nil, 0, err
+	}
+	if filter.ascending {
+		slices.Reverse(entries)
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,382 @@
+package slingshot
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxHookRequests is the number of captured requests kept per bucket
+const MaxHookRequests = 100
+
+// MaxHookBodySize is the largest captured body; longer bodies are truncated
+const MaxHookBodySize = 1 << 20
+
+// MaxHookBuckets is the number of buckets kept; a new bucket past it evicts
+// the least recently used one
+const MaxHookBuckets = 1000
+
+// HookBucketIdleTime is how long a bucket is kept without captures or reads
+const HookBucketIdleTime = 24 * time.Hour
+
+// hookBucketPattern restricts bucket names to URL-safe identifiers
+var hookBucketPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// CapturedRequest is an inbound request received on a webhook bucket
+type CapturedRequest struct {
+	ID         string            `json:"id"`
+	Bucket     string            `json:"bucket"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Query      string            `json:"query,omitempty"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body,omitempty"`
+	IsBinary   bool              `json:"is_binary,omitempty"`
+	BodySize   int64             `json:"body_size"`
+	Truncated  bool              `json:"truncated,omitempty"`
+	RemoteAddr string            `json:"remote_addr"`
+	ReceivedAt time.Time         `json:"received_at"`
+}
+
+// HookListResponse is returned when listing a bucket
+type HookListResponse struct {
+	Success  bool               `json:"success"`
+	Bucket   string             `json:"bucket"`
+	Requests []*CapturedRequest `json:"requests"`
+}
+
+// hookBucketEntry holds the captured requests of one bucket
+type hookBucketEntry struct {
+	requests []*CapturedRequest
+	lastUsed time.Time
+}
+
+// HookStore keeps captured webhook requests in memory, newest last, and
+// notifies live subscribers of each new capture
+type HookStore struct {
+	mu          sync.Mutex
+	buckets     map[string]*hookBucketEntry
+	subscribers map[string]map[chan *CapturedRequest]struct{}
+
+	// cluster, when set, keeps the buckets in Redis, where every proxy
+	// sharing it lists them and hears of their captures. The store keeps
+	// what it captures while Redis cannot be reached.
+	cluster *Cluster
+}
+
+// NewHookStore creates an empty hook store
+func NewHookStore() *HookStore {
+	return &HookStore{
+		buckets:     make(map[string]*hookBucketEntry),
+		subscribers: make(map[string]map[chan *CapturedRequest]struct{}),
+	}
+}
+
+// Start relays what every proxy of the cluster captures to the store's
+// subscribers
+func (h *HookStore) Start() {
+	if h.cluster != nil {
+		go h.cluster.relayHooks(h.notify)
+	}
+}
+
+// Add stores a captured request, dropping the oldest one when the bucket is full
+func (h *HookStore) Add(captured *CapturedRequest) {
+	if h.cluster != nil {
+		// Subscribers hear of it through the cluster, like those of other proxies
+		err := h.cluster.addHook(captured)
+		if err == nil {
+			return
+		}
+		h.cluster.logger.Printf("Failed to keep captured request %s in the cluster: %v", captured.ID, err)
+	}
+
+	h.mu.Lock()
+
+	now := time.Now()
+	entry := h.buckets[captured.Bucket]
+	if entry == nil {
+		h.evict(now)
+		entry = &hookBucketEntry{}
+		h.buckets[captured.Bucket] = entry
+	}
+
+	entry.requests = append(entry.requests, captured)
+	if len(entry.requests) > MaxHookRequests {
+		entry.requests = entry.requests[len(entry.requests)-MaxHookRequests:]
+	}
+	entry.lastUsed = now
+	h.mu.Unlock()
+
+	h.notify(captured)
+}
+
+// notify passes a captured request to the subscribers of its bucket
+func (h *HookStore) notify(captured *CapturedRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Slow subscribers miss events rather than block captures
+	for ch := range h.subscribers[captured.Bucket] {
+		select {
+		case ch <- captured:
+		default:
+		}
+	}
+}
+
+// List returns the captured requests of a bucket
+func (h *HookStore) List(bucket string) []*CapturedRequest {
+	if h.cluster != nil {
+		requests, err := h.cluster.hooks(bucket)
+		if err == nil {
+			return requests
+		}
+		h.cluster.logger.Printf("Failed to read bucket %s from the cluster: %v", bucket, err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry := h.buckets[bucket]
+	if entry == nil {
+		return []*CapturedRequest{}
+	}
+	entry.lastUsed = time.Now()
+
+	return append([]*CapturedRequest{}, entry.requests...)
+}
+
+// Clear removes all captured requests of a bucket
+func (h *HookStore) Clear(bucket string) {
+	if h.cluster != nil {
+		if err := h.cluster.clearHooks(bucket); err != nil {
+			h.cluster.logger.Printf("Failed to clear bucket %s in the cluster: %v", bucket, err)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.buckets, bucket)
+}
+
+// evict drops idle buckets and, when the store is still full, the least
+// recently used one to make room for a new bucket. The caller holds h.mu.
+func (h *HookStore) evict(now time.Time) {
+	var oldest string
+	for name, entry := range h.buckets {
+		if now.Sub(entry.lastUsed) > HookBucketIdleTime {
+			delete(h.buckets, name)
+			continue
+		}
+		if oldest == "" || entry.lastUsed.Before(h.buckets[oldest].lastUsed) {
+			oldest = name
+		}
+	}
+
+	if len(h.buckets) >= MaxHookBuckets {
+		delete(h.buckets, oldest)
+	}
+}
+
+// Subscribe returns a channel receiving new captures for a bucket, and a
+// function to stop the subscription
+func (h *HookStore) Subscribe(bucket string) (<-chan *CapturedRequest, func()) {
+	ch := make(chan *CapturedRequest, 16)
+
+	h.mu.Lock()
+	if h.subscribers[bucket] == nil {
+		h.subscribers[bucket] = make(map[chan *CapturedRequest]struct{})
+	}
+	h.subscribers[bucket][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers[bucket], ch)
+		if len(h.subscribers[bucket]) == 0 {
+			delete(h.subscribers, bucket)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// captureRequest records an inbound request
+func captureRequest(bucket string, r *http.Request) (*CapturedRequest, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxHookBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the rest of an oversized body without keeping it
+	size := int64(len(body))
+	truncated := size > MaxHookBodySize
+	if truncated {
+		body = body[:MaxHookBodySize]
+		rest, _ := io.Copy(io.Discard, r.Body)
+		size += rest
+	}
+
+	headers := make(map[string]string)
+	for key, values := range r.Header {
+		headers[strings.ToLower(key)] = strings.Join(values, ", ")
+	}
+	if r.Host != "" {
+		headers["host"] = r.Host
+	}
+
+	captured := &CapturedRequest{
+		ID:         newRequestID(),
+		Bucket:     bucket,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Headers:    headers,
+		BodySize:   size,
+		Truncated:  truncated,
+		RemoteAddr: r.RemoteAddr,
+		ReceivedAt: time.Now().UTC(),
+	}
+
+	if utf8.Valid(body) {
+		captured.Body = string(body)
+	} else {
+		captured.Body = base64.StdEncoding.EncodeToString(body)
+		captured.IsBinary = true
+	}
+
+	return captured, nil
+}
+
+// hookBucket returns the bucket named in the route, or "" if it is invalid
+func hookBucket(r *http.Request) string {
+	bucket := mux.Vars(r)["bucket"]
+	if !hookBucketPattern.MatchString(bucket) {
+		return ""
+	}
+	return bucket
+}
+
+// handleHookCapture accepts any request sent to /hooks/{bucket} and stores it
+func (s *ProxyServer) handleHookCapture(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	bucket := hookBucket(r)
+	if bucket == "" {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, `{"success":false}`)
+		return
+	}
+
+	captured, err := captureRequest(bucket, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, `{"success":false}`)
+		return
+	}
+	s.scrubCapture(captured)
+	s.hooks.Add(captured)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": captured.ID})
+}
+
+// scrubCapture removes what the scrub rules match from a captured request
+// before it is kept
+func (s *ProxyServer) scrubCapture(captured *CapturedRequest) {
+	if s.scrubber == nil {
+		return
+	}
+	captured.Query = s.scrubber.String(captured.Query)
+	s.scrubber.Headers(captured.Headers)
+	if !captured.IsBinary {
+		captured.Body = string(s.scrubber.Body([]byte(captured.Body), false))
+	}
+}
+
+// handleHookBucket lists (GET) or clears (DELETE) the requests captured in a bucket
+func (s *ProxyServer) handleHookBucket(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	bucket := hookBucket(r)
+	if bucket == "" {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Bucket", "Bucket names may only contain letters, digits, '-' and '_'")
+		return
+	}
+
+	if r.Method == "DELETE" {
+		s.hooks.Clear(bucket)
+	}
+
+	response := &HookListResponse{
+		Success:  true,
+		Bucket:   bucket,
+		Requests: s.hooks.List(bucket),
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleHookFeed streams requests captured in a bucket as Server-Sent Events
+func (s *ProxyServer) handleHookFeed(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	bucket := hookBucket(r)
+	if bucket == "" {
+		w.Header().Set("Content-Type", "application/json")
+		s.writeErrorResponse(w, "request_format_error", "Invalid Bucket", "Bucket names may only contain letters, digits, '-' and '_'")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher, _ := w.(http.Flusher)
+
+	captures, unsubscribe := s.hooks.Subscribe(bucket)
+	defer unsubscribe()
+
+	// Open the stream right away so EventSource reports it as connected
+	fmt.Fprint(w, ": connected\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case captured := <-captures:
+			data, err := json.Marshal(captured)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: request\nid: %s\ndata: %s\n\n", captured.ID, data); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package slingshot
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// hopByHopHeaders are connection-specific headers (RFC 7230 section 6.1) that
+// must not be forwarded between the caller, the proxy and the target
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// isHopByHopHeader reports whether the canonical header name is hop-by-hop
+func isHopByHopHeader(name string) bool {
+	for _, hopByHop := range hopByHopHeaders {
+		if name == hopByHop {
+			return true
+		}
+	}
+	return false
+}
+
+// headerOverrideSet builds a lookup of header names the caller explicitly
+// wants sent as given
+func headerOverrideSet(names []string) map[string]bool {
+	overrides := make(map[string]bool)
+	for _, name := range names {
+		overrides[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+	}
+	return overrides
+}
+
+// removeHopByHopHeaders deletes hop-by-hop headers, including any listed in
+// the Connection header, except those present in keep
+func removeHopByHopHeaders(header http.Header, keep map[string]bool) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !keep[name] {
+				header.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		if !keep[name] {
+			header.Del(name)
+		}
+	}
+}
+
+// removeReservedHeaders deletes headers the proxy derives itself (Host and
+// Content-Length) unless the caller explicitly overrides them
+func removeReservedHeaders(header http.Header, keep map[string]bool) {
+	for _, name := range []string{"Host", "Content-Length"} {
+		if !keep[name] {
+			header.Del(name)
+		}
+	}
+}
+
+// applyHeaderOverrides applies the overridden Host, Content-Length and
+// Transfer-Encoding headers, which Go would otherwise ignore
+func applyHeaderOverrides(httpReq *http.Request, headers http.Header, overrides map[string]bool, chunkSize int) error {
+	if host := headers.Get("Host"); overrides["Host"] && host != "" {
+		httpReq.Host = host
+	}
+
+	if value := headers.Get("Content-Length"); overrides["Content-Length"] && value != "" {
+		length, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || length < 0 {
+			return fmt.Errorf("Invalid Content-Length override: %s", value)
+		}
+		httpReq.ContentLength = length
+	}
+
+	if value := headers.Get("Transfer-Encoding"); overrides["Transfer-Encoding"] && value != "" {
+		if !strings.EqualFold(value, "chunked") {
+			return fmt.Errorf("Unsupported Transfer-Encoding override: %s", value)
+		}
+		useChunkedEncoding(httpReq, chunkSize)
+	}
+
+	return nil
+}
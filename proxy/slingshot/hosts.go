@@ -0,0 +1,22 @@
+package slingshot
+
+import "strings"
+
+// HostPatterns matches host names case-insensitively. Entries match exactly
+// or, written as "*.example.com", any subdomain.
+type HostPatterns []string
+
+// Matches reports whether host matches any of the patterns
+func (p HostPatterns) Matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range p {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package slingshot
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// httpVersions maps the httpVersion option to the protocol written on the
+// request line
+var httpVersions = map[string]string{
+	"1.0": "HTTP/1.0",
+	"1.1": "HTTP/1.1",
+}
+
+// validateHTTPVersion checks the httpVersion option of a request
+func validateHTTPVersion(req *ProxyRequest) error {
+	if req.HTTPVersion == "" {
+		return nil
+	}
+	if _, ok := httpVersions[req.HTTPVersion]; !ok {
+		return fmt.Errorf("httpVersion must be 1.0 or 1.1")
+	}
+	if req.HTTPVersion == "1.0" && req.Chunked {
+		return fmt.Errorf("Chunked request bodies need HTTP/1.1")
+	}
+	return nil
+}
+
+// http1Protocols lets a transport speak HTTP/1.1 only, never upgrading to
+// HTTP/2 through ALPN
+func http1Protocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	return protocols
+}
@@ -0,0 +1,54 @@
+package slingshot
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+
+	"golang.org/x/net/idna"
+)
+
+// toASCIIURL converts an internationalized hostname in the URL to its punycode
+// (A-label) form. When a conversion happens, the Unicode and ASCII hosts are
+// returned along with the rewritten URL; otherwise the URL is unchanged.
+func toASCIIURL(rawURL string) (string, string, string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Host == "" {
+		// Leave it to URL validation to report the problem
+		return rawURL, "", "", nil
+	}
+
+	hostname := parsedURL.Hostname()
+	if isASCII(hostname) {
+		return rawURL, "", "", nil
+	}
+
+	asciiHost, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return "", "", "", fmt.Errorf("Invalid internationalized domain name %q: %v", hostname, err)
+	}
+
+	// Keep the Unicode form for display
+	unicodeHost, err := idna.Display.ToUnicode(asciiHost)
+	if err != nil {
+		unicodeHost = hostname
+	}
+
+	if port := parsedURL.Port(); port != "" {
+		parsedURL.Host = net.JoinHostPort(asciiHost, port)
+	} else {
+		parsedURL.Host = asciiHost
+	}
+
+	return parsedURL.String(), unicodeHost, asciiHost, nil
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,257 @@
+package slingshot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// pmShim implements the Postman pm.* API on top of the script state
+//
+//go:embed pm.js
+var pmShim string
+
+// jsHeader is a header as seen by JavaScript scripts
+type jsHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// jsResponse is the response as seen by JavaScript post-response scripts
+type jsResponse struct {
+	Code         int        `json:"code"`
+	Status       string     `json:"status"`
+	Headers      []jsHeader `json:"headers"`
+	Body         string     `json:"body"`
+	ResponseTime float64    `json:"responseTime"`
+}
+
+// jsState is shared with the pm shim as JSON and read back after the script
+type jsState struct {
+	Request struct {
+		Method  string     `json:"method"`
+		URL     string     `json:"url"`
+		Headers []jsHeader `json:"headers"`
+		Body    string     `json:"body"`
+	} `json:"request"`
+	Response *jsResponse            `json:"response,omitempty"`
+	Env      map[string]interface{} `json:"env"`
+	Next     string                 `json:"next"`
+	Tests    []ScriptTest           `json:"tests"`
+	Logs     []string               `json:"logs"`
+}
+
+// newJSState captures a request for a JavaScript script
+func newJSState(req *ProxyRequest) *jsState {
+	state := &jsState{
+		Env:   map[string]interface{}{},
+		Tests: []ScriptTest{},
+		Logs:  []string{},
+	}
+	for key, value := range req.Environment {
+		state.Env[key] = value
+	}
+	state.Request.Method = req.Method
+	state.Request.URL = req.URL
+	state.Request.Body = req.Body
+	state.Request.Headers = []jsHeader{}
+	for _, field := range parseHeaderFields(req.Headers) {
+		state.Request.Headers = append(state.Request.Headers, jsHeader{Key: field.Name, Value: field.Value})
+	}
+	return state
+}
+
+// runJavaScript runs a script with the pm shim and returns the state it left
+func runJavaScript(ctx context.Context, state *jsState, script string) (*jsState, error) {
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+
+	input, err := json.Marshal(state)
+	if err != nil {
+		return state, err
+	}
+
+	vm := goja.New()
+	vm.Set("__input", string(input))
+	vm.Set("__host", jsHost())
+
+	// Stop the script when it runs out of time
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			vm.Interrupt("script timed out")
+		case <-done:
+		}
+	}()
+
+	if _, err := vm.RunString(pmShim); err != nil {
+		return state, err
+	}
+	_, runErr := vm.RunString(script)
+
+	// Read back the state even after an error so logs and tests are kept
+	result, err := vm.RunString("JSON.stringify(__state)")
+	if err == nil {
+		var updated jsState
+		if err := json.Unmarshal([]byte(result.String()), &updated); err == nil {
+			state = &updated
+		}
+	}
+	if len(state.Logs) > maxScriptLogs {
+		state.Logs = state.Logs[:maxScriptLogs]
+	}
+	return state, runErr
+}
+
+// jsErrorMessage returns a script error without the JavaScript stack trace
+func jsErrorMessage(err error) string {
+	switch e := err.(type) {
+	case *goja.Exception:
+		return e.Value().String()
+	case *goja.InterruptedError:
+		return fmt.Sprint(e.Value())
+	}
+	return err.Error()
+}
+
+// jsHost returns the native helpers the pm shim builds CryptoJS and btoa on.
+// Binary data is passed as hex strings.
+func jsHost() map[string]interface{} {
+	hashes := map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+	lookup := func(algorithm string) (func() hash.Hash, error) {
+		h, ok := hashes[algorithm]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported hash %q", algorithm)
+		}
+		return h, nil
+	}
+
+	return map[string]interface{}{
+		"hash": func(algorithm, dataHex string) (string, error) {
+			h, err := lookup(algorithm)
+			if err != nil {
+				return "", err
+			}
+			data, err := hex.DecodeString(dataHex)
+			if err != nil {
+				return "", err
+			}
+			digest := h()
+			digest.Write(data)
+			return hex.EncodeToString(digest.Sum(nil)), nil
+		},
+		"hmac": func(algorithm, keyHex, dataHex string) (string, error) {
+			h, err := lookup(algorithm)
+			if err != nil {
+				return "", err
+			}
+			key, err := hex.DecodeString(keyHex)
+			if err != nil {
+				return "", err
+			}
+			data, err := hex.DecodeString(dataHex)
+			if err != nil {
+				return "", err
+			}
+			mac := hmac.New(h, key)
+			mac.Write(data)
+			return hex.EncodeToString(mac.Sum(nil)), nil
+		},
+		"utf8ToHex": func(s string) string {
+			return hex.EncodeToString([]byte(s))
+		},
+		"hexToUtf8": func(s string) (string, error) {
+			b, err := hex.DecodeString(s)
+			return strings.ToValidUTF8(string(b), "�"), err
+		},
+		"hexToBase64": func(s string) (string, error) {
+			b, err := hex.DecodeString(s)
+			return base64.StdEncoding.EncodeToString(b), err
+		},
+		"base64ToHex": func(s string) (string, error) {
+			b, err := base64.StdEncoding.DecodeString(s)
+			return hex.EncodeToString(b), err
+		},
+	}
+}
+
+// runJSPreRequestScript runs a JavaScript pre-request script, which may change
+// pm.request before it is sent
+func runJSPreRequestScript(ctx context.Context, req *ProxyRequest, script string) ([]string, error) {
+	state, err := runJavaScript(ctx, newJSState(req), script)
+	if err != nil {
+		return state.Logs, fmt.Errorf("Pre-request script failed: %s", jsErrorMessage(err))
+	}
+
+	req.Method = state.Request.Method
+	req.URL = state.Request.URL
+	req.Body = state.Request.Body
+	req.Headers = nil
+	for _, header := range state.Request.Headers {
+		req.Headers = append(req.Headers, header.Key+": "+header.Value)
+	}
+	req.Environment = jsEnvStrings(state.Env)
+	return state.Logs, nil
+}
+
+// jsEnvStrings converts the variables of a script to strings. Strings are
+// used as they are, anything else as JSON.
+func jsEnvStrings(env map[string]interface{}) map[string]string {
+	if len(env) == 0 {
+		return nil
+	}
+	vars := make(map[string]string, len(env))
+	for key, value := range env {
+		vars[key] = variableString(value)
+	}
+	return vars
+}
+
+// runJSPostResponseScript runs a JavaScript post-response script and adds its
+// variables, tests, next request and error to the response
+func runJSPostResponseScript(ctx context.Context, req *ProxyRequest, response *ProxyResponse, durationMillis float64, script string) {
+	state := newJSState(req)
+	state.Response = &jsResponse{
+		Code:         response.ResponseStatus,
+		Status:       http.StatusText(response.ResponseStatus),
+		Headers:      []jsHeader{},
+		Body:         response.ResponseData,
+		ResponseTime: durationMillis,
+	}
+	for name, value := range response.ResponseHeaders {
+		state.Response.Headers = append(state.Response.Headers, jsHeader{Key: name, Value: value})
+	}
+
+	state, err := runJavaScript(ctx, state, script)
+	response.ScriptLogs = append(response.ScriptLogs, state.Logs...)
+	if len(state.Tests) > 0 {
+		response.ScriptTests = state.Tests
+	}
+	if err != nil {
+		response.ScriptError = "Post-response script failed: " + jsErrorMessage(err)
+		return
+	}
+
+	response.ScriptEnv = jsEnvStrings(state.Env)
+	response.ScriptNext = state.Next
+}
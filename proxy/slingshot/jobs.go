@@ -0,0 +1,440 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// MaxJobs is the number of jobs kept; the oldest finished ones are dropped
+	MaxJobs = 1000
+
+	// callbackAttempts is how many times a callback is sent before giving up
+	callbackAttempts = 3
+
+	// callbackBackoff is the delay before resending a callback; it doubles on
+	// each attempt
+	callbackBackoff = 2 * time.Second
+
+	// CallbackSignatureHeader carries the HMAC-SHA256 of a callback, and
+	// CallbackTimestampHeader the Unix time it was signed at
+	CallbackSignatureHeader = "X-Slingshot-Signature"
+	CallbackTimestampHeader = "X-Slingshot-Timestamp"
+
+	// CallbackJobHeader carries the ID of the job a callback reports on
+	CallbackJobHeader = "X-Slingshot-Job-Id"
+)
+
+// Job states
+const (
+	JobRunning  = "running"
+	JobComplete = "complete"
+	JobFailed   = "failed"
+)
+
+// JobRequest is the body of POST /proxy/jobs: the JSON of /proxy/request,
+// and where to deliver the response
+type JobRequest struct {
+	ProxyRequest
+	CallbackURL    string `json:"callbackUrl,omitempty"`
+	CallbackSecret string `json:"callbackSecret,omitempty"` // Signs the callback instead of -callback-secret
+}
+
+// CallbackDelivery reports how a job's response was delivered to its
+// callbackUrl
+type CallbackDelivery struct {
+	URL         string     `json:"url"`
+	Attempts    int        `json:"attempts"`
+	Status      int        `json:"status,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Job is a request run in the background. Its response is kept until
+// polled, and POSTed to its callbackUrl when it has one.
+type Job struct {
+	ID         string            `json:"id"`
+	State      string            `json:"state"`
+	Request    ProxyRequest      `json:"request"`
+	Response   *ProxyResponse    `json:"response,omitempty"`
+	Callback   *CallbackDelivery `json:"callback,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+
+	callbackSecret string
+}
+
+// JobResponse is returned by the /proxy/jobs endpoints
+type JobResponse struct {
+	Success bool   `json:"success"`
+	Job     *Job   `json:"job,omitempty"`
+	Jobs    []*Job `json:"jobs,omitempty"`
+}
+
+// JobStore keeps the jobs started through the proxy in memory
+type JobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobStore creates an empty job store
+func NewJobStore() *JobStore {
+	return &JobStore{jobs: make(map[string]*Job)}
+}
+
+// Add registers a job, dropping the oldest finished jobs beyond MaxJobs
+func (s *JobStore) Add(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = job
+	for len(s.jobs) > MaxJobs {
+		var oldest *Job
+		for _, candidate := range s.jobs {
+			if candidate.State != JobRunning && (oldest == nil || candidate.CreatedAt.Before(oldest.CreatedAt)) {
+				oldest = candidate
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(s.jobs, oldest.ID)
+	}
+}
+
+// Get returns a snapshot of a job
+func (s *JobStore) Get(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil
+	}
+	return job.snapshot()
+}
+
+// List returns snapshots of all jobs, oldest first
+func (s *JobStore) List() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Remove deletes a finished job, reporting whether it existed
+func (s *JobStore) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.jobs[id]
+	delete(s.jobs, id)
+	return ok
+}
+
+// update changes a job while holding the store lock
+func (s *JobStore) update(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// snapshot copies a job for reading outside the store lock
+func (j *Job) snapshot() *Job {
+	snapshot := *j
+	if j.Callback != nil {
+		callback := *j.Callback
+		snapshot.Callback = &callback
+	}
+	return &snapshot
+}
+
+// signCallback returns the signature of a callback body sent at timestamp:
+// the hex HMAC-SHA256, keyed with secret, of "<timestamp>.<body>"
+func signCallback(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateCallbackURL checks a job's callbackUrl
+func validateCallbackURL(callbackURL string) error {
+	parsed, err := url.Parse(callbackURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("Invalid callbackUrl %q; use an http:// or https:// URL", callbackURL)
+	}
+	return nil
+}
+
+// runJob runs a job in the background, keeping failed runs as dead letters
+func (s *ProxyServer) runJob(job *Job) {
+	run := s.executeJob(job)
+	if isFailedRun(run) {
+		s.deadLetters.Record(&DeadLetter{
+			Source:  DeadLetterJob,
+			JobID:   job.ID,
+			Request: job.Request,
+		}, &DeadLetterAttempt{Reason: failureReason(run), Run: run})
+	}
+}
+
+// retryJob runs the job of a dead letter again, delivering its callback
+// again if the job is still kept
+func (s *ProxyServer) retryJob(letter *DeadLetter) *HistoryEntry {
+	var job *Job
+	s.jobs.update(func() {
+		job = s.jobs.jobs[letter.JobID]
+		if job != nil {
+			job.State = JobRunning
+			job.FinishedAt = nil
+			if job.Callback != nil {
+				job.Callback = &CallbackDelivery{URL: job.Callback.URL}
+			}
+		}
+	})
+	if job == nil {
+		// Forgotten since; keep the ID so the runs stay together in the history
+		job = &Job{ID: letter.JobID, Request: letter.Request}
+	}
+	return s.executeJob(job)
+}
+
+// executeJob sends a job's request, records it in the history and delivers
+// the response to the job's callbackUrl
+func (s *ProxyServer) executeJob(job *Job) *HistoryEntry {
+	req := job.Request
+	req.Headers = append([]string(nil), req.Headers...)
+
+	// Set default timeout if not provided
+	if req.Timeout == 0 {
+		req.Timeout = 60 // default 60 seconds
+	}
+
+	var response *ProxyResponse
+	if req.PathParams != nil {
+		substituted, err := s.httpClient.substitutePathParams(req.URL, req.PathParams, req.PathParamEncoding)
+		if err != nil {
+			response = &ProxyResponse{Success: false, ErrorType: "request_format_error", ErrorTitle: "Invalid Path Parameter", ErrorMessage: err.Error()}
+		} else {
+			req.URL = substituted
+		}
+	}
+
+	id := newRequestID()
+	if response == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Timeout)*time.Second)
+		defer cancel()
+
+		s.logger.Printf("[%s] %s %s (job %s)", id, req.Method, req.URL, job.ID)
+
+		var err error
+		response, err = s.httpClient.ExecuteRequest(ctx, &req)
+		if err != nil {
+			response = &ProxyResponse{Success: false, ErrorType: "unknown_error", ErrorTitle: "Request Failed", ErrorMessage: err.Error()}
+		}
+	}
+	response.RequestID = id
+	s.offloadBody(response, req.Artifact)
+
+	entry := newHistoryEntry(id, HistorySourceJob, job.Request.Method, job.Request.URL, response)
+	entry.JobID = job.ID
+	if err := s.history.Add(entry); err != nil {
+		s.logger.Printf("Failed to record history: %v", err)
+	}
+
+	finished := time.Now().UTC()
+	s.jobs.update(func() {
+		job.State = JobComplete
+		if isFailedRun(entry) {
+			job.State = JobFailed
+		}
+		job.Response = response
+		job.FinishedAt = &finished
+	})
+
+	if job.Callback != nil {
+		s.deliverCallback(job, response)
+	}
+	return entry
+}
+
+// deliverCallback POSTs a job's response to its callbackUrl, signed with the
+// job's secret, resending it when the receiver fails
+func (s *ProxyServer) deliverCallback(job *Job, response *ProxyResponse) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		s.logger.Printf("Job %s: failed to encode callback: %v", job.ID, err)
+		return
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	backoff := callbackBackoff
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		status, err := s.sendCallback(client, job, body)
+
+		delivered := time.Now().UTC()
+		s.jobs.update(func() {
+			job.Callback.Attempts = attempt
+			job.Callback.Status = status
+			job.Callback.Error = ""
+			if err != nil {
+				job.Callback.Error = err.Error()
+			} else {
+				job.Callback.DeliveredAt = &delivered
+			}
+		})
+		if err == nil {
+			return
+		}
+		s.logger.Printf("Job %s: failed to deliver callback (attempt %d): %v", job.ID, attempt, err)
+		if attempt < callbackAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// sendCallback makes one delivery attempt, returning the receiver's status
+func (s *ProxyServer) sendCallback(client *http.Client, job *Job, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", job.Callback.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CallbackJobHeader, job.ID)
+	req.Header.Set(CallbackTimestampHeader, timestamp)
+	req.Header.Set(CallbackSignatureHeader, signCallback(job.callbackSecret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s returned %s", job.Callback.URL, resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// handleJobs lists (GET) or starts (POST) background jobs. A POST returns at
+// once; the response is delivered to the callbackUrl, if set, and kept for
+// GET /proxy/jobs/{id}.
+func (s *ProxyServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "GET" {
+		if err := json.NewEncoder(w).Encode(&JobResponse{Success: true, Jobs: s.jobs.List()}); err != nil {
+			s.logger.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+
+	var req JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if req.Method == "" || req.URL == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing Fields", "Method and URL are required")
+		return
+	}
+	if err := checkTargetURL(r.Context(), req.URL); err != nil {
+		s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+
+	job := &Job{
+		ID:        newRequestID(),
+		State:     JobRunning,
+		Request:   req.ProxyRequest,
+		CreatedAt: time.Now().UTC(),
+	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Callback", err.Error())
+			return
+		}
+		if err := checkTargetURL(r.Context(), req.CallbackURL); err != nil {
+			s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+			return
+		}
+		job.callbackSecret = req.CallbackSecret
+		if job.callbackSecret == "" {
+			job.callbackSecret = s.config.CallbackSecret
+		}
+		if job.callbackSecret == "" {
+			s.writeErrorResponse(w, "request_format_error", "Missing Callback Secret", "Set callbackSecret, or start the proxy with -callback-secret, to sign callbacks")
+			return
+		}
+		job.Callback = &CallbackDelivery{URL: req.CallbackURL}
+	}
+
+	// Forward allowlisted headers from the caller's own request
+	job.Request.Headers = append(s.passthroughHeaders(r, job.Request.Headers), job.Request.Headers...)
+
+	s.jobs.Add(job)
+	s.logger.Printf("[%s] Started job %s: %s %s", requestID(w), job.ID, req.Method, req.URL)
+	go s.runJob(job)
+
+	if err := json.NewEncoder(w).Encode(&JobResponse{Success: true, Job: s.jobs.Get(job.ID)}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleJob returns (GET) or forgets (DELETE) one job
+func (s *ProxyServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	job := s.jobs.Get(id)
+	if job == nil {
+		s.writeErrorResponse(w, "not_found", "Job Not Found", fmt.Sprintf("No job with id %s", id))
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if job.State == JobRunning {
+			s.writeErrorResponse(w, "request_format_error", "Job Running", "A running job cannot be deleted")
+			return
+		}
+		s.jobs.Remove(id)
+	}
+
+	if err := json.NewEncoder(w).Encode(&JobResponse{Success: true, Job: job}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
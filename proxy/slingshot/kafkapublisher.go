@@ -0,0 +1,91 @@
+package slingshot
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// kafkaPublisher produces records to a Kafka topic, spreading them over its
+// partitions in turn and waiting for the leader to acknowledge each one. The
+// other brokers are found through the one in the URL.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// newKafkaPublisher sets up producing to
+// kafka://[user:pass@]broker[:port]/topic?tls=true&sasl=scram-sha-512
+func newKafkaPublisher(parsed *url.URL) (*kafkaPublisher, error) {
+	topic := strings.Trim(parsed.Path, "/")
+	if topic == "" || strings.Contains(topic, "/") {
+		return nil, fmt.Errorf("Kafka URL %s needs a topic, e.g. kafka://broker:9092/slingshot-requests", redactedURL(parsed.String()))
+	}
+
+	tlsConfig, err := publishTLSConfig(parsed.Query())
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := kafkaSASL(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:                   kafka.TCP(hostWithPort(parsed, "9092")),
+		Topic:                  topic,
+		Balancer:               &kafka.RoundRobin{},
+		RequiredAcks:           kafka.RequireOne,
+		BatchSize:              1, // Send each record right away
+		ReadTimeout:            publishTimeout,
+		WriteTimeout:           publishTimeout,
+		AllowAutoTopicCreation: true,
+		Transport: &kafka.Transport{
+			DialTimeout: publishTimeout,
+			ClientID:    "slingshot",
+			TLS:         tlsConfig,
+			SASL:        mechanism,
+		},
+	}}, nil
+}
+
+// kafkaSASL returns the SASL mechanism for the URL's credentials: PLAIN
+// unless the sasl parameter names SCRAM
+func kafkaSASL(parsed *url.URL) (sasl.Mechanism, error) {
+	mechanism := strings.ToLower(parsed.Query().Get("sasl"))
+	if parsed.User == nil {
+		if mechanism != "" {
+			return nil, fmt.Errorf("Kafka sasl=%s needs a user and password in the URL", mechanism)
+		}
+		return nil, nil
+	}
+
+	user := parsed.User.Username()
+	password, _ := parsed.User.Password()
+	switch mechanism {
+	case "", "plain":
+		return plain.Mechanism{Username: user, Password: password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, user, password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, user, password)
+	default:
+		return nil, fmt.Errorf("Unknown Kafka sasl %q (expected plain, scram-sha-256 or scram-sha-512)", mechanism)
+	}
+}
+
+func (k *kafkaPublisher) Publish(key string, record []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	return k.writer.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: record})
+}
+
+func (k *kafkaPublisher) Close() error {
+	return k.writer.Close()
+}
@@ -0,0 +1,312 @@
+package slingshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Request lint severities. Errors make the proxy refuse the request;
+// warnings point out options that are ignored or likely mistakes.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// longTimeout is the timeout, in seconds, above which a request is flagged
+const longTimeout = 300
+
+// pathParamPattern finds :name path parameters in a URL's path
+var pathParamPattern = regexp.MustCompile(`/:([A-Za-z_][A-Za-z0-9_]*)`)
+
+// LintIssue is a problem found in a request
+type LintIssue struct {
+	Severity string `json:"severity"`
+	Field    string `json:"field"` // JSON name of the request field the issue is about
+	Message  string `json:"message"`
+}
+
+// LintResponse is returned by /proxy/validate
+type LintResponse struct {
+	Success bool        `json:"success"`
+	Valid   bool        `json:"valid"` // No errors; warnings may remain
+	Issues  []LintIssue `json:"issues"`
+}
+
+// lintRequest checks a request without sending it
+func (c *HTTPClient) lintRequest(req *ProxyRequest) []LintIssue {
+	issues := []LintIssue{}
+	report := func(severity, field, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{Severity: severity, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	check := func(field string, err error) {
+		if err != nil {
+			report(LintError, field, "%v", err)
+		}
+	}
+
+	// Method and URL
+	check("method", c.validateMethod(req.Method))
+	if req.Method != "" && req.Method != strings.ToUpper(req.Method) {
+		report(LintWarning, "method", "Methods are case-sensitive; %s is not %s", req.Method, strings.ToUpper(req.Method))
+	}
+	c.lintURL(req, report)
+
+	// Headers
+	overrides := headerOverrideSet(req.HeaderOverrides)
+	sent := make(map[string]bool)
+	for _, header := range req.Headers {
+		name, value, found := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		switch {
+		case !found:
+			report(LintWarning, "headers", "%q is not in \"Name: value\" form and is not sent", header)
+			continue
+		case name == "" || !isToken(name):
+			report(LintError, "headers", "%q is not a valid header name", name)
+			continue
+		case strings.TrimSpace(value) == "":
+			report(LintWarning, "headers", "%s has no value and is not sent", name)
+			continue
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		sent[canonical] = true
+		if (isHopByHopHeader(canonical) || canonical == "Host" || canonical == "Content-Length") && !overrides[canonical] {
+			report(LintWarning, "headers", "%s is removed unless listed in headerOverrides", canonical)
+		}
+	}
+	for _, name := range req.HeaderOverrides {
+		if !sent[http.CanonicalHeaderKey(strings.TrimSpace(name))] {
+			report(LintWarning, "headerOverrides", "%s is not among the headers", name)
+		}
+	}
+
+	// Body
+	hasBody := req.Body != "" || req.BodyPath != "" || len(req.Multipart) > 0
+	sources := 0
+	for _, set := range []bool{req.Body != "", req.BodyPath != "", len(req.Multipart) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		report(LintError, "body", "Only one of body, bodyPath and multipart can be set")
+	}
+	if hasBody && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		report(LintWarning, "body", "A body on %s has no defined meaning; many servers ignore or reject it", req.Method)
+	}
+	if req.BodyFormat != "" {
+		if _, ok := bodyFormats[strings.ToLower(req.BodyFormat)]; !ok {
+			report(LintError, "bodyFormat", "Unknown body format %q", req.BodyFormat)
+		} else if _, err := parseJSONValue([]byte(req.Body)); err != nil && !strings.Contains(req.Body, "{{") {
+			report(LintError, "body", "Body is not valid JSON for bodyFormat: %v", err)
+		}
+		if req.ProtoMessage != "" {
+			report(LintError, "bodyFormat", "Use either bodyFormat or protoMessage, not both")
+		}
+	}
+	if req.Chunked && !hasBody {
+		report(LintWarning, "chunked", "There is no body to send chunked")
+	}
+	if req.ChunkSize > 0 && !req.Chunked {
+		report(LintWarning, "chunkSize", "chunkSize only applies with chunked")
+	}
+	if req.ExpectContinue && !hasBody {
+		report(LintWarning, "expectContinue", "Expect: 100-continue is only sent with a body")
+	}
+	check("httpVersion", validateHTTPVersion(req))
+	if req.ExpectContinue && req.HTTPVersion == "1.0" {
+		report(LintWarning, "expectContinue", "HTTP/1.0 servers do not send 100 Continue; the body is sent right away")
+	}
+
+	// Timeouts and budgets
+	switch {
+	case req.Timeout < 0:
+		report(LintError, "timeout", "timeout cannot be negative")
+	case req.Timeout > longTimeout:
+		report(LintWarning, "timeout", "A timeout of %d seconds is unusually long", req.Timeout)
+	}
+	check("maxDownloadBytes", validateDownloadBudget(req))
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = 60
+	}
+	if req.MaxDownloadSeconds > timeout {
+		report(LintWarning, "maxDownloadSeconds", "maxDownloadSeconds is longer than the %d second timeout", timeout)
+	}
+	_, _, err := throttleRates(req)
+	check("throttleKbps", err)
+
+	// Retries and redirects
+	check("retries", validateRetries(req))
+	if req.Retries > 0 && isIdempotencyKeyMethod(req.Method) && !req.IdempotencyKey {
+		report(LintWarning, "retries", "Retried %s requests may be applied twice; consider idempotencyKey", req.Method)
+	}
+	if req.IdempotencyKey && !isIdempotencyKeyMethod(req.Method) {
+		report(LintWarning, "idempotencyKey", "Idempotency keys are only added to POST and PATCH requests")
+	}
+	if _, err := newRedirectPolicy(req); err != nil {
+		field := "redirectMethod"
+		if strings.Contains(err.Error(), "redirectCredentials") {
+			field = "redirectCredentials"
+		}
+		report(LintError, field, "%v", err)
+	}
+	if req.FollowRedirects != nil && !*req.FollowRedirects && (req.RedirectMethod != "" || req.RedirectCredentials != "") {
+		report(LintWarning, "followRedirects", "redirectMethod and redirectCredentials have no effect without following redirects")
+	}
+
+	// TLS
+	if _, err := requestTLSConfig(req); err != nil {
+		// The errors start with the option they are about
+		field, _, _ := strings.Cut(err.Error(), " ")
+		report(LintError, field, "%v", err)
+	}
+	if len(req.CipherSuites) > 0 && req.TLSMaxVersion == "1.3" {
+		report(LintWarning, "cipherSuites", "cipherSuites do not apply when TLS 1.3 is negotiated")
+	}
+	if strings.HasPrefix(strings.ToLower(req.URL), "http:") {
+		for _, option := range []struct {
+			field string
+			set   bool
+		}{
+			{"tlsMinVersion", req.TLSMinVersion != ""},
+			{"tlsMaxVersion", req.TLSMaxVersion != ""},
+			{"cipherSuites", len(req.CipherSuites) > 0},
+			{"alpnProtocols", len(req.ALPNProtocols) > 0},
+			{"serverName", req.ServerName != ""},
+			{"tlsFingerprint", req.TLSFingerprint != ""},
+		} {
+			if option.set {
+				report(LintWarning, option.field, "TLS options only apply to https URLs")
+			}
+		}
+	}
+
+	// Other options
+	if req.Range != "" {
+		_, err := parseRangeHeader(req.Range)
+		check("range", err)
+	}
+	if req.NetworkProfile != "" {
+		_, err := LookupNetworkProfile(req.NetworkProfile)
+		check("networkProfile", err)
+	}
+	check("priority", validatePriority(req.Priority))
+	check("assertions", validateAssertions(req.Assertions))
+	check("scriptLanguage", validateScriptLanguage(req.ScriptLanguage))
+	_, err = loadScript(req.PreRequestScript, req.PreRequestScriptFile, c.scriptDirs)
+	check("preRequestScriptFile", err)
+	_, err = loadScript(req.PostResponseScript, req.PostResponseScriptFile, c.scriptDirs)
+	check("postResponseScriptFile", err)
+	if req.Cache && !isCacheableMethod(req.Method) {
+		report(LintWarning, "cache", "Only GET responses are cached")
+	}
+	if req.Stream {
+		if len(req.Assertions) > 0 || req.PostResponseScript != "" || req.PostResponseScriptFile != "" {
+			report(LintWarning, "stream", "Assertions and post-response scripts do not run on streamed responses")
+		}
+		if req.Cache {
+			report(LintWarning, "stream", "Streamed responses are not cached")
+		}
+	}
+
+	return issues
+}
+
+// lintURL checks the URL once its path parameters are filled in
+func (c *HTTPClient) lintURL(req *ProxyRequest, report func(severity, field, format string, args ...interface{})) {
+	if req.URL == "" {
+		report(LintError, "url", "URL is required")
+		return
+	}
+
+	path := req.URL
+	if end := strings.IndexAny(path, "?#"); end >= 0 {
+		path = path[:end]
+	}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		if _, ok := req.PathParams[match[1]]; !ok {
+			if _, ok := req.PathParams[":"+match[1]]; !ok {
+				report(LintWarning, "path_params", ":%s in the URL has no value and is sent as is", match[1])
+			}
+		}
+	}
+	names := make([]string, 0, len(req.PathParams))
+	for name := range req.PathParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.Contains(path, ":"+strings.TrimPrefix(name, ":")) {
+			report(LintWarning, "path_params", "%s does not appear in the URL", name)
+		}
+	}
+
+	target, err := c.substitutePathParams(req.URL, req.PathParams, req.PathParamEncoding)
+	if err != nil {
+		report(LintError, "path_params", "%v", err)
+		return
+	}
+	if strings.Contains(target, "{{") {
+		// Variables are only known when the request is sent
+		return
+	}
+	asciiURL, _, _, err := toASCIIURL(target)
+	if err != nil {
+		report(LintError, "url", "%v", err)
+		return
+	}
+	if err := c.validateURL(asciiURL); err != nil {
+		report(LintError, "url", "%v", err)
+	}
+}
+
+// isToken reports whether s is an RFC 7230 token
+func isToken(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// handleValidateRequest handles /proxy/validate, which checks a request for
+// problems without sending it
+func (s *ProxyServer) handleValidateRequest(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Failed to read request body", err.Error())
+		return
+	}
+
+	var req ProxyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+
+	issues := s.httpClient.lintRequest(&req)
+	response := LintResponse{Success: true, Valid: true, Issues: issues}
+	for _, issue := range issues {
+		if issue.Severity == LintError {
+			response.Valid = false
+		}
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package slingshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// mmdbMetadataMarker starts the metadata at the end of a MaxMind DB file
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// MaxMind DB data types
+const (
+	mmdbExtended = 0
+	mmdbPointer  = 1
+	mmdbString   = 2
+	mmdbDouble   = 3
+	mmdbBytes    = 4
+	mmdbUint16   = 5
+	mmdbUint32   = 6
+	mmdbMap      = 7
+	mmdbInt32    = 8
+	mmdbUint64   = 9
+	mmdbUint128  = 10
+	mmdbArray    = 11
+	mmdbBool     = 14
+	mmdbFloat    = 15
+
+	// mmdbMaxDepth bounds nesting, so a corrupt file cannot recurse forever
+	mmdbMaxDepth = 32
+)
+
+// mmdbReader looks up IP addresses in a MaxMind DB file, such as the
+// GeoLite2 databases, following https://maxmind.github.io/MaxMind-DB/. The
+// whole file is held in memory.
+type mmdbReader struct {
+	path         string
+	databaseType string
+	buf          []byte
+	data         mmdbDecoder
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint // Node IPv4 lookups start at in an IPv6 tree
+}
+
+// openMMDB reads a MaxMind DB file and checks its metadata
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	marker := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if marker < 0 {
+		return nil, fmt.Errorf("%s is not a MaxMind DB file", path)
+	}
+	value, _, err := mmdbDecoder{buf: buf[marker+len(mmdbMetadataMarker):]}.decode(0, 0)
+	metadata, ok := value.(map[string]interface{})
+	if err != nil || !ok {
+		return nil, fmt.Errorf("%s has corrupt metadata", path)
+	}
+
+	r := &mmdbReader{path: path, buf: buf}
+	r.databaseType, _ = metadata["database_type"].(string)
+	nodeCount, _ := metadata["node_count"].(uint64)
+	recordSize, _ := metadata["record_size"].(uint64)
+	ipVersion, _ := metadata["ip_version"].(uint64)
+	r.nodeCount, r.recordSize, r.ipVersion = uint(nodeCount), uint(recordSize), uint(ipVersion)
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("%s has unsupported record size %d", path, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%s has unsupported IP version %d", path, r.ipVersion)
+	}
+
+	// The search tree is followed by 16 zero bytes, then the data section
+	treeSize := r.recordSize * 2 / 8 * r.nodeCount
+	if treeSize+16 > uint(marker) {
+		return nil, fmt.Errorf("%s is truncated", path)
+	}
+	r.data = mmdbDecoder{buf: buf[treeSize+16 : marker]}
+
+	// IPv4 addresses sit under ::/96 in an IPv6 tree
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, false)
+		}
+	}
+	return r, nil
+}
+
+// record returns the left or right record of a node
+func (r *mmdbReader) record(node uint, right bool) uint {
+	b := r.buf
+	switch r.recordSize {
+	case 24:
+		offset := node * 6
+		if right {
+			offset += 3
+		}
+		return uint(b[offset])<<16 | uint(b[offset+1])<<8 | uint(b[offset+2])
+	case 28:
+		offset := node * 7
+		if right {
+			return uint(b[offset+3]&0x0F)<<24 | uint(b[offset+4])<<16 | uint(b[offset+5])<<8 | uint(b[offset+6])
+		}
+		return uint(b[offset+3]&0xF0)<<20 | uint(b[offset])<<16 | uint(b[offset+1])<<8 | uint(b[offset+2])
+	default:
+		offset := node * 8
+		if right {
+			offset += 4
+		}
+		return uint(binary.BigEndian.Uint32(b[offset:]))
+	}
+}
+
+// lookup returns the data stored for the network containing ip, or nil when
+// the database has none
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, error) {
+	address := ip.To4()
+	node := uint(0)
+	switch {
+	case address != nil && r.ipVersion == 6:
+		node = r.ipv4Start
+	case address == nil && r.ipVersion == 4:
+		return nil, nil
+	case address == nil:
+		address = ip.To16()
+	}
+
+	for i := 0; i < len(address)*8 && node < r.nodeCount; i++ {
+		bit := address[i/8] >> (7 - uint(i%8)) & 1
+		node = r.record(node, bit == 1)
+	}
+	switch {
+	case node == r.nodeCount:
+		return nil, nil
+	case node > r.nodeCount:
+		value, _, err := r.data.decode(node-r.nodeCount-16, 0)
+		return value, err
+	default:
+		return nil, fmt.Errorf("%s has a corrupt search tree", r.path)
+	}
+}
+
+// mmdbDecoder decodes values in a MaxMind DB data section. Maps decode to
+// map[string]interface{}, arrays to []interface{}, unsigned integers to
+// uint64 (uint128 to a hex string), int32 to int64 and floats to float64.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+var errMMDBCorrupt = fmt.Errorf("Corrupt MaxMind DB data")
+
+// decode decodes the value at offset, returning it and the offset after it
+func (d mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if offset >= uint(len(d.buf)) || depth > mmdbMaxDepth {
+		return nil, 0, errMMDBCorrupt
+	}
+	control := d.buf[offset]
+	offset++
+
+	kind := uint(control >> 5)
+	if kind == mmdbPointer {
+		pointer, next, err := d.pointer(control, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+	if kind == mmdbExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		kind = 7 + uint(d.buf[offset])
+		offset++
+	}
+	size, offset, err := d.size(control, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case mmdbMap:
+		values := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var key, value interface{}
+			if key, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			values[name] = value
+		}
+		return values, offset, nil
+	case mmdbArray:
+		values := make([]interface{}, 0, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			var value interface{}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+		}
+		return values, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	// The remaining types are size bytes long
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	raw := d.buf[offset : offset+size]
+	next := offset + size
+	switch kind {
+	case mmdbString:
+		return string(raw), next, nil
+	case mmdbBytes:
+		return bytes.Clone(raw), next, nil
+	case mmdbDouble, mmdbFloat:
+		switch {
+		case kind == mmdbDouble && size == 8:
+			return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+		case kind == mmdbFloat && size == 4:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), next, nil
+		}
+		return nil, 0, errMMDBCorrupt
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		if size > 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		var value uint64
+		for _, b := range raw {
+			value = value<<8 | uint64(b)
+		}
+		if kind == mmdbInt32 {
+			return int64(int32(uint32(value))), next, nil
+		}
+		return value, next, nil
+	case mmdbUint128:
+		return hex.EncodeToString(raw), next, nil
+	default:
+		return nil, 0, fmt.Errorf("Unknown MaxMind DB data type %d", kind)
+	}
+}
+
+// size reads the size encoded in and after a control byte
+func (d mmdbDecoder) size(control byte, offset uint) (uint, uint, error) {
+	size := uint(control & 0x1F)
+	if size < 29 {
+		return size, offset, nil
+	}
+	extra := size - 28
+	if offset+extra > uint(len(d.buf)) {
+		return 0, 0, errMMDBCorrupt
+	}
+	var value uint
+	for _, b := range d.buf[offset : offset+extra] {
+		value = value<<8 | uint(b)
+	}
+	switch size {
+	case 29:
+		value += 29
+	case 30:
+		value += 285
+	default:
+		value += 65821
+	}
+	return value, offset + extra, nil
+}
+
+// pointer reads a pointer into the data section
+func (d mmdbDecoder) pointer(control byte, offset uint) (uint, uint, error) {
+	length := uint(control>>3&0x3) + 1
+	if offset+length > uint(len(d.buf)) {
+		return 0, 0, errMMDBCorrupt
+	}
+	var value uint
+	if length < 4 {
+		value = uint(control & 0x7)
+	}
+	for _, b := range d.buf[offset : offset+length] {
+		value = value<<8 | uint(b)
+	}
+	switch length {
+	case 2:
+		value += 2048
+	case 3:
+		value += 526336
+	}
+	return value, offset + length, nil
+}
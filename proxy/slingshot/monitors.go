@@ -0,0 +1,454 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Monitor states
+const (
+	MonitorPending  = "pending"
+	MonitorUp       = "up"
+	MonitorDown     = "down"
+	MonitorFlapping = "flapping"
+)
+
+const (
+	// MinMonitorInterval is the shortest allowed check interval, in seconds
+	MinMonitorInterval = 5
+
+	// maxMonitorChecks is the number of checks kept per monitor
+	maxMonitorChecks = 50
+
+	// A monitor is flapping when its last flapWindow checks changed between
+	// up and down at least flapTransitions times
+	flapWindow      = 10
+	flapTransitions = 4
+)
+
+// Monitor checks a request at a fixed interval against expected conditions
+type Monitor struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name,omitempty"`
+	Request    ProxyRequest `json:"request"`
+	Assertions []Assertion  `json:"assertions,omitempty"`
+	Interval   int          `json:"interval"` // Seconds between checks
+	CreatedAt  time.Time    `json:"created_at"`
+
+	// State
+	Status      string          `json:"status"`
+	StatusSince time.Time       `json:"status_since"`
+	LastCheck   *MonitorCheck   `json:"last_check,omitempty"`
+	Checks      []*MonitorCheck `json:"checks,omitempty"`
+
+	stop chan struct{}
+}
+
+// MonitorCheck is the outcome of one monitor check
+type MonitorCheck struct {
+	Time         time.Time `json:"time"`
+	Up           bool      `json:"up"`
+	Status       int       `json:"status,omitempty"`
+	ResponseTime string    `json:"response_time,omitempty"`
+	Failures     []string  `json:"failures,omitempty"`
+}
+
+// MonitorResponse is returned by the /monitors endpoints
+type MonitorResponse struct {
+	Success  bool       `json:"success"`
+	Monitor  *Monitor   `json:"monitor,omitempty"`
+	Monitors []*Monitor `json:"monitors,omitempty"`
+}
+
+// MonitorStore runs monitors and tracks their state
+type MonitorStore struct {
+	mu       sync.Mutex
+	monitors map[string]*Monitor
+	file     string
+	check    func(*Monitor) *MonitorCheck
+	notifier *Notifier
+	logger   *log.Logger
+
+	// cluster, when set, checks each monitor on the one proxy holding it
+	cluster *Cluster
+}
+
+// NewMonitorStore creates a store that performs checks with check, tells
+// notifier about state changes and, when file is set, keeps the monitors in
+// that file across restarts
+func NewMonitorStore(file string, check func(*Monitor) *MonitorCheck, notifier *Notifier, logger *log.Logger) *MonitorStore {
+	return &MonitorStore{
+		monitors: make(map[string]*Monitor),
+		file:     file,
+		check:    check,
+		notifier: notifier,
+		logger:   logger,
+	}
+}
+
+// Start loads stored monitors and begins checking them
+func (s *MonitorStore) Start() error {
+	if s.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read monitors: %v", err)
+	}
+
+	var monitors []*Monitor
+	if err := json.Unmarshal(data, &monitors); err != nil {
+		return fmt.Errorf("Failed to parse %s: %v", s.file, err)
+	}
+
+	for _, monitor := range monitors {
+		if err := validateMonitor(monitor); err != nil {
+			s.logger.Printf("Skipping monitor %s: %v", monitor.ID, err)
+			continue
+		}
+		s.start(monitor)
+	}
+	return nil
+}
+
+// Add validates a monitor and starts checking it
+func (s *MonitorStore) Add(monitor *Monitor) error {
+	if err := validateMonitor(monitor); err != nil {
+		return err
+	}
+	monitor.ID = newRequestID()
+	monitor.CreatedAt = time.Now().UTC()
+
+	// Claim the monitor so requests about it reach this proxy
+	s.cluster.holds(clusterMonitor, monitor.ID)
+	s.start(monitor)
+	s.save()
+	return nil
+}
+
+// start registers a monitor and runs its check loop
+func (s *MonitorStore) start(monitor *Monitor) {
+	monitor.Status = MonitorPending
+	monitor.StatusSince = time.Now().UTC()
+	monitor.LastCheck = nil
+	monitor.Checks = nil
+	monitor.stop = make(chan struct{})
+
+	s.mu.Lock()
+	s.monitors[monitor.ID] = monitor
+	s.mu.Unlock()
+
+	go s.loop(monitor)
+}
+
+// Remove stops and deletes a monitor, reporting whether it existed
+func (s *MonitorStore) Remove(id string) bool {
+	s.mu.Lock()
+	monitor, ok := s.monitors[id]
+	if ok {
+		close(monitor.stop)
+		delete(s.monitors, id)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		s.save()
+		s.cluster.release(clusterMonitor, id)
+	}
+	return ok
+}
+
+// Get returns a snapshot of a monitor including its recent checks
+func (s *MonitorStore) Get(id string) *Monitor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	monitor, ok := s.monitors[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *monitor
+	snapshot.Checks = append([]*MonitorCheck(nil), monitor.Checks...)
+	return &snapshot
+}
+
+// List returns snapshots of all monitors without their check history
+func (s *MonitorStore) List() []*Monitor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	monitors := make([]*Monitor, 0, len(s.monitors))
+	for _, monitor := range s.monitors {
+		snapshot := *monitor
+		snapshot.Checks = nil
+		monitors = append(monitors, &snapshot)
+	}
+	sort.Slice(monitors, func(i, j int) bool {
+		return monitors[i].CreatedAt.Before(monitors[j].CreatedAt)
+	})
+	return monitors
+}
+
+// validateMonitor checks a monitor definition
+func validateMonitor(monitor *Monitor) error {
+	if monitor.Request.Method == "" {
+		return fmt.Errorf("HTTP method is required")
+	}
+	if monitor.Request.URL == "" {
+		return fmt.Errorf("URL is required")
+	}
+	if monitor.Interval < MinMonitorInterval {
+		return fmt.Errorf("Interval must be at least %d seconds", MinMonitorInterval)
+	}
+	return validateAssertions(monitor.Assertions)
+}
+
+// loop checks a monitor right away and then every interval until it is
+// removed. In a cluster, only the proxy holding the monitor checks it.
+func (s *MonitorStore) loop(monitor *Monitor) {
+	ticker := time.NewTicker(time.Duration(monitor.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		s.mu.Lock()
+		snapshot := *monitor
+		s.mu.Unlock()
+
+		if s.cluster.holds(clusterMonitor, snapshot.ID) {
+			s.record(monitor, s.check(&snapshot))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-monitor.stop:
+			return
+		}
+	}
+}
+
+// record adds a check to a monitor and updates its state
+func (s *MonitorStore) record(monitor *Monitor, check *MonitorCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	monitor.LastCheck = check
+	monitor.Checks = append(monitor.Checks, check)
+	if len(monitor.Checks) > maxMonitorChecks {
+		monitor.Checks = monitor.Checks[len(monitor.Checks)-maxMonitorChecks:]
+	}
+
+	status := monitorStatus(monitor.Checks)
+	if status != monitor.Status {
+		s.logger.Printf("Monitor %s: %s -> %s", monitor.ID, monitor.Status, status)
+		previous := monitor.Status
+		monitor.Status = status
+		monitor.StatusSince = check.Time
+
+		if n := monitorNotification(monitor, previous); n != nil {
+			s.notifier.Notify(n)
+		}
+	}
+}
+
+// monitorStatus derives a monitor's state from its recent checks
+func monitorStatus(checks []*MonitorCheck) string {
+	if len(checks) == 0 {
+		return MonitorPending
+	}
+
+	recent := checks
+	if len(recent) > flapWindow {
+		recent = recent[len(recent)-flapWindow:]
+	}
+	transitions := 0
+	for i := 1; i < len(recent); i++ {
+		if recent[i].Up != recent[i-1].Up {
+			transitions++
+		}
+	}
+	if transitions >= flapTransitions {
+		return MonitorFlapping
+	}
+
+	if checks[len(checks)-1].Up {
+		return MonitorUp
+	}
+	return MonitorDown
+}
+
+// save writes the monitor definitions to the configured file
+func (s *MonitorStore) save() {
+	if s.file == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(s.List(), "", "  ")
+	if err != nil {
+		s.logger.Printf("Failed to encode monitors: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.file, data, 0600); err != nil {
+		s.logger.Printf("Failed to save monitors: %v", err)
+	}
+}
+
+// checkMonitor performs one monitor check and adds it to the history
+func (s *ProxyServer) checkMonitor(monitor *Monitor) *MonitorCheck {
+	req := monitor.Request
+	req.Headers = append([]string(nil), req.Headers...)
+	req.Assertions = monitor.Assertions
+
+	// Set default timeout if not provided
+	if req.Timeout == 0 {
+		req.Timeout = 60 // default 60 seconds
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Timeout)*time.Second)
+	defer cancel()
+
+	id := newRequestID()
+	response, err := s.httpClient.ExecuteRequest(ctx, &req)
+	if err != nil {
+		response = &ProxyResponse{Success: false, ErrorType: "unknown_error", ErrorTitle: "Request Failed", ErrorMessage: err.Error()}
+	}
+
+	entry := newHistoryEntry(id, HistorySourceMonitor, monitor.Request.Method, monitor.Request.URL, response)
+	entry.MonitorID = monitor.ID
+	if err := s.history.Add(entry); err != nil {
+		s.logger.Printf("Failed to record history: %v", err)
+	}
+
+	check := &MonitorCheck{
+		Time:         entry.Time,
+		Status:       response.ResponseStatus,
+		ResponseTime: response.ResponseTime,
+	}
+
+	switch {
+	case !response.Success:
+		check.Failures = []string{response.ErrorMessage}
+	case len(monitor.Assertions) == 0:
+		// Without assertions, any error status is a failure
+		if response.ResponseStatus >= 400 {
+			check.Failures = []string{fmt.Sprintf("status %d", response.ResponseStatus)}
+		}
+	default:
+		for _, result := range response.Assertions {
+			if !result.Passed {
+				check.Failures = append(check.Failures, result.Assertion.String()+": "+result.Message)
+			}
+		}
+	}
+	check.Up = len(check.Failures) == 0
+
+	return check
+}
+
+// handleMonitors lists (GET) or creates (POST) monitors
+func (s *ProxyServer) handleMonitors(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := &MonitorResponse{Success: true}
+	if r.Method == "POST" {
+		var monitor Monitor
+		if err := json.NewDecoder(r.Body).Decode(&monitor); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+			return
+		}
+		if err := checkTargetURL(r.Context(), monitor.Request.URL); err != nil {
+			s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+			return
+		}
+		if err := s.monitors.Add(&monitor); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Monitor", err.Error())
+			return
+		}
+		s.logger.Printf("Monitoring %s %s every %ds", monitor.Request.Method, monitor.Request.URL, monitor.Interval)
+		response.Monitor = s.monitors.Get(monitor.ID)
+	} else {
+		monitors := s.monitors.List()
+		s.cluster.gather(r, func(body io.Reader) error {
+			var peer MonitorResponse
+			if err := json.NewDecoder(body).Decode(&peer); err != nil {
+				return err
+			}
+			monitors = append(monitors, peer.Monitors...)
+			return nil
+		})
+		response.Monitors = latestMonitors(monitors)
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleMonitor returns (GET) or deletes (DELETE) one monitor
+func (s *ProxyServer) handleMonitor(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	monitor := s.monitors.Get(id)
+	if monitor == nil {
+		s.writeErrorResponse(w, "not_found", "Monitor Not Found", fmt.Sprintf("No monitor with id %s", id))
+		return
+	}
+
+	if r.Method == "DELETE" {
+		s.monitors.Remove(id)
+		// Proxies sharing the monitors file forget it too
+		s.cluster.gather(r, func(io.Reader) error { return nil })
+	}
+
+	if err := json.NewEncoder(w).Encode(&MonitorResponse{Success: true, Monitor: monitor}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// latestMonitors keeps one copy of each monitor listed by several proxies,
+// which load it from a shared file: the copy of the proxy that checked it
+// last
+func latestMonitors(monitors []*Monitor) []*Monitor {
+	latest := make(map[string]*Monitor, len(monitors))
+	for _, monitor := range monitors {
+		kept, ok := latest[monitor.ID]
+		if !ok || (monitor.LastCheck != nil && (kept.LastCheck == nil || monitor.LastCheck.Time.After(kept.LastCheck.Time))) {
+			latest[monitor.ID] = monitor
+		}
+	}
+
+	kept := make([]*Monitor, 0, len(latest))
+	for _, monitor := range latest {
+		kept = append(kept, monitor)
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].CreatedAt.Before(kept[j].CreatedAt)
+	})
+	return kept
+}
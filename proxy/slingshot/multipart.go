@@ -0,0 +1,185 @@
+package slingshot
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MultipartPart describes a single field or file in a multipart/form-data body
+type MultipartPart struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Data        string `json:"data,omitempty"` // Base64-encoded file content
+	Path        string `json:"path,omitempty"` // Server-side file path
+}
+
+// isFile reports whether the part should be sent as a file rather than a plain field
+func (p *MultipartPart) isFile() bool {
+	return p.Filename != "" || p.Data != "" || p.Path != ""
+}
+
+// preparedPart is a validated part ready to be written, with its content
+// either held in memory or streamed from a file
+type preparedPart struct {
+	header textproto.MIMEHeader
+	data   []byte
+	path   string
+	size   int64
+}
+
+// open returns a reader for the part content
+func (p *preparedPart) open() (io.ReadCloser, error) {
+	if p.path != "" {
+		return os.Open(p.path)
+	}
+	return io.NopCloser(bytes.NewReader(p.data)), nil
+}
+
+// newMultipartBody encodes the parts as multipart/form-data. File content is
+// streamed from disk while the body is sent, so large uploads are never held
+// in memory. Returns the body, its exact length and the Content-Type header
+// (including the boundary).
+func (c *HTTPClient) newMultipartBody(parts []MultipartPart) (io.ReadCloser, int64, string, error) {
+	prepared := make([]*preparedPart, 0, len(parts))
+	for i := range parts {
+		part, err := c.preparePart(&parts[i], i)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		prepared = append(prepared, part)
+	}
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	// Compute the encoded length without reading any file content
+	counter := &countingWriter{}
+	writer := multipart.NewWriter(counter)
+	writer.SetBoundary(boundary)
+	for _, part := range prepared {
+		if _, err := writer.CreatePart(part.header); err != nil {
+			return nil, 0, "", err
+		}
+		counter.n += part.size
+	}
+	if err := writer.Close(); err != nil {
+		return nil, 0, "", err
+	}
+
+	// Stream the body through a pipe
+	pr, pw := io.Pipe()
+	go func() {
+		writer := multipart.NewWriter(pw)
+		writer.SetBoundary(boundary)
+		pw.CloseWithError(writeParts(writer, prepared))
+	}()
+
+	return pr, counter.n, writer.FormDataContentType(), nil
+}
+
+// writeParts writes all prepared parts and closes the multipart writer
+func writeParts(writer *multipart.Writer, parts []*preparedPart) error {
+	for _, part := range parts {
+		w, err := writer.CreatePart(part.header)
+		if err != nil {
+			return err
+		}
+
+		content, err := part.open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// preparePart validates a part and resolves its content
+func (c *HTTPClient) preparePart(part *MultipartPart, index int) (*preparedPart, error) {
+	if part.Name == "" {
+		return nil, fmt.Errorf("Multipart part %d is missing a name", index+1)
+	}
+
+	header := make(textproto.MIMEHeader)
+	prepared := &preparedPart{header: header}
+
+	if !part.isFile() {
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(part.Name)))
+		prepared.data = []byte(part.Value)
+		prepared.size = int64(len(prepared.data))
+		return prepared, nil
+	}
+
+	filename := part.Filename
+	switch {
+	case part.Path != "":
+		path, err := resolveUploadPath(part.Path, c.uploadDirs)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %v", part.Path, err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", part.Path)
+		}
+		prepared.path = path
+		prepared.size = info.Size()
+
+		if filename == "" {
+			filename = filepath.Base(path)
+		}
+	case part.Data != "":
+		data, err := base64.StdEncoding.DecodeString(part.Data)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid base64 data for part %q: %v", part.Name, err)
+		}
+		prepared.data = data
+		prepared.size = int64(len(data))
+	default:
+		prepared.data = []byte(part.Value)
+		prepared.size = int64(len(prepared.data))
+	}
+
+	contentType := part.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		escapeQuotes(part.Name), escapeQuotes(filename)))
+	header.Set("Content-Type", contentType)
+
+	return prepared, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes escapes a value for use in a Content-Disposition header
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// countingWriter discards writes while counting the bytes written
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
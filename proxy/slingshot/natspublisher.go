@@ -0,0 +1,94 @@
+package slingshot
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsPublisher publishes records to a NATS subject. Each record is flushed
+// with a round trip to the server, so that it is known to have been accepted.
+type natsPublisher struct {
+	server  string // URL with credentials, without subject or parameters
+	subject string
+	options []nats.Option
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+// newNATSPublisher sets up publishing to
+// nats://[user:pass@|token@]host[:port]/subject?tls=true&creds=/path/user.creds
+func newNATSPublisher(parsed *url.URL) (*natsPublisher, error) {
+	n := &natsPublisher{
+		server:  (&url.URL{Scheme: parsed.Scheme, User: parsed.User, Host: hostWithPort(parsed, "4222")}).String(),
+		subject: strings.Trim(parsed.Path, "/"),
+		options: []nats.Option{
+			nats.Name("slingshot"),
+			nats.Timeout(publishTimeout),
+			nats.NoReconnect(), // Publish reconnects on the next record
+			// Publish reports refused records; don't also print them
+			nats.ErrorHandler(func(*nats.Conn, *nats.Subscription, error) {}),
+		},
+	}
+	if n.subject == "" || strings.ContainsAny(n.subject, " \t\r\n") {
+		return nil, fmt.Errorf("NATS URL %s needs a subject, e.g. nats://host:4222/slingshot.requests", redactedURL(parsed.String()))
+	}
+
+	query := parsed.Query()
+	tlsConfig, err := publishTLSConfig(query)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		n.options = append(n.options, nats.Secure(tlsConfig))
+	}
+
+	// Decentralized authentication, with a JWT and NKey seed
+	if creds := query.Get("creds"); creds != "" {
+		n.options = append(n.options, nats.UserCredentials(creds))
+	}
+	return n, nil
+}
+
+func (n *natsPublisher) Publish(key string, record []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil || n.conn.IsClosed() {
+		conn, err := nats.Connect(n.server, n.options...)
+		if err != nil {
+			return err
+		}
+		n.conn = conn
+	}
+
+	err := n.conn.Publish(n.subject, record)
+	if err == nil {
+		err = n.conn.FlushTimeout(publishTimeout)
+	}
+	if err == nil {
+		// The server reports refused publishes, such as a subject the user
+		// may not publish to, asynchronously
+		err = n.conn.LastError()
+	}
+	if err != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	return err
+}
+
+func (n *natsPublisher) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package slingshot
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// networkErrorType tells apart why a request could not reach its target,
+// falling back on ConnectionError for failures it does not recognize
+func networkErrorType(err error) *ProxyError {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "proxyconnect" {
+		return UpstreamProxyError
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return DNSError
+	}
+
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &verifyErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return CertificateError
+	}
+
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &alertErr) || errors.As(err, &recordErr) || strings.Contains(err.Error(), "tls: ") {
+		return TLSError
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ConnectionRefusedError
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ConnectionResetError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return TimeoutError
+	}
+	return ConnectionError
+}
+
+// errorCauses lists the messages of err and the errors it wraps, outermost
+// first, leaving out layers that add nothing to the message of the next
+func errorCauses(err error) []string {
+	var causes []string
+	for err != nil {
+		message := err.Error()
+		if len(causes) == 0 || causes[len(causes)-1] != message {
+			causes = append(causes, message)
+		}
+
+		switch wrapped := err.(type) {
+		case interface{ Unwrap() error }:
+			err = wrapped.Unwrap()
+		case interface{ Unwrap() []error }:
+			if errs := wrapped.Unwrap(); len(errs) > 0 {
+				err = errs[0]
+			} else {
+				err = nil
+			}
+		default:
+			err = nil
+		}
+	}
+	if len(causes) < 2 {
+		return nil
+	}
+	return causes
+}
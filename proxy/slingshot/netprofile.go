@@ -0,0 +1,188 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// NetworkProfileNone turns off a global network profile for one request
+const NetworkProfileNone = "none"
+
+// NetworkProfile simulates the conditions of a kind of network: extra
+// latency with jitter before each request, limited bandwidth, and
+// connections that are randomly reset while the response downloads
+type NetworkProfile struct {
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	LatencyMs    int     `json:"latency_ms"`
+	JitterMs     int     `json:"jitter_ms"`
+	UploadKbps   int     `json:"upload_kbps,omitempty"`
+	DownloadKbps int     `json:"download_kbps,omitempty"`
+	ResetRate    float64 `json:"reset_rate,omitempty"` // Chance of a reset per request
+}
+
+// networkProfiles are the profiles that networkProfile may name
+var networkProfiles = map[string]*NetworkProfile{
+	"2g": {
+		Description: "2G/EDGE mobile",
+		LatencyMs:   650, JitterMs: 250,
+		UploadKbps: 200, DownloadKbps: 250,
+	},
+	"slow-3g": {
+		Description: "Slow 3G, as in browser dev tools",
+		LatencyMs:   400, JitterMs: 150,
+		UploadKbps: 400, DownloadKbps: 400,
+	},
+	"3g": {
+		Description: "Regular 3G mobile",
+		LatencyMs:   300, JitterMs: 100,
+		UploadKbps: 768, DownloadKbps: 1600,
+	},
+	"4g": {
+		Description: "4G/LTE mobile",
+		LatencyMs:   70, JitterMs: 30,
+		UploadKbps: 9000, DownloadKbps: 20000,
+	},
+	"flaky-wifi": {
+		Description: "Congested Wi-Fi that drops connections",
+		LatencyMs:   100, JitterMs: 80,
+		UploadKbps: 2000, DownloadKbps: 5000,
+		ResetRate: 0.1,
+	},
+	"satellite": {
+		Description: "Geostationary satellite link",
+		LatencyMs:   600, JitterMs: 50,
+		UploadKbps: 1000, DownloadKbps: 10000,
+		ResetRate: 0.02,
+	},
+}
+
+func init() {
+	for name, profile := range networkProfiles {
+		profile.Name = name
+	}
+}
+
+// LookupNetworkProfile finds a profile by name. An empty name or "none" means
+// no simulation.
+func LookupNetworkProfile(name string) (*NetworkProfile, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == NetworkProfileNone {
+		return nil, nil
+	}
+	profile, ok := networkProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown network profile %q; use one of %s", name, strings.Join(networkProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// networkProfileNames lists the profile names in order
+func networkProfileNames() []string {
+	names := make([]string, 0, len(networkProfiles))
+	for name := range networkProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// simulateLatency waits for the profile's latency plus or minus its jitter,
+// returning how long it waited
+func (p *NetworkProfile) simulateLatency(ctx context.Context) (time.Duration, error) {
+	delay := time.Duration(p.LatencyMs) * time.Millisecond
+	if p.JitterMs > 0 {
+		delay += time.Duration(rand.IntN(2*p.JitterMs+1)-p.JitterMs) * time.Millisecond
+	}
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return delay, ctx.Err()
+	}
+}
+
+// simulateReset decides whether this response's connection is reset. If so,
+// reading the body fails after a random part of it has arrived.
+func (p *NetworkProfile) simulateReset(resp *http.Response) bool {
+	if p.ResetRate <= 0 || rand.Float64() >= p.ResetRate {
+		return false
+	}
+
+	// Bodies of unknown length are cut somewhere in their first 64 KB
+	limit := int64(64 << 10)
+	if resp.ContentLength > 0 {
+		limit = resp.ContentLength
+	}
+	cutoff := rand.Int64N(limit)
+	resp.Body = &resetReader{ReadCloser: resp.Body, remaining: cutoff}
+	return true
+}
+
+// annotate records the simulated conditions on a response
+func (p *NetworkProfile) annotate(response *ProxyResponse, latency time.Duration, reset bool) {
+	if p == nil {
+		return
+	}
+	response.NetworkProfile = p.Name
+	response.SimulatedLatency = formatMillis(latency)
+	response.SimulatedReset = reset
+}
+
+// resetReader fails like a reset connection after remaining bytes
+type resetReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *resetReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, fmt.Errorf("%w (simulated)", syscall.ECONNRESET)
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// NetworkProfilesResponse is returned by GET /proxy/network-profiles
+type NetworkProfilesResponse struct {
+	Success  bool              `json:"success"`
+	Default  string            `json:"default,omitempty"`
+	Profiles []*NetworkProfile `json:"profiles"`
+}
+
+// handleNetworkProfiles lists the network profiles and the global default
+func (s *ProxyServer) handleNetworkProfiles(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := &NetworkProfilesResponse{Success: true, Default: s.config.NetworkProfile}
+	for _, name := range networkProfileNames() {
+		response.Profiles = append(response.Profiles, networkProfiles[name])
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
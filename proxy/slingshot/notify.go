@@ -0,0 +1,232 @@
+package slingshot
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// DefaultNotifyAfter is the number of consecutive failed runs of a scheduled
+// request before a notification is sent
+const DefaultNotifyAfter = 3
+
+// Notification events
+const (
+	NotifyMonitorDown       = "monitor_down"
+	NotifyMonitorUp         = "monitor_up"
+	NotifyMonitorFlapping   = "monitor_flapping"
+	NotifyScheduleFailing   = "schedule_failing"
+	NotifyScheduleRecovered = "schedule_recovered"
+)
+
+// Notification describes a monitor state change or a failing schedule
+type Notification struct {
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time"`
+	Title      string    `json:"title"`
+	Message    string    `json:"message,omitempty"`
+	MonitorID  string    `json:"monitor_id,omitempty"`
+	ScheduleID string    `json:"schedule_id,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status,omitempty"`
+	Failures   []string  `json:"failures,omitempty"`
+}
+
+// text renders the notification for chat and email
+func (n *Notification) text() string {
+	var b strings.Builder
+	b.WriteString(n.Title)
+	fmt.Fprintf(&b, "\n%s %s", n.Method, n.URL)
+	if n.Message != "" {
+		b.WriteString("\n" + n.Message)
+	}
+	for _, failure := range n.Failures {
+		b.WriteString("\n- " + failure)
+	}
+	return b.String()
+}
+
+// NotificationSink delivers notifications to one destination
+type NotificationSink interface {
+	Name() string
+	Send(n *Notification) error
+}
+
+// Notifier fans notifications out to the configured sinks
+type Notifier struct {
+	sinks  []NotificationSink
+	logger *log.Logger
+}
+
+// NewNotifier creates a notifier for the sinks configured in config
+func NewNotifier(config *Config, logger *log.Logger) *Notifier {
+	n := &Notifier{logger: logger}
+	if config.NotifyWebhook != "" {
+		n.sinks = append(n.sinks, &webhookSink{url: config.NotifyWebhook})
+	}
+	if config.NotifySlack != "" {
+		n.sinks = append(n.sinks, &slackSink{url: config.NotifySlack})
+	}
+	if len(config.NotifyEmail) > 0 {
+		n.sinks = append(n.sinks, &emailSink{
+			addr:     config.SMTPAddr,
+			username: config.SMTPUsername,
+			password: config.SMTPPassword,
+			from:     config.SMTPFrom,
+			to:       config.NotifyEmail,
+		})
+	}
+	return n
+}
+
+// Notify sends a notification to every sink in the background
+func (n *Notifier) Notify(notification *Notification) {
+	if n == nil {
+		return
+	}
+	notification.Time = time.Now().UTC()
+	for _, sink := range n.sinks {
+		go func(sink NotificationSink) {
+			if err := sink.Send(notification); err != nil {
+				n.logger.Printf("Failed to send %s notification: %v", sink.Name(), err)
+			}
+		}(sink)
+	}
+}
+
+// webhookSink POSTs the notification as JSON
+type webhookSink struct {
+	url string
+}
+
+func (s *webhookSink) Name() string { return "webhook" }
+
+func (s *webhookSink) Send(n *Notification) error {
+	return postJSON(s.url, n)
+}
+
+// slackSink posts the notification to a Slack incoming webhook
+type slackSink struct {
+	url string
+}
+
+func (s *slackSink) Name() string { return "Slack" }
+
+func (s *slackSink) Send(n *Notification) error {
+	return postJSON(s.url, map[string]string{"text": n.text()})
+}
+
+// emailSink sends the notification by email through an SMTP server
+type emailSink struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (s *emailSink) Name() string { return "email" }
+
+func (s *emailSink) Send(n *Notification) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, err := net.SplitHostPort(s.addr)
+		if err != nil {
+			return fmt.Errorf("Invalid SMTP address %q: %v", s.addr, err)
+		}
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: [Slingshot] %s\r\n", n.Title)
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.text(), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	return smtp.SendMail(s.addr, auth, s.from, s.to, []byte(msg.String()))
+}
+
+// monitorNotification describes a monitor's change to status, or returns nil
+// when the change is not worth reporting
+func monitorNotification(monitor *Monitor, previous string) *Notification {
+	n := &Notification{
+		MonitorID: monitor.ID,
+		Name:      monitor.Name,
+		Method:    monitor.Request.Method,
+		URL:       monitor.Request.URL,
+	}
+	if check := monitor.LastCheck; check != nil {
+		n.Status = check.Status
+		n.Failures = check.Failures
+	}
+
+	name := monitor.Name
+	if name == "" {
+		name = monitor.Request.URL
+	}
+
+	switch monitor.Status {
+	case MonitorDown:
+		n.Event = NotifyMonitorDown
+		n.Title = fmt.Sprintf("Monitor %s is down", name)
+	case MonitorFlapping:
+		n.Event = NotifyMonitorFlapping
+		n.Title = fmt.Sprintf("Monitor %s is flapping", name)
+	case MonitorUp:
+		// A monitor coming up for the first time is not news
+		if previous == MonitorPending {
+			return nil
+		}
+		n.Event = NotifyMonitorUp
+		n.Title = fmt.Sprintf("Monitor %s is up again", name)
+		n.Failures = nil
+	default:
+		return nil
+	}
+	n.Message = fmt.Sprintf("Was %s", previous)
+	return n
+}
+
+// scheduleNotification describes a scheduled request that started failing
+// repeatedly or recovered, or returns nil when neither happened
+func scheduleNotification(schedule *Schedule, previousFailures, notifyAfter int) *Notification {
+	n := &Notification{
+		ScheduleID: schedule.ID,
+		Name:       schedule.Name,
+		Method:     schedule.Request.Method,
+		URL:        schedule.Request.URL,
+	}
+	if run := schedule.LastRun; run != nil {
+		n.Status = run.Status
+		if run.ErrorMessage != "" {
+			n.Failures = []string{run.ErrorMessage}
+		}
+	}
+
+	name := schedule.Name
+	if name == "" {
+		name = schedule.ID
+	}
+
+	switch {
+	case schedule.ConsecutiveFailures == notifyAfter:
+		n.Event = NotifyScheduleFailing
+		n.Title = fmt.Sprintf("Scheduled request %s failed %d times in a row", name, notifyAfter)
+	case schedule.ConsecutiveFailures == 0 && previousFailures >= notifyAfter:
+		n.Event = NotifyScheduleRecovered
+		n.Title = fmt.Sprintf("Scheduled request %s succeeded again", name)
+		n.Message = fmt.Sprintf("After %d failed runs", previousFailures)
+		n.Failures = nil
+	default:
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,306 @@
+package slingshot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultArtifactURLExpiry is how long presigned artifact URLs are valid
+	DefaultArtifactURLExpiry = time.Hour
+
+	// maxPresignExpiry is the longest validity S3 accepts for presigned URLs
+	maxPresignExpiry = 7 * 24 * time.Hour
+
+	objectStorageTimeout = 10 * time.Minute
+	amzDateFormat        = "20060102T150405Z"
+	unsignedPayload      = "UNSIGNED-PAYLOAD"
+)
+
+// objectStorage keeps objects in an S3-compatible bucket, signing requests
+// with AWS Signature Version 4
+type objectStorage struct {
+	bucket    string
+	prefix    string
+	region    string
+	endpoint  *url.URL // Path-style endpoint; nil for AWS, addressed by bucket host
+	accessKey string
+	secretKey string
+	token     string
+	client    *http.Client
+}
+
+// openObjectStorage sets up the bucket an s3:// URL names:
+//
+//	s3://bucket/prefix?region=eu-west-1
+//	s3://key:secret@bucket/prefix?endpoint=http://localhost:9000
+//
+// Credentials not in the URL come from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, and the region, unless given,
+// from AWS_REGION.
+func openObjectStorage(storageURL string) (*objectStorage, error) {
+	parsed, err := url.Parse(storageURL)
+	if err != nil || parsed.Scheme != "s3" || parsed.Host == "" {
+		return nil, fmt.Errorf("Invalid object storage %q; use s3://bucket/prefix", storageURL)
+	}
+
+	o := &objectStorage{
+		bucket:    parsed.Host,
+		prefix:    strings.Trim(parsed.Path, "/"),
+		region:    parsed.Query().Get("region"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{Timeout: objectStorageTimeout},
+	}
+	if o.prefix != "" {
+		o.prefix += "/"
+	}
+	if parsed.User != nil {
+		o.accessKey = parsed.User.Username()
+		o.secretKey, _ = parsed.User.Password()
+		o.token = ""
+	}
+	if o.accessKey == "" || o.secretKey == "" {
+		return nil, fmt.Errorf("No credentials for s3://%s; set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", o.bucket)
+	}
+	for _, value := range []string{os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"} {
+		if o.region == "" {
+			o.region = value
+		}
+	}
+	if endpoint := parsed.Query().Get("endpoint"); endpoint != "" {
+		if o.endpoint, err = url.Parse(endpoint); err != nil || o.endpoint.Host == "" {
+			return nil, fmt.Errorf("Invalid object storage endpoint %q", endpoint)
+		}
+	}
+	return o, nil
+}
+
+// objectURL returns the URL of the object stored under name
+func (o *objectStorage) objectURL(name string) *url.URL {
+	key := o.prefix + name
+	if o.endpoint != nil {
+		objectURL := *o.endpoint
+		objectURL.Path = strings.TrimSuffix(objectURL.Path, "/") + "/" + o.bucket + "/" + key
+		return &objectURL
+	}
+	return &url.URL{Scheme: "https", Host: o.awsHost(), Path: "/" + key}
+}
+
+// awsHost is the virtual-hosted name of the bucket on AWS
+func (o *objectStorage) awsHost() string {
+	if o.region == "us-east-1" {
+		return o.bucket + ".s3.amazonaws.com"
+	}
+	return fmt.Sprintf("%s.s3.%s.amazonaws.com", o.bucket, o.region)
+}
+
+// Put uploads size bytes of body under name. sum is the hex SHA-256 of the
+// body.
+func (o *objectStorage) Put(ctx context.Context, name string, body io.Reader, size int64, sum, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", o.objectURL(name).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	o.sign(req, sum, time.Now())
+	return o.do(req, nil)
+}
+
+// Get downloads the object stored under name
+func (o *objectStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", o.objectURL(name).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	o.sign(req, emptyPayloadSum, time.Now())
+	var body io.ReadCloser
+	if err := o.do(req, &body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Delete removes the object stored under name
+func (o *objectStorage) Delete(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", o.objectURL(name).String(), nil)
+	if err != nil {
+		return err
+	}
+	o.sign(req, emptyPayloadSum, time.Now())
+	return o.do(req, nil)
+}
+
+// emptyPayloadSum is the SHA-256 of an empty body
+var emptyPayloadSum = hex.EncodeToString(sha256.New().Sum(nil))
+
+// do sends a signed request, handing the body to body when it is not nil
+func (o *objectStorage) do(req *http.Request, body *io.ReadCloser) error {
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Object storage %s failed: %v", req.Method, err)
+	}
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return fmt.Errorf("Object storage %s %s returned %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if body != nil {
+		*body = resp.Body
+		return nil
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PresignGet returns a URL downloading the object stored under name without
+// credentials until expiry has passed
+func (o *objectStorage) PresignGet(name string, expiry time.Duration) string {
+	return o.presign("GET", name, expiry, time.Now())
+}
+
+// presign signs a request for method in its query string
+func (o *objectStorage) presign(method, name string, expiry time.Duration, now time.Time) string {
+	if expiry <= 0 {
+		expiry = DefaultArtifactURLExpiry
+	}
+	if expiry > maxPresignExpiry {
+		expiry = maxPresignExpiry
+	}
+	now = now.UTC()
+	objectURL := o.objectURL(name)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", o.accessKey+"/"+o.scope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if o.token != "" {
+		query.Set("X-Amz-Security-Token", o.token)
+	}
+
+	headers := http.Header{"Host": {objectURL.Host}}
+	canonical, _ := canonicalRequest(method, objectURL.Path, query, headers, unsignedPayload)
+	query.Set("X-Amz-Signature", o.signature(canonical, now))
+	objectURL.RawQuery = canonicalQuery(query)
+	return objectURL.String()
+}
+
+// sign adds the Signature Version 4 headers to a request whose body has the
+// hex SHA-256 sum
+func (o *objectStorage) sign(req *http.Request, sum string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", sum)
+	if o.token != "" {
+		req.Header.Set("X-Amz-Security-Token", o.token)
+	}
+
+	headers := http.Header{"Host": {req.URL.Host}}
+	for name, values := range req.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-") {
+			headers[name] = values
+		}
+	}
+	canonical, signedHeaders := canonicalRequest(req.Method, req.URL.Path, req.URL.Query(), headers, sum)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		o.accessKey, o.scope(now), signedHeaders, o.signature(canonical, now)))
+}
+
+// scope is the date, region and service a signature is valid for
+func (o *objectStorage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + o.region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with a key derived from the secret key
+func (o *objectStorage) signature(canonical string, now time.Time) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format(amzDateFormat) + "\n" + o.scope(now) + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + o.secretKey)
+	for _, part := range []string{now.Format("20060102"), o.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalRequest builds the canonical form of a request that Signature
+// Version 4 signs, returning it with the names of the signed headers
+func canonicalRequest(method, path string, query url.Values, headers http.Header, payloadSum string) (string, string) {
+	names := make([]string, 0, len(headers))
+	values := make(map[string]string, len(headers))
+	for name, value := range headers {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		values[lower] = strings.TrimSpace(strings.Join(value, ","))
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	if path == "" {
+		path = "/"
+	}
+	return strings.Join([]string{
+		method,
+		awsEscape(path, false),
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadSum,
+	}, "\n"), signedHeaders
+}
+
+// canonicalQuery encodes a query string sorted by name, as signed
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name, true)+"="+awsEscape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything but unreserved characters and, unless
+// slash is set, "/"
+func awsEscape(value string, slash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !slash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
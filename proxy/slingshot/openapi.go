@@ -0,0 +1,476 @@
+package slingshot
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+)
+
+// swaggerUIFiles holds the Swagger UI release (5.18.2) /docs loads, so the
+// page works without internet access
+//
+//go:embed swaggerui
+var swaggerUIFiles embed.FS
+
+// pathVariablePattern finds the {name} variables of a route template
+var pathVariablePattern = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// apiOperation describes what the router does not know about an endpoint:
+// what it is for and what it reads and returns
+type apiOperation struct {
+	Summary      string
+	Query        []string    // Query parameters, all optional strings
+	Request      interface{} // Value of the request body's type
+	RequestType  string      // Media type of the request body; JSON when empty
+	Response     interface{} // Value of the response's type
+	ResponseType string      // Media type of the response; JSON when empty
+}
+
+// apiOperations documents the endpoints, keyed by method and route template.
+// Routes missing here are still described, from their handler's name.
+var apiOperations = map[string]apiOperation{
+	"POST /proxy/request":                {Summary: "Send a request", Request: ProxyRequest{}, Response: ProxyResponse{}},
+	"POST /proxy/form":                   {Summary: "Send a form or multipart body as is", Query: []string{"url", "method", "timeout", "followRedirects", "contentType", "headers", "path_params"}, RequestType: "multipart/form-data", Response: ProxyResponse{}},
+	"POST /proxy/validate":               {Summary: "Check a request without sending it", Request: ProxyRequest{}, Response: LintResponse{}},
+	"POST /proxy/corscheck":              {Summary: "Check a browser's CORS preflight against a target", Request: CORSCheckRequest{}, Response: CORSCheckResponse{}},
+	"GET /proxy/stream":                  {Summary: "Send a request and stream the response", Query: []string{"url", "method", "header", "body", "timeout"}, Response: StreamEvent{}, ResponseType: "text/event-stream"},
+	"POST /proxy/stream":                 {Summary: "Send a request and stream the response", Request: ProxyRequest{}, Response: StreamEvent{}, ResponseType: "text/event-stream"},
+	"POST /proxy/data":                   {Summary: "Run a request or workflow once per row of a dataset", RequestType: "multipart/form-data", Response: DataRunResult{}},
+	"POST /proxy/tcp":                    {Summary: "Probe a TCP port", Request: SocketRequest{}, Response: SocketResponse{}},
+	"POST /proxy/udp":                    {Summary: "Send a UDP datagram", Request: SocketRequest{}, Response: SocketResponse{}},
+	"POST /proxy/raw":                    {Summary: "Send raw HTTP bytes", Request: RawRequest{}, Response: RawResponse{}},
+	"POST /proxy/smtp":                   {Summary: "Send an email", Request: SMTPRequest{}, Response: SMTPResponse{}},
+	"GET /proxy/history":                 {Summary: "Query recent requests", Query: []string{"host", "method", "status", "errorType", "source", "success", "from", "to", "q", "sort", "order", "limit", "offset"}, Response: HistoryResponse{}},
+	"GET /proxy/history/tail":            {Summary: "Stream new history entries and log lines over a WebSocket", Query: []string{"types", "recent", "host", "method", "status", "errorType", "source", "success", "q"}, Response: TailEvent{}},
+	"GET /proxy/history/{id}/body":       {Summary: "Read a page of a stored response body", Query: []string{"unit", "offset", "limit"}, Response: BodyPageResponse{}},
+	"GET /proxy/history/{id}/search":     {Summary: "Search a stored response body", Query: []string{"q", "regex", "ignoreCase", "limit"}, Response: BodySearchResponse{}},
+	"GET /proxy/artifacts/{id}":          {Summary: "Download an artifact, or describe it", Query: []string{"info", "download"}, ResponseType: "application/octet-stream"},
+	"HEAD /proxy/artifacts/{id}":         {Summary: "Check an artifact"},
+	"DELETE /proxy/artifacts/{id}":       {Summary: "Delete an artifact", Response: ArtifactResponse{}},
+	"GET /proxy/downloads":               {Summary: "List downloads", Response: DownloadResponse{}},
+	"POST /proxy/downloads":              {Summary: "Start a download", Request: DownloadRequest{}, Response: DownloadResponse{}},
+	"GET /proxy/downloads/{id}":          {Summary: "Get a download", Response: DownloadResponse{}},
+	"DELETE /proxy/downloads/{id}":       {Summary: "Cancel a download", Response: DownloadResponse{}},
+	"POST /proxy/downloads/{id}/resume":  {Summary: "Resume a download", Query: []string{"resumes"}, Response: DownloadResponse{}},
+	"GET /proxy/network-profiles":        {Summary: "List network profiles", Response: NetworkProfilesResponse{}},
+	"GET /proxy/schedules":               {Summary: "List schedules", Response: ScheduleResponse{}},
+	"POST /proxy/schedules":              {Summary: "Create a schedule", Request: Schedule{}, Response: ScheduleResponse{}},
+	"GET /proxy/schedules/{id}":          {Summary: "Get a schedule and its history", Response: ScheduleResponse{}},
+	"DELETE /proxy/schedules/{id}":       {Summary: "Delete a schedule", Response: ScheduleResponse{}},
+	"GET /proxy/jobs":                    {Summary: "List background jobs", Response: JobResponse{}},
+	"POST /proxy/jobs":                   {Summary: "Send a request in the background", Request: JobRequest{}, Response: JobResponse{}},
+	"GET /proxy/jobs/{id}":               {Summary: "Get a job and its response", Response: JobResponse{}},
+	"DELETE /proxy/jobs/{id}":            {Summary: "Forget a finished job", Response: JobResponse{}},
+	"GET /proxy/deadletters":             {Summary: "List failed background requests", Response: DeadLetterResponse{}},
+	"GET /proxy/deadletters/{id}":        {Summary: "Get a dead letter and its attempts", Response: DeadLetterResponse{}},
+	"DELETE /proxy/deadletters/{id}":     {Summary: "Discard a dead letter", Response: DeadLetterResponse{}},
+	"POST /proxy/deadletters/{id}/retry": {Summary: "Retry a dead letter", Response: DeadLetterResponse{}},
+	"GET /proxy/hooks/{bucket}":          {Summary: "List the requests captured in a webhook bucket", Response: HookListResponse{}},
+	"DELETE /proxy/hooks/{bucket}":       {Summary: "Empty a webhook bucket", Response: HookListResponse{}},
+	"GET /proxy/hooks/{bucket}/feed":     {Summary: "Follow the requests captured in a webhook bucket", Response: CapturedRequest{}, ResponseType: "text/event-stream"},
+	"GET /tunnel/connect":                {Summary: "Connect a tunnel client"},
+	"GET /monitors":                      {Summary: "List monitors", Response: MonitorResponse{}},
+	"POST /monitors":                     {Summary: "Create a monitor", Request: Monitor{}, Response: MonitorResponse{}},
+	"GET /monitors/{id}":                 {Summary: "Get a monitor and its checks", Response: MonitorResponse{}},
+	"DELETE /monitors/{id}":              {Summary: "Delete a monitor", Response: MonitorResponse{}},
+	"POST /graphql/schema":               {Summary: "Introspect a GraphQL schema", Request: GraphQLSchemaRequest{}, Response: GraphQLSchemaResponse{}},
+	"POST /graphql/validate":             {Summary: "Validate a GraphQL query against its schema", Request: GraphQLValidateRequest{}, Response: GraphQLValidateResponse{}},
+	"GET /graphql/subscribe":             {Summary: "Follow a GraphQL subscription", Query: []string{"url", "header", "query", "operationName", "variables"}, ResponseType: "text/event-stream"},
+	"POST /graphql/subscribe":            {Summary: "Follow a GraphQL subscription", Request: GraphQLSubscribeRequest{}, ResponseType: "text/event-stream"},
+	"GET /ws/sessions":                   {Summary: "List WebSocket sessions", Response: WebSocketSessionsResponse{}},
+	"POST /ws/sessions":                  {Summary: "Open a WebSocket session", Request: WebSocketOpenRequest{}, Response: WebSocketSessionResponse{}},
+	"GET /ws/sessions/{id}":              {Summary: "Get a WebSocket session", Response: WebSocketSessionResponse{}},
+	"DELETE /ws/sessions/{id}":           {Summary: "Close a WebSocket session", Response: WebSocketSessionResponse{}},
+	"POST /ws/sessions/{id}/send":        {Summary: "Send a WebSocket message", Request: WebSocketSendRequest{}},
+	"GET /ws/sessions/{id}/messages":     {Summary: "Read the messages of a WebSocket session", Query: []string{"after"}, Response: WebSocketMessagesResponse{}},
+	"GET /ws/sessions/{id}/feed":         {Summary: "Follow the messages of a WebSocket session", Query: []string{"after"}, Response: WebSocketMessage{}, ResponseType: "text/event-stream"},
+	"GET /sse/sessions":                  {Summary: "List SSE sessions", Response: EventSourcesResponse{}},
+	"POST /sse/sessions":                 {Summary: "Open an SSE session", Request: EventSourceOpenRequest{}, Response: EventSourceResponse{}},
+	"GET /sse/sessions/{id}":             {Summary: "Get an SSE session", Response: EventSourceResponse{}},
+	"DELETE /sse/sessions/{id}":          {Summary: "Close an SSE session", Response: EventSourceResponse{}},
+	"GET /sse/sessions/{id}/events":      {Summary: "Read the events of an SSE session", Query: []string{"after"}, Response: EventSourceEventsResponse{}},
+	"GET /sse/sessions/{id}/feed":        {Summary: "Follow the events of an SSE session", Query: []string{"after"}, Response: ServerSentEvent{}, ResponseType: "text/event-stream"},
+	"GET /proto/files":                   {Summary: "List protobuf files and message types", Response: ProtoMessagesResponse{}},
+	"POST /proto/files":                  {Summary: "Register a protobuf file", Request: ProtoFileRequest{}, Response: ProtoMessagesResponse{}},
+	"POST /soap/operations":              {Summary: "List the operations of a WSDL", Request: SOAPOperationsRequest{}, Response: SOAPOperationsResponse{}},
+	"POST /soap/call":                    {Summary: "Call a SOAP operation", Request: SOAPCallRequest{}, Response: SOAPCallResponse{}},
+	"POST /workflows/run":                {Summary: "Run a workflow", Request: Workflow{}, RequestType: "application/yaml", Response: WorkflowResult{}},
+	"GET /health":                        {Summary: "Check that the proxy is up"},
+	"GET /version":                       {Summary: "Get the build information", Response: BuildInfo{}},
+	"GET /health/live":                   {Summary: "Liveness probe"},
+	"GET /health/ready":                  {Summary: "Readiness probe", Response: HealthResponse{}},
+	"GET /admin/keys":                    {Summary: "List API keys", Response: APIKeyResponse{}},
+	"POST /admin/keys":                   {Summary: "Create an API key", Request: CreateAPIKeyRequest{}, Response: APIKeyResponse{}},
+	"GET /admin/keys/{id}":               {Summary: "Get an API key and its usage", Response: APIKeyResponse{}},
+	"DELETE /admin/keys/{id}":            {Summary: "Revoke an API key", Response: APIKeyResponse{}},
+	"GET /admin/config":                  {Summary: "Get the running configuration", Response: AdminConfigResponse{}},
+	"GET /admin/stats":                   {Summary: "Get runtime statistics", Response: AdminStatsResponse{}},
+	"GET /admin/requests":                {Summary: "List the requests in flight", Response: AdminRequestsResponse{}},
+	"DELETE /admin/requests/{id}":        {Summary: "Cancel a request in flight", Response: AdminRequestsResponse{}},
+	"GET /admin/drain":                   {Summary: "Get the drain state", Response: AdminDrainResponse{}},
+	"POST /admin/drain":                  {Summary: "Start draining", Response: AdminDrainResponse{}},
+	"DELETE /admin/drain":                {Summary: "Stop draining", Response: AdminDrainResponse{}},
+	"GET /admin/cluster":                 {Summary: "List the proxies of the cluster", Response: AdminClusterResponse{}},
+	"GET /openapi.json":                  {Summary: "Get this document"},
+	"GET /docs":                          {Summary: "Browse this document in Swagger UI", ResponseType: "text/html"},
+	"GET /docs/":                         {Summary: "Get Swagger UI's files", ResponseType: "text/javascript"},
+	"GET /slingshot.proto":               {Summary: "Get the definition of the gRPC API served with -grpc-port", ResponseType: "text/plain"},
+	"GET /ui":                            {Summary: "Open the web dashboard", ResponseType: "text/html"},
+	"GET /ui/":                           {Summary: "Get the web dashboard's files", ResponseType: "text/html"},
+}
+
+// openAPISpec caches the document, which only changes with the routes
+type openAPISpec struct {
+	once     sync.Once
+	document []byte
+	err      error
+}
+
+// openAPISchemas collects the component schemas of the Go types a document
+// refers to
+type openAPISchemas map[string]interface{}
+
+// schema returns the JSON schema of values of type t as encoding/json
+// marshals them, referring to named structs by component
+func (schemas openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemas.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemas.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return schemas.object(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; !ok {
+			// Registered first so types referring to themselves terminate
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = schemas.object(t)
+		}
+		return ref
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema of a struct's JSON fields, taking fields without
+// omitempty as required
+func (schemas openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	schemas.addFields(t, properties, &required)
+
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// addFields adds the JSON fields of t to properties, including those of
+// embedded structs
+func (schemas openAPISchemas) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				schemas.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemas.schema(field.Type)
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// handlerName returns the name of the method or function handling a route,
+// e.g. handleJSONRequest, or "" when it is not a function
+func handlerName(handler http.Handler) string {
+	value := reflect.ValueOf(handler)
+	if value.Kind() != reflect.Func {
+		return ""
+	}
+	function := runtime.FuncForPC(value.Pointer())
+	if function == nil {
+		return ""
+	}
+	name := function.Name()
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// operationID names an operation after its method and handler, e.g.
+// postJSONRequest for handleJSONRequest, or after its path when the handler
+// has no name
+func operationID(method, template, handler string) string {
+	name := strings.TrimPrefix(handler, "handle")
+	if name == "" {
+		for _, part := range strings.FieldsFunc(template, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			name += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.ToLower(method) + name
+}
+
+// buildOpenAPI describes the routes of router. Routes without methods, such
+// as webhook capture which accepts any method and path below its bucket,
+// cannot be described and are left out.
+func (s *ProxyServer) buildOpenAPI(router *mux.Router) ([]byte, error) {
+	schemas := openAPISchemas{}
+	paths := map[string]map[string]interface{}{}
+	tags := map[string]bool{}
+
+	content := func(mediaType string, value interface{}) map[string]interface{} {
+		if mediaType == "" {
+			mediaType = "application/json"
+		}
+		media := map[string]interface{}{}
+		if value != nil {
+			media["schema"] = schemas.schema(reflect.TypeOf(value))
+		}
+		return map[string]interface{}{mediaType: media}
+	}
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		handler := handlerName(route.GetHandler())
+
+		var parameters []interface{}
+		for _, match := range pathVariablePattern.FindAllStringSubmatch(template, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		path := pathVariablePattern.ReplaceAllString(template, "{$1}")
+		tag := strings.SplitN(strings.TrimPrefix(template, "/"), "/", 2)[0]
+		if strings.HasPrefix(template, "/proxy/") {
+			tag = "proxy " + strings.SplitN(strings.TrimPrefix(template, "/proxy/"), "/", 2)[0]
+		}
+
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			doc := apiOperations[method+" "+path]
+			operation := map[string]interface{}{
+				"operationId": operationID(method, path, handler),
+				"tags":        []string{tag},
+			}
+			tags[tag] = true
+			if doc.Summary != "" {
+				operation["summary"] = doc.Summary
+			}
+
+			opParameters := append([]interface{}{}, parameters...)
+			for _, name := range doc.Query {
+				opParameters = append(opParameters, map[string]interface{}{
+					"name": name, "in": "query",
+					"schema": map[string]interface{}{"type": "string"},
+				})
+			}
+			if len(opParameters) > 0 {
+				operation["parameters"] = opParameters
+			}
+
+			if doc.Request != nil || doc.RequestType != "" {
+				operation["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  content(doc.RequestType, doc.Request),
+				}
+			}
+
+			response := map[string]interface{}{"description": "OK"}
+			if doc.Response != nil || doc.ResponseType != "" {
+				response["content"] = content(doc.ResponseType, doc.Response)
+			}
+			operation["responses"] = map[string]interface{}{
+				"200": response,
+				"default": map[string]interface{}{
+					"description": "Failure, with a 4xx or 5xx status in real status mode",
+					"content":     content("", ProxyResponse{}),
+				},
+			}
+
+			if paths[path] == nil {
+				paths[path] = map[string]interface{}{}
+			}
+			paths[path][strings.ToLower(method)] = operation
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames := make([]string, 0, len(tags))
+	for tag := range tags {
+		tagNames = append(tagNames, tag)
+	}
+	sort.Strings(tagNames)
+	tagList := make([]interface{}, 0, len(tagNames))
+	for _, tag := range tagNames {
+		tagList = append(tagList, map[string]interface{}{"name": tag})
+	}
+
+	document := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Slingshot",
+			"description": "HTTP proxy for sending and inspecting requests on behalf of browser clients",
+			"version":     Version,
+		},
+		"tags":  tagList,
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": APIKeyHeader},
+			},
+		},
+	}
+	if s.config.RequireAPIKey {
+		document["security"] = []interface{}{map[string]interface{}{"apiKey": []string{}}}
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// handleOpenAPI serves the OpenAPI document describing the proxy's own
+// endpoints, built from the routes on first use
+func (s *ProxyServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	s.openAPI.once.Do(func() {
+		s.openAPI.document, s.openAPI.err = s.buildOpenAPI(s.router)
+	})
+	if s.openAPI.err != nil {
+		s.writeErrorResponse(w, "unknown_error", "OpenAPI Error", s.openAPI.err.Error())
+		return
+	}
+	if _, err := w.Write(s.openAPI.document); err != nil {
+		s.logger.Printf("Failed to write OpenAPI document: %v", err)
+	}
+}
+
+// handleDocs serves Swagger UI for the OpenAPI document
+func (s *ProxyServer) handleDocs(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write([]byte(docsPage)); err != nil {
+		s.logger.Printf("Failed to write docs page: %v", err)
+	}
+}
+
+// swaggerUIHandler serves the embedded Swagger UI files below /docs/
+func swaggerUIHandler() http.Handler {
+	files, err := fs.Sub(swaggerUIFiles, "swaggerui")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.StripPrefix("/docs/", http.FileServer(http.FS(files)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		// Embedded files carry no modification time to revalidate against
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// docsPage loads Swagger UI and points it at /openapi.json. The API key, if
+// entered under Authorize, is kept across reloads.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>Slingshot API</title>
+  <link rel="stylesheet" href="docs/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="docs/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      url: "openapi.json",
+      dom_id: "#swagger-ui",
+      persistAuthorization: true
+    });
+  </script>
+</body>
+</html>
+`
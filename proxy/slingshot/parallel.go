@@ -0,0 +1,295 @@
+package slingshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxDownloadConnections is the most connections a parallel download may use
+	MaxDownloadConnections = 16
+
+	// minDownloadChunkSize keeps parallel downloads from splitting small
+	// files into many tiny requests
+	minDownloadChunkSize = 256 << 10
+)
+
+// DownloadChunk is one byte range of a parallel download, fetched over its
+// own connection
+type DownloadChunk struct {
+	Index        int    `json:"index"`
+	Start        int64  `json:"start"`
+	End          int64  `json:"end"`
+	Received     int64  `json:"received"`
+	Status       int    `json:"status,omitempty"`
+	FirstByte    string `json:"first_byte_time,omitempty"` // Until the response headers arrived
+	ResponseTime string `json:"response_time,omitempty"`
+	Throughput   string `json:"throughput,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// size returns the number of bytes in the chunk
+func (c *DownloadChunk) size() int64 {
+	return c.End - c.Start + 1
+}
+
+// planChunks splits total bytes into up to connections ranges of at least
+// minDownloadChunkSize
+func planChunks(total int64, connections int) []*DownloadChunk {
+	n := min(int64(connections), (total+minDownloadChunkSize-1)/minDownloadChunkSize)
+	chunks := make([]*DownloadChunk, 0, n)
+	for i := int64(0); i < n; i++ {
+		chunks = append(chunks, &DownloadChunk{
+			Index: int(i),
+			Start: total * i / n,
+			End:   total*(i+1)/n - 1,
+		})
+	}
+	return chunks
+}
+
+// formatThroughput formats bytes transferred over a duration as a rate
+func formatThroughput(bytes int64, d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return formatSize(int64(float64(bytes)/d.Seconds())) + "/s"
+}
+
+// probeRanges asks for the first byte of a download to learn its size and
+// whether the server supports range requests. It returns why the download
+// cannot be split, or "" when it can.
+func (s *ProxyServer) probeRanges(ctx context.Context, download *Download) (string, error) {
+	httpReq, err := s.newDownloadRequest(ctx, download, "")
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Range", "bytes=0-0")
+
+	resp, err := s.sendDownloadRequest(httpReq)
+	if err != nil {
+		return "", err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Sprintf("Server answered a range request with %s", resp.Status), nil
+	}
+	cr, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil || cr.Total < 0 {
+		return "Server did not report the file size", nil
+	}
+
+	chunks := planChunks(cr.Total, download.Connections)
+	s.downloads.update(func() {
+		download.Total = cr.Total
+		download.AcceptRanges = "bytes"
+		download.ContentType = resp.Header.Get("Content-Type")
+		download.ETag = resp.Header.Get("ETag")
+		download.LastModified = resp.Header.Get("Last-Modified")
+		if len(chunks) > 1 {
+			download.Chunks = chunks
+		}
+	})
+	if len(chunks) < 2 {
+		return fmt.Sprintf("File is too small to split (%s)", formatSize(cr.Total)), nil
+	}
+	return "", nil
+}
+
+// parallelDownloadAttempt fetches the unfinished chunks of a download over
+// separate connections and writes each at its offset in the partial file.
+// The first attempt splits the file, or falls back to a single connection
+// when the server does not support ranges. It reports whether a failed
+// attempt is worth resuming.
+func (s *ProxyServer) parallelDownloadAttempt(ctx context.Context, download *Download) bool {
+	if download.Chunks == nil {
+		reason, err := s.probeRanges(ctx, download)
+		if err != nil {
+			s.downloads.update(func() {
+				download.State = DownloadInterrupted
+				download.Error = fmt.Sprintf("Failed to connect to server: %v", err)
+			})
+			return true
+		}
+		if reason != "" {
+			s.downloads.update(func() {
+				download.Connections = 1
+				download.ParallelFallback = reason
+			})
+			return s.downloadAttempt(ctx, download)
+		}
+	}
+
+	start := time.Now()
+	attempt := &DownloadAttempt{Connections: len(download.Chunks)}
+	fail := func(state, message string) {
+		s.downloads.update(func() {
+			download.State = state
+			download.Error = message
+			attempt.Error = message
+			attempt.ResponseTime = formatMillis(time.Since(start))
+		})
+	}
+
+	file, err := os.OpenFile(s.artifacts.partialPath(download.ID), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fail(DownloadFailed, fmt.Sprintf("Failed to open download file: %v", err))
+		return false
+	}
+	defer file.Close()
+
+	// Start over if the partial file is gone or shorter than the download
+	info, err := file.Stat()
+	s.downloads.update(func() {
+		if err != nil || info.Size() < download.Total {
+			download.Received = 0
+			for _, chunk := range download.Chunks {
+				chunk.Received = 0
+			}
+		}
+		download.State = DownloadRunning
+		download.Error = ""
+		download.Attempts = append(download.Attempts, attempt)
+	})
+	if err := file.Truncate(download.Total); err != nil {
+		fail(DownloadFailed, fmt.Sprintf("Failed to write download file: %v", err))
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(download.Timeout)*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var fatal, interrupted string
+	for _, chunk := range download.Chunks {
+		if chunk.Received == chunk.size() {
+			continue
+		}
+		wg.Add(1)
+		go func(chunk *DownloadChunk) {
+			defer wg.Done()
+			message, retryable := s.fetchChunk(ctx, download, chunk, attempt, file)
+			if message == "" {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !retryable {
+				fatal = message
+				cancel() // The other chunks are of no use
+			} else if interrupted == "" {
+				interrupted = message
+			}
+		}(chunk)
+	}
+	wg.Wait()
+
+	switch {
+	case fatal != "":
+		// A resume starts over with a fresh split
+		fail(DownloadFailed, fatal)
+		s.downloads.update(func() {
+			download.Chunks = nil
+			download.Received = 0
+		})
+		return false
+	case interrupted != "":
+		fail(DownloadInterrupted, interrupted)
+		return true
+	}
+	if err := file.Close(); err != nil {
+		fail(DownloadFailed, fmt.Sprintf("Failed to write download file: %v", err))
+		return false
+	}
+
+	if err := s.finishDownload(download); err != nil {
+		fail(DownloadFailed, err.Error())
+		return false
+	}
+	s.downloads.update(func() { attempt.ResponseTime = formatMillis(time.Since(start)) })
+	return false
+}
+
+// fetchChunk downloads the rest of one chunk. It returns why the chunk is
+// unfinished, if it is, and whether resuming could finish it.
+func (s *ProxyServer) fetchChunk(ctx context.Context, download *Download, chunk *DownloadChunk, attempt *DownloadAttempt, file *os.File) (string, bool) {
+	from := chunk.Start + chunk.Received
+	start := time.Now()
+
+	result := func(message string) {
+		s.downloads.update(func() {
+			chunk.Error = message
+			elapsed := time.Since(start)
+			chunk.ResponseTime = formatMillis(elapsed)
+			chunk.Throughput = formatThroughput(chunk.Start+chunk.Received-from, elapsed)
+		})
+	}
+
+	httpReq, err := s.newDownloadRequest(ctx, download, fmt.Sprintf("bytes=%d-%d", from, chunk.End))
+	if err != nil {
+		result(err.Error())
+		return err.Error(), false
+	}
+	resp, err := s.sendDownloadRequest(httpReq)
+	if err != nil {
+		message := fmt.Sprintf("Chunk %d: failed to connect to server: %v", chunk.Index, err)
+		result(message)
+		return message, true
+	}
+	defer resp.Body.Close()
+	s.downloads.update(func() {
+		chunk.Status = resp.StatusCode
+		chunk.FirstByte = formatMillis(time.Since(start))
+	})
+
+	// Anything but a matching 206 means the file changed or ranges stopped
+	// working, so the chunks already fetched cannot be combined with it
+	if resp.StatusCode != http.StatusPartialContent {
+		message := fmt.Sprintf("Chunk %d: server returned %s instead of 206 Partial Content; the file may have changed", chunk.Index, resp.Status)
+		result(message)
+		return message, false
+	}
+	cr, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err == nil {
+		err = validatePartialResponse(&byteRange{start: from, end: chunk.End}, cr, -1)
+	}
+	if err == nil && cr.Total != download.Total {
+		err = fmt.Errorf("File size changed from %d to %d bytes", download.Total, cr.Total)
+	}
+	if err != nil {
+		message := fmt.Sprintf("Chunk %d: %v", chunk.Index, err)
+		result(message)
+		return message, false
+	}
+
+	writer := &progressWriter{w: io.NewOffsetWriter(file, from), add: func(n int64) {
+		s.downloads.update(func() {
+			chunk.Received += n
+			download.Received += n
+			attempt.Bytes += n
+		})
+	}}
+	_, err = io.Copy(writer, io.LimitReader(resp.Body, chunk.End-from+1))
+	if err == nil && chunk.Start+chunk.Received <= chunk.End {
+		err = fmt.Errorf("connection closed after %d of %d bytes", chunk.Received, chunk.size())
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("attempt timed out after %d seconds", download.Timeout)
+		}
+		message := fmt.Sprintf("Chunk %d interrupted: %v", chunk.Index, err)
+		result(message)
+		return message, true
+	}
+
+	result("")
+	return "", false
+}
@@ -0,0 +1,70 @@
+package slingshot
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderAllowlist matches header names case-insensitively. Entries ending in
+// "*" match any header with that prefix, e.g. "X-*".
+type HeaderAllowlist []string
+
+// Allows reports whether the header name is on the list
+func (a HeaderAllowlist) Allows(name string) bool {
+	for _, pattern := range a {
+		if strings.HasSuffix(pattern, "*") {
+			prefix := strings.TrimSuffix(pattern, "*")
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// passthroughHeaders returns the caller's allowlisted headers in "Key: Value"
+// form, skipping any the JSON payload already sets explicitly
+func (s *ProxyServer) passthroughHeaders(r *http.Request, explicit []string) []string {
+	if len(s.config.PassthroughHeaders) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool)
+	for _, field := range parseHeaderFields(explicit) {
+		set[http.CanonicalHeaderKey(field.Name)] = true
+	}
+
+	var headers []string
+	for key, values := range r.Header {
+		if set[key] || key == "Host" || key == "Content-Length" || key == APIKeyHeader || key == RealStatusHeader || !s.config.PassthroughHeaders.Allows(key) {
+			continue
+		}
+		if isHopByHopHeader(key) {
+			continue
+		}
+		for _, value := range values {
+			headers = append(headers, key+": "+value)
+		}
+	}
+
+	return headers
+}
+
+// allowedRequestHeaders returns the CORS Access-Control-Allow-Headers value,
+// including any requested headers that are on the passthrough allowlist
+func (s *ProxyServer) allowedRequestHeaders(r *http.Request) string {
+	allowed := []string{"Content-Type", "Authorization", "X-Requested-With", APIKeyHeader, RealStatusHeader}
+
+	for _, name := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && s.config.PassthroughHeaders.Allows(name) {
+			allowed = append(allowed, name)
+		}
+	}
+
+	return strings.Join(allowed, ", ")
+}
@@ -0,0 +1,54 @@
+package slingshot
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Path parameter encodings
+const (
+	PathParamEncodingPath     = "path"     // Escape as a single path segment (default)
+	PathParamEncodingReserved = "reserved" // Escape, but keep reserved characters such as "/" and ":"
+	PathParamEncodingRaw      = "raw"      // Insert the value as-is
+	PathParamEncodingQuery    = "query"    // Query escaping, spaces become "+"
+)
+
+// encodePathParam encodes a path parameter value using the given encoding
+func encodePathParam(value, encoding string) (string, error) {
+	switch encoding {
+	case "", PathParamEncodingPath:
+		return url.PathEscape(value), nil
+	case PathParamEncodingReserved:
+		return escapePreservingReserved(value), nil
+	case PathParamEncodingRaw:
+		return value, nil
+	case PathParamEncodingQuery:
+		return url.QueryEscape(value), nil
+	default:
+		return "", fmt.Errorf("Unknown path parameter encoding %q (expected path, reserved, raw or query)", encoding)
+	}
+}
+
+// escapePreservingReserved percent-encodes everything except RFC 3986
+// unreserved and reserved characters
+func escapePreservingReserved(value string) string {
+	const reserved = ":/?#[]@!$&'()*+,;="
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if isUnreserved(ch) || strings.IndexByte(reserved, ch) >= 0 {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
+
+// isUnreserved reports whether ch is an RFC 3986 unreserved character
+func isUnreserved(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+		ch == '-' || ch == '.' || ch == '_' || ch == '~'
+}
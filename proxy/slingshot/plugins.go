@@ -0,0 +1,260 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultPluginTimeout bounds a plugin call unless the plugin sets its own, in
+// seconds
+const DefaultPluginTimeout = 10
+
+// maxPluginOutput caps what a plugin may answer with
+const maxPluginOutput = 10 << 20
+
+// Plugin events
+const (
+	PluginEventRequestPre   = "request-pre"   // Before the request is sent; may change or reject it
+	PluginEventResponsePost = "response-post" // After a response arrived; may change it
+	PluginEventError        = "error"         // After the request failed; may change the error response
+)
+
+// Plugin is an executable or HTTP endpoint called at the events it
+// subscribes to. It receives a PluginCall as JSON on stdin (or as the POST
+// body) and may answer with a PluginResult on stdout (or in the response).
+type Plugin struct {
+	Name     string       `json:"name"`
+	Command  []string     `json:"command,omitempty"` // Executable and its arguments
+	URL      string       `json:"url,omitempty"`     // HTTP endpoint, instead of a command
+	Events   []string     `json:"events"`
+	Hosts    HostPatterns `json:"hosts,omitempty"`    // Target hosts the plugin applies to; empty for all
+	Timeout  int          `json:"timeout,omitempty"`  // Seconds; defaults to DefaultPluginTimeout
+	FailOpen bool         `json:"failOpen,omitempty"` // Send the request anyway when the plugin fails at request-pre
+}
+
+// PluginCall is what a plugin receives
+type PluginCall struct {
+	Event    string         `json:"event"`
+	Plugin   string         `json:"plugin"`
+	Request  *ProxyRequest  `json:"request"`
+	Response *ProxyResponse `json:"response,omitempty"`
+}
+
+// PluginResult is what a plugin may answer with. The fields of request and
+// response it sets replace those of the request or response; an empty answer
+// changes nothing.
+type PluginResult struct {
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Reject   string          `json:"reject,omitempty"` // Refuse to send the request, at request-pre
+}
+
+// Plugins holds the plugins configured in a file
+type Plugins struct {
+	file    string
+	plugins []*Plugin
+}
+
+// NewPlugins creates the plugins configured in file, once loaded
+func NewPlugins(file string) *Plugins {
+	return &Plugins{file: file}
+}
+
+// Load reads and checks the plugins file, if one is configured
+func (p *Plugins) Load() error {
+	if p.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(p.file)
+	if err != nil {
+		return fmt.Errorf("Failed to read plugins: %v", err)
+	}
+	var plugins []*Plugin
+	if err := json.Unmarshal(data, &plugins); err != nil {
+		return fmt.Errorf("Failed to parse plugins %s: %v", p.file, err)
+	}
+
+	for i, plugin := range plugins {
+		if plugin.Name == "" {
+			plugin.Name = fmt.Sprintf("plugin %d", i+1)
+		}
+		if (len(plugin.Command) == 0) == (plugin.URL == "") {
+			return fmt.Errorf("Plugin %s: set exactly one of command and url", plugin.Name)
+		}
+		if len(plugin.Events) == 0 {
+			return fmt.Errorf("Plugin %s: no events", plugin.Name)
+		}
+		for _, event := range plugin.Events {
+			switch event {
+			case PluginEventRequestPre, PluginEventResponsePost, PluginEventError:
+			default:
+				return fmt.Errorf("Plugin %s: unknown event %q; use %s, %s or %s", plugin.Name, event, PluginEventRequestPre, PluginEventResponsePost, PluginEventError)
+			}
+		}
+		if plugin.Timeout <= 0 {
+			plugin.Timeout = DefaultPluginTimeout
+		}
+	}
+	p.plugins = plugins
+	return nil
+}
+
+// subscribed returns the plugins for an event on a request to targetURL, in
+// the order they were configured
+func (p *Plugins) subscribed(event, targetURL string) []*Plugin {
+	if p == nil || len(p.plugins) == 0 {
+		return nil
+	}
+
+	host := ""
+	if parsed, err := url.Parse(targetURL); err == nil {
+		host = parsed.Hostname()
+	}
+
+	var plugins []*Plugin
+	for _, plugin := range p.plugins {
+		if len(plugin.Hosts) > 0 && !plugin.Hosts.Matches(host) {
+			continue
+		}
+		for _, subscribed := range plugin.Events {
+			if subscribed == event {
+				plugins = append(plugins, plugin)
+				break
+			}
+		}
+	}
+	return plugins
+}
+
+// beforeRequest runs the request-pre plugins, which may change req. It
+// returns the error to answer with when a plugin rejected the request or
+// failed without failOpen.
+func (p *Plugins) beforeRequest(ctx context.Context, req *ProxyRequest) (*ProxyError, []string) {
+	var failures []string
+	for _, plugin := range p.subscribed(PluginEventRequestPre, req.URL) {
+		result, err := plugin.call(ctx, &PluginCall{Event: PluginEventRequestPre, Plugin: plugin.Name, Request: req})
+		if err == nil && result.Reject != "" {
+			return &ProxyError{Type: PluginRejectedError.Type, Title: PluginRejectedError.Title, Message: fmt.Sprintf("%s: %s", plugin.Name, result.Reject)}, failures
+		}
+		if err == nil && len(result.Request) > 0 {
+			err = json.Unmarshal(result.Request, req)
+		}
+		if err != nil {
+			if !plugin.FailOpen {
+				return &ProxyError{Type: PluginFailedError.Type, Title: PluginFailedError.Title, Message: fmt.Sprintf("%s: %v", plugin.Name, err)}, failures
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", plugin.Name, err))
+		}
+	}
+	return nil, failures
+}
+
+// afterResponse runs the response-post plugins, or the error plugins when
+// the request failed, which may change response. Failing plugins are
+// reported in the response's plugin_errors.
+func (p *Plugins) afterResponse(ctx context.Context, req *ProxyRequest, response *ProxyResponse) {
+	event := PluginEventResponsePost
+	if !response.Success {
+		event = PluginEventError
+	}
+
+	for _, plugin := range p.subscribed(event, req.URL) {
+		result, err := plugin.call(ctx, &PluginCall{Event: event, Plugin: plugin.Name, Request: req, Response: response})
+		if err == nil && len(result.Response) > 0 {
+			err = json.Unmarshal(result.Response, response)
+		}
+		if err != nil {
+			response.PluginErrors = append(response.PluginErrors, fmt.Sprintf("%s: %v", plugin.Name, err))
+		}
+	}
+}
+
+// call sends a call to the plugin and decodes its answer
+func (p *Plugin) call(ctx context.Context, call *PluginCall) (*PluginResult, error) {
+	input, err := json.Marshal(call)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.Timeout)*time.Second)
+	defer cancel()
+
+	var output []byte
+	if p.URL != "" {
+		output, err = p.post(ctx, input)
+	} else {
+		output, err = p.run(ctx, input)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("no answer within %d seconds", p.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PluginResult{}
+	if len(bytes.TrimSpace(output)) == 0 {
+		return result, nil
+	}
+	if err := json.Unmarshal(output, result); err != nil {
+		return nil, fmt.Errorf("invalid answer: %v", err)
+	}
+	return result, nil
+}
+
+// run runs the plugin's command with input on stdin, returning its stdout
+func (p *Plugin) run(ctx context.Context, input []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+		return nil, err
+	}
+	if stdout.Len() > maxPluginOutput {
+		return nil, fmt.Errorf("answer larger than %s", formatSize(maxPluginOutput))
+	}
+	return stdout.Bytes(), nil
+}
+
+// post POSTs input to the plugin's URL, returning the response body
+func (p *Plugin) post(ctx context.Context, input []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", p.URL, bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	output, err := io.ReadAll(io.LimitReader(resp.Body, maxPluginOutput+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s returned %s", p.URL, resp.Status)
+	}
+	if len(output) > maxPluginOutput {
+		return nil, fmt.Errorf("answer larger than %s", formatSize(maxPluginOutput))
+	}
+	return output, nil
+}
@@ -0,0 +1,427 @@
+// Postman-compatible scripting API for JavaScript scripts.
+//
+// The proxy sets __input to the JSON-encoded script state and __host to a few
+// native helpers, runs this file, then the user's script, and finally reads
+// back JSON.stringify(__state).
+
+var __state = JSON.parse(__input);
+
+(function (global) {
+  "use strict";
+
+  // Logging
+
+  function format(value) {
+    if (typeof value === "string") {
+      return value;
+    }
+    try {
+      return JSON.stringify(value);
+    } catch (e) {
+      return String(value);
+    }
+  }
+
+  function log() {
+    __state.logs.push(Array.prototype.map.call(arguments, format).join(" "));
+  }
+
+  global.console = { log: log, info: log, warn: log, error: log, debug: log };
+
+  // Assertions, a subset of the Chai BDD API
+
+  function AssertionError(message) {
+    this.name = "AssertionError";
+    this.message = message;
+  }
+  AssertionError.prototype = Object.create(Error.prototype);
+
+  function typeOf(value) {
+    if (value === null) {
+      return "null";
+    }
+    if (Array.isArray(value)) {
+      return "array";
+    }
+    return typeof value;
+  }
+
+  function deepEqual(a, b) {
+    return JSON.stringify(a) === JSON.stringify(b);
+  }
+
+  function Assertion(value, negate) {
+    this._value = value;
+    this._negate = !!negate;
+  }
+
+  Assertion.prototype._assert = function (passed, message, negatedMessage) {
+    if (passed === this._negate) {
+      throw new AssertionError(this._negate ? negatedMessage : message);
+    }
+    return this;
+  };
+
+  // Words that only make an assertion read better
+  ["to", "be", "been", "is", "that", "which", "and", "has", "have", "with", "at", "of", "same", "deep"].forEach(function (word) {
+    Object.defineProperty(Assertion.prototype, word, {
+      get: function () { return this; }
+    });
+  });
+
+  Object.defineProperty(Assertion.prototype, "not", {
+    get: function () { return new Assertion(this._value, !this._negate); }
+  });
+
+  function flag(name, test, description) {
+    Object.defineProperty(Assertion.prototype, name, {
+      get: function () {
+        return this._assert(test(this._value),
+          "expected " + format(this._value) + " to be " + description,
+          "expected " + format(this._value) + " not to be " + description);
+      }
+    });
+  }
+
+  flag("ok", function (v) { return !!v; }, "truthy");
+  flag("true", function (v) { return v === true; }, "true");
+  flag("false", function (v) { return v === false; }, "false");
+  flag("null", function (v) { return v === null; }, "null");
+  flag("undefined", function (v) { return v === undefined; }, "undefined");
+  flag("exist", function (v) { return v !== null && v !== undefined; }, "defined");
+  flag("empty", function (v) {
+    if (typeof v === "string" || Array.isArray(v)) {
+      return v.length === 0;
+    }
+    return v !== null && typeof v === "object" && Object.keys(v).length === 0;
+  }, "empty");
+
+  Assertion.prototype.equal = function (expected) {
+    return this._assert(this._value === expected,
+      "expected " + format(this._value) + " to equal " + format(expected),
+      "expected " + format(this._value) + " not to equal " + format(expected));
+  };
+  Assertion.prototype.equals = Assertion.prototype.equal;
+  Assertion.prototype.eq = Assertion.prototype.equal;
+
+  Assertion.prototype.eql = function (expected) {
+    return this._assert(deepEqual(this._value, expected),
+      "expected " + format(this._value) + " to deeply equal " + format(expected),
+      "expected " + format(this._value) + " not to deeply equal " + format(expected));
+  };
+
+  Assertion.prototype.above = function (n) {
+    return this._assert(this._value > n,
+      "expected " + format(this._value) + " to be above " + n,
+      "expected " + format(this._value) + " to be at most " + n);
+  };
+  Assertion.prototype.gt = Assertion.prototype.above;
+  Assertion.prototype.greaterThan = Assertion.prototype.above;
+
+  Assertion.prototype.below = function (n) {
+    return this._assert(this._value < n,
+      "expected " + format(this._value) + " to be below " + n,
+      "expected " + format(this._value) + " to be at least " + n);
+  };
+  Assertion.prototype.lt = Assertion.prototype.below;
+  Assertion.prototype.lessThan = Assertion.prototype.below;
+
+  Assertion.prototype.least = function (n) {
+    return this._assert(this._value >= n,
+      "expected " + format(this._value) + " to be at least " + n,
+      "expected " + format(this._value) + " to be below " + n);
+  };
+  Assertion.prototype.gte = Assertion.prototype.least;
+
+  Assertion.prototype.most = function (n) {
+    return this._assert(this._value <= n,
+      "expected " + format(this._value) + " to be at most " + n,
+      "expected " + format(this._value) + " to be above " + n);
+  };
+  Assertion.prototype.lte = Assertion.prototype.most;
+
+  Assertion.prototype.include = function (item) {
+    var v = this._value;
+    var found;
+    if (typeof v === "string") {
+      found = v.indexOf(item) !== -1;
+    } else if (Array.isArray(v)) {
+      found = v.some(function (element) { return deepEqual(element, item); });
+    } else if (v !== null && typeof v === "object" && item !== null && typeof item === "object") {
+      found = Object.keys(item).every(function (key) { return deepEqual(v[key], item[key]); });
+    } else {
+      found = false;
+    }
+    return this._assert(found,
+      "expected " + format(v) + " to include " + format(item),
+      "expected " + format(v) + " not to include " + format(item));
+  };
+  Assertion.prototype.includes = Assertion.prototype.include;
+  Assertion.prototype.contain = Assertion.prototype.include;
+  Assertion.prototype.contains = Assertion.prototype.include;
+
+  Assertion.prototype.a = function (type) {
+    return this._assert(typeOf(this._value) === type.toLowerCase(),
+      "expected " + format(this._value) + " to be a " + type,
+      "expected " + format(this._value) + " not to be a " + type);
+  };
+  Assertion.prototype.an = Assertion.prototype.a;
+
+  Assertion.prototype.property = function (name, value) {
+    var v = this._value;
+    var has = v !== null && v !== undefined && Object.prototype.hasOwnProperty.call(Object(v), name);
+    if (arguments.length > 1) {
+      return this._assert(has && deepEqual(v[name], value),
+        "expected " + format(v) + " to have property " + name + " of " + format(value),
+        "expected " + format(v) + " not to have property " + name + " of " + format(value));
+    }
+    this._assert(has,
+      "expected " + format(v) + " to have property " + name,
+      "expected " + format(v) + " not to have property " + name);
+    return new Assertion(has ? v[name] : undefined, this._negate);
+  };
+
+  Assertion.prototype.lengthOf = function (n) {
+    var length = this._value === null || this._value === undefined ? undefined : this._value.length;
+    return this._assert(length === n,
+      "expected " + format(this._value) + " to have length " + n + " but got " + length,
+      "expected " + format(this._value) + " not to have length " + n);
+  };
+
+  Assertion.prototype.match = function (re) {
+    return this._assert(re.test(String(this._value)),
+      "expected " + format(this._value) + " to match " + re,
+      "expected " + format(this._value) + " not to match " + re);
+  };
+
+  Assertion.prototype.oneOf = function (list) {
+    var v = this._value;
+    return this._assert(list.some(function (item) { return deepEqual(item, v); }),
+      "expected " + format(v) + " to be one of " + format(list),
+      "expected " + format(v) + " not to be one of " + format(list));
+  };
+
+  function expect(value) {
+    return new Assertion(value);
+  }
+
+  // Variables
+
+  function scope() {
+    return {
+      get: function (key) { return __state.env[key]; },
+      set: function (key, value) { __state.env[key] = value; },
+      unset: function (key) { delete __state.env[key]; },
+      has: function (key) { return Object.prototype.hasOwnProperty.call(__state.env, key); },
+      clear: function () { __state.env = {}; },
+      toObject: function () { return JSON.parse(JSON.stringify(__state.env)); }
+    };
+  }
+
+  // Headers
+
+  function headerList(headers) {
+    function find(name) {
+      name = String(name).toLowerCase();
+      for (var i = 0; i < headers.length; i++) {
+        if (headers[i].key.toLowerCase() === name) {
+          return i;
+        }
+      }
+      return -1;
+    }
+    function remove(name) {
+      name = String(name).toLowerCase();
+      for (var i = headers.length - 1; i >= 0; i--) {
+        if (headers[i].key.toLowerCase() === name) {
+          headers.splice(i, 1);
+        }
+      }
+    }
+    return {
+      get: function (name) {
+        var i = find(name);
+        return i === -1 ? undefined : headers[i].value;
+      },
+      has: function (name) { return find(name) !== -1; },
+      add: function (header) { headers.push({ key: header.key, value: String(header.value) }); },
+      upsert: function (header) {
+        remove(header.key);
+        headers.push({ key: header.key, value: String(header.value) });
+      },
+      remove: remove,
+      toObject: function () {
+        var object = {};
+        headers.forEach(function (header) { object[header.key] = header.value; });
+        return object;
+      },
+      each: function (fn) { headers.forEach(fn); }
+    };
+  }
+
+  // The pm object
+
+  var request = __state.request;
+  var pmRequest = {
+    headers: headerList(request.headers),
+    body: {}
+  };
+  ["method", "url"].forEach(function (field) {
+    Object.defineProperty(pmRequest, field, {
+      enumerable: true,
+      get: function () { return request[field]; },
+      set: function (value) { request[field] = String(value); }
+    });
+  });
+  Object.defineProperty(pmRequest.body, "raw", {
+    enumerable: true,
+    get: function () { return request.body; },
+    set: function (value) { request.body = String(value); }
+  });
+  pmRequest.body.toString = function () { return request.body; };
+  pmRequest.addHeader = pmRequest.headers.add;
+  pmRequest.removeHeader = pmRequest.headers.remove;
+
+  var pm = {
+    request: pmRequest,
+    environment: scope(),
+    variables: scope(),
+    collectionVariables: scope(),
+    globals: scope(),
+    expect: expect,
+    test: function (name, fn) {
+      try {
+        fn();
+        __state.tests.push({ name: name, passed: true });
+      } catch (e) {
+        __state.tests.push({ name: name, passed: false, error: e && e.message ? e.message : String(e) });
+      }
+    },
+    execution: {
+      setNextRequest: function (name) { __state.next = name === null ? "" : String(name); }
+    }
+  };
+
+  var response = __state.response;
+  if (response) {
+    var responseHeaders = headerList(response.headers);
+    pm.response = {
+      code: response.code,
+      status: response.status,
+      responseTime: response.responseTime,
+      headers: responseHeaders,
+      text: function () { return response.body; },
+      json: function () { return JSON.parse(response.body); },
+      to: {}
+    };
+
+    var to = pm.response.to;
+    to.have = {
+      status: function (expected) {
+        if (typeof expected === "number") {
+          expect(response.code).to.equal(expected);
+        } else {
+          expect(response.status).to.equal(expected);
+        }
+      },
+      header: function (name, value) {
+        if (!responseHeaders.has(name)) {
+          throw new AssertionError("expected response to have header " + name);
+        }
+        if (arguments.length > 1) {
+          expect(responseHeaders.get(name)).to.equal(value);
+        }
+      },
+      body: function (expected) {
+        if (arguments.length > 0) {
+          expect(response.body).to.equal(expected);
+        } else {
+          expect(response.body).not.to.be.empty;
+        }
+      },
+      jsonBody: function (path, value) {
+        var body = JSON.parse(response.body);
+        if (arguments.length === 0) {
+          return;
+        }
+        var node = body;
+        String(path).split(".").forEach(function (key) {
+          node = node === null || node === undefined ? undefined : node[key];
+        });
+        if (arguments.length > 1) {
+          expect(node).to.eql(value);
+        } else {
+          expect(node).to.exist;
+        }
+      }
+    };
+    to.be = {};
+    Object.defineProperty(to.be, "ok", {
+      get: function () { expect(response.code >= 200 && response.code < 300).to.be.true; }
+    });
+    Object.defineProperty(to.be, "success", {
+      get: function () { expect(response.code >= 200 && response.code < 300).to.be.true; }
+    });
+    Object.defineProperty(to.be, "error", {
+      get: function () { expect(response.code >= 400).to.be.true; }
+    });
+    Object.defineProperty(to.be, "json", {
+      get: function () { JSON.parse(response.body); }
+    });
+  }
+
+  global.pm = pm;
+  global.postman = {
+    setNextRequest: pm.execution.setNextRequest,
+    getEnvironmentVariable: pm.environment.get,
+    setEnvironmentVariable: pm.environment.set,
+    clearEnvironmentVariable: pm.environment.unset
+  };
+
+  // A subset of CryptoJS. Word arrays are kept as hex strings.
+
+  function WordArray(hex) {
+    this.hex = hex;
+  }
+  WordArray.prototype.toString = function (encoder) {
+    return (encoder || Hex).stringify(this);
+  };
+
+  function toHex(value) {
+    return value instanceof WordArray ? value.hex : __host.utf8ToHex(String(value));
+  }
+
+  var Hex = {
+    parse: function (s) { return new WordArray(String(s).toLowerCase()); },
+    stringify: function (wa) { return wa.hex; }
+  };
+  var Base64 = {
+    parse: function (s) { return new WordArray(__host.base64ToHex(String(s))); },
+    stringify: function (wa) { return __host.hexToBase64(wa.hex); }
+  };
+  var Utf8 = {
+    parse: function (s) { return new WordArray(__host.utf8ToHex(String(s))); },
+    stringify: function (wa) { return __host.hexToUtf8(wa.hex); }
+  };
+
+  function hasher(algorithm) {
+    return function (message) { return new WordArray(__host.hash(algorithm, toHex(message))); };
+  }
+  function hmac(algorithm) {
+    return function (message, key) { return new WordArray(__host.hmac(algorithm, toHex(key), toHex(message))); };
+  }
+
+  global.CryptoJS = {
+    enc: { Hex: Hex, Base64: Base64, Utf8: Utf8 },
+    MD5: hasher("md5"),
+    SHA1: hasher("sha1"),
+    SHA256: hasher("sha256"),
+    SHA512: hasher("sha512"),
+    HmacSHA1: hmac("sha1"),
+    HmacSHA256: hmac("sha256"),
+    HmacSHA512: hmac("sha512")
+  };
+
+  global.btoa = function (s) { return __host.hexToBase64(__host.utf8ToHex(String(s))); };
+  global.atob = function (s) { return __host.hexToUtf8(__host.base64ToHex(String(s))); };
+})(this);
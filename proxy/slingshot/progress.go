@@ -0,0 +1,62 @@
+package slingshot
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// progressInterval is the minimum time between upload progress reports
+const progressInterval = 100 * time.Millisecond
+
+// ProgressStream is implemented by response streams that also want to know
+// how much of the request body has been sent
+type ProgressStream interface {
+	WriteProgress(sent, total int64) error
+}
+
+// trackUploadProgress reports upload progress for the request body as the
+// transport reads it. A replayed body (after a redirect) starts over at zero.
+func trackUploadProgress(httpReq *http.Request, total int64, progress ProgressStream) {
+	httpReq.Body = &progressReader{ReadCloser: httpReq.Body, total: total, progress: progress}
+
+	getBody := httpReq.GetBody
+	if getBody != nil {
+		httpReq.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return &progressReader{ReadCloser: body, total: total, progress: progress}, nil
+		}
+	}
+}
+
+// progressReader counts the bytes read from a request body and reports them
+// at most every progressInterval, plus once when the body is complete
+type progressReader struct {
+	io.ReadCloser
+	sent       int64
+	total      int64
+	progress   ProgressStream
+	lastReport time.Time
+	done       bool
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.sent += int64(n)
+
+	if r.done {
+		return n, err
+	}
+
+	finished := err == io.EOF || r.sent >= r.total
+	if finished || time.Since(r.lastReport) >= progressInterval {
+		r.lastReport = time.Now()
+		r.done = finished
+		r.progress.WriteProgress(r.sent, r.total)
+	}
+
+	return n, err
+}
@@ -0,0 +1,315 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/linker"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// MaxProtoFileSize is the largest .proto file accepted by /proto/files
+const MaxProtoFileSize = 1 << 20
+
+// ProtoFileRequest is the JSON body of /proto/files
+type ProtoFileRequest struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// ProtoMessagesResponse is returned by /proto/files
+type ProtoMessagesResponse struct {
+	Success  bool     `json:"success"`
+	Files    []string `json:"files"`
+	Messages []string `json:"messages"`
+}
+
+// ProtoRegistry compiles .proto files and converts messages between JSON
+// and the protobuf wire format. Files come from the directories given at
+// startup and from /proto/files; registered files may import both.
+type ProtoRegistry struct {
+	mu      sync.Mutex
+	dirs    []string
+	sources map[string]string
+	files   linker.Files
+	loaded  bool
+}
+
+// NewProtoRegistry creates a registry for the .proto files in dirs. The
+// files are compiled on first use or by Load.
+func NewProtoRegistry(dirs []string) *ProtoRegistry {
+	return &ProtoRegistry{dirs: dirs, sources: make(map[string]string)}
+}
+
+// Load compiles the .proto files, reporting the first error
+func (r *ProtoRegistry) Load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.load()
+}
+
+// load compiles the files unless they are already compiled. The caller holds mu.
+func (r *ProtoRegistry) load() error {
+	if r.loaded {
+		return nil
+	}
+	files, err := r.compile(r.sources)
+	if err != nil {
+		return err
+	}
+	r.files = files
+	r.loaded = true
+	return nil
+}
+
+// compile compiles the files in the directories together with sources
+func (r *ProtoRegistry) compile(sources map[string]string) (linker.Files, error) {
+	names := make(map[string]bool)
+	for name := range sources {
+		names[name] = true
+	}
+	for _, dir := range r.dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(path, ".proto") {
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+				names[filepath.ToSlash(rel)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read .proto files: %v", err)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(protocompile.CompositeResolver{
+			&protocompile.SourceResolver{Accessor: protocompile.SourceAccessorFromMap(sources)},
+			&protocompile.SourceResolver{ImportPaths: r.dirs},
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), sorted...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile .proto files: %v", err)
+	}
+	return files, nil
+}
+
+// Register adds or replaces a .proto file. The file is kept only when all
+// files still compile.
+func (r *ProtoRegistry) Register(name, source string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sources := make(map[string]string, len(r.sources)+1)
+	for key, value := range r.sources {
+		sources[key] = value
+	}
+	sources[name] = source
+
+	files, err := r.compile(sources)
+	if err != nil {
+		return err
+	}
+	r.sources = sources
+	r.files = files
+	r.loaded = true
+	return nil
+}
+
+// Contents lists the compiled files and the full names of their messages
+func (r *ProtoRegistry) Contents() ([]string, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.load(); err != nil {
+		return nil, nil, err
+	}
+	files := []string{}
+	messages := []string{}
+	for _, file := range r.files {
+		files = append(files, file.Path())
+		collectMessages(file.Messages(), &messages)
+	}
+	sort.Strings(messages)
+	return files, messages, nil
+}
+
+// collectMessages appends the names of messages and their nested messages
+func collectMessages(descriptors protoreflect.MessageDescriptors, names *[]string) {
+	for i := 0; i < descriptors.Len(); i++ {
+		message := descriptors.Get(i)
+		if message.IsMapEntry() {
+			continue
+		}
+		*names = append(*names, string(message.FullName()))
+		collectMessages(message.Messages(), names)
+	}
+}
+
+// message finds a message type by its full name, such as acme.v1.User
+func (r *ProtoRegistry) message(name string) (protoreflect.MessageDescriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	descriptor, err := r.files.AsResolver().FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("Unknown protobuf message %q", name)
+	}
+	message, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a protobuf message", name)
+	}
+	return message, nil
+}
+
+// Encode converts a JSON body to the protobuf encoding of a message
+func (r *ProtoRegistry) Encode(name string, body []byte) ([]byte, error) {
+	descriptor, err := r.message(name)
+	if err != nil {
+		return nil, err
+	}
+	message := dynamicpb.NewMessage(descriptor)
+	if err := protojson.Unmarshal(body, message); err != nil {
+		return nil, fmt.Errorf("Body does not match %s: %v", name, err)
+	}
+	return proto.Marshal(message)
+}
+
+// Decode converts the protobuf encoding of a message to JSON
+func (r *ProtoRegistry) Decode(name string, data []byte) (string, error) {
+	descriptor, err := r.message(name)
+	if err != nil {
+		return "", err
+	}
+	message := dynamicpb.NewMessage(descriptor)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return "", fmt.Errorf("Response is not a valid %s: %v", name, err)
+	}
+	decoded, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+// isProtobufContent reports whether a content type may hold a protobuf message
+func isProtobufContent(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(contentType, "protobuf") || strings.HasPrefix(contentType, "application/octet-stream")
+}
+
+// encodeProtoBody replaces the JSON body of a request with its protobuf
+// encoding as protoMessage, defaulting the Content-Type to
+// application/x-protobuf
+func (c *HTTPClient) encodeProtoBody(req *ProxyRequest) error {
+	encoded, err := c.protos.Encode(req.ProtoMessage, []byte(req.Body))
+	if err != nil {
+		return err
+	}
+	req.Body = string(encoded)
+
+	for _, field := range parseHeaderFields(req.Headers) {
+		if strings.EqualFold(field.Name, "Content-Type") {
+			return nil
+		}
+	}
+	req.Headers = append(req.Headers, "Content-Type: application/x-protobuf")
+	return nil
+}
+
+// decodeProtoResponse replaces a protobuf response body with its JSON form
+func (c *HTTPClient) decodeProtoResponse(req *ProxyRequest, response *ProxyResponse) error {
+	if !isProtobufContent(response.ContentType) || response.BodyOmitted {
+		return nil
+	}
+
+	data := []byte(response.ResponseData)
+	if response.IsBinary {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(response.ResponseData); err != nil {
+			return err
+		}
+	}
+	decoded, err := c.protos.Decode(req.ProtoResponseMessage, data)
+	if err != nil {
+		return err
+	}
+	response.ResponseData = decoded
+	response.IsBinary = false
+	response.BodyFormat = "protobuf"
+	return nil
+}
+
+// handleProtoFiles handles /proto/files. GET lists the compiled files and
+// messages; POST registers a .proto file.
+func (s *ProxyServer) handleProtoFiles(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "POST" {
+		var req ProtoFileRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxProtoFileSize)).Decode(&req); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+			return
+		}
+		if req.Name == "" || req.Source == "" {
+			s.writeErrorResponse(w, "request_format_error", "Missing Fields", "Name and source are required")
+			return
+		}
+		if !strings.HasSuffix(req.Name, ".proto") || strings.Contains(req.Name, "..") || strings.HasPrefix(req.Name, "/") {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Name", "Name must be a relative path ending in .proto")
+			return
+		}
+		if err := s.httpClient.protos.Register(req.Name, req.Source); err != nil {
+			s.writeErrorResponse(w, "proto_error", "Invalid Proto File", err.Error())
+			return
+		}
+		s.logger.Printf("[%s] Registered %s", requestID(w), req.Name)
+	}
+
+	files, messages, err := s.httpClient.protos.Contents()
+	if err != nil {
+		s.writeErrorResponse(w, "proto_error", "Invalid Proto File", err.Error())
+		return
+	}
+	response := ProtoMessagesResponse{Success: true, Files: files, Messages: messages}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
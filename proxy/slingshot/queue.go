@@ -0,0 +1,196 @@
+package slingshot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Request priorities. Once -max-concurrent requests are in flight, waiting
+// requests are sent highest priority first, and in arrival order within a
+// priority.
+const (
+	PriorityInteractive = "interactive"
+	PriorityNormal      = "normal"
+	PriorityBatch       = "batch"
+)
+
+// DefaultQueueTimeout is how long a request waits for a free slot
+const DefaultQueueTimeout = 30 * time.Second
+
+// priorityLevels orders the priorities, highest first
+var priorityLevels = []string{PriorityInteractive, PriorityNormal, PriorityBatch}
+
+// priorityLevel returns the index of a priority in priorityLevels
+func priorityLevel(priority string) int {
+	for i, level := range priorityLevels {
+		if level == priority {
+			return i
+		}
+	}
+	return 1
+}
+
+// validatePriority checks a request's priority
+func validatePriority(priority string) error {
+	switch priority {
+	case "", PriorityInteractive, PriorityNormal, PriorityBatch:
+		return nil
+	}
+	return fmt.Errorf("Unknown priority %q (use %s, %s or %s)", priority, PriorityInteractive, PriorityNormal, PriorityBatch)
+}
+
+// priorityContextKey carries the priority of requests that do not set one
+type priorityContextKey struct{}
+
+// withDefaultPriority sets the priority of the requests sent within ctx that
+// do not set their own, such as the rows of a data-driven run
+func withDefaultPriority(ctx context.Context, priority string) context.Context {
+	return context.WithValue(ctx, priorityContextKey{}, priority)
+}
+
+// requestPriority returns the priority a request runs at
+func requestPriority(ctx context.Context, req *ProxyRequest) string {
+	if req.Priority != "" {
+		return req.Priority
+	}
+	if priority, ok := ctx.Value(priorityContextKey{}).(string); ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// QueueStats describes the request queue
+type QueueStats struct {
+	MaxConcurrent int            `json:"max_concurrent"` // 0 is unlimited
+	Running       int            `json:"running"`
+	Waiting       map[string]int `json:"waiting"` // By priority
+}
+
+// queuedRequest is a request waiting for a slot
+type queuedRequest struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// RequestQueue limits how many requests are sent at once, queueing the others
+// by priority. A nil queue, or one with no limit, sends every request at once.
+type RequestQueue struct {
+	limit   int
+	timeout time.Duration
+
+	mu      sync.Mutex
+	running int
+	waiting [][]*queuedRequest // By priority level
+}
+
+// NewRequestQueue creates a queue sending up to limit requests at once,
+// failing requests that waited longer than timeout
+func NewRequestQueue(limit int, timeout time.Duration) *RequestQueue {
+	if timeout <= 0 {
+		timeout = DefaultQueueTimeout
+	}
+	return &RequestQueue{
+		limit:   limit,
+		timeout: timeout,
+		waiting: make([][]*queuedRequest, len(priorityLevels)),
+	}
+}
+
+// queueSlotContextKey marks requests sent while holding a slot, such as the
+// introspection query of a GraphQL request, which need no slot of their own
+type queueSlotContextKey struct{}
+
+// acquire waits for a slot, returning how long it waited and the function
+// freeing the slot, which the caller calls once the request is done. Within
+// the returned context, requests do not wait for another slot.
+func (q *RequestQueue) acquire(ctx context.Context, priority string) (context.Context, func(), time.Duration, error) {
+	if q == nil || q.limit <= 0 || ctx.Value(queueSlotContextKey{}) != nil {
+		return ctx, func() {}, 0, nil
+	}
+	ctx = context.WithValue(ctx, queueSlotContextKey{}, true)
+
+	q.mu.Lock()
+	if q.running < q.limit {
+		q.running++
+		q.mu.Unlock()
+		return ctx, q.release, 0, nil
+	}
+	level := priorityLevel(priority)
+	waiter := &queuedRequest{ready: make(chan struct{})}
+	q.waiting[level] = append(q.waiting[level], waiter)
+	q.mu.Unlock()
+
+	started := time.Now()
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-waiter.ready:
+		return ctx, q.release, time.Since(started), nil
+	case <-ctx.Done():
+		err = fmt.Errorf("Gave up waiting for a request slot: %v", context.Cause(ctx))
+	case <-timer.C:
+		err = fmt.Errorf("Waited %s for a request slot; %d requests are in flight", q.timeout, q.limit)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if waiter.granted {
+		// The slot came as we gave up; pass it on
+		q.next()
+		return ctx, nil, 0, err
+	}
+	for i, queued := range q.waiting[level] {
+		if queued == waiter {
+			q.waiting[level] = append(q.waiting[level][:i], q.waiting[level][i+1:]...)
+			break
+		}
+	}
+	return ctx, nil, 0, err
+}
+
+// release frees a slot for the next waiting request
+func (q *RequestQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.next()
+}
+
+// next hands a finished request's slot to the highest priority waiting
+// request, or frees it. Callers hold q.mu.
+func (q *RequestQueue) next() {
+	for level, waiters := range q.waiting {
+		if len(waiters) == 0 {
+			continue
+		}
+		waiter := waiters[0]
+		q.waiting[level] = waiters[1:]
+		waiter.granted = true
+		close(waiter.ready)
+		return
+	}
+	q.running--
+}
+
+// Stats returns the requests running and waiting
+func (q *RequestQueue) Stats() QueueStats {
+	stats := QueueStats{Waiting: make(map[string]int)}
+	for _, priority := range priorityLevels {
+		stats.Waiting[priority] = 0
+	}
+	if q == nil {
+		return stats
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats.MaxConcurrent = q.limit
+	stats.Running = q.running
+	for level, waiters := range q.waiting {
+		stats.Waiting[priorityLevels[level]] = len(waiters)
+	}
+	return stats
+}
@@ -0,0 +1,174 @@
+package slingshot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForWaiting waits until n requests wait in the queue
+func waitForWaiting(t *testing.T, q *RequestQueue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		waiting := 0
+		for _, count := range q.Stats().Waiting {
+			waiting += count
+		}
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests waiting, want %d", waiting, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRequestQueueOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []string // In arrival order
+		want       []string // In the order slots are granted
+	}{
+		{
+			name:       "highest priority first",
+			priorities: []string{PriorityBatch, PriorityNormal, PriorityInteractive},
+			want:       []string{PriorityInteractive, PriorityNormal, PriorityBatch},
+		},
+		{
+			name:       "arrival order within a priority",
+			priorities: []string{"normal-1", "normal-2", PriorityInteractive, "normal-3"},
+			want:       []string{PriorityInteractive, "normal-1", "normal-2", "normal-3"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := NewRequestQueue(1, time.Minute)
+			_, release, _, err := q.acquire(context.Background(), PriorityNormal)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			granted := make(chan string)
+			var finished sync.WaitGroup
+			for i, name := range test.priorities {
+				// Unknown priorities, such as normal-1, queue as normal
+				finished.Add(1)
+				go func() {
+					defer finished.Done()
+					_, done, _, err := q.acquire(context.Background(), name)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					granted <- name
+					<-granted
+					done()
+				}()
+				waitForWaiting(t, q, i+1)
+			}
+
+			release()
+			for _, want := range test.want {
+				if got := <-granted; got != want {
+					t.Fatalf("Slot granted to %s, want %s", got, want)
+				}
+				granted <- ""
+			}
+			finished.Wait()
+			if stats := q.Stats(); stats.Running != 0 {
+				t.Errorf("%d requests running after all finished", stats.Running)
+			}
+		})
+	}
+}
+
+func TestRequestQueueGivingUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+	}{
+		{name: "timeout", timeout: 10 * time.Millisecond},
+		{name: "cancelled", timeout: time.Minute, cancel: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := NewRequestQueue(1, test.timeout)
+			_, release, _, err := q.acquire(context.Background(), PriorityNormal)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if test.cancel {
+				cancel()
+			} else {
+				defer cancel()
+			}
+			if _, _, _, err := q.acquire(ctx, PriorityInteractive); err == nil {
+				t.Fatal("acquire() succeeded with the only slot taken")
+			}
+			if stats := q.Stats(); stats.Waiting[PriorityInteractive] != 0 {
+				t.Errorf("A request that gave up is still waiting")
+			}
+
+			// The slot is free again once released
+			release()
+			_, release, _, err = q.acquire(context.Background(), PriorityNormal)
+			if err != nil {
+				t.Fatalf("acquire() after release: %v", err)
+			}
+			release()
+			if stats := q.Stats(); stats.Running != 0 {
+				t.Errorf("%d requests running after all finished", stats.Running)
+			}
+		})
+	}
+}
+
+func TestRequestQueueUnlimited(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue *RequestQueue
+	}{
+		{name: "nil queue", queue: nil},
+		{name: "no limit", queue: NewRequestQueue(0, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				_, release, waited, err := test.queue.acquire(context.Background(), PriorityBatch)
+				if err != nil || waited != 0 {
+					t.Fatalf("acquire() = %s, %v, want no wait", waited, err)
+				}
+				defer release()
+			}
+			if stats := test.queue.Stats(); stats.Running != 0 || stats.MaxConcurrent != 0 {
+				t.Errorf("Stats() = %+v, want nothing tracked", stats)
+			}
+		})
+	}
+}
+
+func TestRequestQueueNestedRequests(t *testing.T) {
+	q := NewRequestQueue(1, 10*time.Millisecond)
+	ctx, release, _, err := q.acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Requests sent while holding a slot, such as an introspection query,
+	// need no slot of their own
+	_, nestedRelease, _, err := q.acquire(ctx, PriorityNormal)
+	if err != nil {
+		t.Fatalf("Nested acquire() error = %v", err)
+	}
+	nestedRelease()
+	if stats := q.Stats(); stats.Running != 1 {
+		t.Errorf("%d requests running, want 1", stats.Running)
+	}
+}
@@ -0,0 +1,132 @@
+package slingshot
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentRange is a parsed Content-Range response header
+type ContentRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Total int64 `json:"total"` // -1 when the server did not say
+}
+
+// byteRange is a single range of a Range request header. A suffix range
+// ("bytes=-500") has start -1; an open range ("bytes=500-") has end -1.
+type byteRange struct {
+	start, end int64
+}
+
+// parseRangeHeader parses a single-range Range header value such as
+// "bytes=0-1023", "bytes=1024-" or "bytes=-512"
+func parseRangeHeader(value string) (*byteRange, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(value), "bytes=")
+	if !ok {
+		return nil, fmt.Errorf("Invalid range %q: only byte ranges (bytes=start-end) are supported", value)
+	}
+	if strings.Contains(spec, ",") {
+		return nil, fmt.Errorf("Invalid range %q: only a single range is supported", value)
+	}
+
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok || (first == "" && last == "") {
+		return nil, fmt.Errorf("Invalid range %q", value)
+	}
+
+	r := &byteRange{start: -1, end: -1}
+	var err error
+	if first != "" {
+		if r.start, err = strconv.ParseInt(first, 10, 64); err != nil || r.start < 0 {
+			return nil, fmt.Errorf("Invalid range %q", value)
+		}
+	}
+	if last != "" {
+		if r.end, err = strconv.ParseInt(last, 10, 64); err != nil || r.end < 0 {
+			return nil, fmt.Errorf("Invalid range %q", value)
+		}
+	}
+	if first != "" && last != "" && r.end < r.start {
+		return nil, fmt.Errorf("Invalid range %q: end is before start", value)
+	}
+	return r, nil
+}
+
+// parseContentRange parses a Content-Range header such as "bytes 0-499/1234"
+// or "bytes 0-499/*"
+func parseContentRange(value string) (*ContentRange, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !ok {
+		return nil, fmt.Errorf("Content-Range %q is not a byte range", value)
+	}
+	span, total, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("Invalid Content-Range %q", value)
+	}
+	first, last, ok := strings.Cut(span, "-")
+	if !ok {
+		return nil, fmt.Errorf("Invalid Content-Range %q", value)
+	}
+
+	cr := &ContentRange{Total: -1}
+	var err error
+	if cr.Start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return nil, fmt.Errorf("Invalid Content-Range %q", value)
+	}
+	if cr.End, err = strconv.ParseInt(last, 10, 64); err != nil || cr.End < cr.Start {
+		return nil, fmt.Errorf("Invalid Content-Range %q", value)
+	}
+	if total != "*" {
+		if cr.Total, err = strconv.ParseInt(total, 10, 64); err != nil || cr.Total <= cr.End {
+			return nil, fmt.Errorf("Invalid Content-Range %q", value)
+		}
+	}
+	return cr, nil
+}
+
+// validatePartialResponse checks that a 206 response covers the requested
+// range and that its body has the length Content-Range announces
+func validatePartialResponse(requested *byteRange, cr *ContentRange, bodyLength int64) error {
+	switch {
+	case requested.start >= 0 && cr.Start != requested.start:
+		return fmt.Errorf("Server returned bytes %d-%d but the range started at %d", cr.Start, cr.End, requested.start)
+	case requested.start >= 0 && requested.end >= 0 && cr.End > requested.end:
+		return fmt.Errorf("Server returned bytes %d-%d, past the end of the requested range at %d", cr.Start, cr.End, requested.end)
+	case requested.start < 0 && cr.End-cr.Start+1 > requested.end:
+		return fmt.Errorf("Server returned %d bytes for a suffix range of %d", cr.End-cr.Start+1, requested.end)
+	case requested.start < 0 && cr.Total >= 0 && cr.End != cr.Total-1:
+		return fmt.Errorf("Server returned bytes %d-%d, not the last bytes of %d", cr.Start, cr.End, cr.Total)
+	case bodyLength >= 0 && bodyLength != cr.End-cr.Start+1:
+		return fmt.Errorf("Content-Range announces %d bytes but the body has %d", cr.End-cr.Start+1, bodyLength)
+	}
+	return nil
+}
+
+// reportRange records how the server answered a Range request: whether it
+// supports ranges, and whether its 206 matches what was asked for. A 200
+// means the server ignored the range and sent the whole body.
+func reportRange(resp *http.Response, requested *byteRange, bodyLength int64, response *ProxyResponse) {
+	response.AcceptRanges = resp.Header.Get("Accept-Ranges")
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		cr, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			response.RangeError = err.Error()
+			return
+		}
+		response.ContentRange = cr
+		if err := validatePartialResponse(requested, cr, bodyLength); err != nil {
+			response.RangeError = err.Error()
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		response.RangeError = "Server reports the range is not satisfiable"
+		if total, ok := strings.CutPrefix(resp.Header.Get("Content-Range"), "bytes */"); ok {
+			response.RangeError += fmt.Sprintf(" (resource is %s bytes)", total)
+		}
+	case http.StatusOK:
+		response.RangeIgnored = true
+	}
+}
@@ -0,0 +1,256 @@
+package slingshot
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// headerField is a single request header exactly as the caller wrote it
+type headerField struct {
+	Name  string
+	Value string
+}
+
+// parseHeaderFields parses the header array keeping the original order and casing
+func parseHeaderFields(headerArray []string) []headerField {
+	var fields []headerField
+
+	for _, headerStr := range headerArray {
+		// Parse "Key: Value" format
+		parts := strings.SplitN(headerStr, ":", 2)
+		if len(parts) == 2 {
+			name := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
+			if name != "" && value != "" {
+				fields = append(fields, headerField{Name: name, Value: value})
+			}
+		}
+	}
+
+	return fields
+}
+
+// orderedHeaderTransport is an HTTP/1.x round tripper that writes the caller's
+// headers verbatim and in order instead of canonicalizing and sorting them.
+// Each request uses its own connection, which is closed with the response body.
+type orderedHeaderTransport struct {
+	fields      []headerField
+	overrides   map[string]bool
+	proto       string      // Request line protocol; HTTP/1.1 when empty
+	tlsConfig   *tls.Config // The request's TLS options, if any
+	fingerprint string      // Browser whose TLS handshake to send, if any
+	dialer      net.Dialer
+}
+
+// RoundTrip sends the request over a fresh connection
+func (t *orderedHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := t.dial(req.Context(), req)
+	if err != nil {
+		closeBody(req.Body)
+		return nil, err
+	}
+	if trace := httptrace.ContextClientTrace(req.Context()); trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn})
+	}
+
+	// Abort the exchange if the request context ends
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-req.Context().Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	if err := t.writeRequest(conn, req); err != nil {
+		close(stop)
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		close(stop)
+		conn.Close()
+		return nil, err
+	}
+
+	resp.TLS = connTLSState(conn)
+	resp.Body = &connClosingBody{ReadCloser: resp.Body, conn: conn, stop: stop}
+	return resp, nil
+}
+
+// dial opens a TCP (and for https, TLS) connection to the request host
+func (t *orderedHeaderTransport) dial(ctx context.Context, req *http.Request) (net.Conn, error) {
+	host := req.URL.Hostname()
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	conn, err := t.dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL.Scheme != "https" {
+		return conn, nil
+	}
+
+	config := t.tlsConfig.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if t.fingerprint != "" {
+		tlsConn, err := fingerprintHandshake(ctx, conn, config, t.fingerprint)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	// HTTP/1.0 requests leave the protocol to the server's default
+	if len(config.NextProtos) == 0 && t.proto != "HTTP/1.0" {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// writeRequest writes the request line, headers and body to the connection
+func (t *orderedHeaderTransport) writeRequest(conn net.Conn, req *http.Request) error {
+	proto := t.proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "%s %s %s\r\n", req.Method, req.URL.RequestURI(), proto)
+
+	// Report the header fields to client traces, as the standard transport does
+	trace := httptrace.ContextClientTrace(req.Context())
+	writeField := func(name, value string) {
+		fmt.Fprintf(w, "%s: %s\r\n", name, value)
+		if trace != nil && trace.WroteHeaderField != nil {
+			trace.WroteHeaderField(name, []string{value})
+		}
+	}
+
+	written := make(map[string]bool)
+
+	if req.Header.Get("Host") == "" {
+		host := req.Host
+		if host == "" {
+			host = req.URL.Host
+		}
+		writeField("Host", host)
+	}
+
+	// The caller's headers, verbatim. Headers removed from the request (hop-by-hop
+	// headers, or Authorization on a cross-host redirect) are skipped, as are body
+	// framing headers unless the caller overrides them.
+	for _, field := range t.fields {
+		canonical := http.CanonicalHeaderKey(field.Name)
+		if (canonical == "Content-Length" || canonical == "Transfer-Encoding") && !t.overrides[canonical] {
+			continue
+		}
+		if len(req.Header.Values(canonical)) == 0 {
+			continue
+		}
+		writeField(field.Name, field.Value)
+		written[canonical] = true
+	}
+
+	// Headers added by the proxy itself (User-Agent, Content-Type, ...),
+	// sorted as Go's transport writes them
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if written[key] || key == "Content-Length" || key == "Transfer-Encoding" {
+			continue
+		}
+		for _, value := range req.Header[key] {
+			writeField(key, value)
+		}
+	}
+
+	chunked := req.Body != nil && req.Body != http.NoBody && req.ContentLength < 0
+	if !written["Content-Length"] && !written["Transfer-Encoding"] {
+		if chunked {
+			writeField("Transfer-Encoding", "chunked")
+		} else if req.ContentLength > 0 {
+			writeField("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+		}
+	}
+	// HTTP/1.0 connections close after the response unless kept alive
+	if !written["Connection"] && proto != "HTTP/1.0" {
+		writeField("Connection", "close")
+	}
+	w.WriteString("\r\n")
+	if trace != nil && trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		defer req.Body.Close()
+
+		var bodyWriter io.Writer = w
+		var chunkedWriter io.WriteCloser
+		if chunked {
+			chunkedWriter = httputil.NewChunkedWriter(w)
+			bodyWriter = chunkedWriter
+		}
+
+		if _, err := io.Copy(bodyWriter, req.Body); err != nil {
+			return err
+		}
+		if chunkedWriter != nil {
+			chunkedWriter.Close()
+			w.WriteString("\r\n")
+		}
+	}
+
+	return w.Flush()
+}
+
+// connClosingBody closes the underlying connection along with the response body
+type connClosingBody struct {
+	io.ReadCloser
+	conn net.Conn
+	stop chan struct{}
+	once sync.Once
+}
+
+func (b *connClosingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		close(b.stop)
+		b.conn.Close()
+	})
+	return err
+}
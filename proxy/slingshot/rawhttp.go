@@ -0,0 +1,297 @@
+package slingshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultRawMaxBytes is how much of the raw response is read by default
+	DefaultRawMaxBytes = 1 << 20
+
+	// MaxRawMaxBytes is the most of a raw response that may be read
+	MaxRawMaxBytes = 10 << 20
+)
+
+// RawRequest is the JSON body of /proxy/raw
+type RawRequest struct {
+	Address    string `json:"address"`              // host:port
+	Request    string `json:"request"`              // HTTP/1.x bytes to send, in the given encoding
+	Encoding   string `json:"encoding,omitempty"`   // "text" (default), "base64" or "hex"
+	CRLF       bool   `json:"crlf,omitempty"`       // Send the line endings of a text request as \r\n
+	Timeout    int    `json:"timeout,omitempty"`    // Seconds for the whole exchange
+	MaxBytes   int    `json:"maxBytes,omitempty"`   // Stop reading after this many bytes
+	TLS        bool   `json:"tls,omitempty"`        // Connect with TLS
+	ServerName string `json:"serverName,omitempty"` // TLS server name, defaults to the host
+}
+
+// RawResponse is returned by /proxy/raw
+type RawResponse struct {
+	Success      bool   `json:"success"`
+	RequestID    string `json:"request_id,omitempty"`
+	Address      string `json:"address"`
+	RemoteAddr   string `json:"remote_addr,omitempty"`
+	BytesSent    int    `json:"bytes_sent"`
+	ResponseData string `json:"response_data"` // The bytes received, exactly
+	IsBinary     bool   `json:"is_binary,omitempty"`
+	ResponseSize string `json:"response_size"`
+	ConnectTime  string `json:"connect_time"`
+	ResponseTime string `json:"response_time"`
+
+	// The responses found in the bytes received, interim ones included, and
+	// why the rest could not be parsed
+	Responses  []RawResponseHead `json:"responses"`
+	ParseError string            `json:"parse_error,omitempty"`
+
+	// Why reading stopped before a response to every request arrived: the
+	// deadline passed, the server closed the connection, or maxBytes were read
+	TimedOut  bool `json:"timed_out,omitempty"`
+	Closed    bool `json:"closed,omitempty"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// RawResponseHead is one response parsed from the bytes received
+type RawResponseHead struct {
+	Status   int      `json:"status"`
+	Proto    string   `json:"proto"`
+	Headers  []string `json:"headers"`   // "Name: value", sorted by name
+	BodySize int64    `json:"body_size"` // Decoded from chunked framing
+}
+
+// errRawTruncated ends reading once maxBytes were received
+var errRawTruncated = errors.New("maxBytes received")
+
+// cappedBuffer keeps the bytes written to it, failing once max are kept
+type cappedBuffer struct {
+	bytes.Buffer
+	max  int
+	full bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:room])
+		b.full = true
+		return room, errRawTruncated
+	}
+	return b.Buffer.Write(p)
+}
+
+// rawRequestMethods returns the methods of the requests in payload, up to the
+// first that does not parse, so that as many responses can be read. Bodies
+// are skipped as their framing says.
+func rawRequestMethods(payload []byte) []string {
+	var methods []string
+	reader := bufio.NewReader(bytes.NewReader(payload))
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return methods
+		}
+		_, err = io.Copy(io.Discard, req.Body)
+		methods = append(methods, req.Method)
+		if err != nil {
+			return methods
+		}
+	}
+}
+
+// sendRawHTTP writes payload to a new connection and reads responses until
+// one has arrived for each request in payload, the server closes the
+// connection or switches protocols, the deadline passes or maxBytes are read
+func sendRawHTTP(ctx context.Context, req *RawRequest, payload []byte) (*RawResponse, error) {
+	maxBytes := req.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultRawMaxBytes
+	}
+	if maxBytes > MaxRawMaxBytes {
+		maxBytes = MaxRawMaxBytes
+	}
+	methods := rawRequestMethods(payload)
+
+	start := time.Now()
+	conn, err := dialSocket(ctx, "tcp", req.Address, req.TLS, req.ServerName)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	connected := time.Now()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	response := &RawResponse{
+		Success:     true,
+		Address:     req.Address,
+		RemoteAddr:  conn.RemoteAddr().String(),
+		ConnectTime: formatMillis(connected.Sub(start)),
+		Responses:   []RawResponseHead{},
+	}
+
+	n, err := conn.Write(payload)
+	response.BytesSent = n
+	if err != nil {
+		return nil, fmt.Errorf("Failed to send request: %v", err)
+	}
+
+	// Bytes that are not a request still get the server's error response
+	expected := max(len(methods), 1)
+	received := &cappedBuffer{max: maxBytes}
+	reader := bufio.NewReader(io.TeeReader(conn, received))
+	for answered := 0; answered < expected; {
+		method := http.MethodGet
+		if answered < len(methods) {
+			method = methods[answered]
+		}
+		// Wait for the next response to start, so that a connection closed
+		// between responses is told apart from one closed within
+		if _, err := reader.Peek(1); err != nil {
+			response.stoppedBy(err, received.full, true)
+			break
+		}
+		resp, err := http.ReadResponse(reader, &http.Request{Method: method})
+		if err != nil {
+			response.stoppedBy(err, received.full, false)
+			break
+		}
+		size, err := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		response.Responses = append(response.Responses, rawResponseHead(resp, size))
+		if err != nil {
+			response.stoppedBy(err, received.full, false)
+			break
+		}
+
+		if resp.StatusCode == http.StatusSwitchingProtocols || resp.Close {
+			break
+		}
+		// Interim responses precede the response to the same request
+		if resp.StatusCode >= 200 {
+			answered++
+		}
+	}
+
+	reply := received.Bytes()
+	response.ResponseTime = formatMillis(time.Since(start))
+	response.ResponseSize = formatSize(int64(len(reply)))
+	if utf8.Valid(reply) {
+		response.ResponseData = string(reply)
+	} else {
+		response.ResponseData = base64.StdEncoding.EncodeToString(reply)
+		response.IsBinary = true
+	}
+	return response, nil
+}
+
+// stoppedBy records why reading ended early. truncated is set once maxBytes
+// were received, and between when no part of the next response had arrived.
+func (r *RawResponse) stoppedBy(err error, truncated, between bool) {
+	var netErr net.Error
+	switch {
+	case truncated:
+		r.Truncated = true
+	case errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		r.TimedOut = true
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		r.Closed = true
+		if !between {
+			r.ParseError = "The connection closed in the middle of a response"
+		}
+	default:
+		r.ParseError = err.Error()
+	}
+}
+
+// rawResponseHead describes a parsed response with a body of size bytes
+func rawResponseHead(resp *http.Response, size int64) RawResponseHead {
+	headers := []string{}
+	for name, values := range resp.Header {
+		for _, value := range values {
+			headers = append(headers, name+": "+value)
+		}
+	}
+	// Go takes Transfer-Encoding out of the header map while parsing
+	if len(resp.TransferEncoding) > 0 {
+		headers = append(headers, "Transfer-Encoding: "+strings.Join(resp.TransferEncoding, ", "))
+	}
+	sort.Strings(headers)
+	return RawResponseHead{Status: resp.StatusCode, Proto: resp.Proto, Headers: headers, BodySize: size}
+}
+
+// handleRawRequest handles /proxy/raw, sending caller-written HTTP bytes
+func (s *ProxyServer) handleRawRequest(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req RawRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if _, port, err := net.SplitHostPort(req.Address); err != nil || port == "" {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Address", "Address must be host:port")
+		return
+	}
+	if err := checkTargetHost(r.Context(), req.Address); err != nil {
+		s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+	payload, err := decodeSocketPayload(req.Request, req.Encoding)
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Request", err.Error())
+		return
+	}
+	if len(payload) == 0 {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Request", "Request is required")
+		return
+	}
+	if req.CRLF && (req.Encoding == "" || strings.EqualFold(req.Encoding, "text")) {
+		payload = bytes.ReplaceAll(bytes.ReplaceAll(payload, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSocketTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	s.logger.Printf("[%s] RAW %s (%d bytes)", requestID(w), req.Address, len(payload))
+
+	response, err := sendRawHTTP(ctx, &req, payload)
+	if err != nil {
+		s.logger.Printf("[%s] Raw request failed: %v", requestID(w), err)
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			s.writeErrorResponse(w, TimeoutError.Type, TimeoutError.Title, fmt.Sprintf("No connection within %d seconds", timeout))
+		default:
+			errType := networkErrorType(err)
+			s.writeErrorResponse(w, errType.Type, errType.Title, err.Error())
+		}
+		return
+	}
+
+	response.RequestID = requestID(w)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package slingshot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MaxRedirects is the maximum number of redirects followed for one request
+const MaxRedirects = 10
+
+// Redirect method handling modes
+const (
+	RedirectMethodRewrite  = "rewrite"  // Browser behavior: 301/302 turn POST into GET, 303 always GET
+	RedirectMethodPreserve = "preserve" // Keep method and body on 301/302; only 303 switches to GET
+)
+
+// Policies for credentials on cross-origin redirects
+const (
+	RedirectCredentialsStrip      = "strip"      // Drop credentials whenever the origin changes (default)
+	RedirectCredentialsSubdomains = "subdomains" // Keep them for the same domain and its subdomains
+	RedirectCredentialsForward    = "forward"    // Always forward them
+)
+
+// RedirectHop records a redirect that was followed
+type RedirectHop struct {
+	Status  int    `json:"status"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Method  string `json:"method"`            // Method used for the next request
+	Rewrite string `json:"rewrite,omitempty"` // e.g. "POST -> GET" when the method changed
+
+	// What happened to Authorization/Cookie and header profile headers,
+	// when any were sent
+	Credentials     string   `json:"credentials,omitempty"` // "forwarded" or "stripped"
+	StrippedHeaders []string `json:"stripped_headers,omitempty"`
+}
+
+// redirectPolicy controls how redirects are followed for one request
+type redirectPolicy struct {
+	follow      bool
+	methodMode  string
+	credentials string
+}
+
+// newRedirectPolicy builds the redirect policy from a ProxyRequest
+func newRedirectPolicy(req *ProxyRequest) (*redirectPolicy, error) {
+	policy := &redirectPolicy{
+		follow:      true, // default
+		methodMode:  RedirectMethodRewrite,
+		credentials: RedirectCredentialsStrip,
+	}
+
+	if req.FollowRedirects != nil {
+		policy.follow = *req.FollowRedirects
+	}
+
+	switch req.RedirectMethod {
+	case "", RedirectMethodRewrite:
+	case RedirectMethodPreserve:
+		policy.methodMode = RedirectMethodPreserve
+	default:
+		return nil, fmt.Errorf("Unknown redirectMethod %q (expected rewrite or preserve)", req.RedirectMethod)
+	}
+
+	switch req.RedirectCredentials {
+	case "":
+	case RedirectCredentialsStrip, RedirectCredentialsSubdomains, RedirectCredentialsForward:
+		policy.credentials = req.RedirectCredentials
+	default:
+		return nil, fmt.Errorf("Unknown redirectCredentials %q (expected strip, subdomains or forward)", req.RedirectCredentials)
+	}
+
+	return policy, nil
+}
+
+// keepCredentials reports whether credentials may follow a redirect from the
+// initial URL to dest
+func (p *redirectPolicy) keepCredentials(initial, dest *url.URL) bool {
+	switch p.credentials {
+	case RedirectCredentialsForward:
+		return true
+	case RedirectCredentialsSubdomains:
+		return sameDomainOrSubdomain(initial.Hostname(), dest.Hostname())
+	default:
+		return sameOrigin(initial, dest)
+	}
+}
+
+// isRedirectStatus reports whether the status code is a followable redirect
+func isRedirectStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectMethod returns the method to use after a redirect and whether the
+// request body should be dropped
+func (p *redirectPolicy) redirectMethod(statusCode int, method string) (string, bool) {
+	switch statusCode {
+	case http.StatusSeeOther:
+		if method == http.MethodHead {
+			return method, true
+		}
+		return http.MethodGet, true
+	case http.StatusMovedPermanently, http.StatusFound:
+		if p.methodMode == RedirectMethodRewrite && method == http.MethodPost {
+			return http.MethodGet, true
+		}
+	}
+
+	// 307/308, and 301/302 in preserve mode, keep the method and body
+	return method, false
+}
+
+// redirectBodyError reports a redirect that would have to send a request body
+// again when the body was streamed and can't be read twice
+type redirectBodyError struct {
+	status   int
+	location string
+}
+
+func (e *redirectBodyError) Error() string {
+	return fmt.Sprintf("Server returned %d redirect to %s, but the request body was streamed (a file or multipart upload) and cannot be sent again.", e.status, e.location)
+}
+
+// followRedirects sends the request, following redirects according to the
+// policy. It returns the final response and the hops that were followed.
+func (c *HTTPClient) followRedirects(client *http.Client, req *http.Request, policy *redirectPolicy) (*http.Response, []RedirectHop, error) {
+	var hops []RedirectHop
+	initial := req
+
+	for {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, hops, err
+		}
+
+		location := resp.Header.Get("Location")
+		if !policy.follow || !isRedirectStatus(resp.StatusCode) || location == "" {
+			return resp, hops, nil
+		}
+
+		if len(hops) >= MaxRedirects {
+			resp.Body.Close()
+			return nil, hops, fmt.Errorf("stopped after %d redirects", MaxRedirects)
+		}
+
+		nextURL, err := req.URL.Parse(location)
+		if err != nil {
+			resp.Body.Close()
+			return nil, hops, fmt.Errorf("failed to parse redirect location %q: %v", location, err)
+		}
+
+		if err := checkTargetURL(req.Context(), nextURL.String()); err != nil {
+			resp.Body.Close()
+			return nil, hops, fmt.Errorf("refusing redirect: %v", err)
+		}
+
+		method, dropBody := policy.redirectMethod(resp.StatusCode, req.Method)
+
+		// Bodies that can't be replayed (e.g. streamed uploads) stop here
+		hasBody := req.Body != nil && req.Body != http.NoBody
+		if !dropBody && hasBody && req.GetBody == nil {
+			resp.Body.Close()
+			return nil, hops, &redirectBodyError{status: resp.StatusCode, location: nextURL.String()}
+		}
+
+		next, err := http.NewRequestWithContext(req.Context(), method, nextURL.String(), nil)
+		if err != nil {
+			resp.Body.Close()
+			return nil, hops, err
+		}
+
+		next.Header = req.Header.Clone()
+		if dropBody {
+			next.Header.Del("Content-Type")
+			next.Header.Del("Content-Length")
+		} else if hasBody {
+			body, err := req.GetBody()
+			if err != nil {
+				resp.Body.Close()
+				return nil, hops, err
+			}
+			next.Body = body
+			next.GetBody = req.GetBody
+			next.ContentLength = req.ContentLength
+			next.TransferEncoding = req.TransferEncoding
+		}
+
+		// Only keep an overridden Host header on the original host
+		if next.URL.Host != initial.URL.Host {
+			next.Header.Del("Host")
+		} else {
+			next.Host = req.Host
+		}
+
+		// Apply the credentials policy and record the decision
+		var credentials string
+		var stripped []string
+		for _, name := range sensitiveRedirectHeaders {
+			if next.Header.Get(name) == "" {
+				continue
+			}
+			if policy.keepCredentials(initial.URL, next.URL) {
+				credentials = "forwarded"
+				continue
+			}
+			next.Header.Del(name)
+			credentials = "stripped"
+			stripped = append(stripped, name)
+		}
+
+		// Header profile headers only go to the profile's hosts
+		if profile := headerProfileFromContext(req.Context()); profile != nil && !profile.Hosts.Matches(next.URL.Hostname()) {
+			for _, name := range profile.headerNames() {
+				if next.Header.Get(name) != "" {
+					next.Header.Del(name)
+					credentials = "stripped"
+					stripped = append(stripped, name)
+				}
+			}
+		}
+
+		// Point Referer at the previous hop unless the caller set one
+		if initial.Header.Get("Referer") == "" {
+			next.Header.Del("Referer")
+			if referer := redirectReferer(req.URL, next.URL); referer != "" {
+				next.Header.Set("Referer", referer)
+			}
+		}
+
+		hop := RedirectHop{
+			Status: resp.StatusCode,
+			From:   req.URL.String(),
+			To:     next.URL.String(),
+			Method: method,
+
+			Credentials:     credentials,
+			StrippedHeaders: stripped,
+		}
+		if method != req.Method {
+			hop.Rewrite = req.Method + " -> " + method
+		}
+		hops = append(hops, hop)
+
+		// Drain the redirect body so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		req = next
+	}
+}
+
+// sensitiveRedirectHeaders are removed when a redirect leaves the original domain
+var sensitiveRedirectHeaders = []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"}
+
+// sameDomainOrSubdomain reports whether dest is the initial host or one of its subdomains
+func sameDomainOrSubdomain(initial, dest string) bool {
+	initial = strings.ToLower(initial)
+	dest = strings.ToLower(dest)
+	return dest == initial || strings.HasSuffix(dest, "."+initial)
+}
+
+// sameOrigin reports whether two URLs share scheme, host and port
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		effectivePort(a) == effectivePort(b)
+}
+
+// effectivePort returns the URL port, defaulting by scheme
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// redirectReferer returns the Referer to send when redirecting from one URL to
+// another, without userinfo and never from https to http
+func redirectReferer(from, to *url.URL) string {
+	if from.Scheme == "https" && to.Scheme == "http" {
+		return ""
+	}
+
+	referer := *from
+	referer.User = nil
+	referer.Fragment = ""
+	return referer.String()
+}
@@ -0,0 +1,382 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys of the history: the entry IDs scored by time, and hashes of the
+// entries and of their bodies by ID, next to the bytes of bodies held.
+// Artifacts are kept in a hash by ID with their IDs scored by when they were
+// stored, and each session's holder under its own key.
+const (
+	redisHistoryKey       = "slingshot:history:index"
+	redisHistoryEntries   = "slingshot:history:entries"
+	redisHistoryBodies    = "slingshot:history:bodies"
+	redisHistoryBodyBytes = "slingshot:history:body-bytes"
+	redisArtifactsKey     = "slingshot:artifacts"
+	redisArtifactsStored  = "slingshot:artifacts:stored"
+	redisSessionKeyPrefix = "slingshot:session:"
+	redisCommandTimeout   = 10 * time.Second
+	redisConnectTimeout   = 5 * time.Second
+)
+
+// redisTrimHistory drops the oldest entries beyond the limit in ARGV[1],
+// with their bodies, on the server
+var redisTrimHistory = redis.NewScript(`
+local excess = redis.call('ZCARD', KEYS[1]) - tonumber(ARGV[1])
+if excess <= 0 then
+	return 0
+end
+local dropped = redis.call('ZRANGE', KEYS[1], 0, excess - 1)
+for _, id in ipairs(dropped) do
+	redis.call('DECRBY', KEYS[4], redis.call('HSTRLEN', KEYS[3], id))
+end
+redis.call('ZREMRANGEBYRANK', KEYS[1], 0, excess - 1)
+redis.call('HDEL', KEYS[2], unpack(dropped))
+redis.call('HDEL', KEYS[3], unpack(dropped))
+return excess
+`)
+
+// redisClaimSession sets a session's holder unless one is set, returning
+// the holder set
+var redisClaimSession = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX') then
+	return ARGV[1]
+end
+return redis.call('GET', KEYS[1])
+`)
+
+// redisReleaseSession deletes a session's holder if it is still ARGV[1]
+var redisReleaseSession = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// openRedis connects to the server a redis:// or rediss:// URL names
+func openRedis(parsed *url.URL) (*redis.Client, error) {
+	options, err := redis.ParseURL(parsed.String())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Redis URL: %v", err)
+	}
+	if options.Password == "" && options.Username != "" {
+		// redis://secret@host uses the user part as the password
+		options.Username, options.Password = "", options.Username
+	}
+	if options.DialTimeout == 0 {
+		options.DialTimeout = redisConnectTimeout
+	}
+
+	client := redis.NewClient(options)
+	ctx, cancel := redisContext()
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Failed to connect to Redis at %s: %v", options.Addr, err)
+	}
+	return client, nil
+}
+
+// redisContext bounds one exchange with Redis
+func redisContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), redisCommandTimeout)
+}
+
+// redisScore orders history entries by time in Redis
+func redisScore(t time.Time) float64 {
+	return float64(t.UnixMicro())
+}
+
+// redisScoreRange returns the bounds of a range of times for the sorted set
+// commands, open where the times are zero
+func redisScoreRange(from, to time.Time) (string, string) {
+	min, max := "-inf", "+inf"
+	if !from.IsZero() {
+		min = strconv.FormatInt(from.UnixMicro(), 10)
+	}
+	if !to.IsZero() {
+		max = strconv.FormatInt(to.UnixMicro(), 10)
+	}
+	return min, max
+}
+
+// redisStorage keeps the history in Redis, where several proxies can share it
+type redisStorage struct {
+	client *redis.Client
+}
+
+// openRedisStorage connects to the server a redis:// or rediss:// URL names
+func openRedisStorage(parsed *url.URL) (*Storage, error) {
+	client, err := openRedis(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{
+		History:   &redisStorage{client: client},
+		Artifacts: &redisArtifacts{client: client},
+		Sessions:  &redisSessions{client: client},
+		Shared:    true,
+		close:     client.Close,
+	}, nil
+}
+
+// Add stores the entry and trims the history in one transaction
+func (r *redisStorage) Add(entry *HistoryEntry) error {
+	record, err := json.Marshal(newStoredEntry(entry))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := redisContext()
+	defer cancel()
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, redisHistoryKey, redis.Z{Score: redisScore(entry.Time), Member: entry.ID})
+		pipe.HSet(ctx, redisHistoryEntries, entry.ID, record)
+		if len(entry.body) > 0 {
+			pipe.HSet(ctx, redisHistoryBodies, entry.ID, entry.body)
+			pipe.IncrBy(ctx, redisHistoryBodyBytes, int64(len(entry.body)))
+		}
+		redisTrimHistory.Eval(ctx, pipe, []string{redisHistoryKey, redisHistoryEntries, redisHistoryBodies, redisHistoryBodyBytes}, MaxHistoryEntries)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to store history entry: %v", err)
+	}
+	return nil
+}
+
+func (r *redisStorage) Get(id string) (*HistoryEntry, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	var record, body *redis.StringCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		record = pipe.HGet(ctx, redisHistoryEntries, id)
+		body = pipe.HGet(ctx, redisHistoryBodies, id)
+		return nil
+	})
+	if errors.Is(record.Err(), redis.Nil) {
+		return nil, nil
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("Failed to read history entry: %v", err)
+	}
+
+	var stored storedEntry
+	if err := json.Unmarshal([]byte(record.Val()), &stored); err != nil {
+		return nil, fmt.Errorf("Failed to parse history entry %s: %v", id, err)
+	}
+	var data []byte
+	if body.Err() == nil {
+		data = []byte(body.Val())
+	}
+	return stored.withBody(data), nil
+}
+
+// List reads the IDs of the page from the sorted set, then only the records
+// of those entries
+func (r *redisStorage) List(page HistoryRange) ([]*HistoryEntry, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	min, max := redisScoreRange(page.From, page.To)
+	count := int64(page.Limit)
+	if count <= 0 {
+		count = -1
+	}
+	ids, err := r.client.ZRevRangeByScore(ctx, redisHistoryKey, &redis.ZRangeBy{
+		Min: min, Max: max, Offset: int64(page.Offset), Count: count,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read history: %v", err)
+	}
+	if len(ids) == 0 {
+		return []*HistoryEntry{}, nil
+	}
+
+	records, err := r.client.HMGet(ctx, redisHistoryEntries, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read history: %v", err)
+	}
+	entries := make([]*HistoryEntry, 0, len(records))
+	for _, record := range records {
+		record, ok := record.(string)
+		if !ok {
+			// Trimmed since the IDs were read
+			continue
+		}
+		var stored storedEntry
+		if err := json.Unmarshal([]byte(record), &stored); err != nil {
+			continue
+		}
+		entries = append(entries, stored.withBody(nil))
+	}
+	return entries, nil
+}
+
+func (r *redisStorage) Count(from, to time.Time) (int, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	min, max := redisScoreRange(from, to)
+	count, err := r.client.ZCount(ctx, redisHistoryKey, min, max).Result()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read history: %v", err)
+	}
+	return int(count), nil
+}
+
+func (r *redisStorage) Stats() (int, int64, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	var entries *redis.IntCmd
+	var bodyBytes *redis.StringCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		entries = pipe.ZCard(ctx, redisHistoryKey)
+		bodyBytes = pipe.Get(ctx, redisHistoryBodyBytes)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, fmt.Errorf("Failed to read history: %v", err)
+	}
+	size, _ := bodyBytes.Int64()
+	return int(entries.Val()), size, nil
+}
+
+// redisArtifacts keeps artifact metadata in Redis
+type redisArtifacts struct {
+	client *redis.Client
+}
+
+func (r *redisArtifacts) Put(artifact *Artifact) error {
+	record, err := json.Marshal(artifact)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := redisContext()
+	defer cancel()
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisArtifactsKey, artifact.ID, record)
+		pipe.ZAdd(ctx, redisArtifactsStored, redis.Z{Score: redisScore(artifact.StoredAt), Member: artifact.ID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to store artifact: %v", err)
+	}
+	return nil
+}
+
+func (r *redisArtifacts) Get(id string) (*Artifact, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	record, err := r.client.HGet(ctx, redisArtifactsKey, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read artifact: %v", err)
+	}
+	var artifact Artifact
+	if err := json.Unmarshal([]byte(record), &artifact); err != nil {
+		return nil, fmt.Errorf("Failed to parse artifact %s: %v", id, err)
+	}
+	return &artifact, nil
+}
+
+func (r *redisArtifacts) Remove(id string) (bool, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	var removed *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.HDel(ctx, redisArtifactsKey, id)
+		pipe.ZRem(ctx, redisArtifactsStored, id)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed to remove artifact: %v", err)
+	}
+	return removed.Val() > 0, nil
+}
+
+func (r *redisArtifacts) Expired(before time.Time) ([]*Artifact, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	ids, err := r.client.ZRangeByScore(ctx, redisArtifactsStored, &redis.ZRangeBy{
+		Min: "-inf", Max: "(" + strconv.FormatInt(before.UnixMicro(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read artifacts: %v", err)
+	}
+	if len(ids) == 0 {
+		return []*Artifact{}, nil
+	}
+
+	records, err := r.client.HMGet(ctx, redisArtifactsKey, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read artifacts: %v", err)
+	}
+	artifacts := make([]*Artifact, 0, len(records))
+	for i, record := range records {
+		record, ok := record.(string)
+		if !ok {
+			// Only the score is left, as after a failed removal
+			artifacts = append(artifacts, &Artifact{ID: ids[i]})
+			continue
+		}
+		var artifact Artifact
+		if err := json.Unmarshal([]byte(record), &artifact); err != nil {
+			continue
+		}
+		artifacts = append(artifacts, &artifact)
+	}
+	return artifacts, nil
+}
+
+// redisSessions records session holders in Redis
+type redisSessions struct {
+	client *redis.Client
+}
+
+func (r *redisSessions) Claim(kind, id, holder string) (string, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	current, err := redisClaimSession.Run(ctx, r.client, []string{redisSessionKeyPrefix + kind + ":" + id}, holder).Text()
+	if err != nil {
+		return "", fmt.Errorf("Failed to claim session %s: %v", id, err)
+	}
+	return current, nil
+}
+
+func (r *redisSessions) Holder(kind, id string) (string, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	holder, err := r.client.Get(ctx, redisSessionKeyPrefix+kind+":"+id).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to look up session %s: %v", id, err)
+	}
+	return holder, nil
+}
+
+func (r *redisSessions) Release(kind, id, holder string) error {
+	ctx, cancel := redisContext()
+	defer cancel()
+	err := redisReleaseSession.Run(ctx, r.client, []string{redisSessionKeyPrefix + kind + ":" + id}, holder).Err()
+	if err != nil {
+		return fmt.Errorf("Failed to release session %s: %v", id, err)
+	}
+	return nil
+}
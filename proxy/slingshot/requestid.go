@@ -0,0 +1,40 @@
+package slingshot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader carries the correlation ID of each proxied request back to the caller
+const RequestIDHeader = "X-Slingshot-Request-Id"
+
+// newRequestID returns a random 128-bit ID as hex
+func newRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// requestIDMiddleware assigns every request a correlation ID, returned in the
+// X-Slingshot-Request-Id response header
+func (s *ProxyServer) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RequestIDHeader, newRequestID())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestID returns the correlation ID assigned to the current request
+func requestID(w http.ResponseWriter) string {
+	return w.Header().Get(RequestIDHeader)
+}
+
+// forwardRequestID returns the header to send the correlation ID upstream
+// with, or nil when forwarding is not configured
+func (s *ProxyServer) forwardRequestID(w http.ResponseWriter) []string {
+	if s.config.RequestIDHeader == "" {
+		return nil
+	}
+	return []string{s.config.RequestIDHeader + ": " + requestID(w)}
+}
@@ -0,0 +1,65 @@
+package slingshot
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+)
+
+// RequestSent is the request as it went out, after path parameters,
+// variables, scripts, transforms, header profiles and plugins had their say.
+// After redirects, it is the last request of the chain.
+type RequestSent struct {
+	Method  string   `json:"method"`
+	URL     string   `json:"url"`
+	Headers []string `json:"headers"` // In the order they were written, including those the transport adds
+}
+
+// sentTrace records the header fields written for the last request sent
+type sentTrace struct {
+	mu      sync.Mutex
+	headers []string
+	done    bool
+}
+
+// withSentTrace returns a context whose requests record their header fields
+// in the returned trace
+func withSentTrace(ctx context.Context) (context.Context, *sentTrace) {
+	t := &sentTrace{}
+	trace := &httptrace.ClientTrace{
+		WroteHeaderField: func(key string, values []string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			// A retry or redirect starts over
+			if t.done {
+				t.headers, t.done = nil, false
+			}
+			for _, value := range values {
+				t.headers = append(t.headers, key+": "+value)
+			}
+		},
+		WroteHeaders: func() {
+			t.mu.Lock()
+			t.done = true
+			t.mu.Unlock()
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// annotate reports the request sent for req, taking the method and URL of
+// the last redirect when the response followed any. Requests that were never
+// sent, such as invalid or cached ones, are not reported.
+func (t *sentTrace) annotate(req *ProxyRequest, response *ProxyResponse) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.headers) == 0 {
+		return
+	}
+	sent := &RequestSent{Method: req.Method, URL: req.URL, Headers: t.headers}
+	if hops := response.RedirectChain; len(hops) > 0 {
+		sent.Method, sent.URL = hops[len(hops)-1].Method, hops[len(hops)-1].To
+	}
+	response.RequestSent = sent
+}
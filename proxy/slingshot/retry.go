@@ -0,0 +1,105 @@
+package slingshot
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// MaxRetries is the maximum number of retries allowed for one request
+const MaxRetries = 5
+
+// retryBackoff is the delay before the first retry; it doubles on each attempt
+const retryBackoff = 250 * time.Millisecond
+
+// validateRetries checks the retries option
+func validateRetries(req *ProxyRequest) error {
+	if req.Retries < 0 || req.Retries > MaxRetries {
+		return fmt.Errorf("retries must be between 0 and %d", MaxRetries)
+	}
+	return nil
+}
+
+// isRetryableStatus reports whether a response status is worth retrying
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// executeWithRetries sends the request, retrying connection failures and
+// 502/503/504 responses up to retries times with exponential backoff. A body
+// that can't be replayed is never resent. Returns the final outcome.
+func (c *HTTPClient) executeWithRetries(ctx context.Context, httpReq *http.Request, retries int, policy *redirectPolicy, transport http.RoundTripper, metrics *RequestMetrics) (*http.Response, []RedirectHop, error) {
+	hasBody := httpReq.Body != nil && httpReq.Body != http.NoBody
+	backoff := retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		metrics.Attempts = attempt
+
+		resp, hops, err := c.executeWithRedirects(ctx, httpReq, policy, transport, metrics)
+
+		retryable := (err != nil && !isRedirectError(err)) || (err == nil && isRetryableStatus(resp.StatusCode))
+		if attempt > retries || !retryable || ctx.Err() != nil || (hasBody && httpReq.GetBody == nil) {
+			return resp, hops, err
+		}
+
+		// Replay the request with a fresh copy of the body
+		next := httpReq.Clone(ctx)
+		if hasBody {
+			body, bodyErr := httpReq.GetBody()
+			if bodyErr != nil {
+				return resp, hops, err
+			}
+			next.Body = body
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, hops, ctx.Err()
+		}
+		backoff *= 2
+
+		httpReq = next
+	}
+}
+
+// isIdempotencyKeyMethod reports whether an Idempotency-Key is generated for the method
+func isIdempotencyKeyMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch
+}
+
+// ensureIdempotencyKey makes sure a POST/PATCH request carries an
+// Idempotency-Key header, generating one unless the caller set it, and
+// returns the key in use. The key is sent unchanged on every retry.
+func ensureIdempotencyKey(req *ProxyRequest) string {
+	for _, field := range parseHeaderFields(req.Headers) {
+		if http.CanonicalHeaderKey(field.Name) == "Idempotency-Key" {
+			return field.Value
+		}
+	}
+
+	key := newUUID()
+	req.Headers = append(req.Headers, "Idempotency-Key: "+key)
+	return key
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
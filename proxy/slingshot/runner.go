@@ -0,0 +1,555 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxRunnerLoops bounds how many times each request of a collection may run,
+// so scripts that jump with set_next_request cannot loop forever
+const maxRunnerLoops = 100
+
+// Collection is a named list of requests run by `proxy run`
+type Collection struct {
+	Name  string            `json:"name"`
+	Items []*CollectionItem `json:"items"`
+}
+
+// CollectionItem is a request, or a folder of further items when Items is set
+type CollectionItem struct {
+	Name  string            `json:"name"`
+	Items []*CollectionItem `json:"items,omitempty"`
+	*ProxyRequest
+}
+
+// runnerStep is a request of a collection with the folder it is in
+type runnerStep struct {
+	Name    string
+	Folder  string
+	Request *ProxyRequest
+}
+
+// runOptions control a collection run
+type runOptions struct {
+	Bail        bool
+	Iterations  int
+	Environment map[string]string
+	Data        []map[string]string // Values layered over the variables, one row per iteration
+}
+
+// RunResult is the outcome of one request of a collection run
+type RunResult struct {
+	Name         string            `json:"name"`
+	Folder       string            `json:"folder,omitempty"`
+	Iteration    int               `json:"iteration,omitempty"`
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	Passed       bool              `json:"passed"`
+	Status       int               `json:"status,omitempty"`
+	ResponseTime float64           `json:"response_time_ms"`
+	Failures     []string          `json:"failures,omitempty"`
+	Assertions   []AssertionResult `json:"assertions,omitempty"`
+	Tests        []ScriptTest      `json:"tests,omitempty"`
+}
+
+// RunSummary is the JSON report of a collection run
+type RunSummary struct {
+	Collection string       `json:"collection"`
+	Iterations int          `json:"iterations"`
+	StartedAt  time.Time    `json:"started_at"`
+	Duration   float64      `json:"duration_ms"`
+	Total      int          `json:"total"`
+	Passed     int          `json:"passed"`
+	Failed     int          `json:"failed"`
+	Results    []*RunResult `json:"results"`
+}
+
+// loadCollection reads a collection file
+func loadCollection(path string) (*Collection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read collection: %v", err)
+	}
+
+	var collection Collection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %v", path, err)
+	}
+	if collection.Name == "" {
+		collection.Name = strings.TrimSuffix(path, ".json")
+	}
+	return &collection, nil
+}
+
+// collectionSteps flattens the folders of a collection into its requests
+func collectionSteps(items []*CollectionItem, folder string) ([]*runnerStep, error) {
+	var steps []*runnerStep
+	for i, item := range items {
+		name := item.Name
+		if name == "" {
+			name = fmt.Sprintf("Request %d", i+1)
+		}
+
+		if item.Items != nil {
+			path := name
+			if folder != "" {
+				path = folder + "/" + name
+			}
+			nested, err := collectionSteps(item.Items, path)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, nested...)
+			continue
+		}
+
+		if item.ProxyRequest == nil || item.Method == "" || item.URL == "" {
+			return nil, fmt.Errorf("%s needs a method and url", name)
+		}
+		steps = append(steps, &runnerStep{Name: name, Folder: folder, Request: item.ProxyRequest})
+	}
+	return steps, nil
+}
+
+// filterSteps keeps the requests inside any of the named folders. A name
+// matches a folder at any depth, or a full folder path.
+func filterSteps(steps []*runnerStep, folders []string) []*runnerStep {
+	if len(folders) == 0 {
+		return steps
+	}
+
+	var kept []*runnerStep
+	for _, step := range steps {
+		path := strings.Split(step.Folder, "/")
+		for _, folder := range folders {
+			match := step.Folder == folder || strings.HasPrefix(step.Folder, folder+"/")
+			for _, name := range path {
+				match = match || name == folder
+			}
+			if match {
+				kept = append(kept, step)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// runStep executes one request with the current variables and judges its
+// outcome. Without assertions or tests, a request fails when it returns an
+// error status.
+func runStep(ctx context.Context, client *HTTPClient, step *runnerStep, vars map[string]string) (*RunResult, *ProxyResponse) {
+	req := *step.Request
+	req.Headers = append([]string(nil), req.Headers...)
+	req.Environment = vars
+
+	result := &RunResult{
+		Name:   step.Name,
+		Folder: step.Folder,
+		Method: req.Method,
+		URL:    expandVariables(req.URL, vars),
+	}
+
+	// Set default timeout if not provided
+	if req.Timeout == 0 {
+		req.Timeout = 60 // default 60 seconds
+	}
+
+	var response *ProxyResponse
+	if req.PathParams != nil {
+		substituted, err := client.substitutePathParams(req.URL, req.PathParams, req.PathParamEncoding)
+		if err != nil {
+			response = &ProxyResponse{Success: false, ErrorMessage: err.Error()}
+		} else {
+			req.URL = substituted
+		}
+	}
+
+	start := time.Now()
+	if response == nil {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(req.Timeout)*time.Second)
+		defer cancel()
+
+		var err error
+		response, err = client.ExecuteRequest(ctx, &req)
+		if err != nil {
+			response = &ProxyResponse{Success: false, ErrorMessage: err.Error()}
+		}
+	}
+	result.ResponseTime = float64(time.Since(start).Microseconds()) / 1000
+
+	result.Status = response.ResponseStatus
+	result.Assertions = response.Assertions
+	result.Tests = response.ScriptTests
+
+	if !response.Success {
+		result.Failures = append(result.Failures, response.ErrorMessage)
+	}
+	for _, assertion := range response.Assertions {
+		if !assertion.Passed {
+			result.Failures = append(result.Failures, assertion.Assertion.String()+": "+assertion.Message)
+		}
+	}
+	for _, test := range response.ScriptTests {
+		if !test.Passed {
+			result.Failures = append(result.Failures, test.Name+": "+test.Error)
+		}
+	}
+	if response.ScriptError != "" {
+		result.Failures = append(result.Failures, response.ScriptError)
+	}
+	if response.Success && len(response.Assertions) == 0 && len(response.ScriptTests) == 0 && response.ResponseStatus >= 400 {
+		result.Failures = append(result.Failures, fmt.Sprintf("status %d", response.ResponseStatus))
+	}
+	result.Passed = len(result.Failures) == 0
+
+	return result, response
+}
+
+// runCollection runs the requests in order, following set_next_request
+// jumps, and reports each result to out as it completes. Variables set by
+// post-response scripts carry over to later requests and iterations.
+func runCollection(client *HTTPClient, name string, steps []*runnerStep, options runOptions, out io.Writer) *RunSummary {
+	summary := &RunSummary{
+		Collection: name,
+		Iterations: options.Iterations,
+		StartedAt:  time.Now().UTC(),
+		Results:    []*RunResult{},
+	}
+
+	vars := make(map[string]string, len(options.Environment))
+	for key, value := range options.Environment {
+		vars[key] = value
+	}
+
+	index := make(map[string]int, len(steps))
+	for i, step := range steps {
+		if _, ok := index[step.Name]; !ok {
+			index[step.Name] = i
+		}
+	}
+
+iterations:
+	for iteration := 1; iteration <= options.Iterations; iteration++ {
+		if options.Iterations > 1 {
+			fmt.Fprintf(out, "Iteration %d\n", iteration)
+		}
+		if iteration <= len(options.Data) {
+			for key, value := range options.Data[iteration-1] {
+				vars[key] = value
+			}
+		}
+
+		runs := make([]int, len(steps))
+		for i := 0; i < len(steps); {
+			if runs[i]++; runs[i] > maxRunnerLoops {
+				fmt.Fprintf(out, "Stopping: %s ran %d times\n", steps[i].Name, maxRunnerLoops)
+				break iterations
+			}
+
+			result, response := runStep(context.Background(), client, steps[i], vars)
+			if options.Iterations > 1 {
+				result.Iteration = iteration
+			}
+			summary.Results = append(summary.Results, result)
+			printResult(out, result)
+
+			for key, value := range response.ScriptEnv {
+				vars[key] = value
+			}
+
+			if !result.Passed && options.Bail {
+				break iterations
+			}
+
+			next := i + 1
+			if response.ScriptNext != "" {
+				target, ok := index[response.ScriptNext]
+				if !ok {
+					fmt.Fprintf(out, "Stopping: no request named %q\n", response.ScriptNext)
+					break iterations
+				}
+				next = target
+			}
+			i = next
+		}
+	}
+
+	summary.Duration = float64(time.Since(summary.StartedAt).Microseconds()) / 1000
+	summary.Total = len(summary.Results)
+	for _, result := range summary.Results {
+		if result.Passed {
+			summary.Passed++
+		} else {
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+// printResult writes one line per request, followed by its failures
+func printResult(out io.Writer, result *RunResult) {
+	mark := "PASS"
+	if !result.Passed {
+		mark = "FAIL"
+	}
+	name := result.Name
+	if result.Folder != "" {
+		name = result.Folder + "/" + name
+	}
+	fmt.Fprintf(out, "%s  %s  %s %s", mark, name, result.Method, result.URL)
+	if result.Status != 0 {
+		fmt.Fprintf(out, " [%d, %.0f ms]", result.Status, result.ResponseTime)
+	}
+	fmt.Fprintln(out)
+	for _, failure := range result.Failures {
+		fmt.Fprintf(out, "      %s\n", failure)
+	}
+}
+
+// JUnit XML report types
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSeconds formats milliseconds as JUnit's seconds
+func junitSeconds(ms float64) string {
+	return fmt.Sprintf("%.3f", ms/1000)
+}
+
+// writeJUnitReport writes the summary as JUnit XML, one test suite per folder
+func writeJUnitReport(path string, summary *RunSummary) error {
+	report := junitTestSuites{
+		Name:     summary.Collection,
+		Tests:    summary.Total,
+		Failures: summary.Failed,
+		Time:     junitSeconds(summary.Duration),
+	}
+
+	suites := map[string]int{}
+	var suiteMillis []float64
+	for _, result := range summary.Results {
+		suiteName := summary.Collection
+		if result.Folder != "" {
+			suiteName += "/" + result.Folder
+		}
+		i, ok := suites[suiteName]
+		if !ok {
+			i = len(report.Suites)
+			suites[suiteName] = i
+			report.Suites = append(report.Suites, junitTestSuite{
+				Name:      suiteName,
+				Timestamp: summary.StartedAt.Format("2006-01-02T15:04:05"),
+			})
+			suiteMillis = append(suiteMillis, 0)
+		}
+		suiteMillis[i] += result.ResponseTime
+
+		suite := &report.Suites[i]
+		caseName := result.Name
+		if result.Iteration > 0 {
+			caseName = fmt.Sprintf("%s (iteration %d)", result.Name, result.Iteration)
+		}
+		testCase := junitTestCase{
+			Name:      caseName,
+			ClassName: suiteName,
+			Time:      junitSeconds(result.ResponseTime),
+		}
+		if !result.Passed {
+			testCase.Failure = &junitFailure{
+				Message: result.Failures[0],
+				Type:    "AssertionFailure",
+				Text:    strings.Join(result.Failures, "\n"),
+			}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	for i := range report.Suites {
+		report.Suites[i].Time = junitSeconds(suiteMillis[i])
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+// writeJSONReport writes the summary as JSON
+func writeJSONReport(path string, summary *RunSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// RunCommand implements `proxy run <collection>`. It returns the exit code:
+// 0 when every request passed, 1 when any failed and 2 on usage errors.
+func RunCommand(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	var (
+		junitPath  = fs.String("junit", "", "Write a JUnit XML report to this file")
+		jsonPath   = fs.String("json", "", "Write a JSON summary report to this file")
+		bail       = fs.Bool("bail", false, "Stop at the first failing request")
+		envFile    = fs.String("environment", "", "Environment file with variables for {{name}} placeholders")
+		iterations = fs.Int("iterations", 1, "Number of times to run the collection")
+		dataPath   = fs.String("data", "", "CSV or JSON dataset; the collection runs once per row")
+		envVars    stringList
+		folders    stringList
+		uploadDirs = fs.String("upload-dirs", "", "Comma-separated directories files may be uploaded from")
+		scriptDirs = fs.String("script-dirs", "", "Comma-separated directories scripts may be loaded from")
+		protoDirs  = fs.String("proto-dirs", "", "Comma-separated directories of .proto files for protobuf bodies")
+	)
+	fs.Var(&envVars, "env-var", "Set a variable as key=value, overriding the environment file (repeatable)")
+	fs.Var(&folders, "folder", "Only run the requests in this folder (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s run [options] <collection.json>\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *iterations < 1 {
+		fmt.Fprintln(os.Stderr, "-iterations must be at least 1")
+		return 2
+	}
+
+	var data []map[string]string
+	if *dataPath != "" {
+		iterationsSet := false
+		fs.Visit(func(f *flag.Flag) {
+			iterationsSet = iterationsSet || f.Name == "iterations"
+		})
+		if iterationsSet {
+			fmt.Fprintln(os.Stderr, "-iterations cannot be combined with -data")
+			return 2
+		}
+		rows, err := loadDataset(*dataPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		data = rows
+		*iterations = len(rows)
+	}
+
+	environment := map[string]string{}
+	if *envFile != "" {
+		loaded, err := loadEnvironment(*envFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		environment = loaded
+	}
+	for _, envVar := range envVars {
+		key, value, ok := strings.Cut(envVar, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Invalid -env-var %q, expected key=value\n", envVar)
+			return 2
+		}
+		environment[key] = value
+	}
+
+	collection, err := loadCollection(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	steps, err := collectionSteps(collection.Items, "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	steps = filterSteps(steps, folders)
+	if len(steps) == 0 {
+		fmt.Fprintln(os.Stderr, "No requests to run")
+		return 2
+	}
+
+	client := NewHTTPClient(&Config{
+		UploadDirs: SplitList(*uploadDirs),
+		ScriptDirs: SplitList(*scriptDirs),
+		ProtoDirs:  SplitList(*protoDirs),
+	})
+
+	fmt.Printf("Running %s (%d requests)\n\n", collection.Name, len(steps))
+	summary := runCollection(client, collection.Name, steps, runOptions{
+		Bail:        *bail,
+		Iterations:  *iterations,
+		Environment: environment,
+		Data:        data,
+	}, os.Stdout)
+	fmt.Printf("\n%d passed, %d failed, %.0f ms\n", summary.Passed, summary.Failed, summary.Duration)
+
+	if *junitPath != "" {
+		if err := writeJUnitReport(*junitPath, summary); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write JUnit report: %v\n", err)
+			return 2
+		}
+	}
+	if *jsonPath != "" {
+		if err := writeJSONReport(*jsonPath, summary); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write JSON report: %v\n", err)
+			return 2
+		}
+	}
+
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// stringList is a flag that may be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
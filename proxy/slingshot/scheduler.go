@@ -0,0 +1,501 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// notifyTimeout bounds failure notification requests
+const notifyTimeout = 10 * time.Second
+
+// Schedule is a stored request run on a cron schedule
+type Schedule struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name,omitempty"`
+	Cron      string       `json:"cron"`
+	Request   ProxyRequest `json:"request"`
+	NotifyURL string       `json:"notifyUrl,omitempty"` // POSTed to when a run fails
+	CreatedAt time.Time    `json:"created_at"`
+
+	// Run state
+	NextRun             time.Time     `json:"next_run"`
+	LastRun             *HistoryEntry `json:"last_run,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+
+	cron    *CronExpression
+	running bool
+}
+
+// ScheduleResponse is returned by the schedule endpoints
+type ScheduleResponse struct {
+	Success   bool            `json:"success"`
+	Schedule  *Schedule       `json:"schedule,omitempty"`
+	Schedules []*Schedule     `json:"schedules,omitempty"`
+	History   []*HistoryEntry `json:"history,omitempty"`
+}
+
+// ScheduleFailure is the payload sent to a schedule's notifyUrl
+type ScheduleFailure struct {
+	ScheduleID          string        `json:"schedule_id"`
+	Name                string        `json:"name,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	Run                 *HistoryEntry `json:"run"`
+}
+
+// isFailedRun reports whether a scheduled run counts as a failure
+func isFailedRun(entry *HistoryEntry) bool {
+	return !entry.Success || entry.Status >= 400
+}
+
+// Scheduler runs stored requests when their cron expressions fire
+type Scheduler struct {
+	mu        sync.Mutex
+	schedules map[string]*Schedule
+	file      string
+	wake      chan struct{}
+	run       func(*Schedule) *HistoryEntry
+	logger    *log.Logger
+
+	// notifier is told when a schedule has failed notifyAfter runs in a row
+	// and when it recovers
+	notifier    *Notifier
+	notifyAfter int
+
+	// deadLetters keeps failed runs so they can be retried
+	deadLetters *DeadLetterStore
+
+	// cluster, when set, runs each schedule on the one proxy holding it
+	cluster *Cluster
+}
+
+// NewScheduler creates a scheduler that executes runs with run and, when file
+// is set, keeps the schedules in that file across restarts
+func NewScheduler(file string, run func(*Schedule) *HistoryEntry, notifier *Notifier, notifyAfter int, logger *log.Logger) *Scheduler {
+	if notifyAfter < 1 {
+		notifyAfter = DefaultNotifyAfter
+	}
+
+	return &Scheduler{
+		schedules:   make(map[string]*Schedule),
+		file:        file,
+		wake:        make(chan struct{}, 1),
+		run:         run,
+		logger:      logger,
+		notifier:    notifier,
+		notifyAfter: notifyAfter,
+	}
+}
+
+// Start loads stored schedules and begins running them
+func (s *Scheduler) Start() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	go s.loop()
+	return nil
+}
+
+// Add validates and registers a schedule
+func (s *Scheduler) Add(schedule *Schedule) error {
+	if err := prepareSchedule(schedule, time.Now()); err != nil {
+		return err
+	}
+	schedule.ID = newRequestID()
+	schedule.CreatedAt = time.Now().UTC()
+
+	// Claim the schedule so requests about it reach this proxy
+	s.cluster.holds(clusterSchedule, schedule.ID)
+
+	s.mu.Lock()
+	s.schedules[schedule.ID] = schedule
+	s.mu.Unlock()
+
+	s.save()
+	s.notify()
+	return nil
+}
+
+// Remove deletes a schedule, reporting whether it existed
+func (s *Scheduler) Remove(id string) bool {
+	s.mu.Lock()
+	_, ok := s.schedules[id]
+	delete(s.schedules, id)
+	s.mu.Unlock()
+
+	if ok {
+		s.save()
+		s.cluster.release(clusterSchedule, id)
+	}
+	return ok
+}
+
+// Get returns a snapshot of a schedule
+func (s *Scheduler) Get(id string) *Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *schedule
+	return &snapshot
+}
+
+// List returns snapshots of all schedules, oldest first
+func (s *Scheduler) List() []*Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := make([]*Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		snapshot := *schedule
+		schedules = append(schedules, &snapshot)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	return schedules
+}
+
+// prepareSchedule validates a schedule and computes its first run
+func prepareSchedule(schedule *Schedule, now time.Time) error {
+	if schedule.Request.Method == "" {
+		return fmt.Errorf("HTTP method is required")
+	}
+	if schedule.Request.URL == "" {
+		return fmt.Errorf("URL is required")
+	}
+
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+
+	schedule.cron = cron
+	schedule.NextRun = cron.Next(now)
+	if schedule.NextRun.IsZero() {
+		return fmt.Errorf("Cron expression %q never fires", schedule.Cron)
+	}
+	return nil
+}
+
+// notify wakes the loop so it picks up a changed schedule
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop sleeps until the next schedule is due and starts its run
+func (s *Scheduler) loop() {
+	for {
+		wait := time.Hour
+		now := time.Now()
+
+		s.mu.Lock()
+		for _, schedule := range s.schedules {
+			if !schedule.NextRun.After(now) {
+				schedule.NextRun = schedule.cron.Next(now)
+				if schedule.NextRun.IsZero() {
+					// Nothing within a year; look again later
+					schedule.NextRun = now.Add(cronSearchLimit)
+				}
+
+				// Skip a run while the previous one is still going
+				if !schedule.running {
+					schedule.running = true
+					go s.execute(schedule)
+				}
+			}
+			if until := schedule.NextRun.Sub(now); until < wait {
+				wait = until
+			}
+		}
+		s.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// execute performs one run of a schedule and records its outcome. In a
+// cluster, only the proxy holding the schedule runs it.
+func (s *Scheduler) execute(schedule *Schedule) {
+	s.mu.Lock()
+	snapshot := *schedule
+	s.mu.Unlock()
+
+	if !s.cluster.holds(clusterSchedule, snapshot.ID) {
+		s.mu.Lock()
+		schedule.running = false
+		s.mu.Unlock()
+		return
+	}
+
+	entry := s.run(&snapshot)
+	if isFailedRun(entry) {
+		s.deadLetters.Record(&DeadLetter{
+			Source:     DeadLetterSchedule,
+			ScheduleID: snapshot.ID,
+			Name:       snapshot.Name,
+			Request:    snapshot.Request,
+		}, &DeadLetterAttempt{Reason: failureReason(entry), Run: entry})
+	} else {
+		s.deadLetters.Close(DeadLetterSchedule, snapshot.ID)
+	}
+
+	s.mu.Lock()
+	previousFailures := schedule.ConsecutiveFailures
+	schedule.running = false
+	schedule.LastRun = entry
+	if isFailedRun(entry) {
+		schedule.ConsecutiveFailures++
+	} else {
+		schedule.ConsecutiveFailures = 0
+	}
+	if n := scheduleNotification(schedule, previousFailures, s.notifyAfter); n != nil {
+		s.notifier.Notify(n)
+	}
+	failure := &ScheduleFailure{
+		ScheduleID:          schedule.ID,
+		Name:                schedule.Name,
+		ConsecutiveFailures: schedule.ConsecutiveFailures,
+		Run:                 entry,
+	}
+	s.mu.Unlock()
+
+	if isFailedRun(entry) && snapshot.NotifyURL != "" {
+		if err := postJSON(snapshot.NotifyURL, failure); err != nil {
+			s.logger.Printf("Schedule %s: failed to send notification: %v", snapshot.ID, err)
+		}
+	}
+}
+
+// postJSON sends v as a JSON POST request
+func postJSON(targetURL string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(targetURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s returned %s", targetURL, resp.Status)
+	}
+	return nil
+}
+
+// load reads the stored schedules, if a file is configured and exists
+func (s *Scheduler) load() error {
+	if s.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read schedules: %v", err)
+	}
+
+	var schedules []*Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return fmt.Errorf("Failed to parse %s: %v", s.file, err)
+	}
+
+	now := time.Now()
+	for _, schedule := range schedules {
+		if err := prepareSchedule(schedule, now); err != nil {
+			s.logger.Printf("Skipping schedule %s: %v", schedule.ID, err)
+			continue
+		}
+		s.schedules[schedule.ID] = schedule
+	}
+	return nil
+}
+
+// save writes the schedules to the configured file
+func (s *Scheduler) save() {
+	if s.file == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(s.List(), "", "  ")
+	if err != nil {
+		s.logger.Printf("Failed to encode schedules: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.file, data, 0600); err != nil {
+		s.logger.Printf("Failed to save schedules: %v", err)
+	}
+}
+
+// runSchedule executes one run of a scheduled request and adds it to the history
+func (s *ProxyServer) runSchedule(schedule *Schedule) *HistoryEntry {
+	req := schedule.Request
+	req.Headers = append([]string(nil), req.Headers...)
+
+	// Set default timeout if not provided
+	if req.Timeout == 0 {
+		req.Timeout = 60 // default 60 seconds
+	}
+
+	var response *ProxyResponse
+	if req.PathParams != nil {
+		substituted, err := s.httpClient.substitutePathParams(req.URL, req.PathParams, req.PathParamEncoding)
+		if err != nil {
+			response = &ProxyResponse{Success: false, ErrorType: "request_format_error", ErrorTitle: "Invalid Path Parameter", ErrorMessage: err.Error()}
+		} else {
+			req.URL = substituted
+		}
+	}
+
+	id := newRequestID()
+	if response == nil {
+		// Scheduled requests wait behind interactive ones unless they set a priority
+		ctx, cancel := context.WithTimeout(withDefaultPriority(context.Background(), PriorityBatch), time.Duration(req.Timeout)*time.Second)
+		defer cancel()
+
+		s.logger.Printf("[%s] %s %s (schedule %s)", id, req.Method, req.URL, schedule.ID)
+
+		var err error
+		response, err = s.httpClient.ExecuteRequest(ctx, &req)
+		if err != nil {
+			response = &ProxyResponse{Success: false, ErrorType: "unknown_error", ErrorTitle: "Request Failed", ErrorMessage: err.Error()}
+		}
+	}
+
+	entry := newHistoryEntry(id, HistorySourceSchedule, schedule.Request.Method, schedule.Request.URL, response)
+	entry.ScheduleID = schedule.ID
+	if err := s.history.Add(entry); err != nil {
+		s.logger.Printf("Failed to record history: %v", err)
+	}
+	return entry
+}
+
+// handleSchedules lists (GET) or registers (POST) scheduled requests
+func (s *ProxyServer) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := &ScheduleResponse{Success: true}
+	if r.Method == "POST" {
+		var schedule Schedule
+		if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+			return
+		}
+		if err := checkTargetURL(r.Context(), schedule.Request.URL); err != nil {
+			s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+			return
+		}
+		if err := s.scheduler.Add(&schedule); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Schedule", err.Error())
+			return
+		}
+		s.logger.Printf("Scheduled %s %s (%s)", schedule.Request.Method, schedule.Request.URL, schedule.Cron)
+		response.Schedule = s.scheduler.Get(schedule.ID)
+	} else {
+		schedules := s.scheduler.List()
+		s.cluster.gather(r, func(body io.Reader) error {
+			var peer ScheduleResponse
+			if err := json.NewDecoder(body).Decode(&peer); err != nil {
+				return err
+			}
+			schedules = append(schedules, peer.Schedules...)
+			return nil
+		})
+		response.Schedules = latestSchedules(schedules)
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleSchedule returns (GET) or deletes (DELETE) one scheduled request
+func (s *ProxyServer) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	schedule := s.scheduler.Get(id)
+	if schedule == nil {
+		s.writeErrorResponse(w, "not_found", "Schedule Not Found", fmt.Sprintf("No schedule with id %s", id))
+		return
+	}
+
+	response := &ScheduleResponse{Success: true, Schedule: schedule}
+	if r.Method == "DELETE" {
+		s.scheduler.Remove(id)
+		// Proxies sharing the schedules file forget it too
+		s.cluster.gather(r, func(io.Reader) error { return nil })
+	} else {
+		history, err := s.history.Recent(20, func(entry *HistoryEntry) bool {
+			return entry.ScheduleID == id
+		})
+		if err != nil {
+			s.logger.Printf("Failed to read history of schedule %s: %v", id, err)
+		}
+		response.History = history
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// latestSchedules keeps one copy of each schedule listed by several proxies,
+// which load it from a shared file: the copy of the proxy that ran it last
+func latestSchedules(schedules []*Schedule) []*Schedule {
+	latest := make(map[string]*Schedule, len(schedules))
+	for _, schedule := range schedules {
+		kept, ok := latest[schedule.ID]
+		if !ok || (schedule.LastRun != nil && (kept.LastRun == nil || schedule.LastRun.Time.After(kept.LastRun.Time))) {
+			latest[schedule.ID] = schedule
+		}
+	}
+
+	kept := make([]*Schedule, 0, len(latest))
+	for _, schedule := range latest {
+		kept = append(kept, schedule)
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].CreatedAt.Before(kept[j].CreatedAt)
+	})
+	return kept
+}
@@ -0,0 +1,507 @@
+package slingshot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// scriptTimeout bounds how long a script may run
+	scriptTimeout = 5 * time.Second
+
+	// maxScriptLogs is the number of print() lines kept per script
+	maxScriptLogs = 100
+)
+
+// Script languages
+const (
+	ScriptLua        = "lua"
+	ScriptJavaScript = "javascript"
+)
+
+// ScriptTest is the outcome of a pm.test() in a JavaScript script
+type ScriptTest struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// validateScriptLanguage checks the scriptLanguage of a request
+func validateScriptLanguage(language string) error {
+	switch language {
+	case "", ScriptLua, ScriptJavaScript:
+		return nil
+	}
+	return fmt.Errorf("Unknown script language %q (use lua or javascript)", language)
+}
+
+// runPreRequestScript runs a pre-request script in the request's language.
+// It returns the lines the script printed.
+func runPreRequestScript(ctx context.Context, req *ProxyRequest, script string) ([]string, error) {
+	if req.ScriptLanguage == ScriptJavaScript {
+		return runJSPreRequestScript(ctx, req, script)
+	}
+	return runLuaPreRequestScript(ctx, req, script)
+}
+
+// runPostResponseScript runs a post-response script in the request's
+// language and adds its outputs to the response
+func runPostResponseScript(ctx context.Context, req *ProxyRequest, response *ProxyResponse, durationMillis float64, script string) {
+	if req.ScriptLanguage == ScriptJavaScript {
+		runJSPostResponseScript(ctx, req, response, durationMillis, script)
+		return
+	}
+	runLuaPostResponseScript(ctx, req, response, durationMillis, script)
+}
+
+// loadScript returns the script of a request, reading it from a file in one
+// of the allowed script directories when it is given by path
+func loadScript(script, path string, allowedDirs []string) (string, error) {
+	if path == "" {
+		return script, nil
+	}
+	if script != "" {
+		return "", fmt.Errorf("Use either a script or a script file, not both")
+	}
+	if len(allowedDirs) == 0 {
+		return "", fmt.Errorf("Script files are disabled")
+	}
+
+	resolved, inside, err := resolveInDirs(path, allowedDirs)
+	if err != nil {
+		return "", err
+	}
+	if !inside {
+		return "", fmt.Errorf("Script %s is outside the allowed script directories", path)
+	}
+
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read script: %v", err)
+	}
+	return string(data), nil
+}
+
+// newScriptState creates a sandboxed Lua state with the base, table, string
+// and math libraries plus the crypto and encoding helpers. print() output is
+// appended to logs.
+func newScriptState(ctx context.Context, logs *[]string) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	// No access to the file system
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+
+	L.SetGlobal("print", L.NewFunction(func(L *lua.LState) int {
+		parts := make([]string, L.GetTop())
+		for i := range parts {
+			parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+		}
+		if len(*logs) < maxScriptLogs {
+			*logs = append(*logs, strings.Join(parts, "\t"))
+		}
+		return 0
+	}))
+
+	L.SetGlobal("crypto", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"hmac_sha1":   luaHMAC(sha1.New),
+		"hmac_sha256": luaHMAC(sha256.New),
+		"hmac_sha512": luaHMAC(sha512.New),
+		"md5":         luaHash(md5.New),
+		"sha1":        luaHash(sha1.New),
+		"sha256":      luaHash(sha256.New),
+		"sha512":      luaHash(sha512.New),
+	}))
+
+	L.SetGlobal("encoding", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"base64_encode": luaStringFunc(func(s string) (string, error) {
+			return base64.StdEncoding.EncodeToString([]byte(s)), nil
+		}),
+		"base64_decode": luaStringFunc(func(s string) (string, error) {
+			b, err := base64.StdEncoding.DecodeString(s)
+			return string(b), err
+		}),
+		"hex_encode": luaStringFunc(func(s string) (string, error) {
+			return hex.EncodeToString([]byte(s)), nil
+		}),
+		"hex_decode": luaStringFunc(func(s string) (string, error) {
+			b, err := hex.DecodeString(s)
+			return string(b), err
+		}),
+		"url_encode": luaStringFunc(func(s string) (string, error) {
+			return url.QueryEscape(s), nil
+		}),
+	}))
+
+	L.SetGlobal("json", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"decode": func(L *lua.LState) int {
+			var value interface{}
+			if err := json.Unmarshal([]byte(L.CheckString(1)), &value); err != nil {
+				L.RaiseError("Invalid JSON: %v", err)
+			}
+			L.Push(goToLua(L, value))
+			return 1
+		},
+		"encode": func(L *lua.LState) int {
+			encoded, err := json.Marshal(luaToGo(L.CheckAny(1)))
+			if err != nil {
+				L.RaiseError("Failed to encode JSON: %v", err)
+			}
+			L.Push(lua.LString(encoded))
+			return 1
+		},
+	}))
+
+	L.SetGlobal("uuid", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(newUUID()))
+		return 1
+	}))
+	L.SetGlobal("now", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LNumber(time.Now().Unix()))
+		return 1
+	}))
+	L.SetGlobal("now_ms", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LNumber(time.Now().UnixMilli()))
+		return 1
+	}))
+
+	L.SetContext(ctx)
+	return L
+}
+
+// luaHMAC returns a Lua function computing a hex HMAC of (key, data)
+func luaHMAC(h func() hash.Hash) lua.LGFunction {
+	return func(L *lua.LState) int {
+		mac := hmac.New(h, []byte(L.CheckString(1)))
+		mac.Write([]byte(L.CheckString(2)))
+		L.Push(lua.LString(hex.EncodeToString(mac.Sum(nil))))
+		return 1
+	}
+}
+
+// luaHash returns a Lua function computing a hex digest of its argument
+func luaHash(h func() hash.Hash) lua.LGFunction {
+	return func(L *lua.LState) int {
+		digest := h()
+		digest.Write([]byte(L.CheckString(1)))
+		L.Push(lua.LString(hex.EncodeToString(digest.Sum(nil))))
+		return 1
+	}
+}
+
+// luaStringFunc wraps a string conversion as a Lua function
+func luaStringFunc(fn func(string) (string, error)) lua.LGFunction {
+	return func(L *lua.LState) int {
+		result, err := fn(L.CheckString(1))
+		if err != nil {
+			L.RaiseError("%v", err)
+		}
+		L.Push(lua.LString(result))
+		return 1
+	}
+}
+
+// runLuaPreRequestScript runs a Lua script that may change the request's
+// method, URL, headers, body and env before it is sent. It returns the lines the
+// script printed.
+func runLuaPreRequestScript(ctx context.Context, req *ProxyRequest, script string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+
+	var logs []string
+	L := newScriptState(ctx, &logs)
+	defer L.Close()
+
+	request := L.NewTable()
+	request.RawSetString("method", lua.LString(req.Method))
+	request.RawSetString("url", lua.LString(req.URL))
+	request.RawSetString("body", lua.LString(req.Body))
+	headers := L.NewTable()
+	for _, header := range req.Headers {
+		headers.Append(lua.LString(header))
+	}
+	request.RawSetString("headers", headers)
+	setHeaderFuncs(L, request)
+	L.SetGlobal("request", request)
+	L.SetGlobal("env", newEnvTable(L, req.Environment))
+
+	if err := L.DoString(script); err != nil {
+		return logs, fmt.Errorf("Pre-request script failed: %s", scriptErrorMessage(err))
+	}
+	req.Environment = readEnvTable(L)
+
+	// Read back the request, which the script may have replaced entirely
+	request, ok := L.GetGlobal("request").(*lua.LTable)
+	if !ok {
+		return logs, fmt.Errorf("Pre-request script replaced request with a non-table value")
+	}
+	for _, field := range []struct {
+		name   string
+		target *string
+	}{
+		{"method", &req.Method},
+		{"url", &req.URL},
+		{"body", &req.Body},
+	} {
+		value, ok := request.RawGetString(field.name).(lua.LString)
+		if !ok {
+			return logs, fmt.Errorf("Pre-request script left request.%s that is not a string", field.name)
+		}
+		*field.target = string(value)
+	}
+
+	headers, ok = request.RawGetString("headers").(*lua.LTable)
+	if !ok {
+		return logs, fmt.Errorf("Pre-request script left request.headers that is not a table")
+	}
+	req.Headers = nil
+	for i := 1; i <= headers.Len(); i++ {
+		header, ok := headers.RawGetInt(i).(lua.LString)
+		if !ok {
+			return logs, fmt.Errorf("Pre-request script left header %d that is not a string", i)
+		}
+		req.Headers = append(req.Headers, string(header))
+	}
+
+	return logs, nil
+}
+
+// runLuaPostResponseScript runs a Lua script on a response. The script sees the
+// request as sent and the response, may replace the response body, stores
+// values in env and picks the next request of a chain with
+// set_next_request(name). Its outputs are added to the response. A failing
+// script does not fail the request; its error is reported in script_error.
+func runLuaPostResponseScript(ctx context.Context, req *ProxyRequest, response *ProxyResponse, durationMillis float64, script string) {
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+
+	L := newScriptState(ctx, &response.ScriptLogs)
+	defer L.Close()
+
+	request := L.NewTable()
+	request.RawSetString("method", lua.LString(req.Method))
+	request.RawSetString("url", lua.LString(req.URL))
+	request.RawSetString("body", lua.LString(req.Body))
+	requestHeaders := L.NewTable()
+	for _, header := range req.Headers {
+		requestHeaders.Append(lua.LString(header))
+	}
+	request.RawSetString("headers", requestHeaders)
+	L.SetGlobal("request", request)
+
+	responseTable := L.NewTable()
+	responseTable.RawSetString("status", lua.LNumber(response.ResponseStatus))
+	responseTable.RawSetString("body", lua.LString(response.ResponseData))
+	responseTable.RawSetString("time", lua.LNumber(durationMillis))
+	responseTable.RawSetString("content_type", lua.LString(response.ContentType))
+	responseTable.RawSetString("is_binary", lua.LBool(response.IsBinary))
+	responseHeaders := L.NewTable()
+	for name, value := range response.ResponseHeaders {
+		responseHeaders.RawSetString(name, lua.LString(value))
+	}
+	responseTable.RawSetString("headers", responseHeaders)
+	responseTable.RawSetString("json", L.NewFunction(func(L *lua.LState) int {
+		var value interface{}
+		if err := json.Unmarshal([]byte(response.ResponseData), &value); err != nil {
+			L.RaiseError("Response body is not JSON: %v", err)
+		}
+		L.Push(goToLua(L, value))
+		return 1
+	}))
+	L.SetGlobal("response", responseTable)
+
+	L.SetGlobal("env", newEnvTable(L, req.Environment))
+
+	var next string
+	L.SetGlobal("set_next_request", L.NewFunction(func(L *lua.LState) int {
+		next = L.OptString(1, "")
+		return 0
+	}))
+
+	if err := L.DoString(script); err != nil {
+		response.ScriptError = "Post-response script failed: " + scriptErrorMessage(err)
+		return
+	}
+
+	if body, ok := responseTable.RawGetString("body").(lua.LString); ok {
+		response.ResponseData = string(body)
+	}
+
+	response.ScriptEnv = readEnvTable(L)
+	response.ScriptNext = next
+}
+
+// newEnvTable creates the env table of a script from the request's environment
+func newEnvTable(L *lua.LState, vars map[string]string) *lua.LTable {
+	env := L.NewTable()
+	for key, value := range vars {
+		env.RawSetString(key, lua.LString(value))
+	}
+	return env
+}
+
+// readEnvTable returns the values a script left in env. Tables are returned
+// as JSON, other values as strings.
+func readEnvTable(L *lua.LState) map[string]string {
+	env, ok := L.GetGlobal("env").(*lua.LTable)
+	if !ok {
+		return nil
+	}
+
+	var vars map[string]string
+	env.ForEach(func(key, value lua.LValue) {
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+		if table, ok := value.(*lua.LTable); ok {
+			encoded, _ := json.Marshal(luaToGo(table))
+			vars[key.String()] = string(encoded)
+		} else {
+			vars[key.String()] = value.String()
+		}
+	})
+	return vars
+}
+
+// goToLua converts a decoded JSON value to a Lua value
+func goToLua(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		t := L.NewTable()
+		for _, item := range v {
+			t.Append(goToLua(L, item))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.NewTable()
+		for key, item := range v {
+			t.RawSetString(key, goToLua(L, item))
+		}
+		return t
+	}
+	return lua.LNil
+}
+
+// luaToGo converts a Lua value to one that encodes as JSON. Tables with only
+// the keys 1..n become arrays, other tables objects.
+func luaToGo(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		n := v.Len()
+		count := 0
+		v.ForEach(func(_, _ lua.LValue) { count++ })
+		if n > 0 && n == count {
+			items := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				items = append(items, luaToGo(v.RawGetInt(i)))
+			}
+			return items
+		}
+		object := make(map[string]interface{}, count)
+		v.ForEach(func(key, item lua.LValue) {
+			object[key.String()] = luaToGo(item)
+		})
+		return object
+	}
+	return nil
+}
+
+// setHeaderFuncs adds get_header, set_header and remove_header to a request
+// table, working on its "Name: value" headers array
+func setHeaderFuncs(L *lua.LState, t *lua.LTable) {
+	headerList := func() *lua.LTable {
+		headers, ok := t.RawGetString("headers").(*lua.LTable)
+		if !ok {
+			headers = L.NewTable()
+			t.RawSetString("headers", headers)
+		}
+		return headers
+	}
+	matches := func(header lua.LValue, name string) (string, bool) {
+		key, value, ok := strings.Cut(lua.LVAsString(header), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), name) {
+			return "", false
+		}
+		return strings.TrimSpace(value), true
+	}
+	remove := func(name string) {
+		headers := headerList()
+		kept := L.NewTable()
+		headers.ForEach(func(_, header lua.LValue) {
+			if _, ok := matches(header, name); !ok {
+				kept.Append(header)
+			}
+		})
+		t.RawSetString("headers", kept)
+	}
+
+	t.RawSetString("get_header", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		result := lua.LValue(lua.LNil)
+		headerList().ForEach(func(_, header lua.LValue) {
+			if value, ok := matches(header, name); ok && result == lua.LNil {
+				result = lua.LString(value)
+			}
+		})
+		L.Push(result)
+		return 1
+	}))
+	t.RawSetString("set_header", L.NewFunction(func(L *lua.LState) int {
+		name, value := L.CheckString(1), L.CheckString(2)
+		remove(name)
+		headerList().Append(lua.LString(name + ": " + value))
+		return 0
+	}))
+	t.RawSetString("remove_header", L.NewFunction(func(L *lua.LState) int {
+		remove(L.CheckString(1))
+		return 0
+	}))
+}
+
+// scriptErrorMessage returns a script error without the Lua stack traceback
+func scriptErrorMessage(err error) string {
+	if apiErr, ok := err.(*lua.ApiError); ok && apiErr.Object != nil {
+		return apiErr.Object.String()
+	}
+	return err.Error()
+}
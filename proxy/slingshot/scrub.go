@@ -0,0 +1,353 @@
+package slingshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultScrubReplacement replaces scrubbed values unless a rule sets its own
+const DefaultScrubReplacement = "[REDACTED]"
+
+// ScrubRule removes sensitive values from stored traffic. A rule either
+// replaces every match of a regular expression in URLs, error messages, header
+// values and text bodies, replaces the value at a path in JSON bodies, or
+// replaces the whole value of a header.
+type ScrubRule struct {
+	Name        string `json:"name,omitempty"`
+	Builtin     string `json:"builtin,omitempty"`     // Use one of the built-in rules
+	Pattern     string `json:"pattern,omitempty"`     // Regular expression; the replacement may use $1
+	Path        string `json:"path,omitempty"`        // Dot-separated JSON path; "*" matches any key or index
+	Header      string `json:"header,omitempty"`      // Header name, in any case
+	Replacement string `json:"replacement,omitempty"` // Defaults to DefaultScrubReplacement
+
+	re *regexp.Regexp
+}
+
+// builtinScrubRules are the rules -scrub and "builtin" may name
+var builtinScrubRules = map[string]ScrubRule{
+	"email": {
+		Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	},
+	"jwt": {
+		Pattern: `eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+	},
+	"bearer": {
+		Pattern:     `(?i)\b(bearer\s+)[A-Za-z0-9._~+/-]+=*`,
+		Replacement: "${1}" + DefaultScrubReplacement,
+	},
+	"secret-params": {
+		Pattern:     `(?i)([?&](?:access_token|token|api_key|apikey|key|password|secret|client_secret)=)[^&#\s"]+`,
+		Replacement: "${1}" + DefaultScrubReplacement,
+	},
+	"card": {
+		Pattern: `\b(?:\d[ -]?){12,18}\d\b`,
+	},
+}
+
+// builtinScrubRuleNames lists the built-in rules in order
+func builtinScrubRuleNames() []string {
+	names := make([]string, 0, len(builtinScrubRules))
+	for name := range builtinScrubRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Scrubber applies scrub rules to traffic before it is stored. A nil
+// Scrubber leaves everything as is.
+type Scrubber struct {
+	text    []*ScrubRule
+	json    []*ScrubRule
+	headers []*ScrubRule
+}
+
+// NewScrubber builds a scrubber from the named built-in rules and the rules
+// in file, returning nil when there are none
+func NewScrubber(builtins []string, file string) (*Scrubber, error) {
+	var rules []ScrubRule
+	for _, name := range builtins {
+		rules = append(rules, ScrubRule{Builtin: name})
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read scrub rules: %v", err)
+		}
+		var fileRules []ScrubRule
+		if err := json.Unmarshal(data, &fileRules); err != nil {
+			return nil, fmt.Errorf("Failed to parse scrub rules %s: %v", file, err)
+		}
+		rules = append(rules, fileRules...)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	scrubber := &Scrubber{}
+	for i := range rules {
+		rule, err := compileScrubRule(rules[i])
+		if err != nil {
+			return nil, fmt.Errorf("Scrub rule %d: %v", i+1, err)
+		}
+		switch {
+		case rule.re != nil:
+			scrubber.text = append(scrubber.text, rule)
+		case rule.Header != "":
+			scrubber.headers = append(scrubber.headers, rule)
+		default:
+			scrubber.json = append(scrubber.json, rule)
+		}
+	}
+	return scrubber, nil
+}
+
+// compileScrubRule resolves a built-in rule and compiles its pattern
+func compileScrubRule(rule ScrubRule) (*ScrubRule, error) {
+	if rule.Builtin != "" {
+		builtin, ok := builtinScrubRules[rule.Builtin]
+		if !ok {
+			return nil, fmt.Errorf("unknown built-in rule %q; use one of %s", rule.Builtin, strings.Join(builtinScrubRuleNames(), ", "))
+		}
+		builtin.Name = rule.Builtin
+		if rule.Replacement != "" {
+			builtin.Replacement = rule.Replacement
+		}
+		rule = builtin
+	}
+
+	set := 0
+	for _, field := range []string{rule.Pattern, rule.Path, rule.Header} {
+		if field != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("set exactly one of pattern, path and header")
+	}
+	if rule.Replacement == "" {
+		rule.Replacement = DefaultScrubReplacement
+	}
+	if rule.Pattern != "" {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %v", err)
+		}
+		rule.re = re
+	}
+	return &rule, nil
+}
+
+// String scrubs a URL, error message or other text
+func (s *Scrubber) String(text string) string {
+	if s == nil {
+		return text
+	}
+	for _, rule := range s.text {
+		text = rule.re.ReplaceAllString(text, rule.Replacement)
+	}
+	return text
+}
+
+// Headers scrubs header values in place, keyed by header name: header rules
+// replace whole values and pattern rules their matches
+func (s *Scrubber) Headers(headers map[string]string) {
+	if s == nil {
+		return
+	}
+	for name, value := range headers {
+		for _, rule := range s.headers {
+			if strings.EqualFold(name, rule.Header) {
+				value = rule.Replacement
+			}
+		}
+		headers[name] = s.String(value)
+	}
+}
+
+// Body scrubs a response body. Binary bodies are left alone; JSON path rules
+// only apply to bodies that parse as JSON.
+func (s *Scrubber) Body(body []byte, binary bool) []byte {
+	if s == nil || binary || len(body) == 0 {
+		return body
+	}
+
+	if len(s.json) > 0 {
+		body = s.scrubJSON(body)
+	}
+	return s.scrubText(body)
+}
+
+// scrubText replaces the pattern rules' matches
+func (s *Scrubber) scrubText(body []byte) []byte {
+	for _, rule := range s.text {
+		body = rule.re.ReplaceAll(body, []byte(rule.Replacement))
+	}
+	return body
+}
+
+// scrubJSON replaces the values at the JSON path rules' paths
+func (s *Scrubber) scrubJSON(body []byte) []byte {
+	scrubbed, _ := editJSON(body, func(document interface{}) bool {
+		replaced := false
+		for _, rule := range s.json {
+			if replaceJSONPath(document, jsonPathKeys(rule.Path), rule.Replacement, false) {
+				replaced = true
+			}
+		}
+		return replaced
+	})
+	return scrubbed
+}
+
+// editJSON decodes a JSON body, lets edit change it and re-encodes it when
+// edit reports a change. Bodies that are not JSON are returned as is.
+func editJSON(body []byte, edit func(document interface{}) bool) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return body, false
+	}
+	if !edit(document) {
+		return body, false
+	}
+
+	edited, err := json.Marshal(document)
+	if err != nil {
+		return body, false
+	}
+	return edited, true
+}
+
+// jsonPathKeys splits a dot-separated JSON path, which may start with "$."
+func jsonPathKeys(path string) []string {
+	return strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "$"), "."), ".")
+}
+
+// replaceJSONPath replaces the values at keys below node, reporting whether
+// any were found. With create, a missing last key is added to objects.
+func replaceJSONPath(node interface{}, keys []string, value interface{}, create bool) bool {
+	key, last := keys[0], len(keys) == 1
+	replaced := false
+
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if _, exists := node[key]; last && create && key != "*" && !exists {
+			node[key] = value
+			return true
+		}
+		for name, child := range node {
+			if key != "*" && key != name {
+				continue
+			}
+			if last {
+				node[name] = value
+				replaced = true
+			} else if replaceJSONPath(child, keys[1:], value, create) {
+				replaced = true
+			}
+		}
+	case []interface{}:
+		for i, child := range node {
+			if key != "*" && key != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				node[i] = value
+				replaced = true
+			} else if replaceJSONPath(child, keys[1:], value, create) {
+				replaced = true
+			}
+		}
+	}
+	return replaced
+}
+
+// MaxScrubJSONSize is the largest stored file that is scrubbed as a whole,
+// including by JSON path rules, as the document is decoded in memory
+const MaxScrubJSONSize = 32 << 20
+
+// File scrubs a stored file in place, such as a finished download, as Body
+// scrubs a response body. Files larger than MaxScrubJSONSize are scrubbed a
+// line at a time: pattern rules still apply, but not across lines, and JSON
+// path rules do not.
+func (s *Scrubber) File(name string) error {
+	if s == nil {
+		return nil
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() <= MaxScrubJSONSize {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		scrubbed := s.Body(data, isBinaryBody(data))
+		if bytes.Equal(scrubbed, data) {
+			return nil
+		}
+		return writeFileAtomic(name, scrubbed)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Decide from the start of the file, without a rune cut in half
+	reader := bufio.NewReaderSize(file, 64<<10)
+	head, _ := reader.Peek(64 << 10)
+	for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	if isBinaryBody(head) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, err := writer.Write(s.scrubText(line)); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			tmp.Close()
+			return readErr
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
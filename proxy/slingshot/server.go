@@ -0,0 +1,756 @@
+package slingshot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ProxyServer handles HTTP proxy requests
+type ProxyServer struct {
+	port         int
+	config       *Config
+	httpClient   *HTTPClient
+	hooks        *HookStore
+	storage      *Storage
+	history      *History
+	apiKeys      *APIKeyStore
+	active       *ActiveRequests
+	scrubber     *Scrubber
+	artifacts    *ArtifactStore
+	downloads    *DownloadStore
+	deadLetters  *DeadLetterStore
+	jobs         *JobStore
+	scheduler    *Scheduler
+	monitors     *MonitorStore
+	sockets      *WebSocketStore
+	eventSources *EventSourceStore
+	cluster      *Cluster
+	router       *mux.Router
+	openAPI      openAPISpec
+	server       *http.Server
+	grpcServer   *http.Server
+	tail         *Tail
+	logger       *log.Logger
+	started      time.Time
+
+	// tunnelConnections counts the connections held open to the tunnel relay
+	tunnelConnections atomic.Int32
+
+	// draining holds when lame-duck mode started, nil while serving normally
+	draining atomic.Pointer[time.Time]
+}
+
+// NewProxyServer creates a new proxy server instance
+func NewProxyServer(config *Config) (*ProxyServer, error) {
+	scrubber, err := NewScrubber(config.Scrub, config.ScrubRulesFile)
+	if err != nil {
+		return nil, err
+	}
+	tail := NewTail(scrubber)
+	logger := log.New(io.MultiWriter(log.Writer(), tail), "[PROXY] ", log.LstdFlags)
+	var cluster *Cluster
+	storageURL := config.Storage
+	if config.ClusterURL != "" {
+		if cluster, err = NewCluster(config.ClusterURL, config.ClusterAdvertise, logger); err != nil {
+			return nil, err
+		}
+		if storageURL == "" {
+			storageURL = config.ClusterURL
+		}
+	}
+	storage, err := OpenStorage(storageURL)
+	if err != nil {
+		return nil, err
+	}
+	// Sessions are claimed in the cluster's Redis unless the storage is
+	// shared by the proxies too
+	if cluster != nil && storage.Shared {
+		cluster.sessions = storage.Sessions
+	}
+	publishers, err := NewPublishers(config.Publish, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ProxyServer{
+		port:        config.Port,
+		config:      config,
+		httpClient:  NewHTTPClient(config),
+		hooks:       NewHookStore(),
+		storage:     storage,
+		history:     NewHistory(storage.History, scrubber),
+		scrubber:    scrubber,
+		downloads:   NewDownloadStore(),
+		deadLetters: NewDeadLetterStore(),
+		jobs:        NewJobStore(),
+		sockets:     NewWebSocketStore(),
+		active:      NewActiveRequests(),
+		cluster:     cluster,
+		started:     time.Now(),
+		tail:        tail,
+		logger:      logger,
+	}
+	s.apiKeys = NewAPIKeyStore(config.APIKeysFile, s.logger)
+	s.apiKeys.cluster = cluster
+	s.hooks.cluster = cluster
+	s.deadLetters.cluster = cluster
+	s.history.publishers = publishers
+	s.history.tail = tail
+	s.artifacts = NewArtifactStore(config.ArtifactsDir, config.ArtifactRetention, storage.Artifacts, s.logger)
+	if config.ArtifactS3 != "" {
+		if s.artifacts.objects, err = openObjectStorage(config.ArtifactS3); err != nil {
+			return nil, err
+		}
+		s.artifacts.objectThreshold = config.ArtifactS3Threshold
+		s.artifacts.urlExpiry = config.ArtifactURLExpiry
+	} else if storage.Shared {
+		s.logger.Printf("Artifacts are listed in the shared storage but kept in %s; mount it on every proxy or use -artifact-s3", s.artifacts.dir)
+	}
+	if s.httpClient.geoIP, err = OpenGeoIP(config.GeoIP); err != nil {
+		return nil, err
+	}
+	s.eventSources = NewEventSourceStore(s.httpClient.client.Transport)
+	if err := s.httpClient.protos.Load(); err != nil {
+		return nil, err
+	}
+	if err := s.httpClient.transforms.Load(); err != nil {
+		return nil, err
+	}
+	if err := s.httpClient.headerProfiles.Load(); err != nil {
+		return nil, err
+	}
+	if err := s.httpClient.plugins.Load(); err != nil {
+		return nil, err
+	}
+	notifier := NewNotifier(config, s.logger)
+	s.scheduler = NewScheduler(config.SchedulesFile, s.runSchedule, notifier, config.NotifyAfter, s.logger)
+	s.scheduler.deadLetters = s.deadLetters
+	s.scheduler.cluster = cluster
+	s.monitors = NewMonitorStore(config.MonitorsFile, s.checkMonitor, notifier, s.logger)
+	s.monitors.cluster = cluster
+	s.router = s.routes()
+	s.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.port),
+		Handler: s.router,
+	}
+	if config.GRPCPort != 0 {
+		service, err := newGRPCService(s)
+		if err != nil {
+			return nil, err
+		}
+		// gRPC runs on HTTP/2, which clients speak from the start without TLS
+		protocols := new(http.Protocols)
+		protocols.SetUnencryptedHTTP2(true)
+		s.grpcServer = &http.Server{
+			Addr:      fmt.Sprintf(":%d", config.GRPCPort),
+			Handler:   service,
+			Protocols: protocols,
+		}
+	}
+
+	return s, nil
+}
+
+// Handler returns the proxy's endpoints, for mounting them in another HTTP
+// server. Call Serve or Start as well to run schedules, monitors and the
+// tunnel.
+func (s *ProxyServer) Handler() http.Handler {
+	return s.router
+}
+
+// routes registers the proxy's endpoints and middleware
+func (s *ProxyServer) routes() *mux.Router {
+	router := mux.NewRouter()
+
+	// CORS middleware
+	router.Use(s.corsMiddleware)
+
+	// Correlation ID middleware
+	router.Use(s.requestIDMiddleware)
+
+	// Real status code middleware
+	router.Use(s.realStatusMiddleware)
+
+	// Response compression middleware
+	router.Use(s.compressionMiddleware)
+
+	// Request logging middleware
+	router.Use(s.loggingMiddleware)
+
+	// Lame-duck middleware
+	router.Use(s.drainMiddleware)
+
+	// Cluster forwarding middleware
+	router.Use(s.clusterMiddleware)
+
+	// API key middleware
+	router.Use(s.apiKeyMiddleware)
+
+	// Active request tracking middleware
+	router.Use(s.activeRequestMiddleware)
+
+	// API endpoints
+	router.HandleFunc("/proxy/request", s.handleJSONRequest).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/form", s.handleFormRequest).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/validate", s.handleValidateRequest).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/corscheck", s.handleCORSCheck).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/stream", s.handleStreamRequest).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/proxy/data", s.handleDataRun).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/tcp", s.handleTCPProbe).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/udp", s.handleUDPProbe).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/raw", s.handleRawRequest).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/smtp", s.handleSMTPSend).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/history", s.handleHistory).Methods("GET", "OPTIONS")
+	router.HandleFunc("/proxy/history/tail", s.handleHistoryTail).Methods("GET", "OPTIONS")
+	router.HandleFunc("/proxy/history/{id}/body", s.handleHistoryBody).Methods("GET", "OPTIONS")
+	router.HandleFunc("/proxy/history/{id}/search", s.handleHistorySearch).Methods("GET", "OPTIONS")
+	router.HandleFunc("/proxy/artifacts/{id}", s.handleArtifact).Methods("GET", "HEAD", "DELETE", "OPTIONS")
+	router.HandleFunc("/proxy/downloads", s.handleDownloads).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/proxy/downloads/{id}", s.handleDownload).Methods("GET", "DELETE", "OPTIONS")
+	router.HandleFunc("/proxy/downloads/{id}/resume", s.handleDownloadResume).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/network-profiles", s.handleNetworkProfiles).Methods("GET", "OPTIONS")
+	router.HandleFunc("/proxy/schedules", s.handleSchedules).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/proxy/schedules/{id}", s.handleSchedule).Methods("GET", "DELETE", "OPTIONS")
+	router.HandleFunc("/proxy/jobs", s.handleJobs).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/proxy/jobs/{id}", s.handleJob).Methods("GET", "DELETE", "OPTIONS")
+	router.HandleFunc("/proxy/deadletters", s.handleDeadLetters).Methods("GET", "OPTIONS")
+	router.HandleFunc("/proxy/deadletters/{id}", s.handleDeadLetter).Methods("GET", "DELETE", "OPTIONS")
+	router.HandleFunc("/proxy/deadletters/{id}/retry", s.handleDeadLetterRetry).Methods("POST", "OPTIONS")
+	router.HandleFunc("/proxy/hooks/{bucket}", s.handleHookBucket).Methods("GET", "DELETE", "OPTIONS")
+	router.HandleFunc("/proxy/hooks/{bucket}/feed", s.handleHookFeed).Methods("GET", "OPTIONS")
+
+	// Webhook capture accepts any method and path below the bucket. A tunnel
+	// relay forwards those requests to its connected client instead.
+	if s.config.TunnelRelay {
+		relay := NewTunnelRelay(s.config.TunnelToken)
+		router.HandleFunc("/tunnel/connect", relay.handleConnect).Methods("GET")
+		router.PathPrefix("/hooks/{bucket}").Handler(relay)
+	} else {
+		router.PathPrefix("/hooks/{bucket}").HandlerFunc(s.handleHookCapture)
+	}
+
+	// Uptime monitors
+	router.HandleFunc("/monitors", s.handleMonitors).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/monitors/{id}", s.handleMonitor).Methods("GET", "DELETE", "OPTIONS")
+
+	// GraphQL schema introspection, query validation and subscriptions
+	router.HandleFunc("/graphql/schema", s.handleGraphQLSchema).Methods("POST", "OPTIONS")
+	router.HandleFunc("/graphql/validate", s.handleGraphQLValidate).Methods("POST", "OPTIONS")
+	router.HandleFunc("/graphql/subscribe", s.handleGraphQLSubscribe).Methods("GET", "POST", "OPTIONS")
+
+	// WebSocket sessions kept open between requests
+	router.HandleFunc("/ws/sessions", s.handleWebSocketSessions).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/ws/sessions/{id}", s.handleWebSocketSession).Methods("GET", "DELETE", "OPTIONS")
+	router.HandleFunc("/ws/sessions/{id}/send", s.handleWebSocketSend).Methods("POST", "OPTIONS")
+	router.HandleFunc("/ws/sessions/{id}/messages", s.handleWebSocketMessages).Methods("GET", "OPTIONS")
+	router.HandleFunc("/ws/sessions/{id}/feed", s.handleWebSocketFeed).Methods("GET", "OPTIONS")
+
+	// SSE sessions that reconnect and buffer events
+	router.HandleFunc("/sse/sessions", s.handleEventSources).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/sse/sessions/{id}", s.handleEventSource).Methods("GET", "DELETE", "OPTIONS")
+	router.HandleFunc("/sse/sessions/{id}/events", s.handleEventSourceEvents).Methods("GET", "OPTIONS")
+	router.HandleFunc("/sse/sessions/{id}/feed", s.handleEventSourceFeed).Methods("GET", "OPTIONS")
+
+	// Protobuf message types
+	router.HandleFunc("/proto/files", s.handleProtoFiles).Methods("GET", "POST", "OPTIONS")
+
+	// SOAP services described by a WSDL
+	router.HandleFunc("/soap/operations", s.handleSOAPOperations).Methods("POST", "OPTIONS")
+	router.HandleFunc("/soap/call", s.handleSOAPCall).Methods("POST", "OPTIONS")
+
+	// Multi-step workflows
+	router.HandleFunc("/workflows/run", s.handleRunWorkflow).Methods("POST", "OPTIONS")
+
+	// Health check endpoint
+	router.HandleFunc("/health", s.handleHealthCheck).Methods("GET", "OPTIONS")
+	router.HandleFunc("/version", s.handleVersion).Methods("GET", "OPTIONS")
+	router.HandleFunc("/health/live", s.handleHealthLive).Methods("GET", "OPTIONS")
+	router.HandleFunc("/health/ready", s.handleHealthReady).Methods("GET", "OPTIONS")
+
+	// API description
+	router.HandleFunc("/openapi.json", s.handleOpenAPI).Methods("GET", "OPTIONS")
+	router.HandleFunc("/docs", s.handleDocs).Methods("GET", "OPTIONS")
+	router.PathPrefix("/docs/").Handler(swaggerUIHandler()).Methods("GET")
+	router.HandleFunc("/slingshot.proto", s.handleGRPCProto).Methods("GET", "OPTIONS")
+
+	// Web dashboard
+	router.HandleFunc("/ui", s.handleDashboard).Methods("GET")
+	router.PathPrefix("/ui/").Handler(dashboardHandler()).Methods("GET")
+
+	// Admin API
+	router.HandleFunc("/admin/keys", s.handleAdminKeys).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/admin/keys/{id}", s.handleAdminKey).Methods("GET", "DELETE", "OPTIONS")
+	router.HandleFunc("/admin/config", s.handleAdminConfig).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/stats", s.handleAdminStats).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/requests", s.handleAdminRequests).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/requests/{id}", s.handleAdminRequest).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/admin/drain", s.handleAdminDrain).Methods("GET", "POST", "DELETE", "OPTIONS")
+	router.HandleFunc("/admin/cluster", s.handleAdminCluster).Methods("GET", "OPTIONS")
+
+	return router
+}
+
+// Start starts the HTTP server on the configured port
+func (s *ProxyServer) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve starts the background services and serves the proxy on listener
+func (s *ProxyServer) Serve(listener net.Listener) error {
+	// Announce the proxy to the rest of the cluster before claiming
+	// schedules and monitors there
+	if err := s.cluster.Start(); err != nil {
+		return err
+	}
+
+	// Start expiring stored response bodies
+	if err := s.apiKeys.Start(); err != nil {
+		return err
+	}
+
+	if err := s.artifacts.Start(); err != nil {
+		return err
+	}
+
+	// Start running scheduled requests
+	if err := s.scheduler.Start(); err != nil {
+		return err
+	}
+
+	// Start checking monitors
+	if err := s.monitors.Start(); err != nil {
+		return err
+	}
+
+	// Start publishing completed requests to message queues
+	s.history.publishers.Start()
+
+	// Relay webhook captures between the proxies of the cluster
+	s.hooks.Start()
+
+	// Expose the webhook buckets through a public relay
+	if s.config.TunnelURL != "" {
+		s.runTunnel(s.config.TunnelURL, s.config.TunnelToken, s.router)
+	}
+
+	// Serve local tools on the socket too; stopping the server closes it
+	if s.config.Socket != "" {
+		socket, err := listenSocket(s.config.Socket)
+		if err != nil {
+			return err
+		}
+		go s.server.Serve(socket)
+	}
+
+	// Serve the gRPC API on its own port; stopping the proxy stops it
+	if s.grpcServer != nil {
+		grpcListener, err := net.Listen("tcp", s.grpcServer.Addr)
+		if err != nil {
+			return err
+		}
+		go s.grpcServer.Serve(grpcListener)
+	}
+
+	return s.server.Serve(listener)
+}
+
+// listenSocket listens on a Unix socket only the user running the proxy may
+// connect to, replacing the socket a previous run left behind
+func listenSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Socket %s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Stop stops the HTTP server gracefully, ends the live tails, stops the gRPC
+// server, leaves the cluster, sends the records still queued for message
+// queues, then closes the storage
+func (s *ProxyServer) Stop(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	s.tail.Close(ctx)
+	if s.grpcServer != nil {
+		if grpcErr := s.grpcServer.Shutdown(ctx); err == nil {
+			err = grpcErr
+		}
+	}
+	s.cluster.Stop()
+	s.history.publishers.Stop(ctx)
+	if closeErr := s.storage.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// handleJSONRequest handles /proxy/request endpoint
+func (s *ProxyServer) handleJSONRequest(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Failed to read request body", err.Error())
+		return
+	}
+
+	var req ProxyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+
+	// Validate required fields
+	if req.Method == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing Method", "HTTP method is required")
+		return
+	}
+
+	if req.URL == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing URL", "URL is required")
+		return
+	}
+
+	// Set default timeout if not provided
+	if req.Timeout == 0 {
+		req.Timeout = 60 // default 60 seconds
+	}
+
+	// Forward allowlisted headers from the caller's own request
+	req.Headers = append(s.passthroughHeaders(r, req.Headers), req.Headers...)
+	req.Headers = append(req.Headers, s.forwardRequestID(w)...)
+
+	// Substitute path parameters if provided
+	if req.PathParams != nil {
+		substituted, err := s.httpClient.substitutePathParams(req.URL, req.PathParams, req.PathParamEncoding)
+		if err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Path Parameter", err.Error())
+			return
+		}
+		req.URL = substituted
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(req.Timeout)*time.Second)
+	defer cancel()
+
+	// Log the request
+	s.logger.Printf("[%s] %s %s", requestID(w), req.Method, req.URL)
+	s.active.describe(requestID(w), req.Method, req.URL)
+
+	// Stream newline-delimited JSON events when requested
+	if wantsNDJSON(r, &req) {
+		s.streamJSONRequest(ctx, w, &req)
+		return
+	}
+
+	// Execute the request
+	response, err := s.httpClient.ExecuteRequest(ctx, &req)
+	if err != nil {
+		s.logger.Printf("[%s] Request failed: %v", requestID(w), err)
+		s.writeErrorResponse(w, "unknown_error", "Request Failed", err.Error())
+		return
+	}
+	response.RequestID = requestID(w)
+	markAdminCancelled(ctx, response)
+	s.offloadBody(response, req.Artifact)
+	s.recordHistory(w, req.Method, req.URL, response)
+
+	// Write response
+	s.writeProxyResponse(w, response)
+}
+
+// handleFormRequest handles /proxy/form endpoint
+func (s *ProxyServer) handleFormRequest(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse query parameters
+	query := r.URL.Query()
+	formReq := &FormProxyRequest{
+		URL:         query.Get("url"),
+		Method:      query.Get("method"),
+		ContentType: query.Get("contentType"),
+		Headers:     query.Get("headers"),
+		PathParams:  query.Get("path_params"),
+	}
+
+	// Parse timeout
+	if timeoutStr := query.Get("timeout"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil {
+			formReq.Timeout = timeout
+		}
+	}
+
+	// Parse followRedirects
+	if followRedirectsStr := query.Get("followRedirects"); followRedirectsStr != "" {
+		if followRedirects, err := strconv.ParseBool(followRedirectsStr); err == nil {
+			formReq.FollowRedirects = &followRedirects
+		}
+	}
+
+	// Validate required fields
+	if formReq.URL == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing URL", "URL is required")
+		return
+	}
+
+	// Default method to POST
+	if formReq.Method == "" {
+		formReq.Method = "POST"
+	}
+
+	// Set default timeout
+	if formReq.Timeout == 0 {
+		formReq.Timeout = 60
+	}
+
+	// For multipart/form-data, pass the raw body directly to preserve structure
+	var formData map[string]string
+	var rawBody []byte
+
+	if strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
+		// For multipart, read raw body to preserve boundaries and files
+		var err error
+		rawBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Failed to read request body", fmt.Sprintf("Error reading body: %v", err))
+			return
+		}
+		formReq.RawBody = rawBody
+		formReq.ContentType = r.Header.Get("Content-Type") // Preserve exact content-type with boundary
+	} else {
+		// For URL-encoded forms, parse normally
+		if err := r.ParseForm(); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid form data", fmt.Sprintf("Failed to parse form data: %v", err))
+			return
+		}
+
+		// Convert form values to map (preserve multiple values)
+		formData = make(map[string]string)
+		for key, values := range r.PostForm {
+			if len(values) > 0 {
+				// Join multiple values with comma (standard behavior)
+				formData[key] = strings.Join(values, ",")
+			}
+		}
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(formReq.Timeout)*time.Second)
+	defer cancel()
+
+	// Forward the correlation ID if configured
+	for _, header := range s.forwardRequestID(w) {
+		if formReq.Headers != "" {
+			formReq.Headers += ","
+		}
+		formReq.Headers += header
+	}
+
+	// Log the request
+	s.logger.Printf("[%s] %s %s (form)", requestID(w), formReq.Method, formReq.URL)
+	s.active.describe(requestID(w), formReq.Method, formReq.URL)
+
+	// Execute the request
+	response, err := s.httpClient.ExecuteFormRequest(ctx, formReq, formData)
+	if err != nil {
+		s.logger.Printf("[%s] Form request failed: %v", requestID(w), err)
+		s.writeErrorResponse(w, "unknown_error", "Request Failed", err.Error())
+		return
+	}
+	response.RequestID = requestID(w)
+	markAdminCancelled(ctx, response)
+	s.offloadBody(response, false)
+	s.recordHistory(w, formReq.Method, formReq.URL, response)
+
+	// Write response
+	s.writeProxyResponse(w, response)
+}
+
+// handleCORSCheck handles /proxy/corscheck endpoint
+func (s *ProxyServer) handleCORSCheck(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req CORSCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+
+	// Validate required fields
+	if err := s.httpClient.validateURL(req.URL); err != nil {
+		s.writeErrorResponse(w, "url_validation_error", "Invalid URL", err.Error())
+		return
+	}
+	if err := checkTargetURL(r.Context(), req.URL); err != nil {
+		s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+
+	if req.Origin == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing Origin", "Origin is required")
+		return
+	}
+
+	// Default method to GET
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+
+	// Set default timeout
+	if req.Timeout == 0 {
+		req.Timeout = 60
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(req.Timeout)*time.Second)
+	defer cancel()
+
+	s.logger.Printf("CORS check %s %s from %s", req.Method, req.URL, req.Origin)
+
+	if err := json.NewEncoder(w).Encode(s.httpClient.CheckCORS(ctx, &req)); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleHealthCheck handles the health check endpoint
+func (s *ProxyServer) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	build := CurrentBuild()
+	healthResponse := map[string]interface{}{
+		"status":      "ok",
+		"version":     Version,
+		"user-agent":  fmt.Sprintf("rb-slingshot/%s (https://requestbite.com/slingshot)", Version),
+		"commit":      build.Commit,
+		"build_date":  build.BuildDate,
+		"commit_date": build.CommitDate,
+		"go_version":  build.GoVersion,
+	}
+
+	json.NewEncoder(w).Encode(healthResponse)
+}
+
+// corsMiddleware adds CORS headers
+func (s *ProxyServer) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", s.allowedRequestHeaders(r))
+		w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader+", "+RealStatusHeader)
+		w.Header().Set("Access-Control-Max-Age", "86400")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loggingMiddleware logs incoming requests
+func (s *ProxyServer) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Create a response writer wrapper to capture status code
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next.ServeHTTP(wrapped, r)
+
+		// Log the request
+		s.logger.Printf("[%s] %s %s %d %v", requestID(w), r.Method, r.URL.Path, wrapped.statusCode, time.Since(start))
+	})
+}
+
+// responseWriter wraps http.ResponseWriter to capture status code
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Hijack lets the tunnel relay take over client connections through the wrapper
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("Connection does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Flush lets streaming handlers flush through the wrapper
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// writeErrorResponse writes a standardized error response
+func (s *ProxyServer) writeErrorResponse(w http.ResponseWriter, errorType, errorTitle, errorMessage string) {
+	response := &ProxyResponse{
+		Success:      false,
+		RequestID:    requestID(w),
+		ErrorType:    errorType,
+		ErrorTitle:   errorTitle,
+		ErrorMessage: errorMessage,
+		Cancelled:    false,
+	}
+
+	w.WriteHeader(errorStatus(w, errorType)) // 200 for API consistency, unless asked otherwise
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode error response: %v", err)
+	}
+}
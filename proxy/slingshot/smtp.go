@@ -0,0 +1,405 @@
+package slingshot
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSMTPTimeout is the deadline of a test send in seconds
+const DefaultSMTPTimeout = 30
+
+// SMTPRequest is the JSON body of /proxy/smtp
+type SMTPRequest struct {
+	Address  string   `json:"address"` // host:port
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Subject  string   `json:"subject,omitempty"`
+	Body     string   `json:"body,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+
+	// TLS is "starttls" (upgrade when offered, the default), "require"
+	// (fail when STARTTLS is not offered), "implicit" (TLS from the start,
+	// as on port 465) or "none"
+	TLS        string `json:"tls,omitempty"`
+	ServerName string `json:"serverName,omitempty"` // TLS server name, defaults to the host
+	Helo       string `json:"helo,omitempty"`       // Name sent with EHLO
+	Timeout    int    `json:"timeout,omitempty"`    // Seconds for the whole conversation
+}
+
+// SMTPResponse is returned by /proxy/smtp. On failure the transcript shows
+// how far the conversation got.
+type SMTPResponse struct {
+	Success      bool     `json:"success"`
+	RequestID    string   `json:"request_id,omitempty"`
+	Address      string   `json:"address"`
+	TLSVersion   string   `json:"tls_version,omitempty"`
+	AuthMethod   string   `json:"auth_method,omitempty"`
+	MessageID    string   `json:"message_id,omitempty"`
+	Queued       string   `json:"queued,omitempty"` // The server's reply to the message
+	Transcript   []string `json:"transcript"`
+	ResponseTime string   `json:"response_time"`
+	ErrorType    string   `json:"error_type,omitempty"`
+	ErrorTitle   string   `json:"error_title,omitempty"`
+	ErrorMessage string   `json:"error_message,omitempty"`
+}
+
+// smtpSession is one SMTP conversation, recording every line sent ("C:")
+// and received ("S:")
+type smtpSession struct {
+	conn       net.Conn
+	text       *textproto.Conn
+	transcript []string
+}
+
+// note adds a line about the conversation itself to the transcript
+func (s *smtpSession) note(format string, args ...interface{}) {
+	s.transcript = append(s.transcript, "* "+fmt.Sprintf(format, args...))
+}
+
+// reset starts talking over conn, such as after a TLS upgrade
+func (s *smtpSession) reset(conn net.Conn) {
+	s.conn = conn
+	s.text = textproto.NewConn(conn)
+}
+
+// cmd sends a command and reads the reply, failing unless its code is
+// expect. logged replaces the command in the transcript when it holds
+// credentials.
+func (s *smtpSession) cmd(expect int, logged, format string, args ...interface{}) (int, []string, error) {
+	line := fmt.Sprintf(format, args...)
+	if logged == "" {
+		logged = line
+	}
+	s.transcript = append(s.transcript, "C: "+logged)
+	if err := s.text.PrintfLine("%s", line); err != nil {
+		return 0, nil, err
+	}
+	return s.reply(expect)
+}
+
+// reply reads a possibly multi-line reply, failing unless its code is expect
+func (s *smtpSession) reply(expect int) (int, []string, error) {
+	var lines []string
+	for {
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return 0, lines, err
+		}
+		s.transcript = append(s.transcript, "S: "+line)
+		if len(line) < 3 {
+			return 0, lines, fmt.Errorf("Malformed reply %q", line)
+		}
+		lines = append(lines, strings.TrimSpace(line[min(len(line), 4):]))
+		if len(line) == 3 || line[3] != '-' {
+			code, err := strconv.Atoi(line[:3])
+			if err != nil {
+				return 0, lines, fmt.Errorf("Malformed reply %q", line)
+			}
+			if code != expect {
+				return code, lines, &smtpReplyError{code: code, message: strings.Join(lines, " ")}
+			}
+			return code, lines, nil
+		}
+	}
+}
+
+// smtpReplyError is a reply with another code than expected
+type smtpReplyError struct {
+	code    int
+	message string
+}
+
+func (e *smtpReplyError) Error() string {
+	return fmt.Sprintf("%d %s", e.code, e.message)
+}
+
+// ehlo greets the server, returning its extensions, and falls back to HELO
+func (s *smtpSession) ehlo(name string) (map[string]string, error) {
+	_, lines, err := s.cmd(250, "", "EHLO %s", name)
+	if err != nil {
+		if _, ok := err.(*smtpReplyError); !ok {
+			return nil, err
+		}
+		_, _, err = s.cmd(250, "", "HELO %s", name)
+		return map[string]string{}, err
+	}
+	extensions := make(map[string]string)
+	for _, line := range lines[1:] {
+		keyword, params, _ := strings.Cut(line, " ")
+		extensions[strings.ToUpper(keyword)] = params
+	}
+	return extensions, nil
+}
+
+// sendTestMail holds an SMTP conversation that delivers one message
+func sendTestMail(ctx context.Context, req *SMTPRequest) (*SMTPResponse, error) {
+	response := &SMTPResponse{Address: req.Address}
+	session := &smtpSession{transcript: []string{}}
+	err := session.send(ctx, req, response)
+	response.Transcript = session.transcript
+	if session.conn != nil {
+		session.conn.Close()
+	}
+	return response, err
+}
+
+// send runs the conversation, filling in response
+func (s *smtpSession) send(ctx context.Context, req *SMTPRequest, response *SMTPResponse) error {
+	host, _, _ := net.SplitHostPort(req.Address)
+	serverName := req.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	helo := req.Helo
+	if helo == "" {
+		helo = "slingshot.localhost"
+	}
+	tlsMode := strings.ToLower(req.TLS)
+	if tlsMode == "" {
+		tlsMode = "starttls"
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", req.Address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	s.reset(conn)
+	s.note("Connected to %s", conn.RemoteAddr())
+
+	if tlsMode == "implicit" {
+		if err := s.startTLS(ctx, serverName, response); err != nil {
+			return err
+		}
+	}
+	if _, _, err := s.reply(220); err != nil {
+		return err
+	}
+
+	extensions, err := s.ehlo(helo)
+	if err != nil {
+		return err
+	}
+	if _, offered := extensions["STARTTLS"]; offered && (tlsMode == "starttls" || tlsMode == "require") {
+		if _, _, err := s.cmd(220, "", "STARTTLS"); err != nil {
+			return err
+		}
+		if err := s.startTLS(ctx, serverName, response); err != nil {
+			return err
+		}
+		if extensions, err = s.ehlo(helo); err != nil {
+			return err
+		}
+	} else if tlsMode == "require" {
+		return fmt.Errorf("The server does not offer STARTTLS")
+	}
+
+	if req.Username != "" {
+		if err := s.auth(req, extensions, host, response); err != nil {
+			return err
+		}
+	}
+
+	if _, _, err := s.cmd(250, "", "MAIL FROM:<%s>", req.From); err != nil {
+		return err
+	}
+	for _, to := range req.To {
+		// 251 (forwarded) also accepts the recipient
+		if code, _, err := s.cmd(250, "", "RCPT TO:<%s>", to); err != nil && code != 251 {
+			return err
+		}
+	}
+	if _, _, err := s.cmd(354, "", "DATA"); err != nil {
+		return err
+	}
+
+	message, messageID := buildTestMessage(req, host)
+	writer := s.text.DotWriter()
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	s.transcript = append(s.transcript, fmt.Sprintf("C: (message of %d bytes)", len(message)), "C: .")
+	_, lines, err := s.reply(250)
+	if err != nil {
+		return err
+	}
+	response.MessageID = messageID
+	response.Queued = strings.Join(lines, " ")
+
+	// The message is accepted whatever the server says to QUIT
+	s.cmd(221, "", "QUIT")
+	return nil
+}
+
+// startTLS upgrades the connection, recording the negotiated version
+func (s *smtpSession) startTLS(ctx context.Context, serverName string, response *SMTPResponse) error {
+	tlsConn := tls.Client(s.conn, &tls.Config{ServerName: serverName})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("TLS handshake failed: %v", err)
+	}
+	state := tlsConn.ConnectionState()
+	response.TLSVersion = tls.VersionName(state.Version)
+	s.note("TLS established (%s, %s)", response.TLSVersion, tls.CipherSuiteName(state.CipherSuite))
+	s.reset(tlsConn)
+	return nil
+}
+
+// auth logs in with PLAIN or LOGIN, keeping the credentials out of the
+// transcript. Like net/smtp, credentials are only sent over TLS or to
+// localhost.
+func (s *smtpSession) auth(req *SMTPRequest, extensions map[string]string, host string, response *SMTPResponse) error {
+	if response.TLSVersion == "" && host != "localhost" && host != "127.0.0.1" && host != "::1" {
+		return fmt.Errorf("Refusing to send credentials over an unencrypted connection")
+	}
+	mechanisms := strings.Fields(strings.ToUpper(extensions["AUTH"]))
+	has := func(name string) bool {
+		for _, mechanism := range mechanisms {
+			if mechanism == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case has("PLAIN"):
+		response.AuthMethod = "PLAIN"
+		credentials := base64.StdEncoding.EncodeToString([]byte("\x00" + req.Username + "\x00" + req.Password))
+		_, _, err := s.cmd(235, "AUTH PLAIN ********", "AUTH PLAIN %s", credentials)
+		return err
+	case has("LOGIN"):
+		response.AuthMethod = "LOGIN"
+		if _, _, err := s.cmd(334, "", "AUTH LOGIN"); err != nil {
+			return err
+		}
+		if _, _, err := s.cmd(334, "********", "%s", base64.StdEncoding.EncodeToString([]byte(req.Username))); err != nil {
+			return err
+		}
+		_, _, err := s.cmd(235, "********", "%s", base64.StdEncoding.EncodeToString([]byte(req.Password)))
+		return err
+	default:
+		return fmt.Errorf("The server offers no supported AUTH mechanism (have %q)", extensions["AUTH"])
+	}
+}
+
+// buildTestMessage formats the message and returns it with its Message-ID
+func buildTestMessage(req *SMTPRequest, host string) ([]byte, string) {
+	subject := req.Subject
+	if subject == "" {
+		subject = "Slingshot test message"
+	}
+	body := req.Body
+	if body == "" {
+		body = "This is a test message sent by Slingshot to verify mail delivery."
+	}
+	messageID := fmt.Sprintf("<%s@%s>", newRequestID(), host)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", req.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(req.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: %s\r\n", messageID)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return []byte(msg.String()), messageID
+}
+
+// handleSMTPSend handles /proxy/smtp, sending a test message and returning
+// the protocol transcript
+func (s *ProxyServer) handleSMTPSend(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req SMTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if _, port, err := net.SplitHostPort(req.Address); err != nil || port == "" {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Address", "Address must be host:port")
+		return
+	}
+	if err := checkTargetHost(r.Context(), req.Address); err != nil {
+		s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+	if req.From == "" || len(req.To) == 0 {
+		s.writeErrorResponse(w, "request_format_error", "Missing Fields", "From and to are required")
+		return
+	}
+	for _, address := range append([]string{req.From}, req.To...) {
+		if strings.ContainsAny(address, "<>\r\n") {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Address", fmt.Sprintf("Invalid email address %q", address))
+			return
+		}
+	}
+	switch strings.ToLower(req.TLS) {
+	case "", "starttls", "require", "implicit", "none":
+	default:
+		s.writeErrorResponse(w, "request_format_error", "Invalid TLS Mode", "TLS must be starttls, require, implicit or none")
+		return
+	}
+	if strings.ContainsAny(req.Subject+req.Helo, "\r\n") {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Header", "Subject and helo may not contain line breaks")
+		return
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	s.logger.Printf("[%s] SMTP %s to %s", requestID(w), req.Address, strings.Join(req.To, ", "))
+
+	start := time.Now()
+	response, err := sendTestMail(ctx, &req)
+	response.RequestID = requestID(w)
+	response.ResponseTime = formatMillis(time.Since(start))
+	if err != nil {
+		s.logger.Printf("[%s] SMTP failed: %v", requestID(w), err)
+		var netErr net.Error
+		switch {
+		case ctx.Err() == context.DeadlineExceeded || (errors.As(err, &netErr) && netErr.Timeout()):
+			response.ErrorType, response.ErrorTitle = TimeoutError.Type, TimeoutError.Title
+		case len(response.Transcript) == 0:
+			errType := networkErrorType(err)
+			response.ErrorType, response.ErrorTitle = errType.Type, errType.Title
+		default:
+			response.ErrorType, response.ErrorTitle = SMTPError.Type, SMTPError.Title
+		}
+		response.ErrorMessage = err.Error()
+	} else {
+		response.Success = true
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
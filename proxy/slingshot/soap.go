@@ -0,0 +1,663 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	soap11Envelope = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Envelope = "http://www.w3.org/2003/05/soap-envelope"
+	soap11Binding  = "http://schemas.xmlsoap.org/wsdl/soap/"
+	soap12Binding  = "http://schemas.xmlsoap.org/wsdl/soap12/"
+)
+
+// xmlNamePattern matches the JSON keys that can be used as element names
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// SOAPOperationsRequest is the JSON body of /soap/operations
+type SOAPOperationsRequest struct {
+	WSDL    string   `json:"wsdl"`
+	Headers []string `json:"headers,omitempty"`
+}
+
+// SOAPCallRequest is the JSON body of /soap/call
+type SOAPCallRequest struct {
+	WSDL       string          `json:"wsdl"`
+	Operation  string          `json:"operation"`
+	Input      json.RawMessage `json:"input,omitempty"`
+	Headers    []string        `json:"headers,omitempty"`
+	Endpoint   string          `json:"endpoint,omitempty"`   // Overrides the address in the WSDL
+	SOAPHeader string          `json:"soapHeader,omitempty"` // Raw XML for the envelope's Header
+	Timeout    int             `json:"timeout,omitempty"`
+}
+
+// SOAPOperation describes an operation of a WSDL
+type SOAPOperation struct {
+	Name          string `json:"name"`
+	SOAPAction    string `json:"soap_action"`
+	Style         string `json:"style"`
+	InputElement  string `json:"input_element"`
+	OutputElement string `json:"output_element,omitempty"`
+	Namespace     string `json:"namespace"`
+	Documentation string `json:"documentation,omitempty"`
+
+	qualified bool
+}
+
+// SOAPService is the SOAP port of a WSDL with its operations
+type SOAPService struct {
+	Service     string           `json:"service"`
+	Endpoint    string           `json:"endpoint"`
+	SOAPVersion string           `json:"soap_version"`
+	Operations  []*SOAPOperation `json:"operations"`
+}
+
+// SOAPOperationsResponse is returned by /soap/operations
+type SOAPOperationsResponse struct {
+	Success bool `json:"success"`
+	*SOAPService
+}
+
+// SOAPFault is a fault returned by a SOAP service
+type SOAPFault struct {
+	Code   string      `json:"code"`
+	String string      `json:"string"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+// SOAPCallResponse is returned by /soap/call
+type SOAPCallResponse struct {
+	Success         bool        `json:"success"`
+	Operation       string      `json:"operation"`
+	Endpoint        string      `json:"endpoint"`
+	SOAPAction      string      `json:"soap_action"`
+	RequestEnvelope string      `json:"request_envelope"`
+	ResponseStatus  int         `json:"response_status"`
+	ResponseTime    string      `json:"response_time,omitempty"`
+	Result          interface{} `json:"result,omitempty"`
+	Fault           *SOAPFault  `json:"fault,omitempty"`
+	ResponseData    string      `json:"response_data,omitempty"`
+}
+
+// WSDL 1.1 document structure. SOAP extension elements are matched by local
+// name; their namespace tells SOAP 1.1 and 1.2 apart.
+type (
+	wsdlDefinitions struct {
+		TargetNamespace string        `xml:"targetNamespace,attr"`
+		Attrs           []xml.Attr    `xml:",any,attr"`
+		Schemas         []wsdlSchema  `xml:"types>schema"`
+		Messages        []wsdlMessage `xml:"message"`
+		PortTypes       []struct {
+			Name       string `xml:"name,attr"`
+			Operations []struct {
+				Name          string `xml:"name,attr"`
+				Documentation string `xml:"documentation"`
+				Input         struct {
+					Message string `xml:"message,attr"`
+				} `xml:"input"`
+				Output struct {
+					Message string `xml:"message,attr"`
+				} `xml:"output"`
+			} `xml:"operation"`
+		} `xml:"portType"`
+		Bindings []wsdlBinding `xml:"binding"`
+		Services []struct {
+			Name  string `xml:"name,attr"`
+			Ports []struct {
+				Name    string `xml:"name,attr"`
+				Binding string `xml:"binding,attr"`
+				Address struct {
+					XMLName  xml.Name
+					Location string `xml:"location,attr"`
+				} `xml:"address"`
+			} `xml:"port"`
+		} `xml:"service"`
+	}
+	wsdlSchema struct {
+		TargetNamespace    string     `xml:"targetNamespace,attr"`
+		ElementFormDefault string     `xml:"elementFormDefault,attr"`
+		Attrs              []xml.Attr `xml:",any,attr"`
+	}
+	wsdlMessage struct {
+		Name  string `xml:"name,attr"`
+		Parts []struct {
+			Name    string `xml:"name,attr"`
+			Element string `xml:"element,attr"`
+		} `xml:"part"`
+	}
+	wsdlBinding struct {
+		Name        string `xml:"name,attr"`
+		Type        string `xml:"type,attr"`
+		SOAPBinding struct {
+			XMLName xml.Name
+			Style   string `xml:"style,attr"`
+		} `xml:"binding"`
+		Operations []struct {
+			Name          string `xml:"name,attr"`
+			SOAPOperation struct {
+				SOAPAction string `xml:"soapAction,attr"`
+				Style      string `xml:"style,attr"`
+			} `xml:"operation"`
+			Body struct {
+				Namespace string `xml:"namespace,attr"`
+			} `xml:"input>body"`
+		} `xml:"operation"`
+	}
+)
+
+// localName strips the prefix of a QName such as tns:GetWeather
+func localName(qname string) string {
+	if i := strings.LastIndex(qname, ":"); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
+
+// parseWSDL reads the first SOAP port of a WSDL, preferring SOAP 1.1, and
+// describes its operations. Imported documents are not followed.
+func parseWSDL(data []byte) (*SOAPService, error) {
+	var definitions wsdlDefinitions
+	if err := xml.Unmarshal(data, &definitions); err != nil {
+		return nil, fmt.Errorf("Failed to parse WSDL: %v", err)
+	}
+
+	// Resolve QName prefixes from the declarations of the document and its schemas
+	prefixes := map[string]string{}
+	for _, attr := range definitions.Attrs {
+		if attr.Name.Space == "xmlns" {
+			prefixes[attr.Name.Local] = attr.Value
+		}
+	}
+	qualified := map[string]bool{}
+	for _, schema := range definitions.Schemas {
+		qualified[schema.TargetNamespace] = schema.ElementFormDefault == "qualified"
+		for _, attr := range schema.Attrs {
+			if attr.Name.Space == "xmlns" {
+				if _, ok := prefixes[attr.Name.Local]; !ok {
+					prefixes[attr.Name.Local] = attr.Value
+				}
+			}
+		}
+	}
+	namespaceOf := func(qname string) string {
+		if prefix, _, ok := strings.Cut(qname, ":"); ok {
+			if namespace, ok := prefixes[prefix]; ok {
+				return namespace
+			}
+		}
+		return definitions.TargetNamespace
+	}
+
+	// Pick the port, preferring SOAP 1.1 over SOAP 1.2
+	var service *SOAPService
+	var binding *wsdlBinding
+	for _, version := range []string{"1.1", "1.2"} {
+		for _, svc := range definitions.Services {
+			for _, port := range svc.Ports {
+				b := findBinding(definitions.Bindings, localName(port.Binding))
+				if b == nil || soapBindingVersion(b.SOAPBinding.XMLName.Space) != version {
+					continue
+				}
+				service = &SOAPService{Service: svc.Name, Endpoint: port.Address.Location, SOAPVersion: version}
+				binding = b
+				break
+			}
+			if service != nil {
+				break
+			}
+		}
+		if service != nil {
+			break
+		}
+	}
+	if service == nil {
+		return nil, fmt.Errorf("The WSDL has no SOAP port")
+	}
+
+	messages := map[string]wsdlMessage{}
+	for _, message := range definitions.Messages {
+		messages[message.Name] = message
+	}
+
+	service.Operations = []*SOAPOperation{}
+	for _, portType := range definitions.PortTypes {
+		if portType.Name != localName(binding.Type) {
+			continue
+		}
+		for _, op := range portType.Operations {
+			operation := &SOAPOperation{
+				Name:          op.Name,
+				Style:         binding.SOAPBinding.Style,
+				Documentation: strings.TrimSpace(op.Documentation),
+			}
+			for _, bop := range binding.Operations {
+				if bop.Name != op.Name {
+					continue
+				}
+				operation.SOAPAction = bop.SOAPOperation.SOAPAction
+				if bop.SOAPOperation.Style != "" {
+					operation.Style = bop.SOAPOperation.Style
+				}
+				operation.Namespace = bop.Body.Namespace
+			}
+			if operation.Style == "" {
+				operation.Style = "document"
+			}
+
+			input := messages[localName(op.Input.Message)]
+			if operation.Style == "rpc" {
+				// The wrapper is named after the operation and its parts are unqualified
+				operation.InputElement = op.Name
+				if operation.Namespace == "" {
+					operation.Namespace = definitions.TargetNamespace
+				}
+			} else if len(input.Parts) > 0 && input.Parts[0].Element != "" {
+				operation.InputElement = localName(input.Parts[0].Element)
+				operation.Namespace = namespaceOf(input.Parts[0].Element)
+				operation.qualified = qualified[operation.Namespace]
+			} else {
+				operation.InputElement = op.Name
+				operation.Namespace = definitions.TargetNamespace
+			}
+			if output := messages[localName(op.Output.Message)]; len(output.Parts) > 0 && output.Parts[0].Element != "" {
+				operation.OutputElement = localName(output.Parts[0].Element)
+			}
+			service.Operations = append(service.Operations, operation)
+		}
+	}
+	return service, nil
+}
+
+// findBinding returns the binding with the given name
+func findBinding(bindings []wsdlBinding, name string) *wsdlBinding {
+	for i := range bindings {
+		if bindings[i].Name == name {
+			return &bindings[i]
+		}
+	}
+	return nil
+}
+
+// soapBindingVersion returns the SOAP version of a binding namespace
+func soapBindingVersion(namespace string) string {
+	switch namespace {
+	case soap11Binding:
+		return "1.1"
+	case soap12Binding:
+		return "1.2"
+	}
+	return ""
+}
+
+// buildSOAPEnvelope wraps the JSON input of an operation in a SOAP envelope.
+// Object keys become elements in their JSON order, and arrays repeat the
+// element.
+func buildSOAPEnvelope(operation *SOAPOperation, version string, input json.RawMessage, soapHeader string) (string, error) {
+	envelopeNS := soap11Envelope
+	if version == "1.2" {
+		envelopeNS = soap12Envelope
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b, `<soap:Envelope xmlns:soap="%s" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`, envelopeNS)
+	if soapHeader != "" {
+		b.WriteString("<soap:Header>" + soapHeader + "</soap:Header>")
+	}
+	b.WriteString("<soap:Body>")
+
+	// Qualified schemas put the children in the namespace too
+	var open, close string
+	if operation.qualified {
+		open = fmt.Sprintf(`<%s xmlns="%s">`, operation.InputElement, xmlEscape(operation.Namespace))
+		close = "</" + operation.InputElement + ">"
+	} else {
+		open = fmt.Sprintf(`<ns0:%s xmlns:ns0="%s">`, operation.InputElement, xmlEscape(operation.Namespace))
+		close = "</ns0:" + operation.InputElement + ">"
+	}
+	b.WriteString(open)
+
+	if len(bytes.TrimSpace(input)) > 0 && string(bytes.TrimSpace(input)) != "null" {
+		dec := json.NewDecoder(bytes.NewReader(input))
+		dec.UseNumber()
+		tok, err := dec.Token()
+		if err != nil {
+			return "", fmt.Errorf("Invalid input: %v", err)
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+			return "", fmt.Errorf("Input must be a JSON object")
+		}
+		if err := writeXMLFields(&b, dec); err != nil {
+			return "", err
+		}
+	}
+
+	b.WriteString(close)
+	b.WriteString("</soap:Body></soap:Envelope>")
+	return b.String(), nil
+}
+
+// writeXMLFields writes the remaining fields of a JSON object as elements
+func writeXMLFields(b *strings.Builder, dec *json.Decoder) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("Invalid input: %v", err)
+		}
+		name := tok.(string)
+		if !xmlNamePattern.MatchString(name) {
+			return fmt.Errorf("Invalid element name %q", name)
+		}
+		value, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("Invalid input: %v", err)
+		}
+		if err := writeXMLValue(b, dec, name, value); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token() // closing }
+	return err
+}
+
+// writeXMLValue writes a JSON value as an element named name
+func writeXMLValue(b *strings.Builder, dec *json.Decoder, name string, tok json.Token) error {
+	switch value := tok.(type) {
+	case json.Delim:
+		if value == '[' {
+			for dec.More() {
+				item, err := dec.Token()
+				if err != nil {
+					return fmt.Errorf("Invalid input: %v", err)
+				}
+				if err := writeXMLValue(b, dec, name, item); err != nil {
+					return err
+				}
+			}
+			_, err := dec.Token() // closing ]
+			return err
+		}
+		b.WriteString("<" + name + ">")
+		if err := writeXMLFields(b, dec); err != nil {
+			return err
+		}
+		b.WriteString("</" + name + ">")
+	case nil:
+		b.WriteString("<" + name + ` xsi:nil="true"/>`)
+	default:
+		fmt.Fprintf(b, "<%s>%s</%s>", name, xmlEscape(fmt.Sprint(value)), name)
+	}
+	return nil
+}
+
+// xmlEscape escapes text for element content and attribute values
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// parseSOAPResponse converts the first element of a SOAP response body to
+// JSON, or returns the fault it holds
+func parseSOAPResponse(data []byte) (interface{}, *SOAPFault, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	inBody := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("The response has no SOAP body")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to parse response: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !inBody {
+			inBody = start.Name.Local == "Body"
+			continue
+		}
+
+		value, err := xmlToJSON(dec, start)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to parse response: %v", err)
+		}
+		if start.Name.Local == "Fault" {
+			return nil, soapFault(value), nil
+		}
+		return map[string]interface{}{start.Name.Local: value}, nil, nil
+	}
+}
+
+// soapFault reads a SOAP 1.1 or SOAP 1.2 fault
+func soapFault(value interface{}) *SOAPFault {
+	fields, _ := value.(map[string]interface{})
+	fault := &SOAPFault{}
+	if code, ok := fields["faultcode"]; ok {
+		fault.Code = fmt.Sprint(code)
+		fault.String = fmt.Sprint(fields["faultstring"])
+		fault.Detail = fields["detail"]
+		return fault
+	}
+	if code, ok := fields["Code"].(map[string]interface{}); ok {
+		fault.Code = fmt.Sprint(code["Value"])
+	}
+	if reason, ok := fields["Reason"].(map[string]interface{}); ok {
+		fault.String = fmt.Sprint(reason["Text"])
+	}
+	fault.Detail = fields["Detail"]
+	return fault
+}
+
+// xmlToJSON converts an element to JSON. Elements with children become
+// objects, repeated children become arrays and other elements become their
+// text. Namespaces and attributes are dropped.
+func xmlToJSON(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "nil" && attr.Value == "true" {
+			return nil, dec.Skip()
+		}
+	}
+
+	var text strings.Builder
+	var children map[string]interface{}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			value, err := xmlToJSON(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			if children == nil {
+				children = make(map[string]interface{})
+			}
+			name := t.Name.Local
+			switch existing := children[name].(type) {
+			case nil:
+				if _, ok := children[name]; ok {
+					children[name] = []interface{}{nil, value}
+				} else {
+					children[name] = value
+				}
+			case []interface{}:
+				children[name] = append(existing, value)
+			default:
+				children[name] = []interface{}{existing, value}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if children != nil {
+				return children, nil
+			}
+			return strings.TrimSpace(text.String()), nil
+		}
+	}
+}
+
+// fetchWSDL downloads and parses a WSDL
+func (c *HTTPClient) fetchWSDL(ctx context.Context, wsdlURL string, headers []string) (*SOAPService, error) {
+	response, err := c.ExecuteRequest(ctx, &ProxyRequest{
+		Method:  "GET",
+		URL:     wsdlURL,
+		Headers: headers,
+		Timeout: 30,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("Failed to fetch WSDL: %s", response.ErrorMessage)
+	}
+	if response.ResponseStatus != http.StatusOK {
+		return nil, fmt.Errorf("Failed to fetch WSDL: HTTP %d", response.ResponseStatus)
+	}
+	return parseWSDL([]byte(response.ResponseData))
+}
+
+// handleSOAPOperations handles /soap/operations, which lists the operations
+// of a WSDL
+func (s *ProxyServer) handleSOAPOperations(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req SOAPOperationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if req.WSDL == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing WSDL", "WSDL URL is required")
+		return
+	}
+
+	s.logger.Printf("[%s] Reading WSDL %s", requestID(w), req.WSDL)
+
+	service, err := s.httpClient.fetchWSDL(r.Context(), req.WSDL, req.Headers)
+	if err != nil {
+		s.writeErrorResponse(w, "wsdl_error", "Invalid WSDL", err.Error())
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(SOAPOperationsResponse{Success: true, SOAPService: service}); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleSOAPCall handles /soap/call, which builds a SOAP envelope for an
+// operation from JSON, sends it and parses the response
+func (s *ProxyServer) handleSOAPCall(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req SOAPCallRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if req.WSDL == "" || req.Operation == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing Fields", "WSDL URL and operation are required")
+		return
+	}
+
+	// Set default timeout if not provided
+	if req.Timeout == 0 {
+		req.Timeout = 60 // default 60 seconds
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(req.Timeout)*time.Second)
+	defer cancel()
+
+	service, err := s.httpClient.fetchWSDL(ctx, req.WSDL, req.Headers)
+	if err != nil {
+		s.writeErrorResponse(w, "wsdl_error", "Invalid WSDL", err.Error())
+		return
+	}
+	var operation *SOAPOperation
+	for _, op := range service.Operations {
+		if op.Name == req.Operation {
+			operation = op
+		}
+	}
+	if operation == nil {
+		s.writeErrorResponse(w, "wsdl_error", "Unknown Operation", fmt.Sprintf("The WSDL has no operation named %q", req.Operation))
+		return
+	}
+
+	envelope, err := buildSOAPEnvelope(operation, service.SOAPVersion, req.Input, req.SOAPHeader)
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Input", err.Error())
+		return
+	}
+
+	endpoint := service.Endpoint
+	if req.Endpoint != "" {
+		endpoint = req.Endpoint
+	}
+	headers := append([]string(nil), req.Headers...)
+	if service.SOAPVersion == "1.2" {
+		headers = append(headers, fmt.Sprintf(`Content-Type: application/soap+xml; charset=utf-8; action="%s"`, operation.SOAPAction))
+	} else {
+		headers = append(headers, "Content-Type: text/xml; charset=utf-8", fmt.Sprintf(`SOAPAction: "%s"`, operation.SOAPAction))
+	}
+
+	s.logger.Printf("[%s] SOAP %s %s", requestID(w), operation.Name, endpoint)
+
+	response, err := s.httpClient.ExecuteRequest(ctx, &ProxyRequest{
+		Method:  "POST",
+		URL:     endpoint,
+		Headers: headers,
+		Body:    envelope,
+		Timeout: req.Timeout,
+	})
+	if err != nil {
+		s.writeErrorResponse(w, "unknown_error", "Request Failed", err.Error())
+		return
+	}
+	if !response.Success {
+		response.RequestID = requestID(w)
+		s.writeProxyResponse(w, response)
+		return
+	}
+
+	result := SOAPCallResponse{
+		Success:         true,
+		Operation:       operation.Name,
+		Endpoint:        endpoint,
+		SOAPAction:      operation.SOAPAction,
+		RequestEnvelope: envelope,
+		ResponseStatus:  response.ResponseStatus,
+		ResponseTime:    response.ResponseTime,
+	}
+	result.Result, result.Fault, err = parseSOAPResponse([]byte(response.ResponseData))
+	if err != nil {
+		// Keep the raw body when it is not a SOAP envelope
+		result.ResponseData = response.ResponseData
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
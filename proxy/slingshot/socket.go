@@ -0,0 +1,250 @@
+package slingshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultSocketTimeout is the deadline of a probe in seconds
+	DefaultSocketTimeout = 10
+
+	// DefaultSocketMaxBytes is how much of a reply is read by default
+	DefaultSocketMaxBytes = 64 << 10
+
+	// MaxSocketMaxBytes is the most of a reply a probe may read
+	MaxSocketMaxBytes = 1 << 20
+)
+
+// SocketRequest is the JSON body of /proxy/tcp and /proxy/udp
+type SocketRequest struct {
+	Address    string `json:"address"`              // host:port
+	Payload    string `json:"payload,omitempty"`    // Bytes to send, in the given encoding
+	Encoding   string `json:"encoding,omitempty"`   // "text" (default), "base64" or "hex"
+	Timeout    int    `json:"timeout,omitempty"`    // Seconds for the whole exchange
+	ReadUntil  string `json:"readUntil,omitempty"`  // Stop reading once the reply contains this text
+	MaxBytes   int    `json:"maxBytes,omitempty"`   // Stop reading after this many bytes
+	TLS        bool   `json:"tls,omitempty"`        // TCP only: connect with TLS
+	ServerName string `json:"serverName,omitempty"` // TCP only: TLS server name, defaults to the host
+}
+
+// SocketResponse is returned by /proxy/tcp and /proxy/udp
+type SocketResponse struct {
+	Success      bool   `json:"success"`
+	RequestID    string `json:"request_id,omitempty"`
+	Protocol     string `json:"protocol"`
+	Address      string `json:"address"`
+	RemoteAddr   string `json:"remote_addr,omitempty"`
+	BytesSent    int    `json:"bytes_sent"`
+	ResponseData string `json:"response_data"`
+	IsBinary     bool   `json:"is_binary,omitempty"`
+	ResponseSize string `json:"response_size"`
+	ConnectTime  string `json:"connect_time"`
+	ResponseTime string `json:"response_time"`
+
+	// Why reading stopped: the deadline passed, the peer closed the
+	// connection, or maxBytes were read
+	TimedOut  bool `json:"timed_out,omitempty"`
+	Closed    bool `json:"closed,omitempty"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// decodeSocketPayload decodes a payload given as text, base64 or hex
+func decodeSocketPayload(payload, encoding string) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "", "text":
+		return []byte(payload), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(payload)
+	case "hex":
+		return hex.DecodeString(strings.ReplaceAll(payload, " ", ""))
+	default:
+		return nil, fmt.Errorf("Unknown encoding %q; use text, base64 or hex", encoding)
+	}
+}
+
+// dialSocket connects to address over network, with TLS when useTLS is set.
+// The certificate is verified for serverName, which defaults to the host.
+func dialSocket(ctx context.Context, network, address string, useTLS bool, serverName string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil || !useTLS {
+		return conn, err
+	}
+
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(address)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %v", err)
+	}
+	return tlsConn, nil
+}
+
+// probeSocket sends a payload over TCP or UDP and reads the reply until the
+// deadline passes, the peer closes the connection, readUntil appears or
+// maxBytes are read. A UDP reply is a single datagram.
+func probeSocket(ctx context.Context, network string, req *SocketRequest, payload []byte) (*SocketResponse, error) {
+	maxBytes := req.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultSocketMaxBytes
+	}
+	if maxBytes > MaxSocketMaxBytes {
+		maxBytes = MaxSocketMaxBytes
+	}
+
+	start := time.Now()
+	conn, err := dialSocket(ctx, network, req.Address, network == "tcp" && req.TLS, req.ServerName)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	connected := time.Now()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	response := &SocketResponse{
+		Success:     true,
+		Protocol:    network,
+		Address:     req.Address,
+		RemoteAddr:  conn.RemoteAddr().String(),
+		ConnectTime: formatMillis(connected.Sub(start)),
+	}
+
+	if len(payload) > 0 || network == "udp" {
+		n, err := conn.Write(payload)
+		response.BytesSent = n
+		if err != nil {
+			return nil, fmt.Errorf("Failed to send payload: %v", err)
+		}
+	}
+
+	var reply []byte
+	buf := make([]byte, 32<<10)
+read:
+	for len(reply) < maxBytes {
+		n, err := conn.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case errors.Is(err, io.EOF):
+				response.Closed = true
+			case errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+				response.TimedOut = true
+			case len(reply) == 0:
+				return nil, err
+			default:
+				response.Closed = true
+			}
+			break read
+		}
+		if network == "udp" || (req.ReadUntil != "" && bytes.Contains(reply, []byte(req.ReadUntil))) {
+			break
+		}
+	}
+	if len(reply) > maxBytes {
+		reply = reply[:maxBytes]
+		response.Truncated = true
+	} else if len(reply) == maxBytes && !response.Closed && !response.TimedOut {
+		response.Truncated = true
+	}
+
+	response.ResponseTime = formatMillis(time.Since(start))
+	response.ResponseSize = formatSize(int64(len(reply)))
+	if utf8.Valid(reply) {
+		response.ResponseData = string(reply)
+	} else {
+		response.ResponseData = base64.StdEncoding.EncodeToString(reply)
+		response.IsBinary = true
+	}
+	return response, nil
+}
+
+// handleTCPProbe handles /proxy/tcp
+func (s *ProxyServer) handleTCPProbe(w http.ResponseWriter, r *http.Request) {
+	s.handleSocketProbe(w, r, "tcp")
+}
+
+// handleUDPProbe handles /proxy/udp
+func (s *ProxyServer) handleUDPProbe(w http.ResponseWriter, r *http.Request) {
+	s.handleSocketProbe(w, r, "udp")
+}
+
+// handleSocketProbe sends a raw payload to host:port over network
+func (s *ProxyServer) handleSocketProbe(w http.ResponseWriter, r *http.Request, network string) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req SocketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if _, port, err := net.SplitHostPort(req.Address); err != nil || port == "" {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Address", "Address must be host:port")
+		return
+	}
+	if err := checkTargetHost(r.Context(), req.Address); err != nil {
+		s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+	payload, err := decodeSocketPayload(req.Payload, req.Encoding)
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Payload", err.Error())
+		return
+	}
+	if req.TLS && network != "tcp" {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Request", "TLS is only supported over TCP")
+		return
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSocketTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	s.logger.Printf("[%s] %s %s", requestID(w), strings.ToUpper(network), req.Address)
+
+	response, err := probeSocket(ctx, network, &req, payload)
+	if err != nil {
+		s.logger.Printf("[%s] Probe failed: %v", requestID(w), err)
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			s.writeErrorResponse(w, TimeoutError.Type, TimeoutError.Title, fmt.Sprintf("No connection within %d seconds", timeout))
+		default:
+			errType := networkErrorType(err)
+			s.writeErrorResponse(w, errType.Type, errType.Title, err.Error())
+		}
+		return
+	}
+
+	response.RequestID = requestID(w)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package slingshot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// The drivers of the SQL storages, both pure Go
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// sqlDialect covers what differs between the SQL databases the proxy's
+// state can be kept in
+type sqlDialect struct {
+	name     string
+	drivers  []string // database/sql driver names, tried in order
+	blob     string   // Column type of response bodies
+	numbered bool     // Placeholders are $1, $2... instead of ?
+	noLimit  string   // LIMIT that returns all rows, for an OFFSET alone
+	shared   bool     // A server other proxies can reach, not a local file
+}
+
+var (
+	sqliteDialect   = sqlDialect{name: "SQLite", drivers: []string{"sqlite", "sqlite3"}, blob: "BLOB", noLimit: "-1"}
+	postgresDialect = sqlDialect{name: "PostgreSQL", drivers: []string{"pgx", "postgres"}, blob: "BYTEA", numbered: true, noLimit: "ALL", shared: true}
+)
+
+// query rewrites the ? placeholders of a statement for the dialect
+func (d sqlDialect) query(statement string) string {
+	if !d.numbered {
+		return statement
+	}
+	var rewritten strings.Builder
+	n := 0
+	for _, r := range statement {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&rewritten, "$%d", n)
+			continue
+		}
+		rewritten.WriteRune(r)
+	}
+	return rewritten.String()
+}
+
+// sqlStorage keeps the history in a table of a SQL database, one row per
+// entry
+type sqlStorage struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// sqlTables are created in the database on first use: the history, one row
+// per entry, artifact metadata and session holders
+var sqlTables = []string{
+	`CREATE TABLE IF NOT EXISTS slingshot_history (
+		id         VARCHAR(64) PRIMARY KEY,
+		created_at BIGINT NOT NULL,
+		entry      TEXT NOT NULL,
+		body       %s
+	)`,
+	`CREATE INDEX IF NOT EXISTS slingshot_history_created_at ON slingshot_history (created_at)`,
+	`CREATE TABLE IF NOT EXISTS slingshot_artifacts (
+		id        VARCHAR(64) PRIMARY KEY,
+		stored_at BIGINT NOT NULL,
+		artifact  TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS slingshot_artifacts_stored_at ON slingshot_artifacts (stored_at)`,
+	`CREATE TABLE IF NOT EXISTS slingshot_sessions (
+		kind   VARCHAR(16) NOT NULL,
+		id     VARCHAR(255) NOT NULL,
+		holder VARCHAR(64) NOT NULL,
+		PRIMARY KEY (kind, id)
+	)`,
+}
+
+// openSQLStorage connects to a database with the first of the dialect's
+// drivers that is linked in, and creates the tables if needed
+func openSQLStorage(dialect sqlDialect, dataSource string) (*Storage, error) {
+	registered := make(map[string]bool)
+	for _, driver := range sql.Drivers() {
+		registered[driver] = true
+	}
+	driver := ""
+	for _, name := range dialect.drivers {
+		if registered[name] {
+			driver = name
+			break
+		}
+	}
+	if driver == "" {
+		return nil, fmt.Errorf("No %s driver is linked in; import one registering as %s", dialect.name, strings.Join(dialect.drivers, " or "))
+	}
+
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s storage: %v", dialect.name, err)
+	}
+	for _, table := range sqlTables {
+		if strings.Contains(table, "%s") {
+			table = fmt.Sprintf(table, dialect.blob)
+		}
+		if _, err := db.Exec(table); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("Failed to create %s tables: %v", dialect.name, err)
+		}
+	}
+	return &Storage{
+		History:   &sqlStorage{db: db, dialect: dialect},
+		Artifacts: &sqlArtifacts{db: db, dialect: dialect},
+		Sessions:  &sqlSessions{db: db, dialect: dialect},
+		Shared:    dialect.shared,
+		close:     db.Close,
+	}, nil
+}
+
+func (s *sqlStorage) Add(entry *HistoryEntry) error {
+	record, err := json.Marshal(newStoredEntry(entry))
+	if err != nil {
+		return err
+	}
+
+	// The entry is stored and the history trimmed in one transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Failed to store history entry: %v", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(s.dialect.query(`INSERT INTO slingshot_history (id, created_at, entry, body) VALUES (?, ?, ?, ?)`),
+		entry.ID, entry.Time.UnixNano(), string(record), entry.body)
+	if err != nil {
+		return fmt.Errorf("Failed to store history entry: %v", err)
+	}
+	_, err = tx.Exec(s.dialect.query(`DELETE FROM slingshot_history WHERE id NOT IN
+		(SELECT id FROM slingshot_history ORDER BY created_at DESC LIMIT ?)`), MaxHistoryEntries)
+	if err != nil {
+		return fmt.Errorf("Failed to trim history: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to store history entry: %v", err)
+	}
+	return nil
+}
+
+// timeRange returns the WHERE clause selecting entries between from and to,
+// either of which may be zero, and its arguments
+func (s *sqlStorage) timeRange(from, to time.Time) (string, []any) {
+	var conditions []string
+	var args []any
+	if !from.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, from.UnixNano())
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, to.UnixNano())
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *sqlStorage) Get(id string) (*HistoryEntry, error) {
+	var record string
+	var body []byte
+	err := s.db.QueryRow(s.dialect.query(`SELECT entry, body FROM slingshot_history WHERE id = ?`), id).Scan(&record, &body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read history entry: %v", err)
+	}
+
+	var stored storedEntry
+	if err := json.Unmarshal([]byte(record), &stored); err != nil {
+		return nil, fmt.Errorf("Failed to parse history entry %s: %v", id, err)
+	}
+	return stored.withBody(body), nil
+}
+
+func (s *sqlStorage) List(page HistoryRange) ([]*HistoryEntry, error) {
+	where, args := s.timeRange(page.From, page.To)
+	statement := `SELECT entry FROM slingshot_history` + where + ` ORDER BY created_at DESC`
+	switch {
+	case page.Limit > 0:
+		statement += ` LIMIT ? OFFSET ?`
+		args = append(args, page.Limit, page.Offset)
+	case page.Offset > 0:
+		statement += ` LIMIT ` + s.dialect.noLimit + ` OFFSET ?`
+		args = append(args, page.Offset)
+	}
+	rows, err := s.db.Query(s.dialect.query(statement), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read history: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []*HistoryEntry{}
+	for rows.Next() {
+		var record string
+		if err := rows.Scan(&record); err != nil {
+			return nil, fmt.Errorf("Failed to read history: %v", err)
+		}
+		var stored storedEntry
+		if err := json.Unmarshal([]byte(record), &stored); err != nil {
+			continue
+		}
+		entries = append(entries, stored.withBody(nil))
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStorage) Count(from, to time.Time) (int, error) {
+	where, args := s.timeRange(from, to)
+	var count int
+	err := s.db.QueryRow(s.dialect.query(`SELECT COUNT(*) FROM slingshot_history`+where), args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read history: %v", err)
+	}
+	return count, nil
+}
+
+func (s *sqlStorage) Stats() (int, int64, error) {
+	var entries int
+	var bodyBytes int64
+	err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(LENGTH(body)), 0) FROM slingshot_history`).Scan(&entries, &bodyBytes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Failed to read history: %v", err)
+	}
+	return entries, bodyBytes, nil
+}
+
+// sqlArtifacts keeps artifact metadata in a table, one row per artifact
+type sqlArtifacts struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func (s *sqlArtifacts) Put(artifact *Artifact) error {
+	record, err := json.Marshal(artifact)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.dialect.query(`INSERT INTO slingshot_artifacts (id, stored_at, artifact) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET stored_at = excluded.stored_at, artifact = excluded.artifact`),
+		artifact.ID, artifact.StoredAt.UnixNano(), string(record))
+	if err != nil {
+		return fmt.Errorf("Failed to store artifact: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlArtifacts) Get(id string) (*Artifact, error) {
+	var record string
+	err := s.db.QueryRow(s.dialect.query(`SELECT artifact FROM slingshot_artifacts WHERE id = ?`), id).Scan(&record)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read artifact: %v", err)
+	}
+	var artifact Artifact
+	if err := json.Unmarshal([]byte(record), &artifact); err != nil {
+		return nil, fmt.Errorf("Failed to parse artifact %s: %v", id, err)
+	}
+	return &artifact, nil
+}
+
+func (s *sqlArtifacts) Remove(id string) (bool, error) {
+	result, err := s.db.Exec(s.dialect.query(`DELETE FROM slingshot_artifacts WHERE id = ?`), id)
+	if err != nil {
+		return false, fmt.Errorf("Failed to remove artifact: %v", err)
+	}
+	removed, _ := result.RowsAffected()
+	return removed > 0, nil
+}
+
+func (s *sqlArtifacts) Expired(before time.Time) ([]*Artifact, error) {
+	rows, err := s.db.Query(s.dialect.query(`SELECT artifact FROM slingshot_artifacts WHERE stored_at < ?`), before.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read artifacts: %v", err)
+	}
+	defer rows.Close()
+
+	artifacts := []*Artifact{}
+	for rows.Next() {
+		var record string
+		if err := rows.Scan(&record); err != nil {
+			return nil, fmt.Errorf("Failed to read artifacts: %v", err)
+		}
+		var artifact Artifact
+		if err := json.Unmarshal([]byte(record), &artifact); err != nil {
+			continue
+		}
+		artifacts = append(artifacts, &artifact)
+	}
+	return artifacts, rows.Err()
+}
+
+// sqlSessions records session holders in a table
+type sqlSessions struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func (s *sqlSessions) Claim(kind, id, holder string) (string, error) {
+	_, err := s.db.Exec(s.dialect.query(`INSERT INTO slingshot_sessions (kind, id, holder) VALUES (?, ?, ?)
+		ON CONFLICT (kind, id) DO NOTHING`), kind, id, holder)
+	if err != nil {
+		return "", fmt.Errorf("Failed to claim session %s: %v", id, err)
+	}
+	current, err := s.Holder(kind, id)
+	if err == nil && current == "" {
+		// Released again right away
+		return s.Claim(kind, id, holder)
+	}
+	return current, err
+}
+
+func (s *sqlSessions) Holder(kind, id string) (string, error) {
+	var holder string
+	err := s.db.QueryRow(s.dialect.query(`SELECT holder FROM slingshot_sessions WHERE kind = ? AND id = ?`), kind, id).Scan(&holder)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to look up session %s: %v", id, err)
+	}
+	return holder, nil
+}
+
+func (s *sqlSessions) Release(kind, id, holder string) error {
+	_, err := s.db.Exec(s.dialect.query(`DELETE FROM slingshot_sessions WHERE kind = ? AND id = ? AND holder = ?`), kind, id, holder)
+	if err != nil {
+		return fmt.Errorf("Failed to release session %s: %v", id, err)
+	}
+	return nil
+}
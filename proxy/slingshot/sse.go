@@ -0,0 +1,194 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sseStream writes stream events as Server-Sent Events, flushing each event.
+// Like ndjsonStream, writes are serialized and stop after close.
+type sseStream struct {
+	mu        sync.Mutex
+	closed    bool
+	requestID string
+	w         io.Writer
+	flusher   http.Flusher
+}
+
+// newSSEStream prepares w for an event stream
+func newSSEStream(w http.ResponseWriter) *sseStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	flusher, _ := w.(http.Flusher)
+	return &sseStream{requestID: requestID(w), w: w, flusher: flusher}
+}
+
+// write sends one event with a JSON payload
+func (s *sseStream) write(event *StreamEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errStreamClosed
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event.Event, data); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func (s *sseStream) WriteHeaders(response *ProxyResponse) error {
+	return s.write(&StreamEvent{Event: "headers", ProxyResponse: response})
+}
+
+func (s *sseStream) WriteChunk(data string, size int) error {
+	return s.write(&StreamEvent{Event: "chunk", Data: data, Size: size})
+}
+
+func (s *sseStream) WriteProgress(sent, total int64) error {
+	return s.write(&StreamEvent{Event: "progress", Sent: sent, Total: total})
+}
+
+// close stops any further writes
+func (s *sseStream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+// writeError ends the stream with an error event
+func (s *sseStream) writeError(errorType, errorTitle, errorMessage string) {
+	s.write(&StreamEvent{Event: "error", ProxyResponse: &ProxyResponse{
+		Success:      false,
+		RequestID:    s.requestID,
+		ErrorType:    errorType,
+		ErrorTitle:   errorTitle,
+		ErrorMessage: errorMessage,
+	}})
+}
+
+// handleStreamRequest relays the proxied response as Server-Sent Events. GET
+// requests take the request from query parameters so the endpoint can be used
+// with EventSource; POST requests take the same JSON as /proxy/request.
+func (s *ProxyServer) handleStreamRequest(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	stream := newSSEStream(w)
+	defer stream.close()
+
+	var req ProxyRequest
+	if r.Method == "GET" {
+		req = streamRequestFromQuery(r)
+	} else {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			stream.writeError("request_format_error", "Failed to read request body", err.Error())
+			return
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			stream.writeError("request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+			return
+		}
+	}
+
+	// Validate required fields
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+
+	if req.URL == "" {
+		stream.writeError("request_format_error", "Missing URL", "URL is required")
+		return
+	}
+
+	// Set default timeout if not provided
+	if req.Timeout == 0 {
+		req.Timeout = 60 // default 60 seconds
+	}
+
+	// Forward allowlisted headers from the caller's own request
+	req.Headers = append(s.passthroughHeaders(r, req.Headers), req.Headers...)
+	req.Headers = append(req.Headers, s.forwardRequestID(w)...)
+
+	// Substitute path parameters if provided
+	if req.PathParams != nil {
+		substituted, err := s.httpClient.substitutePathParams(req.URL, req.PathParams, req.PathParamEncoding)
+		if err != nil {
+			stream.writeError("request_format_error", "Invalid Path Parameter", err.Error())
+			return
+		}
+		req.URL = substituted
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(req.Timeout)*time.Second)
+	defer cancel()
+
+	// Log the request
+	s.logger.Printf("[%s] %s %s (stream)", requestID(w), req.Method, req.URL)
+
+	response, err := s.httpClient.StreamRequest(ctx, &req, stream)
+	if err != nil {
+		s.logger.Printf("[%s] Request failed: %v", requestID(w), err)
+		stream.writeError("unknown_error", "Request Failed", err.Error())
+		return
+	}
+
+	response.RequestID = requestID(w)
+	s.recordHistory(w, req.Method, req.URL, response)
+
+	event := &StreamEvent{Event: "complete", ProxyResponse: response}
+	if !response.Success {
+		event.Event = "error"
+	}
+	if err := stream.write(event); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// streamRequestFromQuery builds a request from /proxy/stream query parameters
+func streamRequestFromQuery(r *http.Request) ProxyRequest {
+	query := r.URL.Query()
+	req := ProxyRequest{
+		Method:  query.Get("method"),
+		URL:     query.Get("url"),
+		Headers: query["header"],
+		Body:    query.Get("body"),
+	}
+
+	// Parse timeout
+	if timeoutStr := query.Get("timeout"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil {
+			req.Timeout = timeout
+		}
+	}
+
+	// Parse followRedirects
+	if followRedirectsStr := query.Get("followRedirects"); followRedirectsStr != "" {
+		if followRedirects, err := strconv.ParseBool(followRedirectsStr); err == nil {
+			req.FollowRedirects = &followRedirects
+		}
+	}
+
+	return req
+}
@@ -0,0 +1,81 @@
+package slingshot
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// RealStatusHeader set to "true" asks for failures to be answered with a
+	// 4xx or 5xx status matching their error type instead of 200. Responses
+	// in this mode carry the header back.
+	RealStatusHeader = "X-Slingshot-Real-Status"
+
+	// realStatusQueryParam does the same for clients that cannot set headers
+	realStatusQueryParam = "realStatus"
+)
+
+// errorStatusCodes maps error types to the status answered in real status
+// mode. Types not listed are answered with 500.
+var errorStatusCodes = map[string]int{
+	"request_format_error":     http.StatusBadRequest,
+	"url_validation_error":     http.StatusBadRequest,
+	"body_encoding_error":      http.StatusBadRequest,
+	"graphql_validation_error": http.StatusUnprocessableEntity,
+	"proto_error":              http.StatusUnprocessableEntity,
+	"script_error":             http.StatusUnprocessableEntity,
+	"unauthorized":             http.StatusUnauthorized,
+	"host_not_allowed":         http.StatusForbidden,
+	"plugin_rejected":          http.StatusForbidden,
+	"not_found":                http.StatusNotFound,
+	"rate_limited":             http.StatusTooManyRequests,
+	"connection_error":         http.StatusBadGateway,
+	"dns_error":                http.StatusBadGateway,
+	"connection_refused":       http.StatusBadGateway,
+	"connection_reset":         http.StatusBadGateway,
+	"tls_error":                http.StatusBadGateway,
+	"certificate_error":        http.StatusBadGateway,
+	"proxy_error":              http.StatusBadGateway,
+	"redirect_not_followed":    http.StatusBadGateway,
+	"smtp_error":               http.StatusBadGateway,
+	"wsdl_error":               http.StatusBadGateway,
+	"graphql_error":            http.StatusBadGateway,
+	"plugin_error":             http.StatusBadGateway,
+	"draining":                 http.StatusServiceUnavailable,
+	"queue_timeout":            http.StatusServiceUnavailable,
+	"timeout":                  http.StatusGatewayTimeout,
+}
+
+// realStatusMiddleware marks the response of callers that asked for real
+// status codes, in the header or the query
+func (s *ProxyServer) realStatusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(RealStatusHeader) == "true" || r.URL.Query().Get(realStatusQueryParam) == "true" {
+			w.Header().Set(RealStatusHeader, "true")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errorStatus returns the status to answer a failure of errorType with: 200
+// unless the caller asked for real status codes
+func errorStatus(w http.ResponseWriter, errorType string) int {
+	if w.Header().Get(RealStatusHeader) != "true" {
+		return http.StatusOK
+	}
+	if status, ok := errorStatusCodes[errorType]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// writeProxyResponse writes the outcome of a proxied request, with the status
+// of its error type when it failed and the caller asked for real status codes
+func (s *ProxyServer) writeProxyResponse(w http.ResponseWriter, response *ProxyResponse) {
+	if !response.Success {
+		w.WriteHeader(errorStatus(w, response.ErrorType))
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// streamChunkSize is the maximum size of a streamed body chunk
+const streamChunkSize = 32 * 1024
+
+// ResponseStream receives a proxied response incrementally
+type ResponseStream interface {
+	// WriteHeaders is called once the status and headers are known
+	WriteHeaders(response *ProxyResponse) error
+	// WriteChunk is called for each piece of the body, base64-encoded for binary content
+	WriteChunk(data string, size int) error
+}
+
+// StreamEvent is a single line of an NDJSON response stream
+type StreamEvent struct {
+	Event string `json:"event"` // "progress", "headers", "chunk", "complete" or "error"; subscriptions add "connected", "next" and "graphql_error"
+
+	// Set on headers, complete and error events
+	*ProxyResponse
+
+	// Set on chunk events
+	Data string `json:"data,omitempty"`
+	Size int    `json:"size,omitempty"`
+
+	// Set on progress events
+	Sent  int64 `json:"sent,omitempty"`
+	Total int64 `json:"total,omitempty"`
+
+	// Set on subscription next and graphql_error events
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// errStreamClosed is returned when writing to a stream after the handler returned
+var errStreamClosed = errors.New("stream closed")
+
+// streamResponse hands the response to the stream as it is read and returns
+// the final response metadata, with headers trimmed by filter
+func (c *HTTPClient) streamResponse(resp *http.Response, bodyless bool, redirectChain []RedirectHop, metrics *RequestMetrics, stream ResponseStream, filter *responseHeaderFilter) *ProxyResponse {
+	response := c.processResponse(resp, nil, metrics)
+	response.RedirectChain = redirectChain
+	reportContentEncoding(resp, nil, response)
+	if resp.Header.Get("Content-Encoding") != "" && !resp.Uncompressed {
+		// Undecoded bodies are compressed bytes
+		response.IsBinary = true
+	}
+	if bodyless {
+		describeBodylessResponse(resp, response)
+	}
+	filter.apply(response)
+
+	if err := stream.WriteHeaders(response); err != nil {
+		return c.createErrorResponse(ConnectionError, fmt.Sprintf("Failed to write response: %v", err), metrics)
+	}
+
+	if !bodyless {
+		if err := copyChunks(resp.Body, stream, response.IsBinary, metrics); err != nil {
+			return c.createNetworkErrorResponse(err.Error(), err, metrics)
+		}
+	}
+
+	markPartial(resp, response)
+	metrics.EndTime = time.Now()
+	response.ResponseSize = metrics.FormatSize()
+	response.ResponseTime = metrics.FormatDuration()
+	response.ResponseSizeBytes = metrics.ResponseSize
+	response.ResponseTimeMs = metrics.GetDuration()
+	return response
+}
+
+// copyChunks reads the body and writes it to the stream chunk by chunk. Text
+// chunks never split a UTF-8 sequence; incomplete trailing bytes are carried
+// over to the next chunk.
+func copyChunks(body io.Reader, stream ResponseStream, binary bool, metrics *RequestMetrics) error {
+	buf := make([]byte, streamChunkSize)
+	var pending []byte
+
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			metrics.ResponseSize += int64(n)
+
+			chunk := buf[:n]
+			var data string
+			if binary {
+				data = base64.StdEncoding.EncodeToString(chunk)
+			} else {
+				chunk = append(pending, chunk...)
+				complete := utf8Prefix(chunk)
+				pending = append([]byte(nil), chunk[complete:]...)
+				chunk = chunk[:complete]
+				data = string(chunk)
+			}
+
+			if len(chunk) > 0 {
+				if werr := stream.WriteChunk(data, len(chunk)); werr != nil {
+					return fmt.Errorf("Failed to write response: %v", werr)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read response: %v", err)
+		}
+	}
+
+	// Flush whatever is left, even if it isn't valid UTF-8
+	if len(pending) > 0 {
+		if err := stream.WriteChunk(string(pending), len(pending)); err != nil {
+			return fmt.Errorf("Failed to write response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// utf8Prefix returns the length of p without a trailing incomplete UTF-8 sequence
+func utf8Prefix(p []byte) int {
+	// A sequence is at most 4 bytes, so only the last 3 can be incomplete
+	for i := len(p) - 1; i >= 0 && i >= len(p)-3; i-- {
+		if !utf8.RuneStart(p[i]) {
+			continue
+		}
+		if !utf8.FullRune(p[i:]) {
+			return i
+		}
+		break
+	}
+	return len(p)
+}
+
+// ndjsonStream writes stream events as newline-delimited JSON, flushing each line.
+// Upload progress is written from the transport's goroutine, so writes are
+// serialized and stop once the handler has returned.
+type ndjsonStream struct {
+	mu      sync.Mutex
+	closed  bool
+	encoder *json.Encoder
+	flusher http.Flusher
+}
+
+// newNDJSONStream prepares w for an NDJSON response
+func newNDJSONStream(w http.ResponseWriter) *ndjsonStream {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonStream{
+		encoder: json.NewEncoder(w),
+		flusher: flusher,
+	}
+}
+
+// write encodes one event and flushes it to the caller
+func (s *ndjsonStream) write(event *StreamEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errStreamClosed
+	}
+	if err := s.encoder.Encode(event); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func (s *ndjsonStream) WriteHeaders(response *ProxyResponse) error {
+	return s.write(&StreamEvent{Event: "headers", ProxyResponse: response})
+}
+
+func (s *ndjsonStream) WriteChunk(data string, size int) error {
+	return s.write(&StreamEvent{Event: "chunk", Data: data, Size: size})
+}
+
+func (s *ndjsonStream) WriteProgress(sent, total int64) error {
+	return s.write(&StreamEvent{Event: "progress", Sent: sent, Total: total})
+}
+
+// close stops any further writes
+func (s *ndjsonStream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+// wantsNDJSON reports whether the caller asked for a streamed response
+func wantsNDJSON(r *http.Request, req *ProxyRequest) bool {
+	return req.Stream || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// streamJSONRequest executes the request and streams it to the caller as NDJSON
+// events: headers, body chunks, and a final complete (or error) event
+func (s *ProxyServer) streamJSONRequest(ctx context.Context, w http.ResponseWriter, req *ProxyRequest) {
+	stream := newNDJSONStream(w)
+	defer stream.close()
+
+	response, err := s.httpClient.StreamRequest(ctx, req, stream)
+	if err != nil {
+		s.logger.Printf("[%s] Request failed: %v", requestID(w), err)
+		response = &ProxyResponse{
+			Success:      false,
+			ErrorType:    "unknown_error",
+			ErrorTitle:   "Request Failed",
+			ErrorMessage: err.Error(),
+		}
+	}
+
+	response.RequestID = requestID(w)
+	s.recordHistory(w, req.Method, req.URL, response)
+
+	event := &StreamEvent{Event: "complete", ProxyResponse: response}
+	if !response.Success {
+		event.Event = "error"
+	}
+	if err := stream.write(event); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// graphQLTransportWS is the subprotocol of the graphql-ws library
+	graphQLTransportWS = "graphql-transport-ws"
+
+	// graphQLWS is the subprotocol of the older subscriptions-transport-ws
+	// library, used when a server does not offer graphql-transport-ws
+	graphQLWS = "graphql-ws"
+
+	// subscriptionAckTimeout bounds the wait for connection_ack
+	subscriptionAckTimeout = 10 * time.Second
+
+	// subscriptionID identifies the single subscription of a connection
+	subscriptionID = "1"
+)
+
+// GraphQLSubscribeRequest is the JSON body of /graphql/subscribe
+type GraphQLSubscribeRequest struct {
+	URL              string                 `json:"url"`
+	Headers          []string               `json:"headers,omitempty"`
+	Query            string                 `json:"query"`
+	Variables        map[string]interface{} `json:"variables,omitempty"`
+	OperationName    string                 `json:"operationName,omitempty"`
+	ConnectionParams map[string]interface{} `json:"connectionParams,omitempty"`
+	Timeout          int                    `json:"timeout,omitempty"`     // Seconds before the subscription is stopped
+	MaxMessages      int                    `json:"maxMessages,omitempty"` // Results after which the subscription is stopped
+}
+
+// graphQLWSMessage is a message of either subscription protocol
+type graphQLWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// subscriptionURL converts an HTTP endpoint URL to its WebSocket URL
+func subscriptionURL(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return "", fmt.Errorf("Invalid URL format")
+	}
+	switch parsed.Scheme {
+	case "http", "ws":
+		parsed.Scheme = "ws"
+	case "https", "wss":
+		parsed.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("Only HTTP, HTTPS, WS and WSS schemes are supported")
+	}
+	return parsed.String(), nil
+}
+
+// subscribeGraphQL runs a subscription and writes each result to the stream
+// as a "next" event until the server completes it, maxMessages results have
+// arrived or ctx ends
+func (c *HTTPClient) subscribeGraphQL(ctx context.Context, req *GraphQLSubscribeRequest, stream *sseStream) error {
+	endpoint, err := subscriptionURL(req.URL)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	for _, field := range parseHeaderFields(req.Headers) {
+		header.Add(field.Name, field.Value)
+	}
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: subscriptionAckTimeout,
+		Subprotocols:     []string{graphQLTransportWS, graphQLWS},
+	}
+	conn, resp, err := dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("WebSocket handshake failed: HTTP %d", resp.StatusCode)
+		}
+		return fmt.Errorf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadLimit(MaxWebSocketMessageSize)
+
+	// Writes come from both the read loop and the cancellation below
+	var writeMu sync.Mutex
+	send := func(message graphQLWSMessage) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(message)
+	}
+
+	// The older protocol names its messages differently
+	legacy := conn.Subprotocol() == graphQLWS
+	subscribe, next, stop := "subscribe", "next", "complete"
+	if legacy {
+		subscribe, next, stop = "start", "data", "stop"
+	}
+
+	// Close the connection when ctx ends so the read loop returns
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			send(graphQLWSMessage{ID: subscriptionID, Type: stop})
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	init := graphQLWSMessage{Type: "connection_init"}
+	if req.ConnectionParams != nil {
+		init.Payload, _ = json.Marshal(req.ConnectionParams)
+	}
+	if err := send(init); err != nil {
+		return fmt.Errorf("Failed to initialize connection: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(subscriptionAckTimeout))
+	for {
+		var message graphQLWSMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			return fmt.Errorf("No connection_ack from the server: %v", err)
+		}
+		if message.Type == "connection_ack" {
+			break
+		}
+		if message.Type == "connection_error" {
+			return fmt.Errorf("Connection refused by the server: %s", message.Payload)
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	operation := map[string]interface{}{"query": req.Query}
+	if req.Variables != nil {
+		operation["variables"] = req.Variables
+	}
+	if req.OperationName != "" {
+		operation["operationName"] = req.OperationName
+	}
+	payload, _ := json.Marshal(operation)
+	if err := send(graphQLWSMessage{ID: subscriptionID, Type: subscribe, Payload: payload}); err != nil {
+		return fmt.Errorf("Failed to subscribe: %v", err)
+	}
+	stream.write(&StreamEvent{Event: "connected", Data: conn.Subprotocol()})
+
+	messages := 0
+	for {
+		var message graphQLWSMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == websocket.ErrReadLimit {
+				return fmt.Errorf("The server sent a message larger than %d bytes", MaxWebSocketMessageSize)
+			}
+			return fmt.Errorf("Connection lost: %v", err)
+		}
+
+		switch message.Type {
+		case next:
+			if err := stream.write(&StreamEvent{Event: "next", Payload: message.Payload}); err != nil {
+				return nil
+			}
+			messages++
+			if req.MaxMessages > 0 && messages >= req.MaxMessages {
+				send(graphQLWSMessage{ID: subscriptionID, Type: stop})
+				return nil
+			}
+		case "error":
+			stream.write(&StreamEvent{Event: "graphql_error", Payload: message.Payload})
+			return nil
+		case "complete":
+			return nil
+		case "ping":
+			send(graphQLWSMessage{Type: "pong"})
+		}
+	}
+}
+
+// handleGraphQLSubscribe relays a GraphQL subscription as Server-Sent Events.
+// GET requests take the subscription from query parameters so the endpoint
+// can be used with EventSource; POST requests take JSON.
+func (s *ProxyServer) handleGraphQLSubscribe(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	stream := newSSEStream(w)
+	defer stream.close()
+
+	var req GraphQLSubscribeRequest
+	if r.Method == "GET" {
+		query := r.URL.Query()
+		req = GraphQLSubscribeRequest{
+			URL:           query.Get("url"),
+			Headers:       query["header"],
+			Query:         query.Get("query"),
+			OperationName: query.Get("operationName"),
+		}
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				stream.writeError("request_format_error", "Invalid Variables", fmt.Sprintf("Failed to parse variables: %v", err))
+				return
+			}
+		}
+		req.Timeout, _ = strconv.Atoi(query.Get("timeout"))
+		req.MaxMessages, _ = strconv.Atoi(query.Get("maxMessages"))
+	} else {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			stream.writeError("request_format_error", "Failed to read request body", err.Error())
+			return
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			stream.writeError("request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+			return
+		}
+	}
+
+	if req.URL == "" || req.Query == "" {
+		stream.writeError("request_format_error", "Missing Fields", "URL and query are required")
+		return
+	}
+	if err := checkTargetURL(r.Context(), req.URL); err != nil {
+		stream.writeError(HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	s.logger.Printf("[%s] Subscribing to %s", requestID(w), req.URL)
+
+	if err := s.httpClient.subscribeGraphQL(ctx, &req, stream); err != nil {
+		s.logger.Printf("[%s] Subscription failed: %v", requestID(w), err)
+		stream.writeError(networkErrorType(err).Type, "Subscription Failed", err.Error())
+		return
+	}
+	stream.write(&StreamEvent{Event: "complete"})
+}
@@ -0,0 +1,479 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// TailEventHistory and TailEventLog are the types of live tail events
+	TailEventHistory = "history"
+	TailEventLog     = "log"
+
+	// tailBuffer is how many events a slow client may fall behind by before
+	// events are dropped for it
+	tailBuffer = 256
+
+	tailPingInterval = 30 * time.Second
+	tailWriteTimeout = 10 * time.Second
+)
+
+// TailEvent is a message of the live tail: a request added to the history or
+// a line the proxy logged
+type TailEvent struct {
+	Type  string        `json:"type"` // "history" or "log"
+	Time  time.Time     `json:"time"`
+	Entry *HistoryEntry `json:"entry,omitempty"`
+	Line  string        `json:"line,omitempty"`
+
+	// Events skipped before this one because the client fell behind
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// Tail fans out new history entries and log lines to live tail clients. Log
+// lines are scrubbed like the history. A nil Tail publishes nothing.
+type Tail struct {
+	mu          sync.Mutex
+	scrubber    *Scrubber
+	subscribers map[*tailSubscriber]struct{}
+	closed      bool
+	clients     sync.WaitGroup // Until each client has unsubscribed
+}
+
+// tailSubscriber is a client of the live tail
+type tailSubscriber struct {
+	events  chan *TailEvent
+	dropped int
+}
+
+// NewTail creates a live tail without clients
+func NewTail(scrubber *Scrubber) *Tail {
+	return &Tail{scrubber: scrubber, subscribers: make(map[*tailSubscriber]struct{})}
+}
+
+// Subscribe returns the events published from now on, and a function to stop
+// receiving them. The channel is closed when the tail is.
+func (t *Tail) Subscribe() (<-chan *TailEvent, func()) {
+	subscriber := &tailSubscriber{events: make(chan *TailEvent, tailBuffer)}
+
+	t.mu.Lock()
+	if t.closed {
+		close(subscriber.events)
+	} else {
+		t.subscribers[subscriber] = struct{}{}
+	}
+	t.clients.Add(1)
+	t.mu.Unlock()
+
+	var once sync.Once
+	return subscriber.events, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.subscribers, subscriber)
+			t.mu.Unlock()
+			t.clients.Done()
+		})
+	}
+}
+
+// Close ends the events of every client, as the proxy is stopping, and waits
+// until ctx is done for the clients to be told
+func (t *Tail) Close(ctx context.Context) {
+	t.mu.Lock()
+	t.closed = true
+	for subscriber := range t.subscribers {
+		close(subscriber.events)
+		delete(t.subscribers, subscriber)
+	}
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.clients.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// publish sends an event to every client without waiting; clients that fell
+// behind skip it and are told how many they missed with their next event
+func (t *Tail) publish(event *TailEvent) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for subscriber := range t.subscribers {
+		sent := event
+		if subscriber.dropped > 0 {
+			copied := *event
+			copied.Dropped = subscriber.dropped
+			sent = &copied
+		}
+		select {
+		case subscriber.events <- sent:
+			subscriber.dropped = 0
+		default:
+			subscriber.dropped++
+		}
+	}
+}
+
+// publishEntry sends a new history entry to the clients
+func (t *Tail) publishEntry(entry *HistoryEntry) {
+	t.publish(&TailEvent{Type: TailEventHistory, Time: entry.Time, Entry: entry})
+}
+
+// Write sends each line logged to the clients, so the tail can be one of a
+// logger's writers
+func (t *Tail) Write(p []byte) (int, error) {
+	if t == nil {
+		return len(p), nil
+	}
+	now := time.Now().UTC()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.publish(&TailEvent{Type: TailEventLog, Time: now, Line: t.scrubber.String(line)})
+	}
+	return len(p), nil
+}
+
+// tailUpgrader accepts live tail connections from any origin, as the CORS
+// headers allow the rest of the API to be called from any origin
+var tailUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// tailQuery selects the events a live tail client receives
+type tailQuery struct {
+	filter *historyFilter
+	types  map[string]bool
+	recent int // Latest matching entries sent first
+}
+
+// parseTailQuery reads the history filters of a live tail, the event types
+// and how many recent entries to send first
+func parseTailQuery(query url.Values) (*tailQuery, error) {
+	filter, err := parseHistoryFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	tq := &tailQuery{filter: filter, types: map[string]bool{TailEventHistory: true, TailEventLog: true}}
+	if value := splitList(query.Get("types")); len(value) > 0 {
+		tq.types = map[string]bool{}
+		for _, kind := range value {
+			if kind != TailEventHistory && kind != TailEventLog {
+				return nil, fmt.Errorf("Unknown event type %q; use history or log", kind)
+			}
+			tq.types[kind] = true
+		}
+	}
+	if value := query.Get("recent"); value != "" {
+		if tq.recent, err = strconv.Atoi(value); err != nil || tq.recent < 0 || tq.recent > MaxHistoryEntries {
+			return nil, fmt.Errorf("recent must be 0 to %d", MaxHistoryEntries)
+		}
+	}
+	return tq, nil
+}
+
+// tailStream picks the events of one live tail client
+type tailStream struct {
+	query   *tailQuery
+	sent    map[string]bool // Recent entries sent, to skip when published
+	dropped int
+}
+
+// recentEvents returns the latest matching entries as events, oldest first as
+// if they had just happened. Call it after subscribing, so no entry falls in
+// between.
+func (t *tailStream) recentEvents(history *History) ([]*TailEvent, error) {
+	t.sent = make(map[string]bool)
+	if t.query.recent == 0 || !t.query.types[TailEventHistory] {
+		return nil, nil
+	}
+	entries, err := history.Recent(t.query.recent, t.query.filter.matches)
+	events := make([]*TailEvent, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		t.sent[entries[i].ID] = true
+		events = append(events, &TailEvent{Type: TailEventHistory, Time: entries[i].Time, Entry: entries[i]})
+	}
+	return events, err
+}
+
+// next returns the event to send for a published one, or nil when it is
+// filtered out. Events filtered out still count what was dropped before them.
+func (t *tailStream) next(event *TailEvent) *TailEvent {
+	t.dropped += event.Dropped
+	if !t.query.types[event.Type] {
+		return nil
+	}
+	if event.Type == TailEventHistory {
+		if t.sent[event.Entry.ID] {
+			delete(t.sent, event.Entry.ID)
+			return nil
+		}
+		if !t.query.filter.matches(event.Entry) {
+			return nil
+		}
+	}
+	if t.dropped != event.Dropped {
+		copied := *event
+		copied.Dropped = t.dropped
+		event = &copied
+	}
+	t.dropped = 0
+	return event
+}
+
+// handleHistoryTail handles /proxy/history/tail, streaming new history
+// entries and log lines over a WebSocket as JSON TailEvents
+func (s *ProxyServer) handleHistoryTail(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	query, err := parseTailQuery(r.URL.Query())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		s.writeErrorResponse(w, "request_format_error", "Invalid History Query", err.Error())
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		w.Header().Set("Content-Type", "application/json")
+		s.writeErrorResponse(w, "request_format_error", "WebSocket Required", "Connect with a WebSocket client to tail the history")
+		return
+	}
+
+	// Subscribe before reading the recent entries, so none falls in between
+	events, unsubscribe := s.tail.Subscribe()
+	defer unsubscribe()
+
+	conn, err := tailUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Printf("[%s] Failed to open live tail: %v", requestID(w), err)
+		return
+	}
+	defer conn.Close()
+
+	send := func(event *TailEvent) bool {
+		conn.SetWriteDeadline(time.Now().Add(tailWriteTimeout))
+		return conn.WriteJSON(event) == nil
+	}
+
+	stream := &tailStream{query: query}
+	recent, err := stream.recentEvents(s.history)
+	if err != nil {
+		s.logger.Printf("[%s] Failed to read recent history: %v", requestID(w), err)
+	}
+	for _, event := range recent {
+		if !send(event) {
+			return
+		}
+	}
+
+	// Clients only send close frames; reading handles them and notices when
+	// the connection is gone
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(tailPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(tailWriteTimeout)); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "The proxy is stopping"),
+					time.Now().Add(time.Second))
+				return
+			}
+			if event = stream.next(event); event != nil && !send(event) {
+				return
+			}
+		}
+	}
+}
+
+// TailCommand implements `proxy tail`, printing the requests and log lines of
+// a running proxy as they happen. It exits with 1 when the connection fails
+// or the proxy closes it, and with 0 on Ctrl+C.
+func TailCommand(args []string) int {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	var (
+		proxyURL   = fs.String("url", "http://localhost:8080", "URL of the proxy")
+		socketPath = fs.String("socket", "", "Unix socket of a proxy started with -socket, instead of -url")
+		apiKey     = fs.String("api-key", "", "API key, when the proxy requires one")
+		logs       = fs.Bool("logs", true, "Also print the proxy's log lines, which the filters do not apply to")
+		recent     = fs.Int("recent", 0, "First print this many of the latest matching requests")
+		jsonOutput = fs.Bool("json", false, "Print each event as a line of JSON")
+		hosts      = fs.String("host", "", "Comma-separated target hosts (e.g. api.example.com,*.internal)")
+		methods    = fs.String("method", "", "Comma-separated request methods")
+		statuses   = fs.String("status", "", "Comma-separated statuses, classes or ranges (e.g. 404,5xx)")
+		errorTypes = fs.String("error-type", "", "Comma-separated error types (e.g. timeout,dns_error)")
+		sources    = fs.String("source", "", "Comma-separated sources: proxy, schedule, job or monitor")
+		failed     = fs.Bool("failed", false, "Only print requests that failed")
+		text       = fs.String("q", "", "Only print requests whose URL contains this text")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s tail [options]\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"host": *hosts, "method": *methods, "status": *statuses,
+		"errorType": *errorTypes, "source": *sources, "q": *text,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if *failed {
+		query.Set("success", "false")
+	}
+	if *recent > 0 {
+		query.Set("recent", strconv.Itoa(*recent))
+	}
+	if !*logs {
+		query.Set("types", TailEventHistory)
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	target, err := url.Parse(strings.TrimRight(*proxyURL, "/"))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		fmt.Fprintf(os.Stderr, "Invalid -url %q, expected http://host:port\n", *proxyURL)
+		return 2
+	}
+	if *socketPath != "" {
+		dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", *socketPath)
+		}
+		target = &url.URL{Scheme: "http", Host: "localhost"}
+	}
+	target.Scheme = strings.Replace(target.Scheme, "http", "ws", 1)
+	target.Path += "/proxy/history/tail"
+	target.RawQuery = query.Encode()
+
+	header := http.Header{}
+	if *apiKey != "" {
+		header.Set(APIKeyHeader, *apiKey)
+	}
+	conn, resp, err := dialer.Dial(target.String(), header)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to the proxy: %v\n", tailDialError(err, resp))
+		return 1
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			var event TailEvent
+			if err := conn.ReadJSON(&event); err != nil {
+				closed <- err
+				return
+			}
+			if event.Dropped > 0 {
+				fmt.Fprintf(os.Stderr, "... %d events skipped\n", event.Dropped)
+			}
+			printTailEvent(os.Stdout, &event, *jsonOutput)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second))
+		return 0
+	case err := <-closed:
+		fmt.Fprintf(os.Stderr, "The proxy closed the connection: %v\n", err)
+		return 1
+	}
+}
+
+// tailDialError explains a failed connection, with the proxy's error message
+// when it answered without switching to a WebSocket
+func tailDialError(err error, resp *http.Response) error {
+	if resp == nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var failure ProxyResponse
+	if json.NewDecoder(resp.Body).Decode(&failure) == nil && failure.ErrorMessage != "" {
+		return errors.New(failure.ErrorMessage)
+	}
+	return fmt.Errorf("%v (%s)", err, resp.Status)
+}
+
+// printTailEvent prints an event as JSON, or a history entry in the style of
+// the proxy's log lines, tagged with its source
+func printTailEvent(out io.Writer, event *TailEvent, asJSON bool) {
+	switch {
+	case asJSON:
+		if data, err := json.Marshal(event); err == nil {
+			fmt.Fprintln(out, string(data))
+		}
+	case event.Type == TailEventLog:
+		fmt.Fprintln(out, event.Line)
+	case event.Entry != nil:
+		entry := event.Entry
+		outcome := strconv.Itoa(entry.Status)
+		if !entry.Success {
+			outcome = entry.ErrorType + ": " + entry.ErrorMessage
+		}
+		line := fmt.Sprintf("[%s] %s [%s] %s %s %s", strings.ToUpper(entry.Source),
+			entry.Time.Local().Format("2006/01/02 15:04:05"), entry.ID, entry.Method, entry.URL, outcome)
+		if entry.ResponseTime != "" {
+			line += " " + entry.ResponseTime
+		}
+		if entry.ResponseSize != "" {
+			line += " " + entry.ResponseSize
+		}
+		fmt.Fprintln(out, line)
+	}
+}
@@ -0,0 +1,283 @@
+package slingshot
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateFunc is a function that can be called in a {{...}} placeholder.
+// In a pipeline, the previous result is passed as the last argument.
+type templateFunc func(args []interface{}) (interface{}, error)
+
+// templateFuncs are the functions available in placeholders
+var templateFuncs = map[string]templateFunc{
+	"uuid": func(args []interface{}) (interface{}, error) {
+		return newUUID(), nil
+	},
+	"timestamp": func(args []interface{}) (interface{}, error) {
+		return time.Now().Unix(), nil
+	},
+	"timestampMs": func(args []interface{}) (interface{}, error) {
+		return time.Now().UnixMilli(), nil
+	},
+	"now": func(args []interface{}) (interface{}, error) {
+		return time.Now().UTC(), nil
+	},
+	"isoformat": func(args []interface{}) (interface{}, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(time.RFC3339), nil
+	},
+	"unix": func(args []interface{}) (interface{}, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return t.Unix(), nil
+	},
+	"format": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("format takes a layout and a time")
+		}
+		t, err := timeArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(templateString(args[0])), nil
+	},
+	"randomInt": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("randomInt takes a minimum and a maximum")
+		}
+		min, err := intArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		max, err := intArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if max < min {
+			return nil, fmt.Errorf("randomInt maximum is less than its minimum")
+		}
+		return min + rand.IntN(max-min+1), nil
+	},
+	"randomString": func(args []interface{}) (interface{}, error) {
+		n, err := intArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[rand.IntN(len(letters))]
+		}
+		return string(b), nil
+	},
+	"upper": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("upper takes one value")
+		}
+		return strings.ToUpper(templateString(args[0])), nil
+	},
+	"lower": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("lower takes one value")
+		}
+		return strings.ToLower(templateString(args[0])), nil
+	},
+	"base64": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("base64 takes one value")
+		}
+		return base64.StdEncoding.EncodeToString([]byte(templateString(args[0]))), nil
+	},
+}
+
+// evaluateTemplate evaluates a placeholder expression such as
+// `randomInt 1 100` or `now.Add "24h" | isoformat`
+func evaluateTemplate(expr string, vars map[string]string) (string, error) {
+	commands, err := splitPipeline(expr)
+	if err != nil {
+		return "", err
+	}
+
+	var result interface{}
+	for i, tokens := range commands {
+		if len(tokens) == 0 {
+			return "", fmt.Errorf("Empty command in %q", expr)
+		}
+		args := make([]interface{}, 0, len(tokens))
+		for _, token := range tokens[1:] {
+			args = append(args, templateArg(token, vars))
+		}
+		if i > 0 {
+			args = append(args, result)
+		}
+		result, err = callTemplateFunc(tokens[0], args)
+		if err != nil {
+			return "", err
+		}
+	}
+	return templateString(result), nil
+}
+
+// callTemplateFunc calls a function by name. A name such as `now.Add` calls
+// the method Add on the result of now, and `fake.email` generates fake data.
+func callTemplateFunc(name string, args []interface{}) (interface{}, error) {
+	if fn, ok := templateFuncs[name]; ok {
+		return fn(args)
+	}
+	if field, ok := strings.CutPrefix(name, "fake."); ok {
+		if fn, ok := fakeFuncs[field]; ok {
+			return fn(args)
+		}
+		return nil, fmt.Errorf("Unknown fake data %q", field)
+	}
+
+	base, method, found := strings.Cut(name, ".")
+	fn, ok := templateFuncs[base]
+	if !found || !ok {
+		return nil, fmt.Errorf("Unknown function %q", name)
+	}
+	value, err := fn(nil)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := value.(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("%s has no method %s", base, method)
+	}
+
+	switch method {
+	case "Add":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("Add takes a duration")
+		}
+		d, err := time.ParseDuration(templateString(args[0]))
+		if err != nil {
+			return nil, err
+		}
+		return t.Add(d), nil
+	case "AddDate":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("AddDate takes years, months and days")
+		}
+		var n [3]int
+		for i := range n {
+			if n[i], err = intArg(args, i); err != nil {
+				return nil, err
+			}
+		}
+		return t.AddDate(n[0], n[1], n[2]), nil
+	}
+	return nil, fmt.Errorf("%s has no method %s", base, method)
+}
+
+// splitPipeline splits an expression into commands separated by | and each
+// command into tokens. Quoted strings are kept as single tokens.
+func splitPipeline(expr string) ([][]string, error) {
+	var commands [][]string
+	var tokens []string
+	var token strings.Builder
+	inToken, inQuote, escaped := false, false, false
+
+	endToken := func() {
+		if inToken {
+			tokens = append(tokens, token.String())
+			token.Reset()
+			inToken = false
+		}
+	}
+
+	for _, r := range expr {
+		switch {
+		case inQuote:
+			token.WriteRune(r)
+			if escaped {
+				escaped = false
+			} else if r == '\\' {
+				escaped = true
+			} else if r == '"' {
+				inQuote = false
+			}
+		case r == '"':
+			inToken, inQuote = true, true
+			token.WriteRune(r)
+		case r == '|':
+			endToken()
+			commands = append(commands, tokens)
+			tokens = nil
+		case r == ' ' || r == '\t':
+			endToken()
+		default:
+			inToken = true
+			token.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("Unterminated string in %q", expr)
+	}
+	endToken()
+	return append(commands, tokens), nil
+}
+
+// templateArg converts a token to an argument. Quoted strings are unquoted,
+// and bare words are looked up as variables.
+func templateArg(token string, vars map[string]string) interface{} {
+	if strings.HasPrefix(token, `"`) {
+		if s, err := strconv.Unquote(token); err == nil {
+			return s
+		}
+	}
+	if value, ok := vars[token]; ok {
+		return value
+	}
+	return token
+}
+
+// templateString converts a function result to text. Times are formatted
+// as RFC 3339.
+func templateString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// intArg returns argument i as an integer
+func intArg(args []interface{}, i int) (int, error) {
+	if i >= len(args) {
+		return 0, fmt.Errorf("Missing argument %d", i+1)
+	}
+	if n, ok := args[i].(int); ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(templateString(args[i]))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid number %q", templateString(args[i]))
+	}
+	return n, nil
+}
+
+// timeArg returns argument i as a time. Strings are parsed as RFC 3339.
+func timeArg(args []interface{}, i int) (time.Time, error) {
+	if i >= len(args) {
+		return time.Time{}, fmt.Errorf("Missing time argument")
+	}
+	if t, ok := args[i].(time.Time); ok {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, templateString(args[i]))
+}
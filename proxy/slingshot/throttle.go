@@ -0,0 +1,96 @@
+package slingshot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttleSlice is how often a throttled body is allowed to catch up; each
+// read moves at most this much time's worth of bytes
+const throttleSlice = 50 * time.Millisecond
+
+// throttleRates returns the upload and download rates of a request in bytes
+// per second, zero meaning unlimited. throttleKbps sets both directions and
+// the per-direction settings override it.
+func throttleRates(req *ProxyRequest) (upload, download int64, err error) {
+	if req.ThrottleKbps < 0 || req.ThrottleUploadKbps < 0 || req.ThrottleDownloadKbps < 0 {
+		return 0, 0, fmt.Errorf("throttleKbps, throttleUploadKbps and throttleDownloadKbps cannot be negative")
+	}
+
+	upload, download = int64(req.ThrottleKbps), int64(req.ThrottleKbps)
+	if req.ThrottleUploadKbps > 0 {
+		upload = int64(req.ThrottleUploadKbps)
+	}
+	if req.ThrottleDownloadKbps > 0 {
+		download = int64(req.ThrottleDownloadKbps)
+	}
+
+	// Kilobits to bytes
+	return upload * 1000 / 8, download * 1000 / 8, nil
+}
+
+// throttleRequestBody limits how fast the transport reads the request body
+func throttleRequestBody(httpReq *http.Request, rate int64) {
+	httpReq.Body = newThrottledReader(httpReq.Body, rate)
+
+	getBody := httpReq.GetBody
+	if getBody != nil {
+		httpReq.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return newThrottledReader(body, rate), nil
+		}
+	}
+}
+
+// throttledReader reads no faster than rate bytes per second, measured from
+// the first read. Closing it stops a read that is waiting.
+type throttledReader struct {
+	io.ReadCloser
+	rate      int64
+	read      int64
+	start     time.Time
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newThrottledReader limits body to rate bytes per second
+func newThrottledReader(body io.ReadCloser, rate int64) *throttledReader {
+	return &throttledReader{ReadCloser: body, rate: rate, closed: make(chan struct{})}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+
+	// Wait until the bytes read so far are due
+	due := r.start.Add(time.Duration(float64(r.read) / float64(r.rate) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-r.closed:
+			timer.Stop()
+			return 0, io.ErrClosedPipe
+		}
+	}
+
+	limit := max(r.rate*int64(throttleSlice)/int64(time.Second), 1)
+	if int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,148 @@
+package slingshot
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// tlsFingerprints maps the tlsFingerprint option to the browser handshakes
+// uTLS reproduces
+var tlsFingerprints = map[string]utls.ClientHelloID{
+	"chrome":  utls.HelloChrome_Auto,
+	"firefox": utls.HelloFirefox_Auto,
+	"safari":  utls.HelloSafari_Auto,
+	"ios":     utls.HelloIOS_Auto,
+}
+
+// lookupTLSFingerprint finds the browser handshake for a tlsFingerprint name
+func lookupTLSFingerprint(name string) (utls.ClientHelloID, error) {
+	id, ok := tlsFingerprints[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(tlsFingerprints))
+		for known := range tlsFingerprints {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return utls.ClientHelloID{}, fmt.Errorf("tlsFingerprint must be one of %s", strings.Join(names, ", "))
+	}
+	return id, nil
+}
+
+// fingerprintHandshake runs a TLS handshake over conn that sends the browser's
+// ClientHello. The server name and certificate verification come from config.
+// The browser's ALPN list is kept without h2, which the proxy cannot speak.
+func fingerprintHandshake(ctx context.Context, conn net.Conn, config *tls.Config, fingerprint string) (net.Conn, error) {
+	id, err := lookupTLSFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := utls.UTLSIdToSpec(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, extension := range spec.Extensions {
+		if alpn, ok := extension.(*utls.ALPNExtension); ok {
+			protocols := make([]string, 0, len(alpn.AlpnProtocols))
+			for _, protocol := range alpn.AlpnProtocols {
+				if protocol != "h2" {
+					protocols = append(protocols, protocol)
+				}
+			}
+			alpn.AlpnProtocols = protocols
+		}
+	}
+
+	uconn := utls.UClient(conn, &utls.Config{
+		ServerName: config.ServerName,
+		RootCAs:    config.RootCAs,
+	}, utls.HelloCustom)
+	if err := uconn.ApplyPreset(&spec); err != nil {
+		return nil, err
+	}
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return uconn, nil
+}
+
+// connTLSState returns what was negotiated on a connection, whether Go's TLS
+// or uTLS ran the handshake, or nil for plain connections
+func connTLSState(conn net.Conn) *tls.ConnectionState {
+	switch conn := conn.(type) {
+	case *tls.Conn:
+		state := conn.ConnectionState()
+		return &state
+	case *utls.UConn:
+		state := conn.ConnectionState()
+		return &tls.ConnectionState{
+			Version:            state.Version,
+			HandshakeComplete:  state.HandshakeComplete,
+			DidResume:          state.DidResume,
+			CipherSuite:        state.CipherSuite,
+			NegotiatedProtocol: state.NegotiatedProtocol,
+			ServerName:         state.ServerName,
+			PeerCertificates:   state.PeerCertificates,
+			VerifiedChains:     state.VerifiedChains,
+		}
+	}
+	return nil
+}
+
+// fingerprintTransport sends requests over connections that complete the
+// handshake with a browser's ClientHello. Go's transport only reports the TLS
+// state of its own connections, so it is filled in from the connection used.
+type fingerprintTransport struct {
+	transport *http.Transport
+}
+
+// newFingerprintTransport clones base to dial TLS with the fingerprint
+func newFingerprintTransport(base *http.Transport, config *tls.Config, fingerprint string) *fingerprintTransport {
+	transport := base.Clone()
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := transport.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		host, _, _ := net.SplitHostPort(addr)
+		sessionConfig := config.Clone()
+		if sessionConfig.ServerName == "" {
+			sessionConfig.ServerName = host
+		}
+		tlsConn, err := fingerprintHandshake(ctx, conn, sessionConfig, fingerprint)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return &fingerprintTransport{transport: transport}
+}
+
+func (t *fingerprintTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var conn net.Conn
+	traced := req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { conn = info.Conn },
+	}))
+	resp, err := t.transport.RoundTrip(traced)
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	if resp.TLS == nil {
+		resp.TLS = connTLSState(conn)
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the connections kept for the request
+func (t *fingerprintTransport) CloseIdleConnections() {
+	t.transport.CloseIdleConnections()
+}
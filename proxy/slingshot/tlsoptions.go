@@ -0,0 +1,141 @@
+package slingshot
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// tlsVersions maps the tlsMinVersion and tlsMaxVersion options to versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// requestTLSConfig returns the TLS configuration for a request's TLS options,
+// or nil when it sets none and the shared transport's applies. Once a request
+// sets a version, any version from TLS 1.0 to 1.3 it does not rule out may be
+// negotiated.
+func requestTLSConfig(req *ProxyRequest) (*tls.Config, error) {
+	if req.TLSMinVersion == "" && req.TLSMaxVersion == "" && len(req.CipherSuites) == 0 && len(req.ALPNProtocols) == 0 && req.ServerName == "" && req.TLSFingerprint == "" {
+		return nil, nil
+	}
+
+	// A browser fingerprint fixes the versions, suites and protocols offered;
+	// only the server name can still be chosen
+	if req.TLSFingerprint != "" {
+		if _, err := lookupTLSFingerprint(req.TLSFingerprint); err != nil {
+			return nil, err
+		}
+		for _, option := range []struct {
+			name string
+			set  bool
+		}{
+			{"tlsMinVersion", req.TLSMinVersion != ""},
+			{"tlsMaxVersion", req.TLSMaxVersion != ""},
+			{"cipherSuites", len(req.CipherSuites) > 0},
+			{"alpnProtocols", len(req.ALPNProtocols) > 0},
+		} {
+			if option.set {
+				return nil, fmt.Errorf("%s cannot be combined with tlsFingerprint, which sends the browser's own handshake", option.name)
+			}
+		}
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS13}
+	for _, option := range []struct {
+		name    string
+		value   string
+		version *uint16
+	}{
+		{"tlsMinVersion", req.TLSMinVersion, &config.MinVersion},
+		{"tlsMaxVersion", req.TLSMaxVersion, &config.MaxVersion},
+	} {
+		if option.value == "" {
+			continue
+		}
+		version, ok := tlsVersions[option.value]
+		if !ok {
+			return nil, fmt.Errorf("%s must be 1.0, 1.1, 1.2 or 1.3", option.name)
+		}
+		*option.version = version
+	}
+
+	// TLS 1.3 suites are not configurable, so choosing suites caps the
+	// version at TLS 1.2 unless the request says otherwise
+	if len(req.CipherSuites) > 0 {
+		if req.TLSMaxVersion == "" {
+			if config.MinVersion == tls.VersionTLS13 {
+				return nil, fmt.Errorf("cipherSuites only apply up to TLS 1.2, not with tlsMinVersion 1.3")
+			}
+			config.MaxVersion = tls.VersionTLS12
+		}
+		suites, err := lookupCipherSuites(req.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		config.CipherSuites = suites
+	}
+
+	// The protocols are offered as given; HTTP/2 is left out because the
+	// proxy could not speak it once the server chose it
+	for _, protocol := range req.ALPNProtocols {
+		switch {
+		case protocol == "" || len(protocol) > 255:
+			return nil, fmt.Errorf("alpnProtocols must be 1 to 255 bytes long")
+		case protocol == "h2":
+			return nil, fmt.Errorf("alpnProtocols cannot offer h2; requests are sent over HTTP/1.x")
+		}
+	}
+	config.NextProtos = req.ALPNProtocols
+
+	// The certificate is verified against the server name sent, not the URL
+	// host. IP addresses are never sent as SNI.
+	if req.ServerName != "" {
+		if net.ParseIP(req.ServerName) != nil || strings.ContainsAny(req.ServerName, ":/ ") {
+			return nil, fmt.Errorf("serverName must be a host name, such as tenant.example.com")
+		}
+		config.ServerName = req.ServerName
+	}
+
+	if config.MinVersion > config.MaxVersion {
+		return nil, fmt.Errorf("tlsMinVersion %s is above tlsMaxVersion %s", req.TLSMinVersion, req.TLSMaxVersion)
+	}
+	return config, nil
+}
+
+// lookupCipherSuites finds the IDs of TLS 1.0-1.2 cipher suites by their IANA
+// names, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Insecure suites are
+// allowed, to check whether a server still accepts them.
+func lookupCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]*tls.CipherSuite)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite
+	}
+
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		suite, ok := known[strings.ToUpper(strings.TrimSpace(name))]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("cipherSuites has unknown suite %q", name)
+		case len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13:
+			return nil, fmt.Errorf("cipherSuites cannot choose the TLS 1.3 suite %s; TLS 1.3 suites are always offered", suite.Name)
+		}
+		suites = append(suites, suite.ID)
+	}
+	return suites, nil
+}
+
+// reportTLS adds what was negotiated on a TLS connection to the response
+func reportTLS(state *tls.ConnectionState, response *ProxyResponse) {
+	if state == nil {
+		return
+	}
+	response.TLSVersion = tls.VersionName(state.Version)
+	response.TLSCipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	response.ALPNProtocol = state.NegotiatedProtocol
+}
@@ -0,0 +1,293 @@
+package slingshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Transform types. Request transforms run before the request is sent,
+// response transforms before the response is returned.
+const (
+	TransformSetHeader    = "set-header"    // Request: set Header to Value, replacing any value sent
+	TransformRemoveHeader = "remove-header" // Request: drop Header; a trailing "*" matches by prefix
+	TransformRewriteURL   = "rewrite-url"   // Request: replace Pattern in the URL with Replacement, or map From to To
+	TransformReplaceBody  = "replace-body"  // Response: replace Pattern in text bodies with Replacement
+	TransformMaskJSON     = "mask-json"     // Response: replace the values at Path in JSON bodies with Value
+	TransformSetJSON      = "set-json"      // Response: set Path in JSON bodies to JSON, adding the field if missing
+	TransformBaseHref     = "base-href"     // Response: point relative links in HTML bodies at Value
+)
+
+// baseTagPattern and headTagPattern find an HTML document's base tag, or its
+// head tag to add one after
+var (
+	baseTagPattern = regexp.MustCompile(`(?i)<base\b[^>]*>`)
+	headTagPattern = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+)
+
+// Transform is one step of the configured transform chain
+type Transform struct {
+	Name        string       `json:"name,omitempty"`
+	Type        string       `json:"type"`
+	Hosts       HostPatterns `json:"hosts,omitempty"` // Target hosts the step applies to; empty for all
+	Header      string       `json:"header,omitempty"`
+	Value       string       `json:"value,omitempty"`
+	Pattern     string       `json:"pattern,omitempty"`     // Regular expression; the replacement may use $1
+	Replacement string       `json:"replacement,omitempty"` // May be empty to delete the match
+
+	// JSON path for mask-json and set-json, e.g. $.users.*.email, where "*"
+	// matches every field or item
+	Path string          `json:"path,omitempty"`
+	JSON json.RawMessage `json:"json,omitempty"` // Value set by set-json
+
+	// Wildcard URLs for rewrite-url, instead of Pattern and Replacement. Each
+	// "*" in To stands for what the matching "*" in From matched, e.g.
+	// https://api.example.com/* to https://staging.example.com/*
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// URLRewrite records how rewrite-url transforms changed a request's URL
+type URLRewrite struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Rules []string `json:"rules"`
+}
+
+// wildcardRewrite converts a From/To mapping to a pattern and replacement
+func wildcardRewrite(from, to string) (string, string, error) {
+	parts := strings.Split(from, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	pattern := "^" + strings.Join(parts, "(.*)") + "$"
+
+	wildcards := len(parts) - 1
+	var replacement strings.Builder
+	for i, part := range strings.Split(to, "*") {
+		if i > 0 {
+			if i > wildcards {
+				return "", "", fmt.Errorf("to has more * than from")
+			}
+			fmt.Fprintf(&replacement, "${%d}", i)
+		}
+		replacement.WriteString(strings.ReplaceAll(part, "$", "$$"))
+	}
+	return pattern, replacement.String(), nil
+}
+
+// appliesTo reports whether the step applies to a request to targetURL
+func (t *Transform) appliesTo(targetURL string) bool {
+	if len(t.Hosts) == 0 {
+		return true
+	}
+	parsed, err := url.Parse(targetURL)
+	return err == nil && t.Hosts.Matches(parsed.Hostname())
+}
+
+// Transforms is the ordered chain of request and response transforms
+// configured in a file
+type Transforms struct {
+	file     string
+	request  []*Transform
+	response []*Transform
+}
+
+// NewTransforms creates the chain configured in file, once loaded
+func NewTransforms(file string) *Transforms {
+	return &Transforms{file: file}
+}
+
+// Load reads and compiles the transforms file, if one is configured
+func (t *Transforms) Load() error {
+	if t.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(t.file)
+	if err != nil {
+		return fmt.Errorf("Failed to read transforms: %v", err)
+	}
+	var transforms []*Transform
+	if err := json.Unmarshal(data, &transforms); err != nil {
+		return fmt.Errorf("Failed to parse transforms %s: %v", t.file, err)
+	}
+
+	for i, transform := range transforms {
+		if transform.Name == "" {
+			transform.Name = fmt.Sprintf("%s %d", transform.Type, i+1)
+		}
+		if err := transform.compile(); err != nil {
+			return fmt.Errorf("Transform %s: %v", transform.Name, err)
+		}
+		switch transform.Type {
+		case TransformReplaceBody, TransformMaskJSON, TransformSetJSON, TransformBaseHref:
+			t.response = append(t.response, transform)
+		default:
+			t.request = append(t.request, transform)
+		}
+	}
+	return nil
+}
+
+// compile checks the step's fields and compiles its pattern
+func (t *Transform) compile() error {
+	switch t.Type {
+	case TransformSetHeader, TransformRemoveHeader:
+		if t.Header == "" {
+			return fmt.Errorf("header is required")
+		}
+	case TransformRewriteURL, TransformReplaceBody:
+		if t.From != "" || t.To != "" {
+			if t.Type != TransformRewriteURL || t.Pattern != "" || t.From == "" || t.To == "" {
+				return fmt.Errorf("from and to only apply to rewrite-url, instead of pattern")
+			}
+			pattern, replacement, err := wildcardRewrite(t.From, t.To)
+			if err != nil {
+				return err
+			}
+			t.Pattern, t.Replacement = pattern, replacement
+		}
+		if t.Pattern == "" {
+			return fmt.Errorf("pattern is required")
+		}
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		t.re = re
+	case TransformMaskJSON, TransformSetJSON:
+		if t.Path == "" {
+			return fmt.Errorf("path is required")
+		}
+		if t.Type == TransformMaskJSON && t.Value == "" {
+			t.Value = DefaultScrubReplacement
+		}
+		if t.Type == TransformSetJSON {
+			var value interface{}
+			if err := json.Unmarshal(t.JSON, &value); err != nil {
+				return fmt.Errorf("json must be a JSON value: %v", err)
+			}
+		}
+	case TransformBaseHref:
+	default:
+		return fmt.Errorf("unknown type %q; use %s, %s, %s, %s, %s, %s or %s", t.Type, TransformSetHeader, TransformRemoveHeader, TransformRewriteURL, TransformReplaceBody, TransformMaskJSON, TransformSetJSON, TransformBaseHref)
+	}
+	return nil
+}
+
+// applyRequest runs the request transforms matching the request's host, in
+// order, returning the names of those that changed it and how the URL was
+// rewritten, if it was
+func (t *Transforms) applyRequest(req *ProxyRequest) ([]string, *URLRewrite) {
+	if t == nil {
+		return nil, nil
+	}
+
+	var applied []string
+	var rewrite *URLRewrite
+	for _, transform := range t.request {
+		if !transform.appliesTo(req.URL) {
+			continue
+		}
+
+		changed := false
+		switch transform.Type {
+		case TransformSetHeader:
+			req.Headers = append(removeHeaderFields(req.Headers, HeaderAllowlist{transform.Header}), transform.Header+": "+transform.Value)
+			changed = true
+		case TransformRemoveHeader:
+			headers := removeHeaderFields(req.Headers, HeaderAllowlist{transform.Header})
+			changed = len(headers) != len(req.Headers)
+			req.Headers = headers
+		case TransformRewriteURL:
+			rewritten := transform.re.ReplaceAllString(req.URL, transform.Replacement)
+			if rewritten != req.URL {
+				if rewrite == nil {
+					rewrite = &URLRewrite{From: req.URL}
+				}
+				rewrite.To = rewritten
+				rewrite.Rules = append(rewrite.Rules, transform.Name)
+				changed = true
+			}
+			req.URL = rewritten
+		}
+		if changed {
+			applied = append(applied, transform.Name)
+		}
+	}
+	return applied, rewrite
+}
+
+// applyResponse runs the response transforms matching the request's host on
+// a text response body, returning the names of those that changed it
+func (t *Transforms) applyResponse(req *ProxyRequest, response *ProxyResponse) []string {
+	if t == nil || response.IsBinary || response.ResponseData == "" {
+		return nil
+	}
+
+	var applied []string
+	for _, transform := range t.response {
+		if !transform.appliesTo(req.URL) {
+			continue
+		}
+		body := transform.transformBody(req, response)
+		if body != response.ResponseData {
+			response.ResponseData = body
+			applied = append(applied, transform.Name)
+		}
+	}
+	return applied
+}
+
+// transformBody returns the response body as changed by a response transform
+func (t *Transform) transformBody(req *ProxyRequest, response *ProxyResponse) string {
+	switch t.Type {
+	case TransformMaskJSON, TransformSetJSON:
+		var value interface{} = t.Value
+		if t.Type == TransformSetJSON {
+			value = json.RawMessage(t.JSON)
+		}
+		body, _ := editJSON([]byte(response.ResponseData), func(document interface{}) bool {
+			return replaceJSONPath(document, jsonPathKeys(t.Path), value, t.Type == TransformSetJSON)
+		})
+		return string(body)
+	case TransformBaseHref:
+		if !strings.Contains(strings.ToLower(response.ContentType), "html") {
+			return response.ResponseData
+		}
+		href := t.Value
+		if href == "" {
+			href = req.URL
+		}
+		base := `<base href="` + html.EscapeString(href) + `">`
+		if baseTagPattern.MatchString(response.ResponseData) {
+			return baseTagPattern.ReplaceAllLiteralString(response.ResponseData, base)
+		}
+		if head := headTagPattern.FindStringIndex(response.ResponseData); head != nil {
+			return response.ResponseData[:head[1]] + base + response.ResponseData[head[1]:]
+		}
+		return base + response.ResponseData
+	default:
+		return t.re.ReplaceAllString(response.ResponseData, t.Replacement)
+	}
+}
+
+// removeHeaderFields drops the "Name: value" headers whose name is on names
+func removeHeaderFields(headers []string, names HeaderAllowlist) []string {
+	kept := make([]string, 0, len(headers))
+	for _, header := range headers {
+		name, _, _ := strings.Cut(header, ":")
+		if names.Allows(strings.TrimSpace(name)) {
+			continue
+		}
+		kept = append(kept, header)
+	}
+	return kept
+}
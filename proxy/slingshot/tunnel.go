@@ -0,0 +1,267 @@
+package slingshot
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The tunnel exposes a local proxy's webhook buckets through a public one.
+// The local proxy (the client) keeps a few connections open to the public
+// proxy (the relay). The relay writes each /hooks/ request it receives to an
+// idle connection as plain HTTP/1.1, and the client answers it from its own
+// router and reconnects. Nothing but /hooks/ paths is ever forwarded.
+
+const (
+	// tunnelConnections is the number of idle connections a client keeps open
+	tunnelConnections = 4
+
+	// tunnelWait is how long the relay waits for an idle client connection
+	tunnelWait = 10 * time.Second
+
+	// tunnelRetry is the delay before a client reconnects after an error
+	tunnelRetry = 2 * time.Second
+
+	// tunnelUpgrade is the Upgrade protocol used on tunnel connections
+	tunnelUpgrade = "slingshot-tunnel"
+)
+
+// isTunnelPath reports whether a path may be forwarded through a tunnel
+func isTunnelPath(path string) bool {
+	return strings.HasPrefix(path, "/hooks/")
+}
+
+// TunnelRelay accepts tunnel client connections and forwards webhook
+// requests to them
+type TunnelRelay struct {
+	token string
+	idle  chan net.Conn
+}
+
+// NewTunnelRelay creates a relay accepting clients that present token
+func NewTunnelRelay(token string) *TunnelRelay {
+	return &TunnelRelay{
+		token: token,
+		idle:  make(chan net.Conn, 64),
+	}
+}
+
+// handleConnect takes over a client connection and keeps it for forwarding
+func (t *TunnelRelay) handleConnect(w http.ResponseWriter, r *http.Request) {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte(t.token)) != 1 {
+		http.Error(w, "invalid tunnel token", http.StatusUnauthorized)
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), tunnelUpgrade) {
+		http.Error(w, "expected Upgrade: "+tunnelUpgrade, http.StatusBadRequest)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be taken over", http.StatusInternalServerError)
+		return
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n", tunnelUpgrade)
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	select {
+	case t.idle <- conn:
+	default:
+		// Too many idle connections
+		conn.Close()
+	}
+}
+
+// ServeHTTP forwards a webhook request through an idle client connection
+func (t *TunnelRelay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isTunnelPath(r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Buffer the body so the request can be resent on another connection
+	// if an idle one turns out to be dead
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxHookBodySize+1))
+	if err != nil || len(body) > MaxHookBodySize {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	timeout := time.NewTimer(tunnelWait)
+	defer timeout.Stop()
+
+	for {
+		var conn net.Conn
+		select {
+		case conn = <-t.idle:
+		case <-timeout.C:
+			http.Error(w, "no tunnel client connected", http.StatusBadGateway)
+			return
+		case <-r.Context().Done():
+			return
+		}
+
+		resp, err := t.roundTrip(conn, r, body)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		for key, values := range resp.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		resp.Body.Close()
+		conn.Close()
+		return
+	}
+}
+
+// roundTrip writes the request to a client connection and reads the answer
+func (t *TunnelRelay) roundTrip(conn net.Conn, r *http.Request, body []byte) (*http.Response, error) {
+	conn.SetDeadline(time.Now().Add(tunnelWait))
+
+	out := r.Clone(r.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	out.TransferEncoding = nil
+	out.Close = true
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		out.Header.Set("X-Forwarded-For", host)
+	}
+	if err := out.Write(conn); err != nil {
+		return nil, err
+	}
+
+	return http.ReadResponse(bufio.NewReader(conn), r)
+}
+
+// runTunnel keeps tunnelConnections connections open to the relay and serves
+// the requests arriving on them with handler
+func (s *ProxyServer) runTunnel(relayURL, token string, handler http.Handler) {
+	relay, err := url.Parse(relayURL)
+	if err != nil || (relay.Scheme != "http" && relay.Scheme != "https") || relay.Host == "" {
+		s.logger.Printf("Invalid tunnel URL %q", relayURL)
+		return
+	}
+
+	s.logger.Printf("Tunnel: webhook buckets are public at %s/hooks/{bucket}", strings.TrimSuffix(relay.String(), "/"))
+
+	for i := 0; i < tunnelConnections; i++ {
+		go func() {
+			for {
+				if err := s.serveTunnelConnection(relay, token, handler); err != nil {
+					s.logger.Printf("Tunnel: %v", err)
+					time.Sleep(tunnelRetry)
+				}
+			}
+		}()
+	}
+}
+
+// serveTunnelConnection opens one connection to the relay and answers the
+// single request sent over it
+func (s *ProxyServer) serveTunnelConnection(relay *url.URL, token string, handler http.Handler) error {
+	conn, err := dialTunnel(relay)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nAuthorization: Bearer %s\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n",
+		strings.TrimSuffix(relay.Path, "/")+"/tunnel/connect", relay.Host, token, tunnelUpgrade)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("Relay refused the connection: %s", resp.Status)
+	}
+	s.tunnelConnections.Add(1)
+	defer s.tunnelConnections.Add(-1)
+
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	req.RemoteAddr = conn.RemoteAddr().String()
+
+	recorder := newTunnelResponse()
+	if isTunnelPath(req.URL.Path) {
+		handler.ServeHTTP(recorder, req)
+	} else {
+		recorder.WriteHeader(http.StatusNotFound)
+	}
+
+	return recorder.response(req).Write(conn)
+}
+
+// dialTunnel connects to the relay, using TLS for https URLs
+func dialTunnel(relay *url.URL) (net.Conn, error) {
+	host := relay.Host
+	if relay.Port() == "" {
+		host = net.JoinHostPort(relay.Hostname(), effectivePort(relay))
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if relay.Scheme == "https" {
+		return tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: relay.Hostname()})
+	}
+	return dialer.Dial("tcp", host)
+}
+
+// tunnelResponse buffers a locally served response so it can be written
+// back over the tunnel connection
+type tunnelResponse struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newTunnelResponse() *tunnelResponse {
+	return &tunnelResponse{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (t *tunnelResponse) Header() http.Header { return t.header }
+
+func (t *tunnelResponse) Write(p []byte) (int, error) { return t.body.Write(p) }
+
+func (t *tunnelResponse) WriteHeader(statusCode int) { t.statusCode = statusCode }
+
+// response converts the buffered response for writing
+func (t *tunnelResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		StatusCode:    t.statusCode,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        t.header,
+		Body:          io.NopCloser(&t.body),
+		ContentLength: int64(t.body.Len()),
+		Close:         true,
+		Request:       req,
+	}
+}
@@ -0,0 +1,327 @@
+package slingshot
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProxyRequest represents the JSON request structure matching the Lua API
+type ProxyRequest struct {
+	Method                 string            `json:"method"`
+	URL                    string            `json:"url"`
+	Headers                []string          `json:"headers"`
+	PreserveHeaders        bool              `json:"preserveHeaders,omitempty"`
+	HeaderOverrides        []string          `json:"headerOverrides,omitempty"`
+	Body                   string            `json:"body,omitempty"`
+	BodyPath               string            `json:"bodyPath,omitempty"`
+	Chunked                bool              `json:"chunked,omitempty"`
+	ExpectContinue         bool              `json:"expectContinue,omitempty"`
+	HTTPVersion            string            `json:"httpVersion,omitempty"`
+	TLSMinVersion          string            `json:"tlsMinVersion,omitempty"`
+	TLSMaxVersion          string            `json:"tlsMaxVersion,omitempty"`
+	CipherSuites           []string          `json:"cipherSuites,omitempty"`
+	ALPNProtocols          []string          `json:"alpnProtocols,omitempty"`
+	ServerName             string            `json:"serverName,omitempty"`
+	TLSFingerprint         string            `json:"tlsFingerprint,omitempty"`
+	ChunkSize              int               `json:"chunkSize,omitempty"`
+	Timeout                int               `json:"timeout,omitempty"`
+	FollowRedirects        *bool             `json:"followRedirects,omitempty"`
+	RedirectMethod         string            `json:"redirectMethod,omitempty"`
+	RedirectCredentials    string            `json:"redirectCredentials,omitempty"`
+	PathParams             map[string]string `json:"path_params,omitempty"`
+	PathParamEncoding      map[string]string `json:"path_param_encoding,omitempty"`
+	Cache                  bool              `json:"cache,omitempty"`
+	DecodeBody             *bool             `json:"decodeBody,omitempty"`
+	Stream                 bool              `json:"stream,omitempty"`
+	MaxDownloadBytes       int64             `json:"maxDownloadBytes,omitempty"`
+	MaxDownloadSeconds     int               `json:"maxDownloadSeconds,omitempty"`
+	Retries                int               `json:"retries,omitempty"`
+	IdempotencyKey         bool              `json:"idempotencyKey,omitempty"`
+	Assertions             []Assertion       `json:"assertions,omitempty"`
+	PreRequestScript       string            `json:"preRequestScript,omitempty"`
+	PreRequestScriptFile   string            `json:"preRequestScriptFile,omitempty"`
+	PostResponseScript     string            `json:"postResponseScript,omitempty"`
+	PostResponseScriptFile string            `json:"postResponseScriptFile,omitempty"`
+	ScriptLanguage         string            `json:"scriptLanguage,omitempty"`
+	Environment            map[string]string `json:"environment,omitempty"`
+	ValidateGraphQL        bool              `json:"validateGraphQL,omitempty"`
+	BodyFormat             string            `json:"bodyFormat,omitempty"`
+	ProtoMessage           string            `json:"protoMessage,omitempty"`
+	ProtoResponseMessage   string            `json:"protoResponseMessage,omitempty"`
+	Multipart              []MultipartPart   `json:"multipart,omitempty"`
+	Artifact               bool              `json:"artifact,omitempty"`
+	Range                  string            `json:"range,omitempty"`
+	ThrottleKbps           int               `json:"throttleKbps,omitempty"`
+	ThrottleUploadKbps     int               `json:"throttleUploadKbps,omitempty"`
+	ThrottleDownloadKbps   int               `json:"throttleDownloadKbps,omitempty"`
+	NetworkProfile         string            `json:"networkProfile,omitempty"`
+	IncludeResponseHeaders []string          `json:"includeResponseHeaders,omitempty"`
+	ExcludeResponseHeaders []string          `json:"excludeResponseHeaders,omitempty"`
+	EchoRequest            bool              `json:"echoRequest,omitempty"`
+	Priority               string            `json:"priority,omitempty"`
+}
+
+// FormProxyRequest represents form data request parameters
+type FormProxyRequest struct {
+	URL             string `json:"url"`
+	Method          string `json:"method"`
+	Timeout         int    `json:"timeout,omitempty"`
+	FollowRedirects *bool  `json:"followRedirects,omitempty"`
+	ContentType     string `json:"contentType,omitempty"`
+	Headers         string `json:"headers,omitempty"`
+	PathParams      string `json:"path_params,omitempty"`
+	RawBody         []byte `json:"-"` // For multipart data, exclude from JSON
+}
+
+// ProxyResponse represents the response structure matching the Lua API
+type ProxyResponse struct {
+	Success         bool              `json:"success"`
+	RequestID       string            `json:"request_id,omitempty"`
+	ResponseStatus  int               `json:"response_status,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseData    string            `json:"response_data,omitempty"`
+	ResponseSize    string            `json:"response_size,omitempty"`
+	ResponseTime    string            `json:"response_time,omitempty"`
+	ContentType     string            `json:"content_type,omitempty"`
+	IsBinary        bool              `json:"is_binary,omitempty"`
+	HTTPVersion     string            `json:"http_version,omitempty"` // Protocol the server answered with
+	TLSVersion      string            `json:"tls_version,omitempty"`
+	TLSCipherSuite  string            `json:"tls_cipher_suite,omitempty"`
+	ALPNProtocol    string            `json:"alpn_protocol,omitempty"` // Protocol the server selected, if any
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Decoded         bool              `json:"decoded,omitempty"`
+	Cancelled       bool              `json:"cancelled,omitempty"`
+	Cached          bool              `json:"cached,omitempty"`
+	Revalidated     bool              `json:"revalidated,omitempty"`
+	Stale           bool              `json:"stale,omitempty"`
+	HostUnicode     string            `json:"host_unicode,omitempty"`
+	HostASCII       string            `json:"host_ascii,omitempty"`
+	RedirectChain   []RedirectHop     `json:"redirect_chain,omitempty"`
+
+	// ResponseSize and ResponseTime as numbers, to sort and aggregate by
+	ResponseSizeBytes int64   `json:"response_size_bytes,omitempty"`
+	ResponseTimeMs    float64 `json:"response_time_ms,omitempty"`
+
+	// Responses without a body (HEAD, 204, 304)
+	BodyOmitted    bool   `json:"body_omitted,omitempty"`
+	DeclaredSize   string `json:"declared_size,omitempty"`
+	DeclaredLength int64  `json:"declared_length,omitempty"`
+
+	// Body stored in the artifact store instead of response_data
+	ArtifactID  string `json:"artifact_id,omitempty"`
+	ArtifactURL string `json:"artifact_url,omitempty"`
+
+	// Range request results (when a range was requested)
+	AcceptRanges string        `json:"accept_ranges,omitempty"`
+	ContentRange *ContentRange `json:"content_range,omitempty"`
+	RangeIgnored bool          `json:"range_ignored,omitempty"`
+	RangeError   string        `json:"range_error,omitempty"`
+
+	// Assertion results (when requested)
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+
+	// Script outputs: printed lines, values stored in env by the
+	// post-response script, its pm.test() results, the next request it
+	// chose and its error
+	ScriptLogs  []string          `json:"script_logs,omitempty"`
+	ScriptTests []ScriptTest      `json:"script_tests,omitempty"`
+	ScriptEnv   map[string]string `json:"script_env,omitempty"`
+	ScriptNext  string            `json:"script_next,omitempty"`
+	ScriptError string            `json:"script_error,omitempty"`
+
+	// Format a binary response body was converted to JSON from, or why it
+	// could not be
+	BodyFormat      string `json:"body_format,omitempty"`
+	BodyFormatError string `json:"body_format_error,omitempty"`
+
+	// Problems found in a GraphQL query checked with validateGraphQL
+	GraphQLErrors []GraphQLError `json:"graphql_errors,omitempty"`
+
+	// Retries (when requested)
+	Attempts       int    `json:"attempts,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// Body cut short by maxDownloadBytes/maxDownloadSeconds
+	Partial       bool   `json:"partial,omitempty"`
+	PartialReason string `json:"partial_reason,omitempty"`
+
+	// Simulated network conditions (when a network profile applies)
+	NetworkProfile   string `json:"network_profile,omitempty"`
+	SimulatedLatency string `json:"simulated_latency,omitempty"`
+	SimulatedReset   bool   `json:"simulated_reset,omitempty"`
+
+	// Header profile whose headers were attached to the request
+	HeaderProfile string `json:"header_profile,omitempty"`
+
+	// Configured transforms that changed the request or response, and the
+	// URL the request was sent to when one rewrote it
+	Transforms []string    `json:"transforms,omitempty"`
+	URLRewrite *URLRewrite `json:"url_rewrite,omitempty"`
+
+	// The request as it was sent (when echoRequest is set)
+	RequestSent *RequestSent `json:"request_sent,omitempty"`
+
+	// Plugins that failed without stopping the request
+	PluginErrors []string `json:"plugin_errors,omitempty"`
+
+	// The connection the request was sent on
+	Connection *ConnectionInfo `json:"connection,omitempty"`
+
+	// Time spent waiting for a request slot (when -max-concurrent was reached)
+	QueueTime string `json:"queue_time,omitempty"`
+
+	// Expect: 100-continue negotiation (when requested)
+	ContinueReceived *bool  `json:"continue_received,omitempty"`
+	ContinueTime     string `json:"continue_time,omitempty"`
+
+	// Error fields (when success = false)
+	ErrorType    string   `json:"error_type,omitempty"`
+	ErrorTitle   string   `json:"error_title,omitempty"`
+	ErrorMessage string   `json:"error_message,omitempty"`
+	ErrorCauses  []string `json:"error_causes,omitempty"` // The underlying errors, outermost first
+}
+
+// ProxyError represents different types of proxy errors
+type ProxyError struct {
+	Type    string
+	Title   string
+	Message string
+}
+
+func (e *ProxyError) Error() string {
+	return e.Message
+}
+
+// Predefined error types matching Lua implementation
+var (
+	URLValidationError = &ProxyError{
+		Type:  "url_validation_error",
+		Title: "Invalid URL",
+	}
+	TimeoutError = &ProxyError{
+		Type:  "timeout",
+		Title: "Request Timed Out",
+	}
+	ConnectionError = &ProxyError{
+		Type:  "connection_error",
+		Title: "Connection Failed",
+	}
+	DNSError = &ProxyError{
+		Type:  "dns_error",
+		Title: "DNS Resolution Failed",
+	}
+	TLSError = &ProxyError{
+		Type:  "tls_error",
+		Title: "TLS Handshake Failed",
+	}
+	CertificateError = &ProxyError{
+		Type:  "certificate_error",
+		Title: "Invalid Certificate",
+	}
+	ConnectionRefusedError = &ProxyError{
+		Type:  "connection_refused",
+		Title: "Connection Refused",
+	}
+	ConnectionResetError = &ProxyError{
+		Type:  "connection_reset",
+		Title: "Connection Reset",
+	}
+	UpstreamProxyError = &ProxyError{
+		Type:  "proxy_error",
+		Title: "Upstream Proxy Failed",
+	}
+	RedirectNotFollowedError = &ProxyError{
+		Type:  "redirect_not_followed",
+		Title: "Redirect Not Followed",
+	}
+	RequestFormatError = &ProxyError{
+		Type:  "request_format_error",
+		Title: "Invalid Request",
+	}
+	ScriptError = &ProxyError{
+		Type:  "script_error",
+		Title: "Script Failed",
+	}
+	GraphQLValidationError = &ProxyError{
+		Type:  "graphql_validation_error",
+		Title: "Invalid GraphQL Query",
+	}
+	BodyEncodingError = &ProxyError{
+		Type:  "body_encoding_error",
+		Title: "Body Encoding Failed",
+	}
+	SMTPError = &ProxyError{
+		Type:  "smtp_error",
+		Title: "SMTP Conversation Failed",
+	}
+	ProtoError = &ProxyError{
+		Type:  "proto_error",
+		Title: "Protobuf Conversion Failed",
+	}
+	UnauthorizedError = &ProxyError{
+		Type:  "unauthorized",
+		Title: "Unauthorized",
+	}
+	RateLimitedError = &ProxyError{
+		Type:  "rate_limited",
+		Title: "Rate Limit Exceeded",
+	}
+	HostNotAllowedError = &ProxyError{
+		Type:  "host_not_allowed",
+		Title: "Host Not Allowed",
+	}
+	DrainingError = &ProxyError{
+		Type:  "draining",
+		Title: "Server Draining",
+	}
+	PluginRejectedError = &ProxyError{
+		Type:  "plugin_rejected",
+		Title: "Rejected by Plugin",
+	}
+	PluginFailedError = &ProxyError{
+		Type:  "plugin_error",
+		Title: "Plugin Failed",
+	}
+	QueueTimeoutError = &ProxyError{
+		Type:  "queue_timeout",
+		Title: "Request Queue Timeout",
+	}
+)
+
+// RequestMetrics holds timing and size information
+type RequestMetrics struct {
+	StartTime    time.Time
+	EndTime      time.Time
+	ResponseSize int64
+	Attempts     int
+}
+
+// formatMillis formats a duration in milliseconds
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.2f ms", float64(d.Nanoseconds())/1000000)
+}
+
+// GetDuration returns the total request duration in milliseconds
+func (m *RequestMetrics) GetDuration() float64 {
+	return float64(m.EndTime.Sub(m.StartTime).Nanoseconds()) / 1000000
+}
+
+// FormatDuration returns formatted duration string
+func (m *RequestMetrics) FormatDuration() string {
+	return formatMillis(m.EndTime.Sub(m.StartTime))
+}
+
+// FormatSize returns formatted size string
+func (m *RequestMetrics) FormatSize() string {
+	return formatSize(m.ResponseSize)
+}
+
+// formatSize formats a byte count as B, KB or MB
+func formatSize(size int64) string {
+	if size >= 1024*1024 {
+		return fmt.Sprintf("%.2f MB", float64(size)/(1024*1024))
+	} else if size >= 1024 {
+		return fmt.Sprintf("%.2f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%d B", size)
+}
@@ -0,0 +1,473 @@
+// Slingshot dashboard: composes requests through /proxy/request, browses
+// /proxy/history, tails /proxy/history/tail and shows /admin/stats. Environments, the API key and the
+// admin token are kept in localStorage.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+const store = {
+  get(key, fallback) {
+    try {
+      const value = localStorage.getItem("slingshot." + key);
+      return value === null ? fallback : JSON.parse(value);
+    } catch {
+      return fallback;
+    }
+  },
+  set(key, value) {
+    localStorage.setItem("slingshot." + key, JSON.stringify(value));
+  },
+};
+
+// api calls the proxy, sending the API key and, for the admin API, the admin
+// token. Error responses are thrown with their message, unless allowFailure
+// is set for proxied requests, whose failures are results to show.
+async function api(path, options = {}, allowFailure = false) {
+  const headers = { ...(options.headers || {}) };
+  const apiKey = store.get("apiKey", "");
+  if (apiKey) {
+    headers["X-Slingshot-Key"] = apiKey;
+  }
+  const adminToken = store.get("adminToken", "");
+  if (adminToken && path.startsWith("/admin/")) {
+    headers["Authorization"] = "Bearer " + adminToken;
+  }
+  const response = await fetch(path, { ...options, headers });
+  const data = await response.json();
+  if (data.success === false && !allowFailure) {
+    const error = new Error(data.error_message || data.error_title || "Request failed");
+    error.type = data.error_type;
+    throw error;
+  }
+  return data;
+}
+
+function showError(error) {
+  const box = $("error");
+  box.textContent = error.message || String(error);
+  box.hidden = false;
+  clearTimeout(showError.timer);
+  showError.timer = setTimeout(() => { box.hidden = true; }, 6000);
+}
+
+// Tabs
+
+let metricsTimer = null;
+
+function showTab(name) {
+  document.querySelectorAll("header nav button").forEach((button) => {
+    button.classList.toggle("active", button.dataset.tab === name);
+  });
+  document.querySelectorAll(".tab").forEach((tab) => {
+    tab.classList.toggle("active", tab.id === name);
+  });
+  clearInterval(metricsTimer);
+  stopTail();
+  if (name === "history") {
+    loadHistory(false);
+  } else if (name === "metrics") {
+    loadMetrics();
+    metricsTimer = setInterval(loadMetrics, 5000);
+  }
+}
+
+document.querySelectorAll("header nav button").forEach((button) => {
+  button.addEventListener("click", () => showTab(button.dataset.tab));
+});
+
+// Compose
+
+function parseLines(text, separator) {
+  return text.split("\n")
+    .map((line) => line.trim())
+    .filter((line) => line && line.includes(separator));
+}
+
+$("request-form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const request = {
+    method: $("method").value,
+    url: $("url").value.trim(),
+    headers: parseLines($("headers").value, ":"),
+    body: $("body").value,
+    timeout: parseInt($("timeout").value, 10) || 30,
+    followRedirects: $("follow-redirects").checked,
+  };
+  const environment = environments()[$("environment").value];
+  if (environment) {
+    request.environment = environment.variables;
+  }
+
+  $("send").disabled = true;
+  try {
+    const response = await api("/proxy/request", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(request),
+    }, true);
+    showResponse(response);
+  } catch (error) {
+    showError(error);
+  } finally {
+    $("send").disabled = false;
+  }
+});
+
+function showResponse(response) {
+  const summary = $("response-summary");
+  summary.textContent = "";
+  const status = document.createElement("span");
+  if (response.success) {
+    status.className = response.response_status < 400 ? "ok" : "failed";
+    status.textContent = response.response_status;
+  } else {
+    status.className = "failed";
+    status.textContent = response.error_title || response.error_type;
+  }
+  summary.append(status);
+  const details = [response.http_version, response.response_time, response.response_size, response.content_type];
+  summary.append(" " + details.filter(Boolean).join(" · "));
+
+  const headers = response.response_headers || {};
+  $("response-headers").textContent = Object.keys(headers).sort()
+    .map((name) => name + ": " + headers[name]).join("\n");
+
+  let body = response.response_data || "";
+  if (!response.success) {
+    body = response.error_message || "";
+  } else if (response.is_binary) {
+    body = "(binary body, " + response.response_size + ", base64)\n" + body;
+  } else if ((response.content_type || "").includes("json")) {
+    try {
+      body = JSON.stringify(JSON.parse(body), null, 2);
+    } catch {
+      // Shown as received
+    }
+  }
+  $("response-body").textContent = body;
+  $("response").hidden = false;
+}
+
+// History
+
+let historyOffset = 0;
+
+$("history-form").addEventListener("submit", (event) => {
+  event.preventDefault();
+  loadHistory(false);
+});
+$("history-more").addEventListener("click", () => loadHistory(true));
+
+function historyQuery() {
+  const query = new URLSearchParams();
+  if ($("history-query").value) {
+    query.set("q", $("history-query").value);
+  }
+  if ($("history-success").value) {
+    query.set("success", $("history-success").value);
+  }
+  return query;
+}
+
+async function loadHistory(more) {
+  if (!more) {
+    historyOffset = 0;
+    $("history-entries").textContent = "";
+  }
+  const query = historyQuery();
+  query.set("limit", "50");
+  query.set("offset", String(historyOffset));
+
+  try {
+    const page = await api("/proxy/history?" + query);
+    for (const entry of page.entries) {
+      $("history-entries").append(historyRow(entry));
+    }
+    historyOffset = page.next_offset || 0;
+    $("history-more").hidden = !page.next_offset;
+  } catch (error) {
+    showError(error);
+  }
+  if ($("history-live").checked && !more) {
+    startTail();
+  }
+}
+
+// The live tail adds new entries to the top of the table and shows the log
+// lines below it, until the History tab is left or Live is unchecked
+
+const maxLogLines = 500;
+let tailSocket = null;
+
+$("history-live").addEventListener("change", () => {
+  if ($("history-live").checked) {
+    startTail();
+  } else {
+    stopTail();
+  }
+});
+
+function startTail() {
+  stopTail();
+  const query = historyQuery();
+  const apiKey = store.get("apiKey", "");
+  if (apiKey) {
+    query.set("slingshot_key", apiKey);
+  }
+  const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+  const socket = new WebSocket(scheme + "//" + location.host + "/proxy/history/tail?" + query);
+  socket.onmessage = (message) => {
+    const event = JSON.parse(message.data);
+    if (event.dropped) {
+      appendLog("… " + event.dropped + " events skipped");
+    }
+    if (event.type === "history") {
+      $("history-entries").prepend(historyRow(event.entry));
+    } else if (event.type === "log") {
+      appendLog(event.line);
+    }
+  };
+  socket.onclose = () => {
+    if (tailSocket === socket) {
+      tailSocket = null;
+      $("history-live").checked = false;
+      showError(new Error("The live tail was closed"));
+    }
+  };
+  tailSocket = socket;
+  $("history-logs").hidden = false;
+}
+
+function stopTail() {
+  if (tailSocket) {
+    const socket = tailSocket;
+    tailSocket = null;
+    socket.close();
+  }
+}
+
+function appendLog(line) {
+  const log = $("history-log");
+  const lines = (log.textContent ? log.textContent.split("\n") : []).concat(line);
+  log.textContent = lines.slice(-maxLogLines).join("\n");
+}
+
+function historyRow(entry) {
+  const row = document.createElement("tr");
+  const cells = [
+    new Date(entry.time).toLocaleString(),
+    entry.source,
+    entry.method,
+    entry.url,
+    entry.success ? entry.status : entry.error_type,
+    entry.response_time || "",
+    entry.response_size || "",
+  ];
+  cells.forEach((value, i) => {
+    const cell = document.createElement("td");
+    cell.textContent = value;
+    if (i === 3) {
+      cell.className = "url";
+      cell.title = value;
+    }
+    row.append(cell);
+  });
+  row.addEventListener("click", () => showHistoryEntry(entry));
+  return row;
+}
+
+async function showHistoryEntry(entry) {
+  const summary = [entry.method, entry.url, entry.success ? entry.status : entry.error_message];
+  if (entry.remote_addr) {
+    summary.push(entry.remote_addr);
+  }
+  $("history-summary").textContent = summary.join(" ");
+  $("history-resend").onclick = () => {
+    $("method").value = entry.method;
+    $("url").value = entry.url;
+    showTab("compose");
+  };
+  $("history-body").textContent = "";
+  $("history-entry").hidden = false;
+
+  try {
+    const page = await api("/proxy/history/" + encodeURIComponent(entry.id) + "/body");
+    let body = page.data || "";
+    if (page.is_binary) {
+      body = "(binary body, base64)\n" + body;
+    }
+    if (page.more) {
+      body += "\n… " + (page.total_size - page.next_offset) + " more bytes";
+    }
+    $("history-body").textContent = body;
+  } catch (error) {
+    $("history-body").textContent = error.message;
+  }
+}
+
+// Environments
+
+function environments() {
+  return store.get("environments", {});
+}
+
+function renderEnvironments(selected) {
+  const names = Object.keys(environments()).sort();
+  for (const select of [$("environment"), $("environment-list")]) {
+    const current = selected !== undefined && select.id === "environment-list" ? selected : select.value;
+    select.textContent = "";
+    if (select.id === "environment") {
+      select.append(new Option("No environment", ""));
+    }
+    for (const name of names) {
+      select.append(new Option(name, name));
+    }
+    if (names.includes(current) || current === "") {
+      select.value = current;
+    }
+  }
+  editEnvironment($("environment-list").value);
+}
+
+function editEnvironment(name) {
+  const environment = environments()[name];
+  $("environment-name").value = environment ? name : "";
+  $("environment-variables").value = environment
+    ? Object.entries(environment.variables).map(([key, value]) => key + "=" + value).join("\n")
+    : "";
+}
+
+$("environment-list").addEventListener("change", () => editEnvironment($("environment-list").value));
+
+$("environment-new").addEventListener("click", () => {
+  $("environment-list").value = "";
+  editEnvironment("");
+  $("environment-name").focus();
+});
+
+$("environment-save").addEventListener("click", () => {
+  const name = $("environment-name").value.trim();
+  if (!name) {
+    showError(new Error("The environment needs a name"));
+    return;
+  }
+  const variables = {};
+  for (const line of parseLines($("environment-variables").value, "=")) {
+    const at = line.indexOf("=");
+    variables[line.slice(0, at).trim()] = line.slice(at + 1);
+  }
+  const all = environments();
+  const previous = $("environment-list").value;
+  if (previous && previous !== name) {
+    delete all[previous];
+  }
+  all[name] = { variables };
+  store.set("environments", all);
+  renderEnvironments(name);
+});
+
+$("environment-delete").addEventListener("click", () => {
+  const name = $("environment-list").value;
+  if (!name || !confirm("Delete environment " + name + "?")) {
+    return;
+  }
+  const all = environments();
+  delete all[name];
+  store.set("environments", all);
+  renderEnvironments("");
+});
+
+// Metrics
+
+async function loadMetrics() {
+  if (!store.get("adminToken", "")) {
+    $("metrics-note").textContent = "Metrics come from the admin API. Set the admin token under Settings.";
+    $("metrics-grid").textContent = "";
+    return;
+  }
+  try {
+    const stats = await api("/admin/stats");
+    $("metrics-note").textContent = "Refreshed every 5 seconds.";
+    renderMetrics(stats);
+  } catch (error) {
+    $("metrics-note").textContent = error.message;
+    clearInterval(metricsTimer);
+  }
+}
+
+function renderMetrics(stats) {
+  const waiting = Object.values(stats.queue.waiting || {}).reduce((sum, n) => sum + n, 0);
+  const cards = {
+    "Runtime": {
+      "Version": stats.runtime.version,
+      "Uptime": stats.runtime.uptime,
+      "Goroutines": stats.runtime.goroutines,
+      "Heap": stats.runtime.heap_alloc + " / " + stats.runtime.heap_sys,
+      "GC runs": stats.runtime.num_gc,
+    },
+    "Requests": {
+      "In flight": stats.active_requests,
+      "Running": stats.queue.running,
+      "Waiting": waiting,
+      "Max concurrent": stats.queue.max_concurrent || "unlimited",
+    },
+    "Connection pool": {
+      "Open": stats.pool.open,
+      "Opened": stats.pool.opened,
+      "Dial failures": stats.pool.dial_failures,
+      "Idle timeout": stats.pool.idle_conn_timeout,
+    },
+    "History": {
+      "Entries": stats.history.entries + " / " + stats.history.max_entries,
+      "Bodies": stats.history.body_size,
+    },
+    "Sessions": stats.sessions,
+  };
+  for (const publisher of stats.publishers || []) {
+    cards["Publisher " + publisher.url] = {
+      "Published": publisher.published,
+      "Failed": publisher.failed,
+      "Dropped": publisher.dropped,
+      "Queued": publisher.queued,
+    };
+  }
+  for (const limit of stats.rate_limits || []) {
+    cards["API key " + limit.name] = {
+      "Limit": limit.limit + "/min",
+      "Remaining": limit.remaining,
+    };
+  }
+
+  const grid = $("metrics-grid");
+  grid.textContent = "";
+  for (const [title, values] of Object.entries(cards)) {
+    const card = document.createElement("div");
+    card.className = "card";
+    const heading = document.createElement("h3");
+    heading.textContent = title;
+    const list = document.createElement("dl");
+    for (const [name, value] of Object.entries(values)) {
+      const term = document.createElement("dt");
+      term.textContent = name;
+      const description = document.createElement("dd");
+      description.textContent = value;
+      list.append(term, description);
+    }
+    card.append(heading, list);
+    grid.append(card);
+  }
+}
+
+// Settings
+
+$("api-key").value = store.get("apiKey", "");
+$("admin-token").value = store.get("adminToken", "");
+$("settings-save").addEventListener("click", () => {
+  store.set("apiKey", $("api-key").value.trim());
+  store.set("adminToken", $("admin-token").value.trim());
+});
+
+renderEnvironments();
+api("/version").then((info) => {
+  $("version").textContent = info.version;
+}).catch(() => {});
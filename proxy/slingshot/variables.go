@@ -0,0 +1,96 @@
+package slingshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// variablePattern matches {{...}} placeholders
+var variablePattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// expandVariables replaces {{name}} placeholders with values from vars and
+// {{function args}} placeholders with the result of a template function,
+// leaving unknown names and invalid expressions untouched
+func expandVariables(s string, vars map[string]string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return variablePattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+		expr := variablePattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := vars[expr]; ok {
+			return value
+		}
+		value, err := evaluateTemplate(expr, vars)
+		if err != nil {
+			return placeholder
+		}
+		return value
+	})
+}
+
+// substituteVariables fills in the placeholders of a request's URL, headers,
+// body and multipart values
+func substituteVariables(req *ProxyRequest, vars map[string]string) {
+	req.URL = expandVariables(req.URL, vars)
+	req.Body = expandVariables(req.Body, vars)
+	for i, header := range req.Headers {
+		req.Headers[i] = expandVariables(header, vars)
+	}
+	if req.Multipart != nil {
+		parts := make([]MultipartPart, len(req.Multipart))
+		for i, part := range req.Multipart {
+			part.Value = expandVariables(part.Value, vars)
+			parts[i] = part
+		}
+		req.Multipart = parts
+	}
+}
+
+// loadEnvironment reads an environment file: either a JSON object of names
+// and values, or a Postman environment export with a "values" list
+func loadEnvironment(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read environment: %v", err)
+	}
+
+	var export struct {
+		Values []struct {
+			Key     string      `json:"key"`
+			Value   interface{} `json:"value"`
+			Enabled *bool       `json:"enabled"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(data, &export); err == nil && export.Values != nil {
+		vars := make(map[string]string, len(export.Values))
+		for _, v := range export.Values {
+			if v.Enabled == nil || *v.Enabled {
+				vars[v.Key] = variableString(v.Value)
+			}
+		}
+		return vars, nil
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %v", path, err)
+	}
+	vars := make(map[string]string, len(object))
+	for key, value := range object {
+		vars[key] = variableString(value)
+	}
+	return vars, nil
+}
+
+// variableString converts a JSON value to a variable value. Strings are used
+// as they are, anything else as JSON.
+func variableString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
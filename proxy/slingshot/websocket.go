@@ -0,0 +1,641 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// MaxWebSocketSessions is the number of sessions that may be open at once
+	MaxWebSocketSessions = 50
+
+	// MaxWebSocketMessages is the number of messages kept per session
+	MaxWebSocketMessages = 500
+
+	// MaxWebSocketMessageSize is the largest message read from a target, the
+	// size of the bodies kept in the history. Larger messages close the
+	// session.
+	MaxWebSocketMessageSize = MaxHistoryBodySize
+
+	// webSocketHandshakeTimeout bounds the opening handshake
+	webSocketHandshakeTimeout = 30 * time.Second
+)
+
+// WebSocketOpenRequest is the JSON body of POST /ws/sessions
+type WebSocketOpenRequest struct {
+	Name         string   `json:"name,omitempty"`
+	URL          string   `json:"url"`
+	Headers      []string `json:"headers,omitempty"`
+	Subprotocols []string `json:"subprotocols,omitempty"`
+}
+
+// WebSocketSendRequest is the JSON body of POST /ws/sessions/{id}/send
+type WebSocketSendRequest struct {
+	Message string `json:"message"`
+	Binary  bool   `json:"binary,omitempty"` // Message is base64 and is sent as a binary frame
+}
+
+// WebSocketMessage is a message sent or received on a session
+type WebSocketMessage struct {
+	Seq       int64     `json:"seq"`
+	Direction string    `json:"direction"` // "sent" or "received"
+	Data      string    `json:"data"`
+	IsBinary  bool      `json:"is_binary,omitempty"`
+	Size      int       `json:"size"`
+	Time      time.Time `json:"time"`
+}
+
+// WebSocketSessionInfo describes a session
+type WebSocketSessionInfo struct {
+	ID          string     `json:"id"`
+	URL         string     `json:"url"`
+	Subprotocol string     `json:"subprotocol,omitempty"`
+	State       string     `json:"state"` // "open" or "closed"
+	CloseCode   int        `json:"close_code,omitempty"`
+	CloseReason string     `json:"close_reason,omitempty"`
+	Sent        int        `json:"sent"`
+	Received    int        `json:"received"`
+	OpenedAt    time.Time  `json:"opened_at"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+}
+
+// WebSocketSessionResponse is returned for a single session
+type WebSocketSessionResponse struct {
+	Success bool                  `json:"success"`
+	Session *WebSocketSessionInfo `json:"session"`
+}
+
+// WebSocketSessionsResponse is returned when listing sessions
+type WebSocketSessionsResponse struct {
+	Success  bool                    `json:"success"`
+	Sessions []*WebSocketSessionInfo `json:"sessions"`
+}
+
+// WebSocketMessagesResponse is returned when polling a session's messages
+type WebSocketMessagesResponse struct {
+	Success  bool                `json:"success"`
+	State    string              `json:"state"`
+	Messages []*WebSocketMessage `json:"messages"`
+}
+
+// WebSocketSession is a connection to a target kept open between requests.
+// Messages in both directions are numbered and the latest ones are kept.
+type WebSocketSession struct {
+	mu          sync.Mutex
+	writeMu     sync.Mutex
+	conn        *websocket.Conn
+	info        WebSocketSessionInfo
+	seq         int64
+	messages    []*WebSocketMessage
+	subscribers map[chan *WebSocketMessage]struct{}
+	done        chan struct{}
+}
+
+// record numbers a message, keeps it and notifies subscribers
+func (ws *WebSocketSession) record(direction string, data []byte, binary bool) *WebSocketMessage {
+	message := &WebSocketMessage{
+		Direction: direction,
+		Size:      len(data),
+		Time:      time.Now().UTC(),
+	}
+	if binary || !utf8.Valid(data) {
+		message.Data = base64.StdEncoding.EncodeToString(data)
+		message.IsBinary = true
+	} else {
+		message.Data = string(data)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.seq++
+	message.Seq = ws.seq
+	if direction == "sent" {
+		ws.info.Sent++
+	} else {
+		ws.info.Received++
+	}
+	ws.messages = append(ws.messages, message)
+	if len(ws.messages) > MaxWebSocketMessages {
+		ws.messages = ws.messages[len(ws.messages)-MaxWebSocketMessages:]
+	}
+
+	// Slow subscribers miss messages rather than block the connection
+	for ch := range ws.subscribers {
+		select {
+		case ch <- message:
+		default:
+		}
+	}
+	return message
+}
+
+// readLoop records received messages until the connection closes
+func (ws *WebSocketSession) readLoop() {
+	defer close(ws.done)
+
+	for {
+		messageType, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			ws.mu.Lock()
+			closedAt := time.Now().UTC()
+			ws.info.State = "closed"
+			ws.info.ClosedAt = &closedAt
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				ws.info.CloseCode = closeErr.Code
+				ws.info.CloseReason = closeErr.Text
+			} else if err == websocket.ErrReadLimit {
+				// The proxy closed the connection with 1009 Message Too Big
+				ws.info.CloseCode = websocket.CloseMessageTooBig
+				ws.info.CloseReason = fmt.Sprintf("Received a message larger than %d bytes", MaxWebSocketMessageSize)
+			} else if ws.info.CloseReason == "" {
+				ws.info.CloseReason = err.Error()
+			}
+			ws.mu.Unlock()
+			ws.conn.Close()
+			return
+		}
+		ws.record("received", data, messageType == websocket.BinaryMessage)
+	}
+}
+
+// Send writes a message to the target
+func (ws *WebSocketSession) Send(data []byte, binary bool) (*WebSocketMessage, error) {
+	messageType := websocket.TextMessage
+	if binary {
+		messageType = websocket.BinaryMessage
+	}
+
+	ws.writeMu.Lock()
+	err := ws.conn.WriteMessage(messageType, data)
+	ws.writeMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return ws.record("sent", data, binary), nil
+}
+
+// Close sends a close frame and waits briefly for the target to answer it
+func (ws *WebSocketSession) Close() {
+	ws.writeMu.Lock()
+	ws.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+	ws.writeMu.Unlock()
+
+	select {
+	case <-ws.done:
+	case <-time.After(time.Second):
+		ws.conn.Close()
+		<-ws.done
+	}
+}
+
+// Info returns a copy of the session's description
+func (ws *WebSocketSession) Info() *WebSocketSessionInfo {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	info := ws.info
+	return &info
+}
+
+// Messages returns the kept messages numbered after seq
+func (ws *WebSocketSession) Messages(after int64) []*WebSocketMessage {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	messages := []*WebSocketMessage{}
+	for _, message := range ws.messages {
+		if message.Seq > after {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// Subscribe returns the kept messages numbered after seq, a channel receiving
+// new messages, and a function to stop the subscription
+func (ws *WebSocketSession) Subscribe(after int64) ([]*WebSocketMessage, <-chan *WebSocketMessage, func()) {
+	ch := make(chan *WebSocketMessage, 64)
+
+	ws.mu.Lock()
+	messages := []*WebSocketMessage{}
+	for _, message := range ws.messages {
+		if message.Seq > after {
+			messages = append(messages, message)
+		}
+	}
+	ws.subscribers[ch] = struct{}{}
+	ws.mu.Unlock()
+
+	return messages, ch, func() {
+		ws.mu.Lock()
+		delete(ws.subscribers, ch)
+		ws.mu.Unlock()
+	}
+}
+
+// WebSocketStore keeps the open WebSocket sessions
+type WebSocketStore struct {
+	mu       sync.Mutex
+	sessions map[string]*WebSocketSession
+}
+
+// NewWebSocketStore creates an empty session store
+func NewWebSocketStore() *WebSocketStore {
+	return &WebSocketStore{sessions: make(map[string]*WebSocketSession)}
+}
+
+// Open connects to a target and starts recording its messages
+func (s *WebSocketStore) Open(ctx context.Context, req *WebSocketOpenRequest) (*WebSocketSession, error) {
+	endpoint, err := subscriptionURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	id := req.Name
+	if id == "" {
+		id = newRequestID()
+	}
+
+	// Reserve the name before dialing so concurrent opens cannot both win
+	s.mu.Lock()
+	if _, exists := s.sessions[id]; exists {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("A session named %s already exists", id)
+	}
+	if len(s.sessions) >= MaxWebSocketSessions {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("Too many sessions; close one first (maximum %d)", MaxWebSocketSessions)
+	}
+	s.sessions[id] = nil
+	s.mu.Unlock()
+
+	header := http.Header{}
+	for _, field := range parseHeaderFields(req.Headers) {
+		header.Add(field.Name, field.Value)
+	}
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: webSocketHandshakeTimeout,
+		Subprotocols:     req.Subprotocols,
+	}
+	conn, resp, err := dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+		if resp != nil {
+			return nil, fmt.Errorf("WebSocket handshake failed: HTTP %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("Failed to connect: %v", err)
+	}
+	conn.SetReadLimit(MaxWebSocketMessageSize)
+
+	session := &WebSocketSession{
+		conn: conn,
+		info: WebSocketSessionInfo{
+			ID:          id,
+			URL:         endpoint,
+			Subprotocol: conn.Subprotocol(),
+			State:       "open",
+			OpenedAt:    time.Now().UTC(),
+		},
+		subscribers: make(map[chan *WebSocketMessage]struct{}),
+		done:        make(chan struct{}),
+	}
+	go session.readLoop()
+
+	s.mu.Lock()
+	s.sessions[id] = session
+	s.mu.Unlock()
+	return session, nil
+}
+
+// Get returns a session, or nil if there is none with that id
+func (s *WebSocketStore) Get(id string) *WebSocketSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sessions[id]
+}
+
+// List describes all sessions, oldest first
+func (s *WebSocketStore) List() []*WebSocketSessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []*WebSocketSessionInfo{}
+	for _, session := range s.sessions {
+		if session != nil {
+			sessions = append(sessions, session.Info())
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].OpenedAt.Before(sessions[j].OpenedAt)
+	})
+	return sessions
+}
+
+// Remove closes a session and forgets it
+func (s *WebSocketStore) Remove(id string) {
+	s.mu.Lock()
+	session := s.sessions[id]
+	if session != nil {
+		delete(s.sessions, id)
+	}
+	s.mu.Unlock()
+
+	if session != nil {
+		session.Close()
+	}
+}
+
+// webSocketSession returns the session named in the route, writing an error
+// response when there is none
+func (s *ProxyServer) webSocketSession(w http.ResponseWriter, r *http.Request) *WebSocketSession {
+	id := mux.Vars(r)["id"]
+	session := s.sockets.Get(id)
+	if session == nil {
+		w.Header().Set("Content-Type", "application/json")
+		s.writeErrorResponse(w, "not_found", "Session Not Found", fmt.Sprintf("No WebSocket session with id %s", id))
+	}
+	return session
+}
+
+// handleWebSocketSessions lists (GET) or opens (POST) WebSocket sessions
+func (s *ProxyServer) handleWebSocketSessions(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "GET" {
+		sessions := s.sockets.List()
+		s.cluster.gather(r, func(body io.Reader) error {
+			var peer WebSocketSessionsResponse
+			if err := json.NewDecoder(body).Decode(&peer); err != nil {
+				return err
+			}
+			sessions = append(sessions, peer.Sessions...)
+			return nil
+		})
+		sort.Slice(sessions, func(i, j int) bool { return sessions[i].OpenedAt.Before(sessions[j].OpenedAt) })
+
+		response := &WebSocketSessionsResponse{Success: true, Sessions: sessions}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			s.logger.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+
+	var req WebSocketOpenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	if req.URL == "" {
+		s.writeErrorResponse(w, "request_format_error", "Missing URL", "URL is required")
+		return
+	}
+	if err := checkTargetURL(r.Context(), req.URL); err != nil {
+		s.writeErrorResponse(w, HostNotAllowedError.Type, HostNotAllowedError.Title, err.Error())
+		return
+	}
+	if req.Name != "" && !hookBucketPattern.MatchString(req.Name) {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Name", "Session names may only contain letters, digits, '-' and '_'")
+		return
+	}
+
+	if req.Name != "" && s.sockets.Get(req.Name) != nil {
+		s.writeErrorResponse(w, "request_format_error", "Session Exists", fmt.Sprintf("A session named %s already exists", req.Name))
+		return
+	}
+	if req.Name != "" {
+		if err := s.cluster.ClaimSession(clusterSessionWebSocket, req.Name); err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Session Exists", err.Error())
+			return
+		}
+	}
+
+	s.logger.Printf("[%s] Opening WebSocket to %s", requestID(w), req.URL)
+
+	// The session outlives this request, so only the handshake uses its context
+	session, err := s.sockets.Open(r.Context(), &req)
+	if err != nil {
+		if req.Name != "" {
+			s.cluster.ReleaseSession(clusterSessionWebSocket, req.Name)
+		}
+		s.logger.Printf("[%s] WebSocket failed: %v", requestID(w), err)
+		s.writeErrorResponse(w, networkErrorType(err).Type, "WebSocket Failed", err.Error())
+		return
+	}
+	if req.Name == "" {
+		if err := s.cluster.ClaimSession(clusterSessionWebSocket, session.Info().ID); err != nil {
+			s.logger.Printf("[%s] Failed to record WebSocket session in the cluster: %v", requestID(w), err)
+		}
+	}
+
+	response := &WebSocketSessionResponse{Success: true, Session: session.Info()}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleWebSocketSession describes (GET) or closes (DELETE) a session
+func (s *ProxyServer) handleWebSocketSession(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	session := s.webSocketSession(w, r)
+	if session == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "DELETE" {
+		s.sockets.Remove(mux.Vars(r)["id"])
+		s.cluster.ReleaseSession(clusterSessionWebSocket, mux.Vars(r)["id"])
+		s.logger.Printf("[%s] Closed WebSocket session %s", requestID(w), mux.Vars(r)["id"])
+	}
+
+	response := &WebSocketSessionResponse{Success: true, Session: session.Info()}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleWebSocketSend sends a message on a session
+func (s *ProxyServer) handleWebSocketSend(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	session := s.webSocketSession(w, r)
+	if session == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var req WebSocketSendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid JSON", fmt.Sprintf("Failed to parse JSON request: %v", err))
+		return
+	}
+	data := []byte(req.Message)
+	if req.Binary {
+		decoded, err := base64.StdEncoding.DecodeString(req.Message)
+		if err != nil {
+			s.writeErrorResponse(w, "request_format_error", "Invalid Message", "Binary messages must be base64 encoded")
+			return
+		}
+		data = decoded
+	}
+
+	if session.Info().State != "open" {
+		s.writeErrorResponse(w, ConnectionError.Type, "Session Closed", "The WebSocket connection is closed")
+		return
+	}
+	message, err := session.Send(data, req.Binary)
+	if err != nil {
+		s.writeErrorResponse(w, ConnectionError.Type, "Send Failed", err.Error())
+		return
+	}
+
+	response := map[string]interface{}{"success": true, "message": message}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleWebSocketMessages returns the kept messages of a session, optionally
+// only those numbered after the "after" query parameter
+func (s *ProxyServer) handleWebSocketMessages(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	session := s.webSocketSession(w, r)
+	if session == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	response := &WebSocketMessagesResponse{
+		Success:  true,
+		State:    session.Info().State,
+		Messages: session.Messages(after),
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// handleWebSocketFeed streams a session's messages as Server-Sent Events.
+// Messages numbered after the "after" query parameter or the Last-Event-ID
+// header are replayed first.
+func (s *ProxyServer) handleWebSocketFeed(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	session := s.webSocketSession(w, r)
+	if session == nil {
+		return
+	}
+
+	after := int64(-1)
+	if value := r.URL.Query().Get("after"); value != "" {
+		after, _ = strconv.ParseInt(value, 10, 64)
+	} else if value := r.Header.Get("Last-Event-ID"); value != "" {
+		after, _ = strconv.ParseInt(value, 10, 64)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher, _ := w.(http.Flusher)
+
+	// Without a starting point, only new messages are streamed
+	replay, messages, unsubscribe := session.Subscribe(after)
+	defer unsubscribe()
+	if after < 0 {
+		replay = nil
+	}
+
+	write := func(message *WebSocketMessage) bool {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "event: message\nid: %d\ndata: %s\n\n", message.Seq, data); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	// Open the stream right away so EventSource reports it as connected
+	fmt.Fprint(w, ": connected\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for _, message := range replay {
+		if !write(message) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-session.done:
+			// Deliver what arrived before the close, then report it
+		drain:
+			for {
+				select {
+				case message := <-messages:
+					write(message)
+				default:
+					break drain
+				}
+			}
+			data, _ := json.Marshal(session.Info())
+			fmt.Fprintf(w, "event: closed\ndata: %s\n\n", data)
+			return
+		case message := <-messages:
+			if !write(message) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package slingshot
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxWorkflowSize is the largest workflow accepted by /workflows/run
+const MaxWorkflowSize = 1 << 20
+
+// Workflow is a multi-step scenario. Steps run in order and share variables
+// that fill in {{name}} placeholders.
+type Workflow struct {
+	Name  string                 `json:"name"`
+	Vars  map[string]interface{} `json:"vars,omitempty"`
+	Steps []*WorkflowStep        `json:"steps"`
+}
+
+// WorkflowStep runs a request, waits, or both. It can be skipped with if,
+// repeated with repeat and polled until a condition holds.
+type WorkflowStep struct {
+	Name              string                 `json:"name"`
+	Request           *ProxyRequest          `json:"request,omitempty"`
+	Extract           map[string]*Extraction `json:"extract,omitempty"`
+	If                *Condition             `json:"if,omitempty"`
+	Repeat            int                    `json:"repeat,omitempty"`
+	Until             *Condition             `json:"until,omitempty"`
+	Delay             string                 `json:"delay,omitempty"` // Waited before each run, e.g. 500ms or 2s
+	ContinueOnFailure bool                   `json:"continue_on_failure,omitempty"`
+
+	delay time.Duration
+}
+
+// Extraction copies a value of the response into a variable
+type Extraction struct {
+	Source   string `json:"source"`
+	Property string `json:"property,omitempty"`
+}
+
+// Condition compares a variable against a target
+type Condition struct {
+	Var        string `json:"var"`
+	Comparison string `json:"comparison"`
+	Target     string `json:"target,omitempty"`
+}
+
+// WorkflowStepResult is the outcome of one step
+type WorkflowStepResult struct {
+	Name      string            `json:"name"`
+	Passed    bool              `json:"passed"`
+	Skipped   bool              `json:"skipped,omitempty"`
+	Runs      []*RunResult      `json:"runs,omitempty"`
+	Extracted map[string]string `json:"extracted,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// WorkflowResult is returned by /workflows/run and `proxy workflow`
+type WorkflowResult struct {
+	Success  bool                  `json:"success"`
+	Workflow string                `json:"workflow"`
+	Passed   bool                  `json:"passed"`
+	Duration float64               `json:"duration_ms"`
+	Steps    []*WorkflowStepResult `json:"steps"`
+	Vars     map[string]string     `json:"vars,omitempty"`
+}
+
+// parseWorkflow parses a YAML (or JSON) workflow. The document is converted
+// to JSON first so the request fields keep the names of /proxy/request.
+func parseWorkflow(data []byte) (*Workflow, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("Invalid workflow: %v", err)
+	}
+	converted, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid workflow: %v", err)
+	}
+
+	var workflow Workflow
+	if err := json.Unmarshal(converted, &workflow); err != nil {
+		return nil, fmt.Errorf("Invalid workflow: %v", err)
+	}
+	if err := validateWorkflow(&workflow); err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// validateWorkflow checks the steps of a workflow
+func validateWorkflow(workflow *Workflow) error {
+	if len(workflow.Steps) == 0 {
+		return fmt.Errorf("Workflow has no steps")
+	}
+
+	for i, step := range workflow.Steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("Step %d", i+1)
+		}
+		if step.Request == nil && step.Delay == "" {
+			return fmt.Errorf("%s: needs a request or a delay", step.Name)
+		}
+		if step.Request != nil && (step.Request.Method == "" || step.Request.URL == "") {
+			return fmt.Errorf("%s: request needs a method and url", step.Name)
+		}
+		if step.Repeat < 0 || step.Repeat > maxRunnerLoops {
+			return fmt.Errorf("%s: repeat must be at most %d", step.Name, maxRunnerLoops)
+		}
+		if step.Delay != "" {
+			delay, err := time.ParseDuration(step.Delay)
+			if err != nil || delay < 0 {
+				return fmt.Errorf("%s: invalid delay %q", step.Name, step.Delay)
+			}
+			step.delay = delay
+		}
+		for name, extraction := range step.Extract {
+			if extraction == nil {
+				return fmt.Errorf("%s: extraction of %s needs a source", step.Name, name)
+			}
+			if err := validateSource(extraction.Source, extraction.Property); err != nil {
+				return fmt.Errorf("%s: extraction of %s: %v", step.Name, name, err)
+			}
+		}
+		for _, condition := range []*Condition{step.If, step.Until} {
+			if condition == nil {
+				continue
+			}
+			if condition.Var == "" {
+				return fmt.Errorf("%s: condition needs a var", step.Name)
+			}
+			// Targets with placeholders are checked once filled in
+			if !strings.Contains(condition.Target, "{{") {
+				if err := validateComparison(condition.Comparison, condition.Target); err != nil {
+					return fmt.Errorf("%s: %v", step.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts numeric and boolean targets as well as strings
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	type plain Condition
+	var raw struct {
+		plain
+		Target json.RawMessage `json:"target,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*c = Condition(raw.plain)
+	c.Target = scalarString(raw.Target)
+	return nil
+}
+
+// evaluate checks the condition against the current variables
+func (c *Condition) evaluate(vars map[string]string) (bool, error) {
+	target := expandVariables(c.Target, vars)
+	if err := validateComparison(c.Comparison, target); err != nil {
+		return false, err
+	}
+	value, found := vars[c.Var]
+	passed, _ := compare(Assertion{Comparison: c.Comparison, Target: target}, value, found)
+	return passed, nil
+}
+
+// String describes the condition, e.g. "status equals 200"
+func (c *Condition) String() string {
+	return strings.TrimSpace(c.Var + " " + c.Comparison + " " + c.Target)
+}
+
+// sleep waits for d unless ctx ends first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runWorkflow runs the steps of a workflow in order until one fails
+func runWorkflow(ctx context.Context, client *HTTPClient, workflow *Workflow, overrides map[string]string, out io.Writer) *WorkflowResult {
+	start := time.Now()
+	result := &WorkflowResult{
+		Success:  true,
+		Workflow: workflow.Name,
+		Passed:   true,
+		Steps:    []*WorkflowStepResult{},
+		Vars:     map[string]string{},
+	}
+	for key, value := range workflow.Vars {
+		result.Vars[key] = variableString(value)
+	}
+	for key, value := range overrides {
+		result.Vars[key] = value
+	}
+
+	for _, step := range workflow.Steps {
+		stepResult := runWorkflowStep(ctx, client, step, result.Vars, out)
+		result.Steps = append(result.Steps, stepResult)
+		if !stepResult.Passed {
+			result.Passed = false
+			if !step.ContinueOnFailure {
+				break
+			}
+		}
+	}
+
+	result.Duration = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+// runWorkflowStep runs one step, updating vars with the values it extracts
+func runWorkflowStep(ctx context.Context, client *HTTPClient, step *WorkflowStep, vars map[string]string, out io.Writer) *WorkflowStepResult {
+	result := &WorkflowStepResult{Name: step.Name}
+
+	if step.If != nil {
+		ok, err := step.If.evaluate(vars)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if !ok {
+			fmt.Fprintf(out, "SKIP  %s (%s is false)\n", step.Name, step.If)
+			result.Skipped = true
+			result.Passed = true
+			return result
+		}
+	}
+
+	repeat := step.Repeat
+	if repeat == 0 {
+		repeat = 1
+	}
+
+	result.Passed = true
+	for iteration := 1; iteration <= repeat; iteration++ {
+		vars["iteration"] = strconv.Itoa(iteration)
+
+		if step.delay > 0 {
+			fmt.Fprintf(out, "WAIT  %s %s\n", step.Name, step.delay)
+			if err := sleep(ctx, step.delay); err != nil {
+				result.Passed = false
+				result.Error = "Workflow cancelled"
+				return result
+			}
+		}
+
+		if step.Request != nil {
+			run, response := runStep(ctx, client, &runnerStep{Name: step.Name, Request: step.Request}, vars)
+			if repeat > 1 {
+				run.Iteration = iteration
+			}
+			result.Runs = append(result.Runs, run)
+			printResult(out, run)
+
+			for key, value := range response.ScriptEnv {
+				vars[key] = value
+			}
+			if response.Success {
+				for name, extraction := range step.Extract {
+					value, found := assertionValue(Assertion{Source: extraction.Source, Property: extraction.Property}, response, run.ResponseTime)
+					if !found {
+						continue
+					}
+					if result.Extracted == nil {
+						result.Extracted = make(map[string]string)
+					}
+					result.Extracted[name] = value
+					vars[name] = value
+				}
+			}
+
+			// When polling, only the last run has to pass
+			if step.Until == nil {
+				result.Passed = result.Passed && run.Passed
+			} else {
+				result.Passed = run.Passed
+			}
+		}
+
+		if step.Until != nil {
+			done, err := step.Until.evaluate(vars)
+			if err != nil {
+				result.Passed = false
+				result.Error = err.Error()
+				return result
+			}
+			if done {
+				return result
+			}
+			if iteration == repeat {
+				result.Passed = false
+				result.Error = fmt.Sprintf("%s was still false after %d runs", step.Until, repeat)
+				fmt.Fprintf(out, "FAIL  %s: %s\n", step.Name, result.Error)
+			}
+		}
+	}
+	return result
+}
+
+// handleRunWorkflow runs the YAML or JSON workflow in the request body
+func (s *ProxyServer) handleRunWorkflow(w http.ResponseWriter, r *http.Request) {
+	// Handle OPTIONS for CORS preflight
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxWorkflowSize+1))
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Workflow", fmt.Sprintf("Failed to read workflow: %v", err))
+		return
+	}
+	if len(data) > MaxWorkflowSize {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Workflow", "Workflow is too large")
+		return
+	}
+
+	workflow, err := parseWorkflow(data)
+	if err != nil {
+		s.writeErrorResponse(w, "request_format_error", "Invalid Workflow", err.Error())
+		return
+	}
+
+	s.logger.Printf("[%s] Running workflow %s (%d steps)", requestID(w), workflow.Name, len(workflow.Steps))
+
+	result := runWorkflow(r.Context(), s.httpClient, workflow, nil, io.Discard)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		s.logger.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// WorkflowCommand implements `proxy workflow <file>`. It returns the exit
+// code: 0 when the workflow passed, 1 when it failed and 2 on usage errors.
+func WorkflowCommand(args []string) int {
+	fs := flag.NewFlagSet("workflow", flag.ContinueOnError)
+	var (
+		jsonPath   = fs.String("json", "", "Write the JSON result to this file")
+		dataPath   = fs.String("data", "", "CSV or JSON dataset; the workflow runs once per row")
+		uploadDirs = fs.String("upload-dirs", "", "Comma-separated directories files may be uploaded from")
+		scriptDirs = fs.String("script-dirs", "", "Comma-separated directories scripts may be loaded from")
+		protoDirs  = fs.String("proto-dirs", "", "Comma-separated directories of .proto files for protobuf bodies")
+		envVars    stringList
+	)
+	fs.Var(&envVars, "env-var", "Set a variable as key=value, overriding the workflow's vars (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s workflow [options] <workflow.yaml>\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	overrides := map[string]string{}
+	for _, envVar := range envVars {
+		key, value, ok := strings.Cut(envVar, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Invalid -env-var %q, expected key=value\n", envVar)
+			return 2
+		}
+		overrides[key] = value
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read workflow: %v\n", err)
+		return 2
+	}
+	workflow, err := parseWorkflow(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	client := NewHTTPClient(&Config{
+		UploadDirs: SplitList(*uploadDirs),
+		ScriptDirs: SplitList(*scriptDirs),
+		ProtoDirs:  SplitList(*protoDirs),
+	})
+
+	if *dataPath != "" {
+		rows, err := loadDataset(*dataPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+
+		fmt.Printf("Running workflow %s (%d steps, %d rows)\n\n", workflow.Name, len(workflow.Steps), len(rows))
+		result := runWorkflowDataset(context.Background(), client, workflow, rows, overrides, os.Stdout)
+		fmt.Printf("\n%d of %d rows passed, %.0f ms\n", result.Passed, result.Rows, result.Duration)
+
+		if err := writeWorkflowResult(*jsonPath, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write JSON result: %v\n", err)
+			return 2
+		}
+		if result.Failed > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Printf("Running workflow %s (%d steps)\n\n", workflow.Name, len(workflow.Steps))
+	result := runWorkflow(context.Background(), client, workflow, overrides, os.Stdout)
+
+	passed := 0
+	for _, step := range result.Steps {
+		if step.Passed {
+			passed++
+		}
+	}
+	fmt.Printf("\n%d of %d steps passed, %.0f ms\n", passed, len(workflow.Steps), result.Duration)
+
+	if err := writeWorkflowResult(*jsonPath, result); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write JSON result: %v\n", err)
+		return 2
+	}
+
+	if !result.Passed {
+		return 1
+	}
+	return 0
+}
+
+// writeWorkflowResult writes the JSON result of `proxy workflow` to path,
+// unless path is empty
+func writeWorkflowResult(path string, result interface{}) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,362 @@
+// Package slingshotclient calls a running Slingshot proxy's API from Go, for
+// test suites and scripts that send their requests through a shared proxy.
+//
+//	client := slingshotclient.New("http://localhost:8080")
+//	response, err := client.Request(ctx, &slingshot.ProxyRequest{
+//		Method: "GET",
+//		URL:    "https://api.example.com/health",
+//	})
+//
+// Requests and results use the types of the slingshot package, so they match
+// the JSON the endpoints take and return.
+package slingshotclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/requestbite/proxy-go/slingshot"
+)
+
+// DefaultBatchConcurrency is how many requests of a batch run at once unless
+// told otherwise
+const DefaultBatchConcurrency = 8
+
+// Error is an error response from the proxy, or a request the proxy could
+// not complete. Type is one of the error types in the proxy's README.
+type Error struct {
+	RequestID string
+	Type      string
+	Title     string
+	Message   string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %s", e.Type, e.Title)
+	}
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// errorResponse holds the error fields every endpoint may answer with
+type errorResponse struct {
+	RequestID    string `json:"request_id"`
+	ErrorType    string `json:"error_type"`
+	ErrorTitle   string `json:"error_title"`
+	ErrorMessage string `json:"error_message"`
+}
+
+func (r *errorResponse) err() error {
+	if r.ErrorType == "" {
+		return nil
+	}
+	return &Error{RequestID: r.RequestID, Type: r.ErrorType, Title: r.ErrorTitle, Message: r.ErrorMessage}
+}
+
+// Client calls the API of the proxy at BaseURL. Its fields may be changed
+// before first use.
+type Client struct {
+	BaseURL    string
+	APIKey     string       // Sent as X-Slingshot-Key when the proxy requires API keys
+	HTTPClient *http.Client // Defaults to http.DefaultClient
+}
+
+// New creates a client for the proxy at baseURL, e.g. http://localhost:8080
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// do calls an endpoint and decodes its JSON answer into out, returning an
+// *Error when the proxy answered with one
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.APIKey != "" {
+		req.Header.Set(slingshot.APIKeyHeader, c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Failed to read response from %s: %v", path, err)
+	}
+
+	var failure errorResponse
+	if err := json.Unmarshal(data, &failure); err != nil {
+		return fmt.Errorf("Unexpected response from %s (%s): %v", path, resp.Status, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("Unexpected response from %s (%s): %v", path, resp.Status, err)
+	}
+	return failure.err()
+}
+
+// postJSON calls an endpoint with a JSON body
+func (c *Client) postJSON(ctx context.Context, path string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "POST", path, "application/json", bytes.NewReader(data), out)
+}
+
+// Request executes a request through /proxy/request. When the proxy could
+// not complete it, the response describing the failure is returned along
+// with an *Error.
+func (c *Client) Request(ctx context.Context, req *slingshot.ProxyRequest) (*slingshot.ProxyResponse, error) {
+	response := &slingshot.ProxyResponse{}
+	if err := c.postJSON(ctx, "/proxy/request", req, response); err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+// BatchResult is the outcome of one request of a batch
+type BatchResult struct {
+	Response *slingshot.ProxyResponse
+	Err      error
+}
+
+// Batch executes requests through /proxy/request, concurrency at a time (0
+// for DefaultBatchConcurrency), and returns their results in order
+func (c *Client) Batch(ctx context.Context, reqs []*slingshot.ProxyRequest, concurrency int) []BatchResult {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	results := make([]BatchResult, len(reqs))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			response, err := c.Request(ctx, req)
+			results[i] = BatchResult{Response: response, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Validate checks a request through /proxy/validate without sending it
+func (c *Client) Validate(ctx context.Context, req *slingshot.ProxyRequest) (*slingshot.LintResponse, error) {
+	response := &slingshot.LintResponse{}
+	if err := c.postJSON(ctx, "/proxy/validate", req, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// RunWorkflow runs a YAML or JSON workflow through /workflows/run
+func (c *Client) RunWorkflow(ctx context.Context, workflow []byte) (*slingshot.WorkflowResult, error) {
+	result := &slingshot.WorkflowResult{}
+	if err := c.do(ctx, "POST", "/workflows/run", "application/yaml", bytes.NewReader(workflow), result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RunDataset runs a request once per row of a CSV or JSON dataset through
+// /proxy/data. The file name tells the dataset's format.
+func (c *Client) RunDataset(ctx context.Context, req *slingshot.ProxyRequest, name string, data []byte) (*slingshot.DataRunResult, error) {
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("request", string(request)); err != nil {
+		return nil, err
+	}
+	file, err := form.CreateFormFile("data", filepath.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(data); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	result := &slingshot.DataRunResult{}
+	if err := c.do(ctx, "POST", "/proxy/data", form.FormDataContentType(), &body, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// History returns up to limit of the most recent requests, newest first
+// (0 for the proxy's default)
+func (c *Client) History(ctx context.Context, limit int) ([]*slingshot.HistoryEntry, error) {
+	path := "/proxy/history"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	response := &slingshot.HistoryResponse{}
+	if err := c.do(ctx, "GET", path, "", nil, response); err != nil {
+		return nil, err
+	}
+	return response.Entries, nil
+}
+
+// HistoryQuery filters, sorts and pages QueryHistory. Lists match any of
+// their items; zero values don't filter.
+type HistoryQuery struct {
+	Hosts      []string // Host patterns, e.g. *.example.com
+	Methods    []string
+	Statuses   []string // Statuses, classes or ranges, e.g. 404, 5xx or 400-403
+	ErrorTypes []string
+	Sources    []string // slingshot.HistorySourceProxy, HistorySourceSchedule or HistorySourceMonitor
+	Success    *bool
+	From, To   time.Time
+	Text       string // Text the URL contains, case-insensitively
+	Sort       string // slingshot.HistorySortTime (default), HistorySortStatus, ...
+	Ascending  bool
+	Limit      int
+	Offset     int
+}
+
+// QueryHistory returns a page of the history entries matching query, with
+// the number of matches and the offset of the next page
+func (c *Client) QueryHistory(ctx context.Context, query HistoryQuery) (*slingshot.HistoryResponse, error) {
+	values := url.Values{}
+	for name, list := range map[string][]string{"host": query.Hosts, "method": query.Methods, "status": query.Statuses, "errorType": query.ErrorTypes, "source": query.Sources} {
+		if len(list) > 0 {
+			values.Set(name, strings.Join(list, ","))
+		}
+	}
+	if query.Success != nil {
+		values.Set("success", strconv.FormatBool(*query.Success))
+	}
+	if !query.From.IsZero() {
+		values.Set("from", query.From.Format(time.RFC3339))
+	}
+	if !query.To.IsZero() {
+		values.Set("to", query.To.Format(time.RFC3339))
+	}
+	if query.Text != "" {
+		values.Set("q", query.Text)
+	}
+	if query.Sort != "" {
+		values.Set("sort", query.Sort)
+	}
+	if query.Ascending {
+		values.Set("order", "asc")
+	}
+	if query.Limit > 0 {
+		values.Set("limit", strconv.Itoa(query.Limit))
+	}
+	if query.Offset > 0 {
+		values.Set("offset", strconv.Itoa(query.Offset))
+	}
+
+	response := &slingshot.HistoryResponse{}
+	if err := c.do(ctx, "GET", "/proxy/history?"+values.Encode(), "", nil, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// PageOptions selects a page of a history entry's body. Zero values use the
+// proxy's defaults: bytes from the start.
+type PageOptions struct {
+	Unit   string // "bytes" or "lines"
+	Offset int64
+	Limit  int64
+}
+
+// HistoryBody reads a page of the response body of a history entry
+func (c *Client) HistoryBody(ctx context.Context, id string, options PageOptions) (*slingshot.BodyPageResponse, error) {
+	query := url.Values{}
+	if options.Unit != "" {
+		query.Set("unit", options.Unit)
+	}
+	if options.Offset > 0 {
+		query.Set("offset", strconv.FormatInt(options.Offset, 10))
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.FormatInt(options.Limit, 10))
+	}
+
+	page := &slingshot.BodyPageResponse{}
+	if err := c.do(ctx, "GET", "/proxy/history/"+url.PathEscape(id)+"/body?"+query.Encode(), "", nil, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// SearchOptions changes how SearchHistory matches
+type SearchOptions struct {
+	Regex      bool
+	IgnoreCase bool
+	Limit      int
+}
+
+// SearchHistory searches the response body of a history entry
+func (c *Client) SearchHistory(ctx context.Context, id, q string, options SearchOptions) (*slingshot.BodySearchResponse, error) {
+	query := url.Values{"q": {q}}
+	if options.Regex {
+		query.Set("regex", "true")
+	}
+	if options.IgnoreCase {
+		query.Set("ignoreCase", "true")
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+
+	response := &slingshot.BodySearchResponse{}
+	if err := c.do(ctx, "GET", "/proxy/history/"+url.PathEscape(id)+"/search?"+query.Encode(), "", nil, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Ready runs the proxy's readiness checks. A proxy that is not ready answers
+// with the failed checks and no error.
+func (c *Client) Ready(ctx context.Context) (*slingshot.HealthResponse, error) {
+	response := &slingshot.HealthResponse{}
+	if err := c.do(ctx, "GET", "/health/ready", "", nil, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Version returns the proxy's build metadata
+func (c *Client) Version(ctx context.Context) (*slingshot.BuildInfo, error) {
+	build := &slingshot.BuildInfo{}
+	if err := c.do(ctx, "GET", "/version", "", nil, build); err != nil {
+		return nil, err
+	}
+	return build, nil
+}